@@ -1,11 +1,14 @@
 package ast
 
 import (
+	"strings"
+
 	"github.com/afoley/salami-lang/tok"
 )
 
 type Node interface {
 	Literal() string
+	Pos() tok.Position
 }
 
 type Statement interface {
@@ -20,6 +23,12 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []tok.Comment // in source order; set by the parser
+
+	// Set by the resolver: the name of each global slot, and whether the
+	// identifiers in the tree have been annotated yet.
+	Globals  []string
+	Resolved bool
 }
 
 func (p *Program) Literal() string {
@@ -29,30 +38,168 @@ func (p *Program) Literal() string {
 	return ""
 }
 
+func (p *Program) Pos() tok.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return tok.Position{}
+}
+
 type VarStatement struct {
 	Token tok.Tok
 	Name  *Identifier
+	Type  *TypeAnnotation // optional
 	Value Expression
 }
 
-func (vs *VarStatement) statementNode()  {}
-func (vs *VarStatement) Literal() string { return vs.Token.Literal }
+func (vs *VarStatement) statementNode()    {}
+func (vs *VarStatement) Literal() string   { return vs.Token.Literal }
+func (vs *VarStatement) Pos() tok.Position { return vs.Token.Pos }
 
 type Identifier struct {
 	Token tok.Tok // the token.IDENT token
 	Value string
+	Type  *TypeAnnotation // optional, only on parameters
+
+	// Pattern is set on the name the parser makes up for a destructured var
+	// or parameter. Its Value is the pattern's source, such as "[a, b]",
+	// which no program can use as a name, and its slot holds the whole
+	// value before the pattern takes it apart.
+	Pattern Pattern
+
+	// Default is the value of a parameter the call leaves out, evaluated
+	// in the function's scope each time it is needed. Variadic marks the
+	// last parameter as ...name, which collects the arguments left over in
+	// an array. Both only appear on parameters.
+	Default  Expression
+	Variadic bool
+
+	// Set by the resolver: the binding lives Depth function scopes out from
+	// the use, in slot Index. Unresolved names have Resolved == false.
+	Depth    int
+	Index    int
+	Resolved bool
 }
 
-func (i *Identifier) expressionNode() {}
-func (i *Identifier) Literal() string { return i.Token.Literal }
+func (i *Identifier) expressionNode()   {}
+func (i *Identifier) patternNode()      {}
+func (i *Identifier) Literal() string   { return i.Token.Literal }
+func (i *Identifier) Pos() tok.Position { return i.Token.Pos }
+
+// Pattern is what a var or parameter binds: a name, or an array or hash
+// pattern that takes a value apart into several names.
+type Pattern interface {
+	Node
+	patternNode()
+	String() string
+}
+
+// String returns the name, so an Identifier prints like any other pattern.
+func (i *Identifier) String() string { return i.Value }
+
+// ArrayPattern is [a, b, ...rest]. It takes an array with exactly as many
+// elements as it lists or, with a rest element, at least as many; rest gets
+// the others as a new array. An element can be a pattern of its own, or _
+// to skip it.
+type ArrayPattern struct {
+	Token    tok.Tok // The '[' token
+	Elements []Pattern
+	Rest     *Identifier  // nil without a ...rest
+	End      tok.Position // The closing ']'
+}
+
+func (ap *ArrayPattern) patternNode()      {}
+func (ap *ArrayPattern) expressionNode()   {}
+func (ap *ArrayPattern) Literal() string   { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() tok.Position { return ap.Token.Pos }
+
+func (ap *ArrayPattern) String() string {
+	parts := make([]string, len(ap.Elements))
+	for idx, e := range ap.Elements {
+		parts[idx] = e.String()
+	}
+	if ap.Rest != nil {
+		parts = append(parts, "..."+ap.Rest.Value)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// HashPattern is {a, b, ...rest}. Each name takes the value of the string
+// key spelled the same, which the hash must have; rest gets the other pairs
+// as a new hash.
+type HashPattern struct {
+	Token tok.Tok // The '{' token
+	Keys  []*Identifier
+	Rest  *Identifier  // nil without a ...rest
+	End   tok.Position // The closing '}'
+}
+
+func (hp *HashPattern) patternNode()      {}
+func (hp *HashPattern) expressionNode()   {}
+func (hp *HashPattern) Literal() string   { return hp.Token.Literal }
+func (hp *HashPattern) Pos() tok.Position { return hp.Token.Pos }
+
+func (hp *HashPattern) String() string {
+	parts := make([]string, len(hp.Keys))
+	for idx, k := range hp.Keys {
+		parts[idx] = k.Value
+	}
+	if hp.Rest != nil {
+		parts = append(parts, "..."+hp.Rest.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// PatternNames returns the names p binds, in source order, leaving out _.
+// For a made up name it returns those of its pattern.
+func PatternNames(p Pattern) []*Identifier {
+	var names []*Identifier
+	var collect func(Pattern)
+	collect = func(p Pattern) {
+		switch p := p.(type) {
+		case *Identifier:
+			if p.Pattern != nil {
+				collect(p.Pattern)
+			} else if p.Value != "_" {
+				names = append(names, p)
+			}
+		case *ArrayPattern:
+			for _, e := range p.Elements {
+				collect(e)
+			}
+			if p.Rest != nil {
+				collect(p.Rest)
+			}
+		case *HashPattern:
+			for _, k := range p.Keys {
+				collect(k)
+			}
+			if p.Rest != nil {
+				collect(p.Rest)
+			}
+		}
+	}
+	collect(p)
+	return names
+}
 
 type IntegerLiteral struct {
 	Token tok.Tok // The token.INT token
 	Value int64   // The actual value of the integer
 }
 
-func (il *IntegerLiteral) expressionNode() {}
-func (il *IntegerLiteral) Literal() string { return il.Token.Literal }
+func (il *IntegerLiteral) expressionNode()   {}
+func (il *IntegerLiteral) Literal() string   { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() tok.Position { return il.Token.Pos }
+
+type StringLiteral struct {
+	Token tok.Tok // The token.STRING token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()   {}
+func (sl *StringLiteral) Literal() string   { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() tok.Position { return sl.Token.Pos }
 
 type InfixExpression struct {
 	Token    tok.Tok // The operator token, e.g. +
@@ -61,9 +208,14 @@ type InfixExpression struct {
 	Right    Expression
 }
 
-func (ie *InfixExpression) expressionNode() {}
-func (ie *InfixExpression) Literal() string { return ie.Token.Literal }
+func (ie *InfixExpression) expressionNode()   {}
+func (ie *InfixExpression) Literal() string   { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() tok.Position { return ie.Token.Pos }
 
+// IfExpression is an if statement or, anywhere an expression can go, an
+// if whose value is that of the last statement of the branch it runs. In
+// an else if chain, each Alternative is a block whose token is the next
+// 'if' and whose only statement is that if.
 type IfExpression struct {
 	Token       tok.Tok // The 'if' token
 	Condition   Expression
@@ -71,66 +223,445 @@ type IfExpression struct {
 	Alternative *BlockStatement
 }
 
-func (ie *IfExpression) expressionNode() {}
-func (ie *IfExpression) statementNode()  {}
-func (ie *IfExpression) Literal() string { return ie.Token.Literal }
+func (ie *IfExpression) expressionNode()   {}
+func (ie *IfExpression) statementNode()    {}
+func (ie *IfExpression) Literal() string   { return ie.Token.Literal }
+func (ie *IfExpression) Pos() tok.Position { return ie.Token.Pos }
+
+// ElseIf returns the if that follows else in an else if, or nil.
+func (ie *IfExpression) ElseIf() *IfExpression {
+	alt := ie.Alternative
+	if alt == nil || alt.Token.Type != tok.IF || len(alt.Statements) != 1 {
+		return nil
+	}
+	next, _ := alt.Statements[0].(*IfExpression)
+	return next
+}
 
 type BlockStatement struct {
 	Token      tok.Tok // The '{' token
 	Statements []Statement
+	End        tok.Position // The closing '}'
+}
+
+func (bs *BlockStatement) statementNode()    {}
+func (bs *BlockStatement) Literal() string   { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() tok.Position { return bs.Token.Pos }
+
+// ArrayLiteral is [a, b, c].
+type ArrayLiteral struct {
+	Token    tok.Tok // The '[' token
+	Elements []Expression
+	End      tok.Position // The closing ']'
+}
+
+func (al *ArrayLiteral) expressionNode()   {}
+func (al *ArrayLiteral) Literal() string   { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() tok.Position { return al.Token.Pos }
+
+// HashLiteral is {k1: v1, k2: v2}. Keys are expressions; Keys[i] goes with
+// Values[i].
+type HashLiteral struct {
+	Token  tok.Tok // The '{' token
+	Keys   []Expression
+	Values []Expression
+	End    tok.Position // The closing '}'
+}
+
+func (hl *HashLiteral) expressionNode()   {}
+func (hl *HashLiteral) Literal() string   { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() tok.Position { return hl.Token.Pos }
+
+// IndexExpression is an element of an array or the value of a key in a
+// hash, left[index].
+type IndexExpression struct {
+	Token tok.Tok // The '[' token
+	Left  Expression
+	Index Expression
+	End   tok.Position // The closing ']'
 }
 
-func (bs *BlockStatement) statementNode()  {}
-func (bs *BlockStatement) Literal() string { return bs.Token.Literal }
+func (ie *IndexExpression) expressionNode()   {}
+func (ie *IndexExpression) Literal() string   { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() tok.Position { return ie.Token.Pos }
 
 type BooleanLiteral struct {
 	Token tok.Tok
 	Value bool
 }
 
-func (bl *BooleanLiteral) expressionNode() {}
-func (bl *BooleanLiteral) Literal() string { return bl.Token.Literal }
+func (bl *BooleanLiteral) expressionNode()   {}
+func (bl *BooleanLiteral) Literal() string   { return bl.Token.Literal }
+func (bl *BooleanLiteral) Pos() tok.Position { return bl.Token.Pos }
+
+// NullLiteral is the null keyword.
+type NullLiteral struct {
+	Token tok.Tok // The 'null' token
+}
+
+func (nl *NullLiteral) expressionNode()   {}
+func (nl *NullLiteral) Literal() string   { return nl.Token.Literal }
+func (nl *NullLiteral) Pos() tok.Position { return nl.Token.Pos }
+
+// MatchExpression is match (value) { arms }. Its value is that of the
+// first arm whose patterns match and whose guard holds.
+type MatchExpression struct {
+	Token tok.Tok // The 'match' token
+	Value Expression
+	Arms  []*MatchArm
+	End   tok.Position // The closing '}'
+}
+
+func (me *MatchExpression) expressionNode()   {}
+func (me *MatchExpression) Literal() string   { return me.Token.Literal }
+func (me *MatchExpression) Pos() tok.Position { return me.Token.Pos }
+
+// MatchArm is one arm of a match, p1, p2 if guard => body. A pattern is a
+// literal, which matches an equal value, _, which matches anything, or a
+// name, which matches anything and is bound to it. The body is either an
+// expression, Value, or a block, Body, worth its last statement.
+type MatchArm struct {
+	Patterns []Expression
+	Guard    Expression // nil without an if
+	Value    Expression
+	Body     *BlockStatement
+}
+
+func (ma *MatchArm) Literal() string   { return "=>" }
+func (ma *MatchArm) Pos() tok.Position { return ma.Patterns[0].Pos() }
+
+// IsWildcard reports whether pattern is _, the pattern that matches
+// anything without binding it.
+func IsWildcard(pattern Expression) bool {
+	ident, ok := pattern.(*Identifier)
+	return ok && ident.Value == "_"
+}
+
+// Binding returns the name pattern binds, or nil if it is a literal or _.
+func Binding(pattern Expression) *Identifier {
+	ident, ok := pattern.(*Identifier)
+	if !ok || ident.Value == "_" {
+		return nil
+	}
+	return ident
+}
+
+// Bindings returns every name pattern binds, in source order: the pattern
+// itself if it is a name, or the names inside a variant, array or hash
+// pattern.
+func Bindings(pattern Expression) []*Identifier {
+	if name := Binding(pattern); name != nil {
+		return []*Identifier{name}
+	}
+	var names []*Identifier
+	switch p := pattern.(type) {
+	case *VariantPattern:
+		for _, p := range p.Patterns {
+			names = append(names, Bindings(p)...)
+		}
+	case *ArrayPattern, *HashPattern:
+		names = PatternNames(p.(Pattern))
+	}
+	return names
+}
+
+// VariantPattern is Result.Ok(v), a match pattern that takes a value of
+// the variant Type names and matches each of the values it carries
+// against one of Patterns.
+type VariantPattern struct {
+	Token    tok.Tok // The '(' token
+	Type     Expression
+	Patterns []Expression
+	End      tok.Position // The closing ')'
+}
+
+func (vp *VariantPattern) expressionNode()   {}
+func (vp *VariantPattern) Literal() string   { return vp.Token.Literal }
+func (vp *VariantPattern) Pos() tok.Position { return vp.Token.Pos }
 
 type ExitStatement struct {
 	Token tok.Tok // The 'exit' token
 	Value Expression
 }
 
-func (es *ExitStatement) statementNode()  {}
-func (es *ExitStatement) Literal() string { return es.Token.Literal }
+func (es *ExitStatement) statementNode()    {}
+func (es *ExitStatement) Literal() string   { return es.Token.Literal }
+func (es *ExitStatement) Pos() tok.Position { return es.Token.Pos }
+
+// TryStatement is try { body } catch (name) { handler } finally { cleanup }.
+// Either the catch or the finally can be left out, but not both.
+type TryStatement struct {
+	Token   tok.Tok // The 'try' token
+	Body    *BlockStatement
+	Param   *Identifier     // the name a caught error is bound to; nil without a catch
+	Catch   *BlockStatement // nil without a catch
+	Finally *BlockStatement // nil without a finally
+}
+
+func (ts *TryStatement) statementNode()    {}
+func (ts *TryStatement) Literal() string   { return ts.Token.Literal }
+func (ts *TryStatement) Pos() tok.Position { return ts.Token.Pos }
+
+// ThrowStatement is throw value;, which raises value as an error.
+type ThrowStatement struct {
+	Token tok.Tok // The 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()    {}
+func (ts *ThrowStatement) Literal() string   { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() tok.Position { return ts.Token.Pos }
+
+// ForStatement is for (name in iterable) { body }. It runs body once for
+// each value of iterable, an array, a hash's keys or a generator, with
+// name bound to it. Like a var, Name can carry a pattern to destructure
+// each value with.
+type ForStatement struct {
+	Token    tok.Tok // The 'for' token
+	Name     *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()    {}
+func (fs *ForStatement) Literal() string   { return fs.Token.Literal }
+func (fs *ForStatement) Pos() tok.Position { return fs.Token.Pos }
+
+// YieldStatement is yield value;. A function with one in its body is a
+// generator: calling it runs none of the body, and each next() on the
+// generator it returns runs the body up to its next yield.
+type YieldStatement struct {
+	Token tok.Tok // The 'yield' token
+	Value Expression
+}
+
+func (ys *YieldStatement) statementNode()    {}
+func (ys *YieldStatement) Literal() string   { return ys.Token.Literal }
+func (ys *YieldStatement) Pos() tok.Position { return ys.Token.Pos }
 
 type FunctionLiteral struct {
 	Token      tok.Tok // The 'gorlami' token
 	Parameters []*Identifier
+	ReturnType *TypeAnnotation // optional
 	Body       *BlockStatement
+	Locals     []string // slot names, parameters first; set by the resolver
+	Generator  bool     // whether the body yields; set by the resolver
 }
 
-func (fl *FunctionLiteral) expressionNode() {}
-func (fl *FunctionLiteral) Literal() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) expressionNode()   {}
+func (fl *FunctionLiteral) Literal() string   { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() tok.Position { return fl.Token.Pos }
 
 type FunctionStatement struct {
-	Token      tok.Tok       // The 'gorlami' token
-	Name       *Identifier   // Function name
-	Parameters []*Identifier // Parameters are identifiers
+	Token      tok.Tok         // The 'gorlami' token
+	Name       *Identifier     // Function name
+	Parameters []*Identifier   // Parameters are identifiers
+	ReturnType *TypeAnnotation // optional
 	Body       *BlockStatement
+	Locals     []string // slot names, parameters first; set by the resolver
+	Generator  bool     // whether the body yields; set by the resolver
+
+	// A method, gorlami (p Point) norm(), has a Receiver bound to the
+	// value it is called on and the ReceiverType it belongs to. Its Name
+	// is not declared in any scope.
+	Receiver     *Identifier
+	ReceiverType *Identifier
+}
+
+func (fs *FunctionStatement) statementNode()    {}
+func (fs *FunctionStatement) Literal() string   { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() tok.Position { return fs.Token.Pos }
+
+// StructStatement declares a record type, struct Point { x, y }, and binds
+// its name to it.
+type StructStatement struct {
+	Token  tok.Tok // The 'struct' token
+	Name   *Identifier
+	Fields []*Identifier
+	End    tok.Position // The closing '}'
+}
+
+func (ss *StructStatement) statementNode()    {}
+func (ss *StructStatement) Literal() string   { return ss.Token.Literal }
+func (ss *StructStatement) Pos() tok.Position { return ss.Token.Pos }
+
+// EnumStatement declares an enum, enum Result { Ok(value), Err(error) },
+// and binds its name to it.
+type EnumStatement struct {
+	Token    tok.Tok // The 'enum' token
+	Name     *Identifier
+	Variants []*EnumVariant
+	End      tok.Position // The closing '}'
+}
+
+func (es *EnumStatement) statementNode()    {}
+func (es *EnumStatement) Literal() string   { return es.Token.Literal }
+func (es *EnumStatement) Pos() tok.Position { return es.Token.Pos }
+
+// EnumVariant is one variant of an enum: a name, Red, or a name and the
+// names of the values it carries, Ok(value).
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier // nil without parentheses
+	End    tok.Position  // The closing ')', if there are fields
+}
+
+func (ev *EnumVariant) Literal() string   { return ev.Name.Literal() }
+func (ev *EnumVariant) Pos() tok.Position { return ev.Name.Pos() }
+
+// StructLiteral builds a value of a struct, Point{x: 1, y: 2}. Type is
+// the name of the struct, or a member of a module naming it. Fields left
+// out are null.
+type StructLiteral struct {
+	Token  tok.Tok // The '{' token
+	Type   Expression
+	Fields []*Identifier
+	Values []Expression
+	End    tok.Position // The closing '}'
+}
+
+func (sl *StructLiteral) expressionNode()   {}
+func (sl *StructLiteral) Literal() string   { return sl.Token.Literal }
+func (sl *StructLiteral) Pos() tok.Position { return sl.Token.Pos }
+
+// AssignStatement sets a field of a struct value, p.x = 1.
+type AssignStatement struct {
+	Token  tok.Tok // The '=' token
+	Target *MemberExpression
+	Value  Expression
 }
 
-func (fs *FunctionStatement) statementNode()  {}
-func (fs *FunctionStatement) Literal() string { return fs.Token.Literal }
+func (as *AssignStatement) statementNode()    {}
+func (as *AssignStatement) Literal() string   { return as.Token.Literal }
+func (as *AssignStatement) Pos() tok.Position { return as.Token.Pos }
 
+// CallExpression is a call, f(x), or with Optional set a safe call,
+// f?.(x), which is null if f is.
 type CallExpression struct {
 	Token     tok.Tok // The '(' token
 	Function  Expression
 	Arguments []Expression
+	End       tok.Position // The closing ')'
+	Optional  bool
 }
 
-func (ce *CallExpression) expressionNode() {}
-func (ce *CallExpression) Literal() string { return ce.Token.Literal }
+func (ce *CallExpression) expressionNode()   {}
+func (ce *CallExpression) Literal() string   { return ce.Token.Literal }
+func (ce *CallExpression) Pos() tok.Position { return ce.Token.Pos }
 
 type ReturnStatement struct {
 	Token       tok.Tok // The 'dicocco' token
 	ReturnValue Expression
 }
 
-func (rs *ReturnStatement) statementNode()  {}
-func (rs *ReturnStatement) Literal() string { return rs.Token.Literal }
+func (rs *ReturnStatement) statementNode()    {}
+func (rs *ReturnStatement) Literal() string   { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() tok.Position { return rs.Token.Pos }
+
+// ExpressionStatement is an expression run for its effect, such as a call.
+type ExpressionStatement struct {
+	Token      tok.Tok // the first token of the expression
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()    {}
+func (es *ExpressionStatement) Literal() string   { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() tok.Position { return es.Token.Pos }
+
+type ImportStatement struct {
+	Token tok.Tok // The 'import' token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()    {}
+func (is *ImportStatement) Literal() string   { return is.Token.Literal }
+func (is *ImportStatement) Pos() tok.Position { return is.Token.Pos }
+
+// ExportStatement marks a top level var or gorlami declaration as visible
+// to modules that import this file.
+type ExportStatement struct {
+	Token       tok.Tok // The 'export' token
+	Declaration Statement
+}
+
+func (es *ExportStatement) statementNode()    {}
+func (es *ExportStatement) Literal() string   { return es.Token.Literal }
+func (es *ExportStatement) Pos() tok.Position { return es.Token.Pos }
+
+// Name returns the identifier the exported declaration binds.
+func (es *ExportStatement) Name() *Identifier {
+	switch d := es.Declaration.(type) {
+	case *VarStatement:
+		return d.Name
+	case *FunctionStatement:
+		return d.Name
+	case *StructStatement:
+		return d.Name
+	case *EnumStatement:
+		return d.Name
+	}
+	return nil
+}
+
+// NamedArgument is an argument passed by the name of the parameter it is
+// for, name: value. It can only appear in a call, after the arguments
+// passed by position.
+type NamedArgument struct {
+	Token tok.Tok // the name's token.IDENT token
+	Name  string
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()   {}
+func (na *NamedArgument) Literal() string   { return na.Token.Literal }
+func (na *NamedArgument) Pos() tok.Position { return na.Token.Pos }
+
+// SpreadExpression is ...value, which passes the elements of an array as
+// arguments of their own. It can only appear in a call.
+type SpreadExpression struct {
+	Token tok.Tok // The '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()   {}
+func (se *SpreadExpression) Literal() string   { return se.Token.Literal }
+func (se *SpreadExpression) Pos() tok.Position { return se.Token.Pos }
+
+// MemberExpression is a member access, m.x, or with Optional set a safe
+// one, m?.x, which is null if m is.
+type MemberExpression struct {
+	Token    tok.Tok // The '.' or '?.' token
+	Object   Expression
+	Member   *Identifier
+	Optional bool
+}
+
+func (me *MemberExpression) expressionNode()   {}
+func (me *MemberExpression) Literal() string   { return me.Token.Literal }
+func (me *MemberExpression) Pos() tok.Position { return me.Token.Pos }
+
+// TypeAnnotation is an optional static type written after a name, such as
+// the `int` in `var x: int = 5;`. Function types are spelled
+// `gorlami(int, int): int`.
+type TypeAnnotation struct {
+	Token      tok.Tok // The type name, or the 'gorlami' token
+	Name       string  // empty for function types
+	Parameters []*TypeAnnotation
+	Return     *TypeAnnotation
+}
+
+func (ta *TypeAnnotation) Literal() string   { return ta.Token.Literal }
+func (ta *TypeAnnotation) Pos() tok.Position { return ta.Token.Pos }
+
+func (ta *TypeAnnotation) String() string {
+	if ta.Name != "" {
+		return ta.Name
+	}
+
+	params := make([]string, len(ta.Parameters))
+	for i, p := range ta.Parameters {
+		params[i] = p.String()
+	}
+	return "gorlami(" + strings.Join(params, ", ") + "): " + ta.Return.String()
+}
@@ -0,0 +1,950 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/afoley/salami-lang/tok"
+)
+
+// JSONVersion is the version of the encoding ToJSON writes. It goes up
+// whenever an existing node kind's encoding changes incompatibly; new node
+// kinds and new optional fields leave it alone.
+const JSONVersion = 1
+
+// ToJSON encodes program as JSON for tools written in other languages:
+//
+//	{"version": 1, "program": {"kind": "Program", ...}}
+//
+// Every node is an object whose first members are its kind (the Go type
+// name), pos (the position of its token, as Pos returns) and span (from
+// Start to End), followed by its fields in declaration order. Optional
+// fields that are absent are left out. Positions are {"line", "column"}
+// objects counting from 1. Resolver annotations are included when program
+// has been resolved.
+func ToJSON(program *Program) ([]byte, error) {
+	doc := object{{"version", JSONVersion}, {"program", encode(program)}}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// object is a JSON object that keeps its members in order, so the output
+// reads naturally and stays the same from run to run.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for idx, m := range o {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func encodePos(pos tok.Position) object {
+	return object{{"line", pos.Line}, {"column", pos.Column}}
+}
+
+func encodeList(nodes []Node) []interface{} {
+	list := []interface{}{}
+	for _, n := range nodes {
+		list = append(list, encode(n))
+	}
+	return list
+}
+
+func expressionNodes(exprs []Expression) []Node {
+	nodes := make([]Node, len(exprs))
+	for idx, e := range exprs {
+		nodes[idx] = e
+	}
+	return nodes
+}
+
+func encodeStatements(stmts []Statement) []interface{} {
+	nodes := make([]Node, len(stmts))
+	for idx, s := range stmts {
+		nodes[idx] = s
+	}
+	return encodeList(nodes)
+}
+
+func encodeIdentifiers(idents []*Identifier) []interface{} {
+	nodes := make([]Node, len(idents))
+	for idx, i := range idents {
+		nodes[idx] = i
+	}
+	return encodeList(nodes)
+}
+
+func encode(node Node) object {
+	o := object{
+		{"kind", kindOf(node)},
+		{"pos", encodePos(node.Pos())},
+		{"span", object{{"start", encodePos(Start(node))}, {"end", encodePos(End(node))}}},
+	}
+	add := func(key string, value interface{}) { o = append(o, member{key, value}) }
+	optional := func(key string, n Node) {
+		if !isNil(n) {
+			add(key, encode(n))
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		add("statements", encodeStatements(n.Statements))
+		comments := []interface{}{}
+		for _, c := range n.Comments {
+			comments = append(comments, object{{"pos", encodePos(c.Pos)}, {"text", c.Text}})
+		}
+		add("comments", comments)
+		if n.Resolved {
+			add("globals", stringList(n.Globals))
+		}
+	case *VarStatement:
+		add("name", encode(n.Name))
+		optional("type", n.Type)
+		add("value", encode(n.Value))
+	case *Identifier:
+		add("name", n.Value)
+		optional("type", n.Type)
+		if n.Resolved {
+			add("binding", object{{"depth", n.Depth}, {"index", n.Index}})
+		}
+		optional("pattern", n.Pattern)
+		optional("default", n.Default)
+		if n.Variadic {
+			add("variadic", true)
+		}
+	case *ArrayPattern:
+		elements := make([]Node, len(n.Elements))
+		for idx, e := range n.Elements {
+			elements[idx] = e
+		}
+		add("elements", encodeList(elements))
+		optional("rest", n.Rest)
+	case *HashPattern:
+		add("keys", encodeIdentifiers(n.Keys))
+		optional("rest", n.Rest)
+	case *IntegerLiteral:
+		add("value", n.Value)
+		add("literal", n.Token.Literal)
+	case *StringLiteral:
+		add("value", n.Value)
+	case *BooleanLiteral:
+		add("value", n.Value)
+	case *NullLiteral:
+	case *InfixExpression:
+		add("operator", n.Operator)
+		add("left", encode(n.Left))
+		add("right", encode(n.Right))
+	case *ArrayLiteral:
+		add("elements", encodeList(expressionNodes(n.Elements)))
+	case *HashLiteral:
+		add("keys", encodeList(expressionNodes(n.Keys)))
+		add("values", encodeList(expressionNodes(n.Values)))
+	case *IndexExpression:
+		add("left", encode(n.Left))
+		add("index", encode(n.Index))
+	case *IfExpression:
+		add("condition", encode(n.Condition))
+		add("consequence", encode(n.Consequence))
+		optional("alternative", n.Alternative)
+		if n.ElseIf() != nil {
+			add("elseIf", true)
+		}
+	case *BlockStatement:
+		add("statements", encodeStatements(n.Statements))
+	case *MatchExpression:
+		add("value", encode(n.Value))
+		arms := make([]Node, len(n.Arms))
+		for idx, arm := range n.Arms {
+			arms[idx] = arm
+		}
+		add("arms", encodeList(arms))
+	case *MatchArm:
+		add("patterns", encodeList(expressionNodes(n.Patterns)))
+		optional("guard", n.Guard)
+		optional("value", n.Value)
+		optional("body", n.Body)
+	case *ExitStatement:
+		add("value", encode(n.Value))
+	case *TryStatement:
+		add("body", encode(n.Body))
+		optional("param", n.Param)
+		optional("catch", n.Catch)
+		optional("finally", n.Finally)
+	case *ThrowStatement:
+		add("value", encode(n.Value))
+	case *ForStatement:
+		add("name", encode(n.Name))
+		add("iterable", encode(n.Iterable))
+		add("body", encode(n.Body))
+	case *YieldStatement:
+		add("value", encode(n.Value))
+	case *FunctionLiteral:
+		add("parameters", encodeIdentifiers(n.Parameters))
+		optional("returnType", n.ReturnType)
+		add("body", encode(n.Body))
+		if n.Locals != nil {
+			add("locals", stringList(n.Locals))
+		}
+		if n.Generator {
+			add("generator", true)
+		}
+	case *FunctionStatement:
+		optional("receiver", n.Receiver)
+		optional("receiverType", n.ReceiverType)
+		add("name", encode(n.Name))
+		add("parameters", encodeIdentifiers(n.Parameters))
+		optional("returnType", n.ReturnType)
+		add("body", encode(n.Body))
+		if n.Locals != nil {
+			add("locals", stringList(n.Locals))
+		}
+		if n.Generator {
+			add("generator", true)
+		}
+	case *StructStatement:
+		add("name", encode(n.Name))
+		add("fields", encodeIdentifiers(n.Fields))
+	case *StructLiteral:
+		add("type", encode(n.Type))
+		add("fields", encodeIdentifiers(n.Fields))
+		add("values", encodeList(expressionNodes(n.Values)))
+	case *EnumStatement:
+		add("name", encode(n.Name))
+		variants := make([]Node, len(n.Variants))
+		for idx, v := range n.Variants {
+			variants[idx] = v
+		}
+		add("variants", encodeList(variants))
+	case *EnumVariant:
+		add("name", encode(n.Name))
+		if n.Fields != nil {
+			add("fields", encodeIdentifiers(n.Fields))
+		}
+	case *VariantPattern:
+		add("type", encode(n.Type))
+		add("patterns", encodeList(expressionNodes(n.Patterns)))
+	case *AssignStatement:
+		add("target", encode(n.Target))
+		add("value", encode(n.Value))
+	case *CallExpression:
+		add("function", encode(n.Function))
+		add("arguments", encodeList(expressionNodes(n.Arguments)))
+		if n.Optional {
+			add("optional", true)
+		}
+	case *ReturnStatement:
+		add("value", encode(n.ReturnValue))
+	case *ExpressionStatement:
+		add("expression", encode(n.Expression))
+	case *ImportStatement:
+		add("path", encode(n.Path))
+		add("alias", encode(n.Alias))
+	case *ExportStatement:
+		add("declaration", encode(n.Declaration))
+	case *NamedArgument:
+		add("name", n.Name)
+		add("value", encode(n.Value))
+	case *SpreadExpression:
+		add("value", encode(n.Value))
+	case *MemberExpression:
+		add("object", encode(n.Object))
+		add("member", encode(n.Member))
+		if n.Optional {
+			add("optional", true)
+		}
+	case *TypeAnnotation:
+		if n.Name != "" {
+			add("name", n.Name)
+		} else {
+			params := make([]Node, len(n.Parameters))
+			for idx, p := range n.Parameters {
+				params[idx] = p
+			}
+			add("parameters", encodeList(params))
+			optional("return", n.Return)
+		}
+	default:
+		panic(fmt.Sprintf("ast.ToJSON: unexpected node type %T", node))
+	}
+
+	return o
+}
+
+func stringList(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// kindOf returns the Go type name of node, without the package.
+func kindOf(node Node) string {
+	name := fmt.Sprintf("%T", node)
+	return name[len("*ast."):]
+}
+
+// FromJSON decodes a program written by ToJSON. Tokens are rebuilt from
+// each node's kind, position and fields, so the tree is the same as the
+// one that was encoded.
+func FromJSON(data []byte) (program *Program, err error) {
+	var doc struct {
+		Version *int            `json:"version"`
+		Program json.RawMessage `json:"program"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version == nil {
+		return nil, fmt.Errorf("missing version")
+	}
+	if *doc.Version != JSONVersion {
+		return nil, fmt.Errorf("unsupported version %d, want %d", *doc.Version, JSONVersion)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(jsonError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	d := &decoder{}
+	node := d.node(doc.Program, "program")
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("program: want a Program, got %s", kindOf(node))
+	}
+	return program, nil
+}
+
+// jsonError is raised inside the decoder and returned by FromJSON, so the
+// decoding functions need not check errors at every step.
+type jsonError struct {
+	path string
+	msg  string
+}
+
+func (e jsonError) Error() string { return e.path + ": " + e.msg }
+
+type decoder struct{}
+
+type fields struct {
+	path string
+	m    map[string]json.RawMessage
+}
+
+func (d *decoder) fail(path, format string, args ...interface{}) {
+	panic(jsonError{path, fmt.Sprintf(format, args...)})
+}
+
+func (d *decoder) fields(raw json.RawMessage, path string) fields {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil || m == nil {
+		d.fail(path, "want an object")
+	}
+	return fields{path, m}
+}
+
+func (d *decoder) has(f fields, key string) bool {
+	raw, ok := f.m[key]
+	return ok && string(raw) != "null"
+}
+
+func (d *decoder) value(f fields, key string, into interface{}) {
+	raw, ok := f.m[key]
+	if !ok {
+		d.fail(f.path, "missing %s", key)
+	}
+	if err := json.Unmarshal(raw, into); err != nil {
+		d.fail(f.path+"."+key, "%s", err)
+	}
+}
+
+func (d *decoder) str(f fields, key string) string {
+	var s string
+	d.value(f, key, &s)
+	return s
+}
+
+func (d *decoder) pos(f fields, key string) tok.Position {
+	var p struct{ Line, Column int }
+	d.value(f, key, &p)
+	return tok.Position{Line: p.Line, Column: p.Column}
+}
+
+// flag reads an optional boolean field, false if absent.
+func (d *decoder) flag(f fields, key string) bool {
+	if !d.has(f, key) {
+		return false
+	}
+	var b bool
+	d.value(f, key, &b)
+	return b
+}
+
+func (d *decoder) spanEnd(f fields) tok.Position {
+	var span struct{ End struct{ Line, Column int } }
+	d.value(f, "span", &span)
+	return tok.Position{Line: span.End.Line, Column: span.End.Column}
+}
+
+func (d *decoder) list(f fields, key string) []json.RawMessage {
+	var list []json.RawMessage
+	d.value(f, key, &list)
+	return list
+}
+
+func (d *decoder) child(f fields, key string) Node {
+	raw, ok := f.m[key]
+	if !ok {
+		d.fail(f.path, "missing %s", key)
+	}
+	return d.node(raw, f.path+"."+key)
+}
+
+func (d *decoder) expression(f fields, key string) Expression {
+	n := d.child(f, key)
+	e, ok := n.(Expression)
+	if !ok {
+		d.fail(f.path+"."+key, "want an expression, got %s", kindOf(n))
+	}
+	return e
+}
+
+func (d *decoder) expressions(f fields, key string) []Expression {
+	exprs := []Expression{}
+	for idx, raw := range d.list(f, key) {
+		path := fmt.Sprintf("%s.%s[%d]", f.path, key, idx)
+		e, ok := d.node(raw, path).(Expression)
+		if !ok {
+			d.fail(path, "want an expression")
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs
+}
+
+func (d *decoder) statement(raw json.RawMessage, path string) Statement {
+	n := d.node(raw, path)
+	s, ok := n.(Statement)
+	if !ok {
+		d.fail(path, "want a statement, got %s", kindOf(n))
+	}
+	return s
+}
+
+func (d *decoder) statements(f fields, key string) []Statement {
+	stmts := []Statement{}
+	for idx, raw := range d.list(f, key) {
+		stmts = append(stmts, d.statement(raw, fmt.Sprintf("%s.%s[%d]", f.path, key, idx)))
+	}
+	return stmts
+}
+
+func (d *decoder) identifier(f fields, key string) *Identifier {
+	n := d.child(f, key)
+	i, ok := n.(*Identifier)
+	if !ok {
+		d.fail(f.path+"."+key, "want an Identifier, got %s", kindOf(n))
+	}
+	return i
+}
+
+func (d *decoder) identifiers(f fields, key string) []*Identifier {
+	var idents []*Identifier
+	for idx, raw := range d.list(f, key) {
+		path := fmt.Sprintf("%s.%s[%d]", f.path, key, idx)
+		i, ok := d.node(raw, path).(*Identifier)
+		if !ok {
+			d.fail(path, "want an Identifier")
+		}
+		idents = append(idents, i)
+	}
+	return idents
+}
+
+func (d *decoder) pattern(raw json.RawMessage, path string) Pattern {
+	p, ok := d.node(raw, path).(Pattern)
+	if !ok {
+		d.fail(path, "want a pattern")
+	}
+	return p
+}
+
+// rest reads the optional rest element of an array or hash pattern.
+func (d *decoder) rest(f fields) *Identifier {
+	if !d.has(f, "rest") {
+		return nil
+	}
+	return d.identifier(f, "rest")
+}
+
+func (d *decoder) block(f fields, key string) *BlockStatement {
+	n := d.child(f, key)
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		d.fail(f.path+"."+key, "want a BlockStatement, got %s", kindOf(n))
+	}
+	return b
+}
+
+func (d *decoder) typeAnnotation(f fields, key string) *TypeAnnotation {
+	if !d.has(f, key) {
+		return nil
+	}
+	n := d.child(f, key)
+	t, ok := n.(*TypeAnnotation)
+	if !ok {
+		d.fail(f.path+"."+key, "want a TypeAnnotation, got %s", kindOf(n))
+	}
+	return t
+}
+
+func (d *decoder) locals(f fields) []string {
+	if !d.has(f, "locals") {
+		return nil
+	}
+	var locals []string
+	d.value(f, "locals", &locals)
+	return locals
+}
+
+// token rebuilds a token the lexer would have produced at pos.
+func token(typ tok.TokenType, literal string, pos tok.Position) tok.Tok {
+	end := tok.Position{Line: pos.Line, Column: pos.Column + utf8.RuneCountInString(literal)}
+	return tok.Tok{Type: typ, Literal: literal, Pos: pos, End: end}
+}
+
+func before1(pos tok.Position) tok.Position {
+	return tok.Position{Line: pos.Line, Column: pos.Column - 1}
+}
+
+func (d *decoder) node(raw json.RawMessage, path string) Node {
+	f := d.fields(raw, path)
+	kind := d.str(f, "kind")
+	var pos tok.Position
+	if kind != "Program" {
+		pos = d.pos(f, "pos")
+	}
+
+	switch kind {
+	case "Program":
+		p := &Program{Statements: d.statements(f, "statements"), Comments: []tok.Comment{}}
+		for idx, raw := range d.list(f, "comments") {
+			c := d.fields(raw, fmt.Sprintf("%s.comments[%d]", path, idx))
+			p.Comments = append(p.Comments, tok.Comment{Pos: d.pos(c, "pos"), Text: d.str(c, "text")})
+		}
+		if len(p.Comments) == 0 {
+			p.Comments = nil
+		}
+		if d.has(f, "globals") {
+			d.value(f, "globals", &p.Globals)
+			p.Resolved = true
+		}
+		return p
+
+	case "VarStatement":
+		return &VarStatement{
+			Token: token(tok.VAR, "var", pos),
+			Name:  d.identifier(f, "name"),
+			Type:  d.typeAnnotation(f, "type"),
+			Value: d.expression(f, "value"),
+		}
+
+	case "Identifier":
+		name := d.str(f, "name")
+		i := &Identifier{Token: token(tok.IDENT, name, pos), Value: name, Type: d.typeAnnotation(f, "type")}
+		if d.has(f, "binding") {
+			var b struct{ Depth, Index int }
+			d.value(f, "binding", &b)
+			i.Depth, i.Index, i.Resolved = b.Depth, b.Index, true
+		}
+		if d.has(f, "pattern") {
+			i.Pattern = d.pattern(f.m["pattern"], path+".pattern")
+			i.Token.End = End(i.Pattern)
+		}
+		if d.has(f, "default") {
+			i.Default = d.expression(f, "default")
+		}
+		i.Variadic = d.flag(f, "variadic")
+		return i
+
+	case "ArrayPattern":
+		ap := &ArrayPattern{Token: token(tok.LBRACKET, "[", pos), Elements: []Pattern{}}
+		for idx, raw := range d.list(f, "elements") {
+			ap.Elements = append(ap.Elements, d.pattern(raw, fmt.Sprintf("%s.elements[%d]", path, idx)))
+		}
+		ap.Rest = d.rest(f)
+		ap.End = before1(d.spanEnd(f))
+		return ap
+
+	case "HashPattern":
+		return &HashPattern{
+			Token: token(tok.LBRACE, "{", pos),
+			Keys:  d.identifiers(f, "keys"),
+			Rest:  d.rest(f),
+			End:   before1(d.spanEnd(f)),
+		}
+
+	case "ArrayLiteral":
+		return &ArrayLiteral{Token: token(tok.LBRACKET, "[", pos), Elements: d.expressions(f, "elements"), End: before1(d.spanEnd(f))}
+
+	case "HashLiteral":
+		hl := &HashLiteral{Token: token(tok.LBRACE, "{", pos), Keys: d.expressions(f, "keys"), Values: d.expressions(f, "values")}
+		if len(hl.Keys) != len(hl.Values) {
+			d.fail(path, "want as many values as keys")
+		}
+		hl.End = before1(d.spanEnd(f))
+		return hl
+
+	case "IndexExpression":
+		return &IndexExpression{
+			Token: token(tok.LBRACKET, "[", pos),
+			Left:  d.expression(f, "left"),
+			Index: d.expression(f, "index"),
+			End:   before1(d.spanEnd(f)),
+		}
+
+	case "IntegerLiteral":
+		literal := d.str(f, "literal")
+		il := &IntegerLiteral{Token: token(tok.INT, literal, pos)}
+		d.value(f, "value", &il.Value)
+		return il
+
+	case "StringLiteral":
+		value := d.str(f, "value")
+		return &StringLiteral{Token: tok.Tok{Type: tok.STRING, Literal: value, Pos: pos, End: d.spanEnd(f)}, Value: value}
+
+	case "BooleanLiteral":
+		bl := &BooleanLiteral{}
+		d.value(f, "value", &bl.Value)
+		if bl.Value {
+			bl.Token = token(tok.TRUE, "true", pos)
+		} else {
+			bl.Token = token(tok.FALSE, "false", pos)
+		}
+		return bl
+
+	case "NullLiteral":
+		return &NullLiteral{Token: token(tok.NULL, "null", pos)}
+
+	case "InfixExpression":
+		op := d.str(f, "operator")
+		return &InfixExpression{
+			Token:    token(tok.TokenType(op), op, pos),
+			Left:     d.expression(f, "left"),
+			Operator: op,
+			Right:    d.expression(f, "right"),
+		}
+
+	case "IfExpression":
+		ie := &IfExpression{
+			Token:       token(tok.IF, "if", pos),
+			Condition:   d.expression(f, "condition"),
+			Consequence: d.block(f, "consequence"),
+		}
+		if d.has(f, "alternative") {
+			ie.Alternative = d.block(f, "alternative")
+			if d.flag(f, "elseIf") {
+				ie.Alternative.Token = token(tok.IF, "if", ie.Alternative.Token.Pos)
+			}
+		}
+		return ie
+
+	case "BlockStatement":
+		return &BlockStatement{
+			Token:      token(tok.LBRACE, "{", pos),
+			Statements: d.statements(f, "statements"),
+			End:        before1(d.spanEnd(f)),
+		}
+
+	case "MatchExpression":
+		me := &MatchExpression{Token: token(tok.MATCH, "match", pos), Value: d.expression(f, "value"), Arms: []*MatchArm{}}
+		for idx, raw := range d.list(f, "arms") {
+			armPath := fmt.Sprintf("%s.arms[%d]", path, idx)
+			arm, ok := d.node(raw, armPath).(*MatchArm)
+			if !ok {
+				d.fail(armPath, "want a MatchArm")
+			}
+			me.Arms = append(me.Arms, arm)
+		}
+		me.End = before1(d.spanEnd(f))
+		return me
+
+	case "MatchArm":
+		arm := &MatchArm{Patterns: d.expressions(f, "patterns")}
+		if len(arm.Patterns) == 0 {
+			d.fail(path+".patterns", "want at least one pattern")
+		}
+		if d.has(f, "guard") {
+			arm.Guard = d.expression(f, "guard")
+		}
+		if d.has(f, "value") {
+			arm.Value = d.expression(f, "value")
+		} else {
+			arm.Body = d.block(f, "body")
+		}
+		return arm
+
+	case "ExitStatement":
+		return &ExitStatement{Token: token(tok.EXIT, "exit", pos), Value: d.expression(f, "value")}
+
+	case "TryStatement":
+		ts := &TryStatement{Token: token(tok.TRY, "try", pos), Body: d.block(f, "body")}
+		if d.has(f, "catch") {
+			ts.Param = d.identifier(f, "param")
+			ts.Catch = d.block(f, "catch")
+		}
+		if d.has(f, "finally") {
+			ts.Finally = d.block(f, "finally")
+		}
+		return ts
+
+	case "ThrowStatement":
+		return &ThrowStatement{Token: token(tok.THROW, "throw", pos), Value: d.expression(f, "value")}
+
+	case "ForStatement":
+		return &ForStatement{
+			Token:    token(tok.FOR, "for", pos),
+			Name:     d.identifier(f, "name"),
+			Iterable: d.expression(f, "iterable"),
+			Body:     d.block(f, "body"),
+		}
+
+	case "YieldStatement":
+		return &YieldStatement{Token: token(tok.YIELD, "yield", pos), Value: d.expression(f, "value")}
+
+	case "FunctionLiteral":
+		return &FunctionLiteral{
+			Token:      token(tok.FUNCTION, "gorlami", pos),
+			Parameters: d.identifiers(f, "parameters"),
+			ReturnType: d.typeAnnotation(f, "returnType"),
+			Body:       d.block(f, "body"),
+			Locals:     d.locals(f),
+			Generator:  d.flag(f, "generator"),
+		}
+
+	case "FunctionStatement":
+		fs := &FunctionStatement{Token: token(tok.FUNCTION, "gorlami", pos)}
+		if d.has(f, "receiver") {
+			fs.Receiver = d.identifier(f, "receiver")
+			fs.ReceiverType = d.identifier(f, "receiverType")
+		}
+		fs.Name = d.identifier(f, "name")
+		fs.Parameters = d.identifiers(f, "parameters")
+		fs.ReturnType = d.typeAnnotation(f, "returnType")
+		fs.Body = d.block(f, "body")
+		fs.Locals = d.locals(f)
+		fs.Generator = d.flag(f, "generator")
+		return fs
+
+	case "StructStatement":
+		return &StructStatement{
+			Token:  token(tok.STRUCT, "struct", pos),
+			Name:   d.identifier(f, "name"),
+			Fields: d.identifiers(f, "fields"),
+			End:    before1(d.spanEnd(f)),
+		}
+
+	case "EnumStatement":
+		es := &EnumStatement{Token: token(tok.ENUM, "enum", pos), Name: d.identifier(f, "name")}
+		for idx, raw := range d.list(f, "variants") {
+			variantPath := fmt.Sprintf("%s.variants[%d]", path, idx)
+			v, ok := d.node(raw, variantPath).(*EnumVariant)
+			if !ok {
+				d.fail(variantPath, "want an EnumVariant")
+			}
+			es.Variants = append(es.Variants, v)
+		}
+		if len(es.Variants) == 0 {
+			d.fail(path+".variants", "want at least one variant")
+		}
+		es.End = before1(d.spanEnd(f))
+		return es
+
+	case "EnumVariant":
+		ev := &EnumVariant{Name: d.identifier(f, "name")}
+		if d.has(f, "fields") {
+			ev.Fields = d.identifiers(f, "fields")
+			if len(ev.Fields) == 0 {
+				d.fail(path+".fields", "want at least one field")
+			}
+			ev.End = before1(d.spanEnd(f))
+		}
+		return ev
+
+	case "VariantPattern":
+		return &VariantPattern{
+			Token:    token(tok.LPAREN, "(", pos),
+			Type:     d.expression(f, "type"),
+			Patterns: d.expressions(f, "patterns"),
+			End:      before1(d.spanEnd(f)),
+		}
+
+	case "StructLiteral":
+		sl := &StructLiteral{
+			Token:  token(tok.LBRACE, "{", pos),
+			Type:   d.expression(f, "type"),
+			Fields: d.identifiers(f, "fields"),
+			Values: d.expressions(f, "values"),
+		}
+		if len(sl.Fields) != len(sl.Values) {
+			d.fail(path, "want as many values as fields")
+		}
+		sl.End = before1(d.spanEnd(f))
+		return sl
+
+	case "AssignStatement":
+		target, ok := d.child(f, "target").(*MemberExpression)
+		if !ok {
+			d.fail(f.path+".target", "want a MemberExpression")
+		}
+		return &AssignStatement{Token: token(tok.ASSIGN, "=", pos), Target: target, Value: d.expression(f, "value")}
+
+	case "CallExpression":
+		ce := &CallExpression{
+			Token:     token(tok.LPAREN, "(", pos),
+			Function:  d.expression(f, "function"),
+			Arguments: d.expressions(f, "arguments"),
+		}
+		ce.End = before1(d.spanEnd(f))
+		ce.Optional = d.flag(f, "optional")
+		return ce
+
+	case "ReturnStatement":
+		return &ReturnStatement{Token: token(tok.RETURN, "dicocco", pos), ReturnValue: d.expression(f, "value")}
+
+	case "ExpressionStatement":
+		expr := d.expression(f, "expression")
+		return &ExpressionStatement{Token: firstToken(expr, pos), Expression: expr}
+
+	case "ImportStatement":
+		path, ok := d.child(f, "path").(*StringLiteral)
+		if !ok {
+			d.fail(f.path+".path", "want a StringLiteral")
+		}
+		return &ImportStatement{Token: token(tok.IMPORT, "import", pos), Path: path, Alias: d.identifier(f, "alias")}
+
+	case "ExportStatement":
+		decl := d.child(f, "declaration")
+		switch decl.(type) {
+		case *VarStatement, *FunctionStatement, *StructStatement, *EnumStatement:
+		default:
+			d.fail(f.path+".declaration", "cannot export a %s", kindOf(decl))
+		}
+		return &ExportStatement{Token: token(tok.EXPORT, "export", pos), Declaration: decl.(Statement)}
+
+	case "NamedArgument":
+		name := d.str(f, "name")
+		return &NamedArgument{Token: token(tok.IDENT, name, pos), Name: name, Value: d.expression(f, "value")}
+
+	case "SpreadExpression":
+		return &SpreadExpression{Token: token(tok.ELLIPSIS, "...", pos), Value: d.expression(f, "value")}
+
+	case "MemberExpression":
+		me := &MemberExpression{Object: d.expression(f, "object"), Member: d.identifier(f, "member"), Optional: d.flag(f, "optional")}
+		if me.Optional {
+			me.Token = token(tok.OPTIONAL_DOT, "?.", pos)
+		} else {
+			me.Token = token(tok.DOT, ".", pos)
+		}
+		return me
+
+	case "TypeAnnotation":
+		if d.has(f, "name") {
+			name := d.str(f, "name")
+			return &TypeAnnotation{Token: token(tok.IDENT, name, pos), Name: name}
+		}
+		ta := &TypeAnnotation{Token: token(tok.FUNCTION, "gorlami", pos)}
+		for idx, raw := range d.list(f, "parameters") {
+			paramPath := fmt.Sprintf("%s.parameters[%d]", path, idx)
+			p, ok := d.node(raw, paramPath).(*TypeAnnotation)
+			if !ok {
+				d.fail(paramPath, "want a TypeAnnotation")
+			}
+			ta.Parameters = append(ta.Parameters, p)
+		}
+		ta.Return = d.typeAnnotation(f, "return")
+		return ta
+	}
+
+	d.fail(path, "unknown node kind %q", kind)
+	return nil
+}
+
+// firstToken rebuilds the first token of an expression statement at pos:
+// the first token of the expression itself, or an opening parenthesis if
+// the expression starts later.
+func firstToken(expr Expression, pos tok.Position) tok.Tok {
+	for {
+		switch e := expr.(type) {
+		case *InfixExpression:
+			expr = e.Left
+			continue
+		case *CallExpression:
+			expr = e.Function
+			continue
+		case *MemberExpression:
+			expr = e.Object
+			continue
+		case *IndexExpression:
+			expr = e.Left
+			continue
+		case *StructLiteral:
+			expr = e.Type
+			continue
+		}
+		break
+	}
+
+	if expr.Pos() != pos {
+		return token(tok.LPAREN, "(", pos)
+	}
+	switch e := expr.(type) {
+	case *Identifier:
+		return e.Token
+	case *IntegerLiteral:
+		return e.Token
+	case *StringLiteral:
+		return e.Token
+	case *BooleanLiteral:
+		return e.Token
+	case *NullLiteral:
+		return e.Token
+	case *FunctionLiteral:
+		return e.Token
+	case *IfExpression:
+		return e.Token
+	case *MatchExpression:
+		return e.Token
+	case *ArrayLiteral:
+		return e.Token
+	case *HashLiteral:
+		return e.Token
+	}
+	return token(tok.ILLEGAL, "", pos)
+}
@@ -0,0 +1,88 @@
+package ast_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func parseFile(t *testing.T, path string) *ast.Program {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parse(t, string(src))
+}
+
+// roundTrip checks that program encodes to JSON that decodes to a tree
+// which encodes to the same JSON again.
+func roundTrip(t *testing.T, name string, program *ast.Program) {
+	t.Helper()
+	first, err := ast.ToJSON(program)
+	if err != nil {
+		t.Fatalf("%s: ToJSON: %v", name, err)
+	}
+	decoded, err := ast.FromJSON(first)
+	if err != nil {
+		t.Fatalf("%s: FromJSON: %v", name, err)
+	}
+	second, err := ast.ToJSON(decoded)
+	if err != nil {
+		t.Fatalf("%s: ToJSON of the decoded tree: %v", name, err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("%s: JSON changed on a round trip", name)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("../examples/*.salami")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	paths = append(paths, "../examples/modules/main.salami", "testdata/nodes.salami")
+
+	for _, path := range paths {
+		program := parseFile(t, path)
+		roundTrip(t, path, program)
+
+		// and with the resolver's annotations
+		if errs := resolver.Resolve(program); len(errs) != 0 {
+			t.Fatalf("%s: resolver errors: %v", path, errs)
+		}
+		roundTrip(t, path+" resolved", program)
+	}
+}
+
+// The golden file pins down the encoding of every kind of node, as
+// `salami parse -format=json` prints it. Run go test with -update after
+// changing the encoding on purpose.
+func TestJSONGolden(t *testing.T) {
+	got, err := ast.ToJSON(parseFile(t, "testdata/nodes.salami"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	golden := "testdata/nodes.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ToJSON of testdata/nodes.salami differs from %s; run go test -update if the change is intended", golden)
+	}
+}
@@ -0,0 +1,276 @@
+package ast
+
+import "fmt"
+
+// Rewrite traverses the tree rooted at node bottom up, replacing each node
+// with what f returns for it: the node itself to keep it, or another node
+// to put in its place. f sees a node only after its children have been
+// rewritten. Rewrite returns the replacement for node.
+//
+// Returning nil for a statement in a list (a program or block) removes it,
+// and for an optional field (an else block or a type annotation) clears
+// it. A replacement must fit where it goes, so an expression can only be
+// replaced by an expression and an identifier by an identifier; anything
+// else panics.
+func Rewrite(node Node, f func(Node) Node) Node {
+	r := &rewriter{f: f}
+	return r.node(node)
+}
+
+type rewriter struct {
+	f func(Node) Node
+}
+
+func (r *rewriter) node(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = r.statements(n.Statements)
+	case *VarStatement:
+		n.Name = r.identifier(n, n.Name)
+		n.Type = r.typeAnnotation(n, n.Type)
+		n.Value = r.expression(n, n.Value)
+	case *Identifier:
+		if n.Pattern != nil {
+			n.Pattern = r.pattern(n, n.Pattern)
+		}
+		n.Type = r.typeAnnotation(n, n.Type)
+		if n.Default != nil {
+			n.Default = r.expression(n, n.Default)
+		}
+	case *ArrayPattern:
+		for idx, e := range n.Elements {
+			n.Elements[idx] = r.pattern(n, e)
+		}
+		if n.Rest != nil {
+			n.Rest = r.identifier(n, n.Rest)
+		}
+	case *HashPattern:
+		n.Keys = r.identifiers(n, n.Keys)
+		if n.Rest != nil {
+			n.Rest = r.identifier(n, n.Rest)
+		}
+	case *IntegerLiteral, *StringLiteral, *BooleanLiteral, *NullLiteral:
+	case *InfixExpression:
+		n.Left = r.expression(n, n.Left)
+		n.Right = r.expression(n, n.Right)
+	case *ArrayLiteral:
+		for idx, e := range n.Elements {
+			n.Elements[idx] = r.expression(n, e)
+		}
+	case *HashLiteral:
+		for idx := range n.Keys {
+			n.Keys[idx] = r.expression(n, n.Keys[idx])
+			n.Values[idx] = r.expression(n, n.Values[idx])
+		}
+	case *IndexExpression:
+		n.Left = r.expression(n, n.Left)
+		n.Index = r.expression(n, n.Index)
+	case *IfExpression:
+		n.Condition = r.expression(n, n.Condition)
+		n.Consequence = r.block(n, n.Consequence, false)
+		n.Alternative = r.block(n, n.Alternative, true)
+	case *BlockStatement:
+		n.Statements = r.statements(n.Statements)
+	case *MatchExpression:
+		n.Value = r.expression(n, n.Value)
+		for idx, arm := range n.Arms {
+			replaced, ok := r.node(arm).(*MatchArm)
+			if !ok || replaced == nil {
+				panic("ast.Rewrite: a match arm must stay a match arm")
+			}
+			n.Arms[idx] = replaced
+		}
+	case *MatchArm:
+		for idx, p := range n.Patterns {
+			n.Patterns[idx] = r.expression(n, p)
+		}
+		if n.Guard != nil {
+			n.Guard = r.expression(n, n.Guard)
+		}
+		if n.Value != nil {
+			n.Value = r.expression(n, n.Value)
+		}
+		n.Body = r.block(n, n.Body, false)
+	case *ExitStatement:
+		n.Value = r.expression(n, n.Value)
+	case *TryStatement:
+		n.Body = r.block(n, n.Body, false)
+		if n.Param != nil {
+			n.Param = r.identifier(n, n.Param)
+		}
+		n.Catch = r.block(n, n.Catch, false)
+		n.Finally = r.block(n, n.Finally, false)
+	case *ThrowStatement:
+		n.Value = r.expression(n, n.Value)
+	case *ForStatement:
+		n.Name = r.identifier(n, n.Name)
+		n.Iterable = r.expression(n, n.Iterable)
+		n.Body = r.block(n, n.Body, false)
+	case *YieldStatement:
+		n.Value = r.expression(n, n.Value)
+	case *FunctionLiteral:
+		n.Parameters = r.identifiers(n, n.Parameters)
+		n.ReturnType = r.typeAnnotation(n, n.ReturnType)
+		n.Body = r.block(n, n.Body, false)
+	case *FunctionStatement:
+		if n.Receiver != nil {
+			n.Receiver = r.identifier(n, n.Receiver)
+			n.ReceiverType = r.identifier(n, n.ReceiverType)
+		}
+		n.Name = r.identifier(n, n.Name)
+		n.Parameters = r.identifiers(n, n.Parameters)
+		n.ReturnType = r.typeAnnotation(n, n.ReturnType)
+		n.Body = r.block(n, n.Body, false)
+	case *StructStatement:
+		n.Name = r.identifier(n, n.Name)
+		n.Fields = r.identifiers(n, n.Fields)
+	case *EnumStatement:
+		n.Name = r.identifier(n, n.Name)
+		for idx, v := range n.Variants {
+			replaced, ok := r.node(v).(*EnumVariant)
+			if !ok || replaced == nil {
+				panic("ast.Rewrite: an enum variant must stay an enum variant")
+			}
+			n.Variants[idx] = replaced
+		}
+	case *EnumVariant:
+		n.Name = r.identifier(n, n.Name)
+		n.Fields = r.identifiers(n, n.Fields)
+	case *VariantPattern:
+		n.Type = r.expression(n, n.Type)
+		for idx, p := range n.Patterns {
+			n.Patterns[idx] = r.expression(n, p)
+		}
+	case *StructLiteral:
+		n.Type = r.expression(n, n.Type)
+		n.Fields = r.identifiers(n, n.Fields)
+		for idx, v := range n.Values {
+			n.Values[idx] = r.expression(n, v)
+		}
+	case *AssignStatement:
+		target, ok := r.node(n.Target).(*MemberExpression)
+		if !ok || target == nil {
+			panic("ast.Rewrite: an assignment target must stay a member expression")
+		}
+		n.Target = target
+		n.Value = r.expression(n, n.Value)
+	case *CallExpression:
+		n.Function = r.expression(n, n.Function)
+		for idx, arg := range n.Arguments {
+			n.Arguments[idx] = r.expression(n, arg)
+		}
+	case *ReturnStatement:
+		n.ReturnValue = r.expression(n, n.ReturnValue)
+	case *ExpressionStatement:
+		n.Expression = r.expression(n, n.Expression)
+	case *ImportStatement:
+		path, ok := r.node(n.Path).(*StringLiteral)
+		if !ok || path == nil {
+			panic("ast.Rewrite: an import path must stay a string literal")
+		}
+		n.Path = path
+		n.Alias = r.identifier(n, n.Alias)
+	case *ExportStatement:
+		decl := r.node(n.Declaration)
+		switch decl.(type) {
+		case *VarStatement, *FunctionStatement, *StructStatement, *EnumStatement:
+			n.Declaration = decl.(Statement)
+		default:
+			panic(fmt.Sprintf("ast.Rewrite: cannot export %T", decl))
+		}
+	case *NamedArgument:
+		n.Value = r.expression(n, n.Value)
+	case *SpreadExpression:
+		n.Value = r.expression(n, n.Value)
+	case *MemberExpression:
+		n.Object = r.expression(n, n.Object)
+		n.Member = r.identifier(n, n.Member)
+	case *TypeAnnotation:
+		for idx, p := range n.Parameters {
+			n.Parameters[idx] = r.typeAnnotation(n, p)
+		}
+		n.Return = r.typeAnnotation(n, n.Return)
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", node))
+	}
+
+	return r.f(node)
+}
+
+func (r *rewriter) statements(stmts []Statement) []Statement {
+	out := stmts[:0]
+	for _, stmt := range stmts {
+		replaced := r.node(stmt)
+		if isNil(replaced) {
+			continue
+		}
+		s, ok := replaced.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: cannot replace statement %T with %T", stmt, replaced))
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (r *rewriter) expression(parent Node, e Expression) Expression {
+	replaced := r.node(e)
+	x, ok := replaced.(Expression)
+	if !ok || isNil(replaced) {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace %T in %T with %T", e, parent, replaced))
+	}
+	return x
+}
+
+func (r *rewriter) identifier(parent Node, ident *Identifier) *Identifier {
+	replaced, ok := r.node(ident).(*Identifier)
+	if !ok || replaced == nil {
+		panic(fmt.Sprintf("ast.Rewrite: an identifier in %T must stay an identifier", parent))
+	}
+	return replaced
+}
+
+func (r *rewriter) pattern(parent Node, p Pattern) Pattern {
+	replaced, ok := r.node(p).(Pattern)
+	if !ok || isNil(replaced) {
+		panic(fmt.Sprintf("ast.Rewrite: a pattern in %T must stay a pattern", parent))
+	}
+	return replaced
+}
+
+func (r *rewriter) identifiers(parent Node, idents []*Identifier) []*Identifier {
+	for idx, ident := range idents {
+		idents[idx] = r.identifier(parent, ident)
+	}
+	return idents
+}
+
+func (r *rewriter) block(parent Node, block *BlockStatement, optional bool) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	replaced := r.node(block)
+	if isNil(replaced) && optional {
+		return nil
+	}
+	b, ok := replaced.(*BlockStatement)
+	if !ok || b == nil {
+		panic(fmt.Sprintf("ast.Rewrite: a block in %T must stay a block", parent))
+	}
+	return b
+}
+
+func (r *rewriter) typeAnnotation(parent Node, ta *TypeAnnotation) *TypeAnnotation {
+	if ta == nil {
+		return nil
+	}
+	replaced := r.node(ta)
+	if isNil(replaced) {
+		return nil
+	}
+	t, ok := replaced.(*TypeAnnotation)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: a type annotation in %T must stay a type annotation", parent))
+	}
+	return t
+}
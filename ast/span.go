@@ -0,0 +1,154 @@
+package ast
+
+import "github.com/afoley/salami-lang/tok"
+
+// Start returns the position of the first character of node. For most
+// nodes that is Pos, but an infix expression, call, member access, struct
+// literal, variant pattern or assignment starts with its left operand
+// rather than its operator token. Parentheses around an expression are not part of it.
+func Start(node Node) tok.Position {
+	switch n := node.(type) {
+	case *InfixExpression:
+		return Start(n.Left)
+	case *CallExpression:
+		return Start(n.Function)
+	case *MemberExpression:
+		return Start(n.Object)
+	case *IndexExpression:
+		return Start(n.Left)
+	case *StructLiteral:
+		return Start(n.Type)
+	case *VariantPattern:
+		return Start(n.Type)
+	case *AssignStatement:
+		return Start(n.Target)
+	}
+	return node.Pos()
+}
+
+// End returns the position just past the last character of node that the
+// tree records. A statement's closing semicolon is not recorded, so it is
+// not included.
+func End(node Node) tok.Position {
+	switch n := node.(type) {
+	case *Program:
+		if len(n.Statements) == 0 {
+			return tok.Position{}
+		}
+		return End(n.Statements[len(n.Statements)-1])
+	case *VarStatement:
+		return End(n.Value)
+	case *Identifier:
+		if n.Default != nil {
+			return End(n.Default)
+		}
+		if n.Type != nil {
+			return End(n.Type)
+		}
+		if n.Pattern != nil {
+			return End(n.Pattern)
+		}
+	case *ArrayPattern:
+		return after(n.End)
+	case *HashPattern:
+		return after(n.End)
+	case *ArrayLiteral:
+		return after(n.End)
+	case *HashLiteral:
+		return after(n.End)
+	case *IndexExpression:
+		return after(n.End)
+	case *InfixExpression:
+		return End(n.Right)
+	case *IfExpression:
+		if n.Alternative != nil {
+			return End(n.Alternative)
+		}
+		return End(n.Consequence)
+	case *BlockStatement:
+		return after(n.End)
+	case *MatchExpression:
+		return after(n.End)
+	case *MatchArm:
+		if n.Body != nil {
+			return End(n.Body)
+		}
+		return End(n.Value)
+	case *ExitStatement:
+		return End(n.Value)
+	case *TryStatement:
+		if n.Finally != nil {
+			return End(n.Finally)
+		}
+		return End(n.Catch)
+	case *ThrowStatement:
+		return End(n.Value)
+	case *ForStatement:
+		return End(n.Body)
+	case *YieldStatement:
+		return End(n.Value)
+	case *FunctionLiteral:
+		return End(n.Body)
+	case *FunctionStatement:
+		return End(n.Body)
+	case *StructStatement:
+		return after(n.End)
+	case *StructLiteral:
+		return after(n.End)
+	case *EnumStatement:
+		return after(n.End)
+	case *EnumVariant:
+		if n.Fields != nil {
+			return after(n.End)
+		}
+		return End(n.Name)
+	case *VariantPattern:
+		return after(n.End)
+	case *AssignStatement:
+		return End(n.Value)
+	case *CallExpression:
+		return after(n.End)
+	case *ReturnStatement:
+		return End(n.ReturnValue)
+	case *ExpressionStatement:
+		return End(n.Expression)
+	case *ImportStatement:
+		return End(n.Alias)
+	case *ExportStatement:
+		return End(n.Declaration)
+	case *NamedArgument:
+		return End(n.Value)
+	case *SpreadExpression:
+		return End(n.Value)
+	case *MemberExpression:
+		return End(n.Member)
+	case *TypeAnnotation:
+		if n.Return != nil {
+			return End(n.Return)
+		}
+	}
+	return tokenEnd(node)
+}
+
+// tokenEnd returns the end of node's own token.
+func tokenEnd(node Node) tok.Position {
+	switch n := node.(type) {
+	case *Identifier:
+		return n.Token.End
+	case *IntegerLiteral:
+		return n.Token.End
+	case *StringLiteral:
+		return n.Token.End
+	case *BooleanLiteral:
+		return n.Token.End
+	case *NullLiteral:
+		return n.Token.End
+	case *TypeAnnotation:
+		return n.Token.End
+	}
+	return node.Pos()
+}
+
+func after(pos tok.Position) tok.Position {
+	return tok.Position{Line: pos.Line, Column: pos.Column + 1}
+}
@@ -0,0 +1,192 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called for each node Walk reaches. If it
+// returns a non-nil visitor w, Walk visits each child of node with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth first, children in source
+// order, calling v.Visit for each node.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node depth first, calling f for each
+// node and, if f returns true, for its children. After the children, f is
+// called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Children returns the nodes directly inside node, in source order. Fields
+// that are optional and absent, such as a missing else block or type
+// annotation, are left out. It panics on a node type it does not know, so a
+// new node type cannot silently be skipped by every tool built on Walk.
+func Children(node Node) []Node {
+	var children []Node
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if !isNil(n) {
+				children = append(children, n)
+			}
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *VarStatement:
+		add(n.Name, n.Type, n.Value)
+	case *Identifier:
+		add(n.Pattern, n.Type, n.Default)
+	case *ArrayPattern:
+		for _, e := range n.Elements {
+			add(e)
+		}
+		add(n.Rest)
+	case *HashPattern:
+		for _, k := range n.Keys {
+			add(k)
+		}
+		add(n.Rest)
+	case *IntegerLiteral, *StringLiteral, *BooleanLiteral, *NullLiteral:
+	case *InfixExpression:
+		add(n.Left, n.Right)
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			add(e)
+		}
+	case *HashLiteral:
+		for idx := range n.Keys {
+			add(n.Keys[idx], n.Values[idx])
+		}
+	case *IndexExpression:
+		add(n.Left, n.Index)
+	case *IfExpression:
+		add(n.Condition, n.Consequence, n.Alternative)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *MatchExpression:
+		add(n.Value)
+		for _, arm := range n.Arms {
+			add(arm)
+		}
+	case *MatchArm:
+		for _, p := range n.Patterns {
+			add(p)
+		}
+		add(n.Guard, n.Value, n.Body)
+	case *ExitStatement:
+		add(n.Value)
+	case *TryStatement:
+		add(n.Body, n.Param, n.Catch, n.Finally)
+	case *ThrowStatement:
+		add(n.Value)
+	case *ForStatement:
+		add(n.Name, n.Iterable, n.Body)
+	case *YieldStatement:
+		add(n.Value)
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			add(p)
+		}
+		add(n.ReturnType, n.Body)
+	case *FunctionStatement:
+		add(n.Receiver, n.ReceiverType, n.Name)
+		for _, p := range n.Parameters {
+			add(p)
+		}
+		add(n.ReturnType, n.Body)
+	case *StructStatement:
+		add(n.Name)
+		for _, f := range n.Fields {
+			add(f)
+		}
+	case *EnumStatement:
+		add(n.Name)
+		for _, v := range n.Variants {
+			add(v)
+		}
+	case *EnumVariant:
+		add(n.Name)
+		for _, f := range n.Fields {
+			add(f)
+		}
+	case *VariantPattern:
+		add(n.Type)
+		for _, p := range n.Patterns {
+			add(p)
+		}
+	case *StructLiteral:
+		add(n.Type)
+		for idx := range n.Fields {
+			add(n.Fields[idx], n.Values[idx])
+		}
+	case *AssignStatement:
+		add(n.Target, n.Value)
+	case *CallExpression:
+		add(n.Function)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *ReturnStatement:
+		add(n.ReturnValue)
+	case *ExpressionStatement:
+		add(n.Expression)
+	case *ImportStatement:
+		add(n.Path, n.Alias)
+	case *ExportStatement:
+		add(n.Declaration)
+	case *NamedArgument:
+		add(n.Value)
+	case *SpreadExpression:
+		add(n.Value)
+	case *MemberExpression:
+		add(n.Object, n.Member)
+	case *TypeAnnotation:
+		for _, p := range n.Parameters {
+			add(p)
+		}
+		add(n.Return)
+	default:
+		panic(fmt.Sprintf("ast.Children: unexpected node type %T", node))
+	}
+
+	return children
+}
+
+// isNil reports whether n is nil or a nil pointer to a node, as absent
+// optional fields are.
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,379 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/tok"
+)
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parsing %q: %v", src, errs)
+	}
+	return program
+}
+
+// find returns the nth node, counting from 0 in the order Inspect visits
+// them, whose type is named kind.
+func find(t *testing.T, root ast.Node, kind string, nth int) ast.Node {
+	t.Helper()
+	var found ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n != nil && found == nil && kindOf(n) == kind {
+			if nth == 0 {
+				found = n
+			}
+			nth--
+		}
+		return found == nil
+	})
+	if found == nil {
+		t.Fatalf("no %s in the tree", kind)
+	}
+	return found
+}
+
+// kindOf is the name of n's type, without the package.
+func kindOf(n ast.Node) string {
+	if n == nil {
+		return "nil"
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+}
+
+func kinds(nodes []ast.Node) []string {
+	names := []string{}
+	for _, n := range nodes {
+		names = append(names, kindOf(n))
+	}
+	return names
+}
+
+// One case for each node type, with every child it can have that the
+// source allows for.
+var childrenTests = []struct {
+	src  string
+	kind string
+	nth  int
+	want []string
+}{
+	{`var a = 1; a;`, "Program", 0, []string{"VarStatement", "ExpressionStatement"}},
+	{`var a: int = 1;`, "VarStatement", 0, []string{"Identifier", "TypeAnnotation", "IntegerLiteral"}},
+	{`gorlami f(a: int = 1) {}`, "Identifier", 1, []string{"TypeAnnotation", "IntegerLiteral"}},
+	{`var [a, {b}, ...c] = x;`, "ArrayPattern", 0, []string{"Identifier", "HashPattern", "Identifier"}},
+	{`var {a, b, ...c} = x;`, "HashPattern", 0, []string{"Identifier", "Identifier", "Identifier"}},
+	{`1;`, "IntegerLiteral", 0, []string{}},
+	{`"a";`, "StringLiteral", 0, []string{}},
+	{`true;`, "BooleanLiteral", 0, []string{}},
+	{`null;`, "NullLiteral", 0, []string{}},
+	{`1 + x;`, "InfixExpression", 0, []string{"IntegerLiteral", "Identifier"}},
+	{`[1, x];`, "ArrayLiteral", 0, []string{"IntegerLiteral", "Identifier"}},
+	{`var h = {"a": 1, "b": x};`, "HashLiteral", 0, []string{"StringLiteral", "IntegerLiteral", "StringLiteral", "Identifier"}},
+	{`x[1];`, "IndexExpression", 0, []string{"Identifier", "IntegerLiteral"}},
+	{`if (x) { 1; } else { 2; }`, "IfExpression", 0, []string{"Identifier", "BlockStatement", "BlockStatement"}},
+	{`if (x) { 1; y; }`, "BlockStatement", 0, []string{"ExpressionStatement", "ExpressionStatement"}},
+	{`match (x) { 1 => 2, _ => 3 };`, "MatchExpression", 0, []string{"Identifier", "MatchArm", "MatchArm"}},
+	{`match (x) { 1, 2 if y => { 3; } };`, "MatchArm", 0, []string{"IntegerLiteral", "IntegerLiteral", "Identifier", "BlockStatement"}},
+	{`exit 1;`, "ExitStatement", 0, []string{"IntegerLiteral"}},
+	{`try { 1; } catch (e) { 2; } finally { 3; }`, "TryStatement", 0, []string{"BlockStatement", "Identifier", "BlockStatement", "BlockStatement"}},
+	{`throw x;`, "ThrowStatement", 0, []string{"Identifier"}},
+	{`for (x in xs) { x; }`, "ForStatement", 0, []string{"Identifier", "Identifier", "BlockStatement"}},
+	{`gorlami g() { yield 1; }`, "YieldStatement", 0, []string{"IntegerLiteral"}},
+	{`var f = gorlami(a, b): int { dicocco a; };`, "FunctionLiteral", 0, []string{"Identifier", "Identifier", "TypeAnnotation", "BlockStatement"}},
+	{`gorlami (p Point) move(dx): int {}`, "FunctionStatement", 0, []string{"Identifier", "Identifier", "Identifier", "Identifier", "TypeAnnotation", "BlockStatement"}},
+	{`struct Point { x, y }`, "StructStatement", 0, []string{"Identifier", "Identifier", "Identifier"}},
+	{`enum R { Ok(v), Err }`, "EnumStatement", 0, []string{"Identifier", "EnumVariant", "EnumVariant"}},
+	{`enum R { Ok(v, w) }`, "EnumVariant", 0, []string{"Identifier", "Identifier", "Identifier"}},
+	{`match (x) { R.Ok(v, 1) => v };`, "VariantPattern", 0, []string{"MemberExpression", "Identifier", "IntegerLiteral"}},
+	{`var p = Point{x: 1, y: z};`, "StructLiteral", 0, []string{"Identifier", "Identifier", "IntegerLiteral", "Identifier", "Identifier"}},
+	{`p.x = 1;`, "AssignStatement", 0, []string{"MemberExpression", "IntegerLiteral"}},
+	{`f(1, x);`, "CallExpression", 0, []string{"Identifier", "IntegerLiteral", "Identifier"}},
+	{`gorlami f() { dicocco 1; }`, "ReturnStatement", 0, []string{"IntegerLiteral"}},
+	{`x;`, "ExpressionStatement", 0, []string{"Identifier"}},
+	{`import "./m.salami" as m;`, "ImportStatement", 0, []string{"StringLiteral", "Identifier"}},
+	{`export var a = 1;`, "ExportStatement", 0, []string{"VarStatement"}},
+	{`f(a: 1);`, "NamedArgument", 0, []string{"IntegerLiteral"}},
+	{`f(...xs);`, "SpreadExpression", 0, []string{"Identifier"}},
+	{`p.x;`, "MemberExpression", 0, []string{"Identifier", "Identifier"}},
+	{`var f: gorlami(int, string): int = g;`, "TypeAnnotation", 0, []string{"TypeAnnotation", "TypeAnnotation", "TypeAnnotation"}},
+}
+
+func TestChildren(t *testing.T) {
+	for _, tt := range childrenTests {
+		node := find(t, parse(t, tt.src), tt.kind, tt.nth)
+		if got := kinds(ast.Children(node)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Children of the %s in %q = %v, want %v", tt.kind, tt.src, got, tt.want)
+		}
+	}
+}
+
+// Optional fields that are absent are not children.
+func TestChildrenLeavesOutAbsentFields(t *testing.T) {
+	tests := []struct {
+		src  string
+		kind string
+		want []string
+	}{
+		{`if (x) { 1; }`, "IfExpression", []string{"Identifier", "BlockStatement"}},
+		{`var a = 1;`, "VarStatement", []string{"Identifier", "IntegerLiteral"}},
+		{`try { 1; } finally { 2; }`, "TryStatement", []string{"BlockStatement", "BlockStatement"}},
+		{`gorlami f(a) {}`, "FunctionStatement", []string{"Identifier", "Identifier", "BlockStatement"}},
+		{`match (x) { _ => 1 };`, "MatchArm", []string{"Identifier", "IntegerLiteral"}},
+		{`var [a] = x;`, "ArrayPattern", []string{"Identifier"}},
+	}
+	for _, tt := range tests {
+		node := find(t, parse(t, tt.src), tt.kind, 0)
+		if got := kinds(ast.Children(node)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Children of the %s in %q = %v, want %v", tt.kind, tt.src, got, tt.want)
+		}
+	}
+}
+
+// bogus is a node type Children and Rewrite do not know.
+type bogus struct{}
+
+func (bogus) Literal() string   { return "bogus" }
+func (bogus) Pos() tok.Position { return tok.Position{} }
+
+func TestChildrenPanicsOnUnknownNode(t *testing.T) {
+	mustPanic(t, "ast.Children: unexpected node type ast_test.bogus", func() {
+		ast.Children(bogus{})
+	})
+}
+
+// recorder notes each node it visits, and nil for the end of a node's
+// children, skipping the children of nodes of the type named skip.
+type recorder struct {
+	visits *[]string
+	skip   string
+}
+
+func (r recorder) Visit(n ast.Node) ast.Visitor {
+	*r.visits = append(*r.visits, kindOf(n))
+	if n != nil && kindOf(n) == r.skip {
+		return nil
+	}
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, `f(1 + x);`)
+
+	var visits []string
+	ast.Walk(recorder{visits: &visits}, program)
+	want := []string{
+		"Program",
+		"ExpressionStatement",
+		"CallExpression",
+		"Identifier", "nil",
+		"InfixExpression",
+		"IntegerLiteral", "nil",
+		"Identifier", "nil",
+		"nil", // InfixExpression
+		"nil", // CallExpression
+		"nil", // ExpressionStatement
+		"nil", // Program
+	}
+	if !reflect.DeepEqual(visits, want) {
+		t.Errorf("Walk visited %v, want %v", visits, want)
+	}
+
+	// a nil visitor for a node skips its children and its closing nil
+	visits = nil
+	ast.Walk(recorder{visits: &visits, skip: "InfixExpression"}, program)
+	want = []string{
+		"Program",
+		"ExpressionStatement",
+		"CallExpression",
+		"Identifier", "nil",
+		"InfixExpression",
+		"nil", // CallExpression
+		"nil", // ExpressionStatement
+		"nil", // Program
+	}
+	if !reflect.DeepEqual(visits, want) {
+		t.Errorf("Walk skipping InfixExpression visited %v, want %v", visits, want)
+	}
+}
+
+// Walk reaches every node of every type, so a tool built on it sees all
+// of the tree.
+func TestWalkReachesEveryNodeType(t *testing.T) {
+	for _, tt := range childrenTests {
+		program := parse(t, tt.src)
+		var visits []string
+		ast.Walk(recorder{visits: &visits}, program)
+		count := 0
+		for _, v := range visits {
+			if v == tt.kind {
+				count++
+			}
+		}
+		if count <= tt.nth {
+			t.Errorf("Walk over %q visited %d %s nodes, want more than %d", tt.src, count, tt.kind, tt.nth)
+		}
+	}
+}
+
+func TestRewriteReplaces(t *testing.T) {
+	program := parse(t, `var a = 1 + f(1, [1]);`)
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		if il, ok := n.(*ast.IntegerLiteral); ok && il.Value == 1 {
+			return &ast.IntegerLiteral{Token: tok.Tok{Type: tok.INT, Literal: "2"}, Value: 2}
+		}
+		return n
+	})
+	var values []int64
+	ast.Inspect(program, func(n ast.Node) bool {
+		if il, ok := n.(*ast.IntegerLiteral); ok {
+			values = append(values, il.Value)
+		}
+		return true
+	})
+	if want := []int64{2, 2, 2}; !reflect.DeepEqual(values, want) {
+		t.Errorf("integers after rewriting are %v, want %v", values, want)
+	}
+}
+
+// Rewrite sees a node only once its children are rewritten.
+func TestRewriteIsBottomUp(t *testing.T) {
+	program := parse(t, `1 + 2;`)
+	var order []string
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		order = append(order, kindOf(n))
+		return n
+	})
+	want := []string{"IntegerLiteral", "IntegerLiteral", "InfixExpression", "ExpressionStatement", "Program"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Rewrite visited %v, want %v", order, want)
+	}
+}
+
+func TestRewriteDropsStatements(t *testing.T) {
+	program := parse(t, `var a = 1; a; if (a) { a; var b = 2; }`)
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.ExpressionStatement); ok {
+			return nil
+		}
+		return n
+	})
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has %d statements, want 2", len(program.Statements))
+	}
+	block := find(t, program, "BlockStatement", 0).(*ast.BlockStatement)
+	if len(block.Statements) != 1 {
+		t.Errorf("block has %d statements, want 1", len(block.Statements))
+	}
+}
+
+func TestRewriteClearsOptionalFields(t *testing.T) {
+	program := parse(t, `var a: int = 1; if (a) { 1; } else { 2; }`)
+	ie := find(t, program, "IfExpression", 0).(*ast.IfExpression)
+	alternative := ie.Alternative
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.TypeAnnotation); ok || n == ast.Node(alternative) {
+			return nil
+		}
+		return n
+	})
+	if vs := program.Statements[0].(*ast.VarStatement); vs.Type != nil {
+		t.Errorf("type annotation is %v, want it cleared", vs.Type)
+	}
+	if ie.Alternative != nil {
+		t.Errorf("else block is %v, want it cleared", ie.Alternative)
+	}
+	if ie.Consequence == nil {
+		t.Errorf("then block was cleared too")
+	}
+}
+
+func TestRewritePanicsOnTheWrongKind(t *testing.T) {
+	tests := []struct {
+		src     string
+		replace func(ast.Node) ast.Node
+		panic   string
+	}{
+		{`1 + 2;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.IntegerLiteral); ok {
+				return &ast.BlockStatement{}
+			}
+			return n
+		}, "ast.Rewrite: cannot replace *ast.IntegerLiteral in *ast.InfixExpression with *ast.BlockStatement"},
+		{`1 + 2;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.IntegerLiteral); ok {
+				return nil
+			}
+			return n
+		}, "ast.Rewrite: cannot replace *ast.IntegerLiteral in *ast.InfixExpression with <nil>"},
+		{`x;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.ExpressionStatement); ok {
+				return &ast.IntegerLiteral{}
+			}
+			return n
+		}, "ast.Rewrite: cannot replace statement *ast.ExpressionStatement with *ast.IntegerLiteral"},
+		{`var a = 1;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.Identifier); ok {
+				return &ast.IntegerLiteral{}
+			}
+			return n
+		}, "ast.Rewrite: an identifier in *ast.VarStatement must stay an identifier"},
+		{`if (x) { 1; }`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.BlockStatement); ok {
+				return nil
+			}
+			return n
+		}, "ast.Rewrite: a block in *ast.IfExpression must stay a block"},
+		{`match (x) { _ => 1 };`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.MatchArm); ok {
+				return nil
+			}
+			return n
+		}, "ast.Rewrite: a match arm must stay a match arm"},
+		{`var [a] = x;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.ArrayPattern); ok {
+				return &ast.IntegerLiteral{}
+			}
+			return n
+		}, "ast.Rewrite: a pattern in *ast.Identifier must stay a pattern"},
+		{`export var a = 1;`, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.VarStatement); ok {
+				return &ast.ExpressionStatement{}
+			}
+			return n
+		}, "ast.Rewrite: cannot export *ast.ExpressionStatement"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.src)
+		mustPanic(t, tt.panic, func() { ast.Rewrite(program, tt.replace) })
+	}
+}
+
+func TestRewritePanicsOnUnknownNode(t *testing.T) {
+	mustPanic(t, "ast.Rewrite: unexpected node type ast_test.bogus", func() {
+		ast.Rewrite(bogus{}, func(n ast.Node) ast.Node { return n })
+	})
+}
+
+// mustPanic fails t unless fn panics with message.
+func mustPanic(t *testing.T, message string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Errorf("no panic, want %q", message)
+		} else if fmt.Sprint(r) != message {
+			t.Errorf("panic %q, want %q", r, message)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/vm"
+)
+
+type engineResult struct {
+	exited   bool
+	exitCode int64
+	result   interface{}
+}
+
+// benchCommand runs each file under both engines, checks that they agree
+// and reports the average wall time per run.
+func benchCommand(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", 10, "number of runs per engine")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		usage()
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		program, ok := parseFile(path)
+		if !ok {
+			failed = true
+			continue
+		}
+
+		var interpResult, vmResult engineResult
+
+		interpTime := timeRuns(*n, func() error {
+			interp := interpreter.New()
+			interp.File, _ = filepath.Abs(path)
+			result, err := interp.Run(program)
+			if err != nil {
+				return err
+			}
+			interpResult = engineResult{interp.Exited, interp.ExitCode, result}
+			return nil
+		})
+
+		if interpTime < 0 {
+			fmt.Printf("%s: interpreter failed\n", path)
+			failed = true
+			continue
+		}
+
+		bytecode, err := compileProgram(path, program)
+		if err != nil {
+			fmt.Printf("%s: %s\n", path, err)
+			failed = true
+			continue
+		}
+
+		vmTime := timeRuns(*n, func() error {
+			machine, err := vm.New(bytecode)
+			if err != nil {
+				return err
+			}
+			if err := machine.Run(); err != nil {
+				return err
+			}
+			vmResult = engineResult{machine.Exited, machine.ExitCode, machine.Result()}
+			return nil
+		})
+
+		if vmTime < 0 {
+			fmt.Printf("%s: vm failed\n", path)
+			failed = true
+			continue
+		}
+
+		status := "ok"
+		if !sameResult(interpResult, vmResult) {
+			status = fmt.Sprintf("MISMATCH interp=%+v vm=%+v", interpResult, vmResult)
+			failed = true
+		}
+
+		speedup := float64(interpTime) / float64(vmTime)
+		fmt.Printf("%-45s interp %12v  vm %12v  x%.2f  %s\n", path, interpTime, vmTime, speedup, status)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// compileProgram compiles program, the contents of the file at path, and
+// every module it imports.
+func compileProgram(path string, program *ast.Program) (*compiler.Bytecode, error) {
+	comp := compiler.New()
+	comp.File, _ = filepath.Abs(path)
+	comp.SearchPath = interpreter.SearchPath(filepath.Dir(comp.File))
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compiler: %w", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// timeRuns returns the mean duration of n calls to fn, or -1 if any fail.
+func timeRuns(n int, fn func() error) time.Duration {
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := fn(); err != nil {
+			fmt.Println("error:", err)
+			return -1
+		}
+	}
+	return time.Since(start) / time.Duration(n)
+}
+
+func sameResult(a, b engineResult) bool {
+	if a.exited != b.exited {
+		return false
+	}
+	if a.exited {
+		return a.exitCode == b.exitCode
+	}
+
+	// functions are distinct types in each engine, so only compare scalars,
+	// and arrays and hashes by their contents
+	switch a.result.(type) {
+	case int64, bool, string, *interpreter.Null:
+		return reflect.DeepEqual(a.result, b.result)
+	case *interpreter.Array, *interpreter.Hash:
+		return interpreter.Equal(a.result, b.result)
+	}
+	return true
+}
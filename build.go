@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/salc"
+)
+
+func isCompiled(path string) bool {
+	return filepath.Ext(path) == ".salc"
+}
+
+// buildCommand compiles a .salami source file into a .salc artifact.
+func buildCommand(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("o", "", "output path (default: source path with a .salc extension)")
+	opt := addOptimizeFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	src := fs.Arg(0)
+	program, ok := parseFile(src)
+	if !ok || !optimizeProgram(program, opt.Passes()) {
+		os.Exit(1)
+	}
+
+	bytecode, err := compileProgram(src, program)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	dest := *out
+	if dest == "" {
+		dest = strings.TrimSuffix(src, filepath.Ext(src)) + ".salc"
+	}
+
+	file, err := os.Create(dest)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	if err := salc.Write(file, bytecode); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+}
+
+// disasmCommand prints the bytecode of a .salc file, or of a .salami file
+// compiled on the fly.
+func disasmCommand(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	bytecode, err := loadBytecode(args[0])
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	if err := salc.Disassemble(os.Stdout, bytecode); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+}
+
+func loadBytecode(path string) (*compiler.Bytecode, error) {
+	if isCompiled(path) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		bytecode, err := salc.Read(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return bytecode, nil
+	}
+
+	program, ok := parseFile(path)
+	if !ok {
+		return nil, fmt.Errorf("%s: could not be parsed", path)
+	}
+	return compileProgram(path, program)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/afoley/salami-lang/typecheck"
+)
+
+// checkCommand type checks a program without running it and prints the
+// inferred type of every global.
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	strictBooleans := fs.Bool("strict-booleans", false, "require if conditions to be bool")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	program, ok := parseFile(fs.Arg(0))
+	if !ok {
+		os.Exit(1)
+	}
+
+	types, errs := typecheck.Check(program, typecheck.Options{StrictBooleans: *strictBooleans})
+	if len(errs) != 0 {
+		fmt.Println("type errors:")
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+		os.Exit(1)
+	}
+
+	for i, name := range program.Globals {
+		if strings.HasPrefix(name, "[") || strings.HasPrefix(name, "{") {
+			continue // the slot holding a destructured value
+		}
+		fmt.Printf("%s: %s\n", name, types[i])
+	}
+}
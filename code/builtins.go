@@ -0,0 +1,17 @@
+package code
+
+// Builtins names the builtin functions that both engines provide. OpGetBuiltin
+// refers to one by its index here, which .salc files keep, so new ones go
+// last.
+var Builtins = []string{
+	"assert",
+	"assert_eq",
+	"bool",
+	"len",
+	"next",
+	"range",
+	"map",
+	"filter",
+	"take",
+	"zip",
+}
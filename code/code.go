@@ -0,0 +1,358 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpGreaterThan
+	OpLessThan
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpCurrentClosure
+
+	OpClosure
+	OpCall
+	OpTailCall
+	OpReturnValue
+	OpReturn
+
+	OpExit
+
+	// new opcodes go last so that the numbering of .salc files holds
+	OpJumpNull
+	OpJumpNotNull
+	OpDup
+	OpEqual
+	OpNoMatch
+	OpArray
+	OpHash
+	OpIndex
+	OpDestructureArray
+	OpDestructureHash
+	OpJumpPassed
+	OpSpread
+	OpCallWith
+	OpTry
+	OpEndTry
+	OpThrow
+	OpMember
+	OpStruct
+	OpConstruct
+	OpSetMember
+	OpMethod
+	OpEnum
+	OpIsVariant
+	OpField
+	OpIter
+	OpIterNext
+	OpYield
+	OpMakeCell
+	OpGetCell
+	OpSetCell
+	OpGetFreeCell
+	OpGetBuiltin
+	OpModule
+	OpIsArray
+	OpHasKeys
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	// constant index of the function, number of free variables
+	OpClosure:     {"OpClosure", []int{2, 1}},
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpExit: {"OpExit", []int{}},
+
+	// jump if the top of the stack is null, leaving it there
+	OpJumpNull: {"OpJumpNull", []int{2}},
+	// jump if the top of the stack is not null, leaving it there; pop it
+	// otherwise
+	OpJumpNotNull: {"OpJumpNotNull", []int{2}},
+
+	// push a copy of the top of the stack
+	OpDup: {"OpDup", []int{}},
+	// pop two values and push whether they are the same value
+	OpEqual: {"OpEqual", []int{}},
+	// pop the value of a match that no arm matched and fail
+	OpNoMatch: {"OpNoMatch", []int{}},
+
+	// pop that many elements, or key and value pairs, and push an array or
+	// hash of them
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	// pop an index and a value and push the value's element at the index
+	OpIndex: {"OpIndex", []int{}},
+	// pop an array, then push its elements after the first count as a new
+	// array if the rest flag is set, then the first count elements from
+	// last to first, so the first ends up on top
+	OpDestructureArray: {"OpDestructureArray", []int{1, 1}},
+	// pop count keys and a hash, then push the other keys as a new hash if
+	// the rest flag is set, then the values of the keys from last to first
+	OpDestructureHash: {"OpDestructureHash", []int{1, 1}},
+
+	// jump if the local parameter was passed by the call, so its default
+	// is skipped
+	OpJumpPassed: {"OpJumpPassed", []int{1, 2}},
+	// pop an array to spread and the array of arguments before it, and
+	// push the arguments with its elements added
+	OpSpread: {"OpSpread", []int{}},
+	// pop a hash of named arguments and an array of positional ones and
+	// call the function below them
+	OpCallWith: {"OpCallWith", []int{}},
+
+	// start a try: an error raised before the matching OpEndTry unwinds
+	// the stack to where it was, pushes the error and jumps to the target
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	// pop a value and raise it as an error
+	OpThrow: {"OpThrow", []int{}},
+	// pop a value and push its member named by the constant
+	OpMember: {"OpMember", []int{2}},
+
+	// pop that many field names and push a struct named by the constant
+	OpStruct: {"OpStruct", []int{2, 2}},
+	// pop that many field name and value pairs and the struct below them,
+	// and push a value of the struct
+	OpConstruct: {"OpConstruct", []int{2}},
+	// pop a value and a struct value and set the struct's field named by
+	// the constant, pushing the value
+	OpSetMember: {"OpSetMember", []int{2}},
+	// pop a closure and add it to the struct below it as the method named
+	// by the constant, leaving the struct
+	OpMethod: {"OpMethod", []int{2}},
+
+	// pop that many variant name and field names pairs, the field names an
+	// array or null, and push an enum named by the constant
+	OpEnum: {"OpEnum", []int{2, 2}},
+	// pop a variant and a value and push whether the value is a value of
+	// the variant, whose fields a pattern matches that many values of
+	OpIsVariant: {"OpIsVariant", []int{1}},
+	// pop a value of an enum and push the value of its field at the index
+	OpField: {"OpField", []int{1}},
+
+	// pop an array, hash or generator and push an iterator over its
+	// elements, keys or values
+	OpIter: {"OpIter", []int{}},
+	// push the next value of the iterator on top of the stack, or pop the
+	// iterator and jump if there are none left
+	OpIterNext: {"OpIterNext", []int{2}},
+	// pop a value and hand it to whoever resumed the generator, stopping
+	// until it is resumed again
+	OpYield: {"OpYield", []int{}},
+
+	// put the value of the local in a cell of its own, which the closures
+	// that capture the local share with the function
+	OpMakeCell: {"OpMakeCell", []int{1}},
+	// push or pop the value in the cell of the local
+	OpGetCell: {"OpGetCell", []int{1}},
+	OpSetCell: {"OpSetCell", []int{1}},
+	// push the cell of the free variable itself, for a closure to capture
+	OpGetFreeCell: {"OpGetFreeCell", []int{1}},
+	// push the builtin function at the index of Builtins
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	// pop that many export name and value pairs and push the module of the
+	// file named by the constant
+	OpModule: {"OpModule", []int{2, 2}},
+	// pop a value and push whether it is an array a pattern of that many
+	// elements, and a ...rest if the second operand is 1, can take apart
+	OpIsArray: {"OpIsArray", []int{1, 1}},
+	// pop that many keys and a value and push whether the value is a hash
+	// with every one of the keys
+	OpHasKeys: {"OpHasKeys", []int{1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	count := len(def.OperandWidths)
+	if len(operands) != count {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), count)
+	}
+
+	switch count {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+// LineEntry marks the instruction offset at which a new source line starts.
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+type LineTable []LineEntry
+
+// LineFor returns the source line of the instruction at offset, or 0 if it
+// is unknown.
+func (lt LineTable) LineFor(offset int) int {
+	line := 0
+	for _, e := range lt {
+		if e.Offset > offset {
+			break
+		}
+		line = e.Line
+	}
+	return line
+}
+
+type CompiledFunction struct {
+	Name          string
+	Instructions  Instructions
+	Lines         LineTable
+	NumLocals     int
+	NumParameters int
+
+	// ParameterNames names the parameters for named arguments. The last
+	// NumDefaults parameters before a Variadic one have defaults.
+	ParameterNames []string
+	NumDefaults    int
+	Variadic       bool
+
+	// Generator is set for a function whose body yields: calling it makes
+	// a generator instead of running the body.
+	Generator bool
+}
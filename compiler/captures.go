@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// captured returns, in order, the slots of a function's scope that the
+// functions nested in it use. It goes by the resolver's annotations: a
+// name in a function nested depth deep that refers to depth scopes up is
+// one of the function's own.
+func captured(params []*ast.Identifier, body *ast.BlockStatement) []int {
+	seen := map[int]bool{}
+	var visit func(node ast.Node, depth int)
+	visit = func(node ast.Node, depth int) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FunctionLiteral, *ast.FunctionStatement:
+				for _, child := range ast.Children(n) {
+					visit(child, depth+1)
+				}
+				return false
+			case *ast.Identifier:
+				if depth > 0 && n.Resolved && n.Depth == depth {
+					seen[n.Index] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, p := range params {
+		if p.Default != nil {
+			visit(p.Default, 0)
+		}
+	}
+	visit(body, 0)
+
+	slots := make([]int, 0, len(seen))
+	for idx := range seen {
+		slots = append(slots, idx)
+	}
+	sort.Ints(slots)
+	return slots
+}
@@ -0,0 +1,1304 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+type CompilationScope struct {
+	instructions code.Instructions
+	lines        code.LineTable
+
+	// the finally of each try around the code being compiled, innermost
+	// last, or nil for a try without one
+	tries []*ast.BlockStatement
+
+	yields bool // whether the function has a yield in it
+}
+
+type Compiler struct {
+	constants []interface{}
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	line int // source line of the node being compiled
+
+	// File is the path of the file being compiled, which imports starting
+	// with ./ or ../ are relative to. Other imports are looked for along
+	// SearchPath, as interpreter.Loader does.
+	File       string
+	SearchPath []string
+
+	modules map[string]int // the global holding each module compiled, by file
+	loading []string       // files being compiled, outermost first
+
+	// the first operand too big for its instruction, which fails the
+	// program once it is compiled
+	err error
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Constants    []interface{}
+	NumGlobals   int
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []interface{}{},
+		symbolTable: newGlobalTable(),
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+		modules:     make(map[string]int),
+	}
+}
+
+// newGlobalTable returns the symbol table of the top level of a file, in
+// which the builtins are visible.
+func newGlobalTable() *SymbolTable {
+	s := NewSymbolTable()
+	for idx, name := range code.Builtins {
+		s.DefineBuiltin(idx, name)
+	}
+	return s
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil {
+		if line := node.Pos().Line; line > 0 && line != c.line {
+			previous := c.line
+			c.line = line
+			defer func() { c.line = previous }()
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if !node.Resolved {
+			if errs := resolver.Resolve(node); len(errs) != 0 {
+				return fmt.Errorf("%s", errs[0])
+			}
+		}
+		// every global is defined up front, in the resolver's slots, so
+		// that a function can use one declared after it
+		for _, g := range node.Globals {
+			c.symbolTable.Define(g)
+		}
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		return c.err
+
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements)
+
+	case *ast.VarStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		// the names in a pattern are set before the whole value, so that
+		// the value is still the last thing set
+		if node.Name.Pattern != nil {
+			c.emit(code.OpDup)
+			c.compileDestructure(node.Name.Pattern)
+		}
+		c.emitSet(c.symbolTable.Define(node.Name.Value))
+
+	case *ast.FunctionStatement:
+		if node.Receiver != nil {
+			if err := c.compileMethod(node); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+			return nil
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.compileFunction(node.Name.Value, nil, node.Parameters, node.Locals, node.Body); err != nil {
+			return err
+		}
+		c.emitSet(symbol)
+
+	case *ast.StructStatement:
+		for _, f := range node.Fields {
+			c.emit(code.OpConstant, c.addConstant(f.Value))
+		}
+		c.emit(code.OpStruct, c.addConstant(node.Name.Value), len(node.Fields))
+		c.emitSet(c.symbolTable.Define(node.Name.Value))
+
+	case *ast.EnumStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.compileEnum(node)
+		c.emitSet(symbol)
+
+	case *ast.AssignStatement:
+		if err := c.compileAssign(node); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.ReturnStatement:
+		return c.compileReturn(node.ReturnValue)
+
+	case *ast.ExitStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpExit)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.TryStatement:
+		return c.compileTry(node, false)
+
+	case *ast.ForStatement:
+		return c.compileFor(node)
+
+	case *ast.YieldStatement:
+		if c.scopeIndex == 0 {
+			return fmt.Errorf("yield outside of a function")
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.scopes[c.scopeIndex].yields = true
+		c.emit(code.OpYield)
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.IfExpression:
+		// ifs in statement lists are compiled by compileStatements; this one
+		// is a value
+		return c.compileIf(node, true)
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node, false)
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		// the right operand of ?? only runs if the left one is null
+		if node.Operator == "??" {
+			jumpNotNullPos := c.emit(code.OpJumpNotNull, 9999)
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.changeOperand(jumpNotNullPos, len(c.currentInstructions()))
+			return nil
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(node.Value))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(node.Value))
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	case *ast.ExportStatement:
+		return c.Compile(node.Declaration)
+
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+
+	case *ast.MemberExpression:
+		var nullJumps []int
+		if err := c.compileChain(node, &nullJumps); err != nil {
+			return err
+		}
+		c.patchJumps(nullJumps)
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction("", nil, node.Parameters, node.Locals, node.Body)
+
+	case *ast.StructLiteral:
+		if err := c.Compile(node.Type); err != nil {
+			return err
+		}
+		for idx, f := range node.Fields {
+			c.emit(code.OpConstant, c.addConstant(f.Value))
+			if err := c.Compile(node.Values[idx]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConstruct, len(node.Fields))
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			if err := c.Compile(e); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for idx := range node.Keys {
+			if err := c.Compile(node.Keys[idx]); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Values[idx]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys))
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.CallExpression:
+		var nullJumps []int
+		if err := c.compileCallOperands(node, &nullJumps); err != nil {
+			return err
+		}
+		c.emitCall(node)
+		c.patchJumps(nullJumps)
+
+	case nil:
+		c.emit(code.OpNull)
+
+	default:
+		return fmt.Errorf("cannot compile node of type %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Constants:    c.constants,
+		NumGlobals:   c.symbolTable.numDefinitions,
+	}
+}
+
+// compileStatements compiles a statement list, in which an if is a
+// statement and leaves nothing on the stack.
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	for _, s := range stmts {
+		if ie, ok := s.(*ast.IfExpression); ok {
+			if err := c.compileIf(ie, false); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileReturn returns the value of expr from the function. A call in
+// tail position replaces the current frame instead of pushing a new one,
+// and so does one that is the value of a branch of an if or an arm of a
+// match that is. The top level has no frame to replace, a chain with ?. in
+// it may end up returning null instead, and a call inside a try has to run
+// inside it.
+func (c *Compiler) compileReturn(expr ast.Expression) error {
+	tail := c.scopeIndex > 0 && len(c.scopes[c.scopeIndex].tries) == 0
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		if !tail {
+			break
+		}
+		var nullJumps []int
+		if err := c.compileCallOperands(expr, &nullJumps); err != nil {
+			return err
+		}
+		if len(nullJumps) == 0 && !hasNamedOrSpread(expr) {
+			c.emit(code.OpTailCall, len(expr.Arguments))
+			return nil
+		}
+		c.emitCall(expr)
+		c.patchJumps(nullJumps)
+		c.emit(code.OpReturnValue)
+		return nil
+
+	case *ast.IfExpression:
+		if !tail {
+			break
+		}
+		if err := c.Compile(expr.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compileReturnBranch(expr.Consequence); err != nil {
+			return err
+		}
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		if expr.Alternative == nil {
+			c.emit(code.OpNull)
+			c.emit(code.OpReturnValue)
+			return nil
+		}
+		return c.compileReturnBranch(expr.Alternative)
+
+	case *ast.MatchExpression:
+		if !tail {
+			break
+		}
+		return c.compileMatch(expr, true)
+	}
+
+	if err := c.Compile(expr); err != nil {
+		return err
+	}
+	if err := c.compileLeavingTries(); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// compileReturnBranch returns the value of block, a branch of an if or an
+// arm of a match in tail position, whose last statement is in tail
+// position too.
+func (c *Compiler) compileReturnBranch(block *ast.BlockStatement) error {
+	n := len(block.Statements)
+	if n > 0 {
+		var last ast.Expression
+		switch s := block.Statements[n-1].(type) {
+		case *ast.ExpressionStatement:
+			last = s.Expression
+		case *ast.IfExpression:
+			last = s
+		}
+		if last != nil {
+			if err := c.compileStatements(block.Statements[:n-1]); err != nil {
+				return err
+			}
+			return c.compileReturn(last)
+		}
+	}
+	if err := c.compileBranch(block, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// compileIf compiles an if. As a value, it leaves the value of the branch
+// it runs on the stack, or null if it runs neither.
+func (c *Compiler) compileIf(node *ast.IfExpression, value bool) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBranch(node.Consequence, value); err != nil {
+		return err
+	}
+
+	if node.Alternative == nil && !value {
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBranch(node.Alternative, value); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileMatch compiles a match, which leaves the value of the arm it runs
+// on the stack, or, in tail position, returns it. The value being matched
+// stays on the stack while the arms test it and is popped once one of them
+// matches.
+func (c *Compiler) compileMatch(node *ast.MatchExpression, tail bool) error {
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	var endJumps []int
+	for _, arm := range node.Arms {
+		var matchedJumps, nextArmJumps []int
+
+		for idx, pattern := range arm.Patterns {
+			failJumps, err := c.compilePattern(pattern, nil)
+			if err != nil {
+				return err
+			}
+			if len(failJumps) == 0 {
+				break
+			}
+			if idx == len(arm.Patterns)-1 {
+				nextArmJumps = append(nextArmJumps, failJumps...)
+				break
+			}
+			matchedJumps = append(matchedJumps, c.emit(code.OpJump, 9999))
+			c.patchJumps(failJumps)
+		}
+		c.patchJumps(matchedJumps)
+
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				return err
+			}
+			nextArmJumps = append(nextArmJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		c.emit(code.OpPop)
+		switch {
+		case tail && arm.Body != nil:
+			if err := c.compileReturnBranch(arm.Body); err != nil {
+				return err
+			}
+		case tail:
+			if err := c.compileReturn(arm.Value); err != nil {
+				return err
+			}
+		case arm.Body != nil:
+			if err := c.compileBranch(arm.Body, true); err != nil {
+				return err
+			}
+		default:
+			if err := c.Compile(arm.Value); err != nil {
+				return err
+			}
+		}
+		if !tail {
+			endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		}
+		c.patchJumps(nextArmJumps)
+	}
+
+	c.emit(code.OpNoMatch)
+	c.patchJumps(endJumps)
+	return nil
+}
+
+// compilePattern tests the value on top of the stack, or the value path
+// leads to through the fields of variants inside it, against pattern,
+// binding names as it goes. It returns the jumps taken if the pattern does
+// not match, none if it always does; either way the value stays on the
+// stack.
+func (c *Compiler) compilePattern(pattern ast.Expression, path []int) ([]int, error) {
+	if ast.IsWildcard(pattern) {
+		return nil, nil
+	}
+
+	reach := func() {
+		c.emit(code.OpDup)
+		for _, idx := range path {
+			c.emit(code.OpField, idx)
+		}
+	}
+	switch p := pattern.(type) {
+	case *ast.ArrayPattern, *ast.HashPattern:
+		failJumps := c.compileShape(p.(ast.Pattern), reach)
+		reach()
+		c.compileDestructure(p.(ast.Pattern))
+		return failJumps, nil
+	}
+
+	reach()
+	if name := ast.Binding(pattern); name != nil {
+		c.emitSet(c.symbolTable.Define(name.Value))
+		return nil, nil
+	}
+
+	vp, ok := pattern.(*ast.VariantPattern)
+	if !ok {
+		if err := c.Compile(pattern); err != nil {
+			return nil, err
+		}
+		c.emit(code.OpEqual)
+		return []int{c.emit(code.OpJumpNotTruthy, 9999)}, nil
+	}
+
+	if err := c.Compile(vp.Type); err != nil {
+		return nil, err
+	}
+	c.emit(code.OpIsVariant, len(vp.Patterns))
+	failJumps := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+	for idx, p := range vp.Patterns {
+		jumps, err := c.compilePattern(p, append(path[:len(path):len(path)], idx))
+		if err != nil {
+			return nil, err
+		}
+		failJumps = append(failJumps, jumps...)
+	}
+	return failJumps, nil
+}
+
+// compileShape tests that the value reach pushes has the shape of pattern,
+// an array of the right length or a hash with its keys, and so on for the
+// elements, returning the jumps to take if it has not.
+func (c *Compiler) compileShape(pattern ast.Pattern, reach func()) []int {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Pattern != nil {
+			return c.compileShape(p.Pattern, reach)
+		}
+
+	case *ast.ArrayPattern:
+		rest := 0
+		if p.Rest != nil {
+			rest = 1
+		}
+		reach()
+		c.emit(code.OpIsArray, len(p.Elements), rest)
+		failJumps := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+		for idx, e := range p.Elements {
+			index := c.addConstant(int64(idx))
+			failJumps = append(failJumps, c.compileShape(e, func() {
+				reach()
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+			})...)
+		}
+		return failJumps
+
+	case *ast.HashPattern:
+		reach()
+		for _, k := range p.Keys {
+			c.emit(code.OpConstant, c.addConstant(k.Value))
+		}
+		c.emit(code.OpHasKeys, len(p.Keys))
+		return []int{c.emit(code.OpJumpNotTruthy, 9999)}
+	}
+	return nil
+}
+
+// compileEnum leaves an enum on the stack, built from each variant's name
+// and an array of its field names, or null if it has none.
+func (c *Compiler) compileEnum(node *ast.EnumStatement) {
+	for _, v := range node.Variants {
+		c.emit(code.OpConstant, c.addConstant(v.Name.Value))
+		if v.Fields == nil {
+			c.emit(code.OpNull)
+			continue
+		}
+		for _, f := range v.Fields {
+			c.emit(code.OpConstant, c.addConstant(f.Value))
+		}
+		c.emit(code.OpArray, len(v.Fields))
+	}
+	c.emit(code.OpEnum, c.addConstant(node.Name.Value), len(node.Variants))
+}
+
+// compileBranch compiles a block of an if or a match arm. As a value, the
+// block leaves the value of its last statement on the stack, or null if it
+// has none.
+func (c *Compiler) compileBranch(block *ast.BlockStatement, value bool) error {
+	if !value {
+		return c.Compile(block)
+	}
+
+	n := len(block.Statements)
+	if n == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+	if err := c.compileStatements(block.Statements[:n-1]); err != nil {
+		return err
+	}
+
+	switch last := block.Statements[n-1].(type) {
+	case *ast.ExpressionStatement:
+		return c.Compile(last.Expression)
+	case *ast.IfExpression:
+		return c.compileIf(last, true)
+	case *ast.VarStatement:
+		if err := c.Compile(last); err != nil {
+			return err
+		}
+		return c.Compile(last.Name)
+	case *ast.FunctionStatement:
+		if err := c.Compile(last); err != nil {
+			return err
+		}
+		return c.Compile(last.Name)
+	case *ast.EnumStatement:
+		if err := c.Compile(last); err != nil {
+			return err
+		}
+		return c.Compile(last.Name)
+	case *ast.AssignStatement:
+		return c.compileAssign(last)
+	case *ast.TryStatement:
+		return c.compileTry(last, true)
+	default:
+		// exit and dicocco don't come back
+		if err := c.Compile(last); err != nil {
+			return err
+		}
+		c.emit(code.OpNull)
+		return nil
+	}
+}
+
+// compileMethod compiles a method, leaving the closure on the stack once it
+// is added to its struct.
+func (c *Compiler) compileMethod(node *ast.FunctionStatement) error {
+	if err := c.Compile(node.ReceiverType); err != nil {
+		return err
+	}
+	name := node.ReceiverType.Value + "." + node.Name.Value
+	if err := c.compileFunction(name, node.Receiver, node.Parameters, node.Locals, node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpMethod, c.addConstant(node.Name.Value))
+	return nil
+}
+
+// compileAssign compiles an assignment to a field, leaving the value on the
+// stack.
+func (c *Compiler) compileAssign(node *ast.AssignStatement) error {
+	if err := c.Compile(node.Target.Object); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	c.emit(code.OpSetMember, c.addConstant(node.Target.Member.Value))
+	return nil
+}
+
+// compileFunction compiles a function and pushes a closure of it. locals
+// are the slots the resolver gave its scope, which are all declared up
+// front so that the body can use a name declared further down, as a nested
+// function does. The receiver of a method takes the local slot after the
+// parameters, which a call fills in.
+func (c *Compiler) compileFunction(name string, receiver *ast.Identifier, params []*ast.Identifier, locals []string, body *ast.BlockStatement) error {
+	c.enterScope()
+
+	for _, l := range locals {
+		c.symbolTable.Define(l)
+	}
+	symbols := make([]Symbol, len(params))
+	for idx, p := range params {
+		symbols[idx] = c.symbolTable.Define(p.Value)
+	}
+	if receiver != nil {
+		c.symbolTable.Define(receiver.Value)
+	}
+	// a local a nested function uses lives in a cell, made before anything
+	// sets it, which the closures share instead of a copy
+	for _, idx := range captured(params, body) {
+		if idx < len(locals) {
+			c.symbolTable.Capture(locals[idx])
+			c.emit(code.OpMakeCell, idx)
+		}
+	}
+	// the prologue runs the default of each parameter the call left out,
+	// then takes pattern parameters apart, in parameter order so that a
+	// default sees the parameters before it
+	numDefaults := 0
+	for idx, p := range params {
+		if p.Default != nil {
+			numDefaults++
+			jumpPos := c.emit(code.OpJumpPassed, symbols[idx].Index, 9999)
+			if err := c.Compile(p.Default); err != nil {
+				return err
+			}
+			c.emitSet(symbols[idx])
+			c.replaceInstruction(jumpPos, c.make(code.OpJumpPassed, symbols[idx].Index, len(c.currentInstructions())))
+		}
+		if p.Pattern != nil {
+			c.loadSymbol(symbols[idx])
+			c.compileDestructure(p.Pattern)
+		}
+	}
+
+	// falling off the end of a body returns the value of its last
+	// statement, as the value of a block does
+	if err := c.compileBranch(body, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	lines := c.scopes[c.scopeIndex].lines
+	generator := c.scopes[c.scopeIndex].yields
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadCell(s)
+	}
+
+	fn := &code.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		Lines:         lines,
+		NumLocals:     numLocals,
+		NumParameters: len(params),
+		NumDefaults:   numDefaults,
+		Generator:     generator,
+	}
+	for _, p := range params {
+		fn.ParameterNames = append(fn.ParameterNames, p.Value)
+		fn.Variadic = p.Variadic
+	}
+
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return nil
+}
+
+// compileImport compiles an import, which binds its alias to the module of
+// the file it names. The first import of a file runs the file, compiled as
+// a function, and keeps the module in a global of its own, which any other
+// import of it reads.
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	fromDir, _ := os.Getwd()
+	if c.File != "" {
+		fromDir = filepath.Dir(c.File)
+	}
+	file, err := interpreter.NewLoader(c.SearchPath).Find(fromDir, node.Path.Value)
+	if err != nil {
+		return fmt.Errorf("import %q: %s", node.Path.Value, err)
+	}
+
+	global, ok := c.modules[file]
+	if !ok {
+		for idx, loading := range c.loading {
+			if loading == file {
+				cycle := []string{}
+				for _, f := range append(c.loading[idx:], file) {
+					cycle = append(cycle, filepath.Base(f))
+				}
+				return fmt.Errorf("import %q: import cycle: %s", node.Path.Value, strings.Join(cycle, " -> "))
+			}
+		}
+		program, err := interpreter.ParseModule(file)
+		if err != nil {
+			return fmt.Errorf("import %q: %s", node.Path.Value, err)
+		}
+		if err := c.compileModule(file, program); err != nil {
+			return err
+		}
+		global = c.symbolTable.Reserve()
+		c.modules[file] = global
+		c.emit(code.OpSetGlobal, global)
+	}
+	c.emit(code.OpGetGlobal, global)
+	c.emitSet(c.symbolTable.Define(node.Alias.Value))
+	return nil
+}
+
+// compileModule compiles program, the contents of file, as a function
+// called in place, which leaves the module on the stack. Its top level
+// names are globals of their own, after those of the file importing it.
+func (c *Compiler) compileModule(file string, program *ast.Program) error {
+	outer, importer := c.symbolTable, c.File
+	c.symbolTable = newGlobalTable()
+	c.symbolTable.numDefinitions = outer.numDefinitions
+	c.File = file
+	c.loading = append(c.loading, file)
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	defer func() {
+		c.loading = c.loading[:len(c.loading)-1]
+		c.File = importer
+	}()
+
+	if err := c.Compile(program); err != nil {
+		return err
+	}
+	n := 0
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			name := export.Name()
+			symbol, _ := c.symbolTable.Resolve(name.Value)
+			c.emit(code.OpConstant, c.addConstant(name.Value))
+			c.loadSymbol(symbol)
+			n++
+		}
+	}
+	c.emit(code.OpModule, c.addConstant(file), n)
+	c.emit(code.OpReturnValue)
+
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	outer.numDefinitions = c.symbolTable.numDefinitions
+	c.symbolTable = outer
+
+	fn := &code.CompiledFunction{Name: filepath.Base(file), Instructions: instructions, Lines: lines}
+	c.emit(code.OpClosure, c.addConstant(fn), 0)
+	c.emit(code.OpCall, 0)
+	return nil
+}
+
+// compileFor compiles a for, which keeps an iterator on the stack while it
+// runs. Each value is set as a var would set it.
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	loopPos := len(c.currentInstructions())
+	nextPos := c.emit(code.OpIterNext, 9999)
+	if node.Name.Pattern != nil {
+		c.emit(code.OpDup)
+		c.compileDestructure(node.Name.Pattern)
+	}
+	c.emitSet(c.symbolTable.Define(node.Name.Value))
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopPos)
+	c.changeOperand(nextPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileDestructure pops the value on top of the stack and sets the names
+// in pattern to its parts.
+func (c *Compiler) compileDestructure(pattern ast.Pattern) {
+	rest := func(r *ast.Identifier) int {
+		if r == nil {
+			return 0
+		}
+		return 1
+	}
+
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		switch {
+		case p.Pattern != nil:
+			c.compileDestructure(p.Pattern)
+		case p.Value == "_":
+			c.emit(code.OpPop)
+		default:
+			c.emitSet(c.symbolTable.Define(p.Value))
+		}
+
+	case *ast.ArrayPattern:
+		c.emit(code.OpDestructureArray, len(p.Elements), rest(p.Rest))
+		for _, e := range p.Elements {
+			c.compileDestructure(e)
+		}
+		if p.Rest != nil {
+			c.compileDestructure(p.Rest)
+		}
+
+	case *ast.HashPattern:
+		for _, k := range p.Keys {
+			c.emit(code.OpConstant, c.addConstant(k.Value))
+		}
+		c.emit(code.OpDestructureHash, len(p.Keys), rest(p.Rest))
+		for _, k := range p.Keys {
+			c.compileDestructure(k)
+		}
+		if p.Rest != nil {
+			c.compileDestructure(p.Rest)
+		}
+	}
+}
+
+// compileTry compiles a try. The body runs under a handler that jumps to
+// the catch, with the error on the stack; the catch, if there is a finally,
+// runs under one that jumps to a copy of the finally which raises the
+// error again. Each way out of a block runs the finally on its way. As a
+// value, it leaves the value of the finally on the stack, or else that of
+// the body or the catch, whichever finished.
+func (c *Compiler) compileTry(node *ast.TryStatement, value bool) error {
+	tryPos := c.emit(code.OpTry, 9999)
+	if err := c.compileProtected(node.Body, node.Finally, value); err != nil {
+		return err
+	}
+	endJumps := []int{c.emit(code.OpJump, 9999)}
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		c.emitSet(c.symbolTable.Define(node.Param.Value))
+		if node.Finally == nil {
+			if err := c.compileBranch(node.Catch, value); err != nil {
+				return err
+			}
+			c.patchJumps(endJumps)
+			return nil
+		}
+
+		tryPos = c.emit(code.OpTry, 9999)
+		if err := c.compileProtected(node.Catch, node.Finally, value); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+	}
+
+	if err := c.Compile(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.patchJumps(endJumps)
+	return nil
+}
+
+// compileProtected compiles block under the handler an OpTry just set up,
+// then removes the handler and runs finally, if there is one. As a value,
+// the finally's is left on the stack, or else the block's.
+func (c *Compiler) compileProtected(block, finally *ast.BlockStatement, value bool) error {
+	tries := c.scopes[c.scopeIndex].tries
+	c.scopes[c.scopeIndex].tries = append(tries, finally)
+	err := c.compileBranch(block, value && finally == nil)
+	c.scopes[c.scopeIndex].tries = tries
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	if finally == nil {
+		return nil
+	}
+	return c.compileBranch(finally, value)
+}
+
+// compileLeavingTries removes the handlers of the tries a dicocco returns
+// out of, innermost first, running each one's finally with only the tries
+// around it still active.
+func (c *Compiler) compileLeavingTries() error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for k := len(tries) - 1; k >= 0; k-- {
+		c.emit(code.OpEndTry)
+		if tries[k] == nil {
+			continue
+		}
+		c.scopes[c.scopeIndex].tries = tries[:k]
+		if err := c.Compile(tries[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileChain pushes the value of expr, compiling the calls and member
+// accesses in a chain of them in turn. Each safe call, f?.(x), or access,
+// e?.message, in the chain adds a jump to nullJumps, for the caller to
+// patch to just after the whole chain: a null is left on the stack as the
+// value of the chain.
+func (c *Compiler) compileChain(expr ast.Expression, nullJumps *[]int) error {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		if err := c.compileCallOperands(expr, nullJumps); err != nil {
+			return err
+		}
+		c.emitCall(expr)
+		return nil
+
+	case *ast.MemberExpression:
+		if err := c.compileChain(expr.Object, nullJumps); err != nil {
+			return err
+		}
+		if expr.Optional {
+			*nullJumps = append(*nullJumps, c.emit(code.OpJumpNull, 9999))
+		}
+		c.emit(code.OpMember, c.addConstant(expr.Member.Value))
+		return nil
+	}
+	return c.Compile(expr)
+}
+
+// compileCallOperands pushes the function and arguments of call, the
+// function by way of compileChain.
+func (c *Compiler) compileCallOperands(call *ast.CallExpression, nullJumps *[]int) error {
+	if err := c.compileChain(call.Function, nullJumps); err != nil {
+		return err
+	}
+	if call.Optional {
+		*nullJumps = append(*nullJumps, c.emit(code.OpJumpNull, 9999))
+	}
+	if hasNamedOrSpread(call) {
+		return c.compileArgumentsWith(call.Arguments)
+	}
+	for _, a := range call.Arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasNamedOrSpread reports whether call has named or spread arguments, which
+// are bound by OpCallWith instead of being pushed one by one.
+func hasNamedOrSpread(call *ast.CallExpression) bool {
+	for _, a := range call.Arguments {
+		switch a.(type) {
+		case *ast.NamedArgument, *ast.SpreadExpression:
+			return true
+		}
+	}
+	return false
+}
+
+// compileArgumentsWith pushes the operands of OpCallWith: an array of the
+// positional arguments, with spreads added in place, then a hash of the
+// named ones.
+func (c *Compiler) compileArgumentsWith(args []ast.Expression) error {
+	c.emit(code.OpArray, 0)
+	run := 0
+	endRun := func() {
+		if run > 0 {
+			c.emit(code.OpArray, run)
+			c.emit(code.OpSpread)
+			run = 0
+		}
+	}
+
+	var named []*ast.NamedArgument
+	for _, a := range args {
+		switch a := a.(type) {
+		case *ast.NamedArgument:
+			named = append(named, a)
+		case *ast.SpreadExpression:
+			endRun()
+			if err := c.Compile(a.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpSpread)
+		default:
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+			run++
+		}
+	}
+	endRun()
+
+	for _, a := range named {
+		c.emit(code.OpConstant, c.addConstant(a.Name))
+		if err := c.Compile(a.Value); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpHash, len(named))
+	return nil
+}
+
+func (c *Compiler) emitCall(call *ast.CallExpression) {
+	if hasNamedOrSpread(call) {
+		c.emit(code.OpCallWith)
+		return
+	}
+	c.emit(code.OpCall, len(call.Arguments))
+}
+
+func (c *Compiler) patchJumps(jumps []int) {
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) addConstant(obj interface{}) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := c.make(op, operands...)
+	return c.addInstruction(ins)
+}
+
+// make makes an instruction as code.Make does. An operand that does not
+// fit its width would be cut short and run as some other value, so it
+// fails the compilation instead.
+func (c *Compiler) make(op code.Opcode, operands ...int) []byte {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return code.Make(op, operands...)
+	}
+	for idx, operand := range operands {
+		limit := 1 << (8 * def.OperandWidths[idx])
+		if (operand < 0 || operand >= limit) && c.err == nil {
+			c.err = fmt.Errorf("line %d: %s", c.line, tooMany(def, op, idx, limit))
+		}
+	}
+	return code.Make(op, operands...)
+}
+
+// tooMany describes what there are more of than operand idx of op, whose
+// definition is def, can count up to. An index is below limit, so there
+// can be limit things it indexes; a count or offset is at most limit-1.
+func tooMany(def *code.Definition, op code.Opcode, idx, limit int) string {
+	switch op {
+	case code.OpGetLocal, code.OpSetLocal, code.OpMakeCell, code.OpGetCell, code.OpSetCell:
+		return fmt.Sprintf("more than %d locals in a function", limit)
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return fmt.Sprintf("more than %d globals", limit)
+	case code.OpGetFree, code.OpGetFreeCell:
+		return fmt.Sprintf("more than %d free variables in a closure", limit)
+	case code.OpCall, code.OpTailCall:
+		return fmt.Sprintf("more than %d arguments in a call", limit-1)
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNull, code.OpJumpNotNull, code.OpTry, code.OpIterNext:
+		return fmt.Sprintf("function too long to jump within: more than %d bytes of instructions", limit-1)
+	case code.OpJumpPassed:
+		if idx == 0 {
+			return fmt.Sprintf("more than %d locals in a function", limit)
+		}
+		return fmt.Sprintf("function too long to jump within: more than %d bytes of instructions", limit-1)
+	case code.OpClosure:
+		if idx == 1 {
+			return fmt.Sprintf("more than %d free variables in a closure", limit-1)
+		}
+		return fmt.Sprintf("more than %d constants", limit)
+	case code.OpConstant, code.OpMember, code.OpSetMember, code.OpMethod:
+		return fmt.Sprintf("more than %d constants", limit)
+	case code.OpStruct, code.OpEnum, code.OpModule:
+		if idx == 0 {
+			return fmt.Sprintf("more than %d constants", limit)
+		}
+	}
+	return fmt.Sprintf("more than %d items for one %s", limit-1, def.Name)
+}
+
+func (c *Compiler) emitSet(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Cell:
+		c.emit(code.OpSetCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+// loadCell pushes the cell of s, a captured local or a free variable, for a
+// closure to capture in turn.
+func (c *Compiler) loadCell(s Symbol) {
+	if s.Scope == FreeScope {
+		c.emit(code.OpGetFreeCell, s.Index)
+	} else {
+		c.emit(code.OpGetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.lines); c.line > 0 && (n == 0 || scope.lines[n-1].Line != c.line) {
+		scope.lines = append(scope.lines, code.LineEntry{Offset: posNewInstruction, Line: c.line})
+	}
+
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := c.make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,88 @@
+package compiler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+func compile(t *testing.T, src string) error {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return compiler.New().Compile(program)
+}
+
+// repeat joins n copies of format, each given its index.
+func repeat(n int, format string) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, format, i)
+	}
+	return b.String()
+}
+
+// Programs whose operands only just fit, and one past that, which would
+// otherwise be cut short and run as some other local, global, constant or
+// jump.
+var operandLimits = []struct {
+	name      string
+	fits, not string
+	want      string
+}{
+	{
+		"locals",
+		"gorlami f() {\n" + repeat(256, "var v%d = null;\n") + "dicocco v255;\n}\nf();\n",
+		"gorlami f() {\n" + repeat(300, "var v%d = null;\n") + "dicocco v0 + v299;\n}\nf();\n",
+		"more than 256 locals in a function",
+	},
+	{
+		"globals",
+		repeat(65536-200, "var g%d = null;\n"),
+		repeat(70001, "var g%d = null;\n"),
+		"more than 65536 globals",
+	},
+	{
+		"constants",
+		repeat(65536, "%d;\n"),
+		repeat(65537, "%d;\n"),
+		"more than 65536 constants",
+	},
+	{
+		"free variables",
+		"gorlami outer() {\n" + repeat(127, "var a%d = null;\n") +
+			"gorlami middle() {\n" + repeat(128, "var b%d = null;\n") +
+			"dicocco gorlami() { dicocco [" + repeat(127, "a%d, ") + repeat(128, "b%d, ") + "null]; };\n}\n}\n",
+		"gorlami outer() {\n" + repeat(200, "var a%d = null;\n") +
+			"gorlami middle() {\n" + repeat(200, "var b%d = null;\n") +
+			"dicocco gorlami() { dicocco [" + repeat(200, "a%d, ") + repeat(200, "b%d, ") + "null]; };\n}\n}\n",
+		"free variables in a closure",
+	},
+	{
+		"jumps",
+		"var x = true;\nif (x) {\n" + repeat(16000, "x; // %d\n") + "}\n",
+		"var x = true;\nif (x) {\n" + repeat(17000, "x; // %d\n") + "}\n",
+		"function too long to jump within",
+	},
+}
+
+func TestOperandLimits(t *testing.T) {
+	for _, tc := range operandLimits {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := compile(t, tc.fits); err != nil {
+				t.Errorf("at the limit: %v", err)
+			}
+			err := compile(t, tc.not)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("past the limit: got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
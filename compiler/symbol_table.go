@@ -0,0 +1,104 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+
+	// Cell is set for a local that a nested function captures: its slot
+	// holds a cell the closures share, so that they see it change
+	Cell bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in the current table. Re-declaring a name with var
+// reuses its slot, matching how Environment.Set overwrites the store.
+func (s *SymbolTable) Define(name string) Symbol {
+	if sym, ok := s.store[name]; ok && (sym.Scope == GlobalScope || sym.Scope == LocalScope) {
+		return sym
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Reserve takes a slot of the table that no name refers to.
+func (s *SymbolTable) Reserve() int {
+	s.numDefinitions++
+	return s.numDefinitions - 1
+}
+
+// DefineBuiltin binds name to the builtin at index of code.Builtins. A
+// declaration of the same name shadows it.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Capture makes the local name a cell.
+func (s *SymbolTable) Capture(name string) {
+	symbol := s.store[name]
+	symbol.Cell = true
+	s.store[name] = symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		return s.defineFree(obj), true
+	}
+	return obj, ok
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,297 @@
+// Package coverage records which statements, if/else branches and gorlamis
+// of a salami program ran, using the positions the parser leaves on ast
+// nodes. A Profile is an interpreter.Tracer: attach it to every interpreter
+// that should be measured, run them, then write a summary, an LCOV file or
+// an annotated HTML view of the sources.
+package coverage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// Statement is one statement that can run. Function declarations are left
+// out, as they always "run" whether or not the function is ever called.
+type Statement struct {
+	Pos   tok.Position
+	Count int64
+}
+
+// Branch is one if, counting how often its condition was true (Then) and
+// false (Else). An if without an else still has two branches: skipping the
+// block is a path through the code like any other.
+type Branch struct {
+	Pos        tok.Position
+	Then, Else int64
+}
+
+// Function is one gorlami, named or not, and how often it was called.
+type Function struct {
+	Name  string
+	Pos   tok.Position
+	Count int64
+}
+
+// File holds the counters for one source file, each slice in source order.
+type File struct {
+	Path       string
+	Statements []*Statement
+	Branches   []*Branch
+	Functions  []*Function
+
+	statementAt map[tok.Position]*Statement
+	branchAt    map[tok.Position]*Branch
+	functionAt  map[tok.Position]*Function
+}
+
+// Profile collects coverage for every file run while it is attached. The
+// same file may be run many times, and even parsed again (each test gets a
+// fresh interpreter and so fresh imports); counters are kept by file and
+// position so they all add up in one place.
+type Profile struct {
+	files    map[string]*File
+	programs map[*ast.Program]bool
+
+	statements map[ast.Statement]*Statement
+	branches   map[*ast.IfExpression]*Branch
+	functions  map[*ast.BlockStatement]*Function
+}
+
+func New() *Profile {
+	return &Profile{
+		files:      map[string]*File{},
+		programs:   map[*ast.Program]bool{},
+		statements: map[ast.Statement]*Statement{},
+		branches:   map[*ast.IfExpression]*Branch{},
+		functions:  map[*ast.BlockStatement]*Function{},
+	}
+}
+
+// Attach makes i report to p, along with the interpreters running any
+// modules it imports. Set i.File and the strict modes first: imports are
+// found relative to the file and run as strictly as it is.
+func (p *Profile) Attach(i *interpreter.Interpreter) {
+	i.Tracer = p
+	if i.Loader == nil {
+		root := "."
+		if i.File != "" {
+			root = filepath.Dir(i.File)
+		}
+		i.Loader = interpreter.NewLoader(interpreter.SearchPath(root))
+		i.Loader.Strict = i.Strict
+		i.Loader.StrictBooleans = i.StrictBooleans
+	}
+	i.Loader.Tracer = p
+}
+
+// Files returns the files seen so far, sorted by path.
+func (p *Profile) Files() []*File {
+	files := make([]*File, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].Path < files[b].Path })
+	return files
+}
+
+// Filter keeps only the files for which keep returns true, such as every
+// file but the tests themselves.
+func (p *Profile) Filter(keep func(path string) bool) {
+	for path := range p.files {
+		if !keep(path) {
+			delete(p.files, path)
+		}
+	}
+}
+
+// Program registers every statement, branch and function in program, so
+// the ones that never run are counted too.
+func (p *Profile) Program(file string, program *ast.Program) {
+	if p.programs[program] {
+		return
+	}
+	p.programs[program] = true
+	if file == "" {
+		file = "<stdin>"
+	}
+
+	f, ok := p.files[file]
+	if !ok {
+		f = &File{
+			Path:        file,
+			statementAt: map[tok.Position]*Statement{},
+			branchAt:    map[tok.Position]*Branch{},
+			functionAt:  map[tok.Position]*Function{},
+		}
+		p.files[file] = f
+	}
+
+	r := &register{p: p, file: f}
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Program:
+			r.statements(n.Statements)
+		case *ast.BlockStatement:
+			r.statements(n.Statements)
+		case *ast.IfExpression:
+			r.branch(n)
+		case *ast.FunctionStatement:
+			r.function(n.Name.Value, n.Pos(), n.Body)
+		case *ast.FunctionLiteral:
+			r.function("", n.Pos(), n.Body)
+		}
+		return true
+	})
+
+	if r.added {
+		sort.Slice(f.Statements, func(a, b int) bool { return before(f.Statements[a].Pos, f.Statements[b].Pos) })
+		sort.Slice(f.Branches, func(a, b int) bool { return before(f.Branches[a].Pos, f.Branches[b].Pos) })
+		sort.Slice(f.Functions, func(a, b int) bool { return before(f.Functions[a].Pos, f.Functions[b].Pos) })
+	}
+}
+
+func (p *Profile) Enter(fn *interpreter.Function) {
+	if f, ok := p.functions[fn.Body]; ok {
+		f.Count++
+	}
+}
+
+func (p *Profile) Exit(*interpreter.Function) {}
+
+func (p *Profile) Statement(stmt ast.Statement) {
+	if s, ok := p.statements[stmt]; ok {
+		s.Count++
+	}
+}
+
+func (p *Profile) Branch(expr *ast.IfExpression, consequence bool) {
+	b, ok := p.branches[expr]
+	if !ok {
+		return
+	}
+	if consequence {
+		b.Then++
+	} else {
+		b.Else++
+	}
+}
+
+// register walks one program, linking its nodes to the counters for their
+// positions in file. A file run before reuses its counters.
+type register struct {
+	p     *Profile
+	file  *File
+	added bool
+}
+
+func (r *register) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		decl := stmt
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			decl = export.Declaration
+		}
+		if _, ok := decl.(*ast.FunctionStatement); ok {
+			continue
+		}
+
+		s, ok := r.file.statementAt[stmt.Pos()]
+		if !ok {
+			s = &Statement{Pos: stmt.Pos()}
+			r.file.statementAt[s.Pos] = s
+			r.file.Statements = append(r.file.Statements, s)
+			r.added = true
+		}
+		r.p.statements[stmt] = s
+	}
+}
+
+func (r *register) branch(node *ast.IfExpression) {
+	b, ok := r.file.branchAt[node.Pos()]
+	if !ok {
+		b = &Branch{Pos: node.Pos()}
+		r.file.branchAt[b.Pos] = b
+		r.file.Branches = append(r.file.Branches, b)
+		r.added = true
+	}
+	r.p.branches[node] = b
+}
+
+func (r *register) function(name string, pos tok.Position, body *ast.BlockStatement) {
+	fn, ok := r.file.functionAt[pos]
+	if !ok {
+		if name == "" {
+			name = fmt.Sprintf("<anonymous>:%d", pos.Line)
+		}
+		fn = &Function{Name: name, Pos: pos}
+		r.file.functionAt[pos] = fn
+		r.file.Functions = append(r.file.Functions, fn)
+		r.added = true
+	}
+	r.p.functions[body] = fn
+}
+
+// Summary is how much of something ran: statements, branches or functions.
+type Summary struct {
+	Covered, Total int
+}
+
+func (s Summary) Percent() float64 {
+	if s.Total == 0 {
+		return 100
+	}
+	return 100 * float64(s.Covered) / float64(s.Total)
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%.1f%% (%d/%d)", s.Percent(), s.Covered, s.Total)
+}
+
+func (s *Summary) add(o Summary) {
+	s.Covered += o.Covered
+	s.Total += o.Total
+}
+
+// StatementSummary counts the statements in f that ran at least once.
+func (f *File) StatementSummary() Summary {
+	s := Summary{Total: len(f.Statements)}
+	for _, stmt := range f.Statements {
+		if stmt.Count > 0 {
+			s.Covered++
+		}
+	}
+	return s
+}
+
+// BranchSummary counts the branches taken at least once, two per if.
+func (f *File) BranchSummary() Summary {
+	s := Summary{Total: 2 * len(f.Branches)}
+	for _, b := range f.Branches {
+		if b.Then > 0 {
+			s.Covered++
+		}
+		if b.Else > 0 {
+			s.Covered++
+		}
+	}
+	return s
+}
+
+// FunctionSummary counts the functions called at least once.
+func (f *File) FunctionSummary() Summary {
+	s := Summary{Total: len(f.Functions)}
+	for _, fn := range f.Functions {
+		if fn.Count > 0 {
+			s.Covered++
+		}
+	}
+	return s
+}
+
+func before(a, b tok.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
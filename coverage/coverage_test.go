@@ -0,0 +1,100 @@
+package coverage_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/coverage"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// run runs the program in file under a fresh coverage profile, as many
+// times as asked.
+func run(t *testing.T, file string, times int) *coverage.Profile {
+	t.Helper()
+	src, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cov := coverage.New()
+	for n := 0; n < times; n++ {
+		// each run parses the file again, as each test in salami test does
+		p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) != 0 {
+			t.Fatalf("parser errors: %v", errs)
+		}
+		interp := interpreter.New()
+		interp.File = file
+		cov.Attach(interp)
+		if _, err := interp.Run(program); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cov
+}
+
+// The golden file pins down the LCOV records: FN and FNDA for every
+// gorlami, called or not; two BRDA per if, with "-" for an if that never
+// ran; and DA for every line a statement starts on.
+func TestLCOV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run(t, "testdata/branches.salami", 1).WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	golden := "testdata/branches.lcov"
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("got\n%s\nwant, from %s\n%s\nrun go test -update if the change is intended", got, golden, want)
+	}
+}
+
+// Counts from several runs of the same file, each parsed afresh, add up.
+func TestBranches(t *testing.T) {
+	cov := run(t, "testdata/branches.salami", 2)
+	files := cov.Files()
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	f := files[0]
+
+	var got []string
+	for _, b := range f.Branches {
+		got = append(got, fmt.Sprintf("%d:%d/%d", b.Pos.Line, b.Then, b.Else))
+	}
+	if want := "2:2/4 10:0/0 21:0/2 24:0/2"; strings.Join(got, " ") != want {
+		t.Errorf("branches: got %s, want %s", strings.Join(got, " "), want)
+	}
+
+	statements, branches, functions := cov.Totals()
+	if branches != (coverage.Summary{Covered: 4, Total: 8}) {
+		t.Errorf("branch summary: got %v", branches)
+	}
+	if functions != (coverage.Summary{Covered: 2, Total: 3}) {
+		t.Errorf("function summary: got %v", functions)
+	}
+	// never's three statements, the call to it and the then value on the
+	// last line
+	if statements.Total != len(f.Statements) || statements.Covered != statements.Total-5 {
+		t.Errorf("statement summary: got %v, want all but the five that never run", statements)
+	}
+}
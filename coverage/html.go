@@ -0,0 +1,153 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteHTML writes a single page showing the source of every file, each
+// line coloured by whether what starts on it ran: green when every
+// statement ran and every branch went both ways, yellow when only some of
+// it did and red when none of it did. Hovering over a line shows its
+// counts.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	page := htmlPage{}
+	page.Statements, page.Branches, page.Functions = p.Totals()
+
+	for idx, f := range p.Files() {
+		src, err := os.ReadFile(f.Path)
+		if err != nil {
+			return err
+		}
+		page.Files = append(page.Files, htmlFile{
+			ID:         fmt.Sprintf("file%d", idx),
+			Name:       displayPath(f.Path),
+			Statements: f.StatementSummary(),
+			Branches:   f.BranchSummary(),
+			Lines:      f.annotate(string(src)),
+		})
+	}
+
+	return htmlTemplate.Execute(w, page)
+}
+
+type htmlPage struct {
+	Statements, Branches, Functions Summary
+	Files                           []htmlFile
+}
+
+type htmlFile struct {
+	ID                   string
+	Name                 string
+	Statements, Branches Summary
+	Lines                []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Text   string
+	Class  string // covered, partial, uncovered or empty for no code
+	Title  string
+}
+
+// annotate splits src into lines, classifying each by the statements and
+// branches that start on it.
+func (f *File) annotate(src string) []htmlLine {
+	type tally struct {
+		statements, ran int
+		arms, taken     int
+		notes           []string
+	}
+	tallies := map[int]*tally{}
+	at := func(line int) *tally {
+		t, ok := tallies[line]
+		if !ok {
+			t = &tally{}
+			tallies[line] = t
+		}
+		return t
+	}
+
+	for _, s := range f.Statements {
+		t := at(s.Pos.Line)
+		t.statements++
+		if s.Count > 0 {
+			t.ran++
+		}
+		t.notes = append(t.notes, fmt.Sprintf("statement at column %d ran %d times", s.Pos.Column, s.Count))
+	}
+	for _, b := range f.Branches {
+		t := at(b.Pos.Line)
+		t.arms += 2
+		if b.Then > 0 {
+			t.taken++
+		}
+		if b.Else > 0 {
+			t.taken++
+		}
+		t.notes = append(t.notes, fmt.Sprintf("if at column %d: true %d times, false %d times", b.Pos.Column, b.Then, b.Else))
+	}
+
+	var lines []htmlLine
+	for idx, text := range strings.Split(strings.TrimRight(src, "\n"), "\n") {
+		line := htmlLine{Number: idx + 1, Text: text}
+		if t, ok := tallies[idx+1]; ok {
+			switch {
+			case t.ran == 0 && t.taken == 0:
+				line.Class = "uncovered"
+			case t.ran == t.statements && t.taken == t.arms:
+				line.Class = "covered"
+			default:
+				line.Class = "partial"
+			}
+			line.Title = strings.Join(t.notes, "\n")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>salami coverage</title>
+<style>
+body { font-family: sans-serif; margin: 0; background: #fafafa; color: #222; }
+header { padding: 12px 16px; background: #222; color: #eee; }
+header select { font-size: 14px; margin-left: 12px; }
+.summary { font-size: 13px; margin-top: 6px; color: #bbb; }
+pre { margin: 0; padding: 12px 0; font-size: 13px; line-height: 1.4; }
+.line { display: block; padding: 0 16px; white-space: pre; }
+.number { display: inline-block; width: 4em; color: #999; user-select: none; }
+.covered { background: #d7f5d7; }
+.partial { background: #fbeec2; }
+.uncovered { background: #f8d0d0; }
+.file { display: none; }
+.file.shown { display: block; }
+</style>
+</head>
+<body>
+<header>
+<strong>salami coverage</strong>
+<select onchange="show(this.value)">
+{{range .Files}}<option value="{{.ID}}">{{.Name}} ({{printf "%.1f" .Statements.Percent}}%)</option>
+{{end}}</select>
+<div class="summary">statements {{.Statements}}, branches {{.Branches}}, functions {{.Functions}}</div>
+</header>
+{{range $idx, $f := .Files}}<div class="file{{if eq $idx 0}} shown{{end}}" id="{{$f.ID}}">
+<pre>{{range $f.Lines}}<span class="line {{.Class}}"{{if .Title}} title="{{.Title}}"{{end}}><span class="number">{{.Number}}</span>{{.Text}}</span>{{end}}</pre>
+</div>
+{{end}}<script>
+function show(id) {
+	document.querySelectorAll(".file").forEach(function (el) {
+		el.classList.toggle("shown", el.id === id);
+	});
+}
+</script>
+</body>
+</html>
+`))
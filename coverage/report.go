@@ -0,0 +1,111 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// Totals sums the statement, branch and function coverage of every file.
+func (p *Profile) Totals() (statements, branches, functions Summary) {
+	for _, f := range p.files {
+		statements.add(f.StatementSummary())
+		branches.add(f.BranchSummary())
+		functions.add(f.FunctionSummary())
+	}
+	return statements, branches, functions
+}
+
+// WriteSummary writes a line per file and a total.
+func (p *Profile) WriteSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tstatements\tbranches\tfunctions")
+	for _, f := range p.Files() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", displayPath(f.Path), f.StatementSummary(), f.BranchSummary(), f.FunctionSummary())
+	}
+	statements, branches, functions := p.Totals()
+	fmt.Fprintf(tw, "total\t%s\t%s\t%s\n", statements, branches, functions)
+	return tw.Flush()
+}
+
+// WriteLCOV writes the profile in the LCOV tracefile format read by genhtml
+// and most CI coverage services. Each statement line gets the count of the
+// statement starting there that ran most, so a line counts as hit if
+// anything on it ran.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range p.Files() {
+		fmt.Fprintln(bw, "TN:")
+		fmt.Fprintf(bw, "SF:%s\n", f.Path)
+
+		for _, fn := range f.Functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.Pos.Line, fn.Name)
+		}
+		for _, fn := range f.Functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.Count, fn.Name)
+		}
+		functions := f.FunctionSummary()
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", functions.Total, functions.Covered)
+
+		for idx, b := range f.Branches {
+			taken := [2]string{"-", "-"}
+			if b.Then+b.Else > 0 {
+				taken = [2]string{fmt.Sprint(b.Then), fmt.Sprint(b.Else)}
+			}
+			fmt.Fprintf(bw, "BRDA:%d,%d,0,%s\n", b.Pos.Line, idx, taken[0])
+			fmt.Fprintf(bw, "BRDA:%d,%d,1,%s\n", b.Pos.Line, idx, taken[1])
+		}
+		branches := f.BranchSummary()
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", branches.Total, branches.Covered)
+
+		lines := f.lineCounts()
+		hit := 0
+		for _, l := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.line, l.count)
+			if l.count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\n", len(lines), hit)
+		fmt.Fprintln(bw, "end_of_record")
+	}
+	return bw.Flush()
+}
+
+type lineCount struct {
+	line  int
+	count int64
+}
+
+// lineCounts returns the lines on which statements start, in order, each
+// with the highest count of those statements.
+func (f *File) lineCounts() []lineCount {
+	var lines []lineCount
+	for _, s := range f.Statements {
+		if n := len(lines); n > 0 && lines[n-1].line == s.Pos.Line {
+			if s.Count > lines[n-1].count {
+				lines[n-1].count = s.Count
+			}
+			continue
+		}
+		lines = append(lines, lineCount{s.Pos.Line, s.Count})
+	}
+	return lines
+}
+
+// displayPath shortens path to be relative to the working directory when it
+// is inside it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || len(rel) >= 2 && rel[:2] == ".." {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,394 @@
+// Package dap implements a Debug Adapter Protocol server over stdio on top
+// of package debugger, so editors can launch salami programs, set
+// breakpoints, step and inspect variables.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/afoley/salami-lang/debugger"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+// The interpreter is single threaded; this is the one thread DAP sees.
+const threadID = 1
+
+type Server struct {
+	in *bufio.Reader
+
+	mu  sync.Mutex // guards out and seq, written from two goroutines
+	out io.Writer
+	seq int
+
+	d *debugger.Debugger
+
+	// variable references handed out since the last stop; reference n is
+	// scopes[n-1]
+	scopes []scopeRef
+
+	state       sync.Mutex
+	terminating bool
+}
+
+type scopeRef struct {
+	frame, scope int
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out}
+}
+
+// Serve handles requests until the client disconnects or closes the stream.
+func (s *Server) Serve() int {
+	for {
+		body, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0
+			}
+			s.output("stderr", err.Error()+"\n")
+			continue
+		}
+
+		var req message
+		if err := json.Unmarshal(body, &req); err != nil || req.Type != "request" {
+			s.output("stderr", fmt.Sprintf("bad message: %s\n", body))
+			continue
+		}
+
+		result, err := s.handle(req)
+		s.respond(req, result, err)
+
+		switch req.Command {
+		case "initialize":
+			// nothing can be configured until launch has loaded a program
+		case "launch":
+			if err == nil {
+				s.event("initialized", nil)
+			}
+		case "disconnect":
+			return 0
+		}
+	}
+}
+
+func (s *Server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) write(msg *message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) respond(req message, body interface{}, err error) {
+	success := err == nil
+	msg := &message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body}
+	if err != nil {
+		msg.Message = err.Error()
+	}
+	s.write(msg)
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.write(&message{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) output(category, text string) {
+	s.event("output", OutputEvent{Category: category, Output: text})
+}
+
+func (s *Server) handle(req message) (interface{}, error) {
+	if req.Command != "initialize" && req.Command != "launch" && req.Command != "disconnect" && s.d == nil {
+		return nil, errors.New("no program has been launched")
+	}
+
+	switch req.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+
+	case "setExceptionBreakpoints":
+		return map[string]interface{}{}, nil
+
+	case "configurationDone":
+		s.d.Start()
+		go s.forwardEvents()
+		return nil, nil
+
+	case "threads":
+		return map[string][]Thread{"threads": {{ID: threadID, Name: "main"}}}, nil
+
+	case "stackTrace":
+		return s.stackTrace()
+
+	case "scopes":
+		var args ScopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopesFor(args.FrameID)
+
+	case "variables":
+		var args VariablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+
+	case "evaluate":
+		var args EvaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		value, err := s.d.Evaluate(args.Expression, args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": debugger.FormatValue(value), "variablesReference": 0}, nil
+
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.d.Continue()
+	case "next":
+		return nil, s.d.StepOver()
+	case "stepIn":
+		return nil, s.d.StepIn()
+	case "stepOut":
+		return nil, s.d.StepOut()
+	case "pause":
+		s.d.Pause()
+		return nil, nil
+
+	case "terminate", "disconnect":
+		if s.d != nil {
+			s.terminate()
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	if s.d != nil {
+		return errors.New("a program is already running")
+	}
+
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return fmt.Errorf("%s: %s", filepath.Base(args.Program), strings.Join(errs, "; "))
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		return fmt.Errorf("%s: %s", filepath.Base(args.Program), strings.Join(errs, "; "))
+	}
+
+	s.d = debugger.New(program, args.Program)
+	s.d.StopOnEntry = args.StopOnEntry
+	return nil
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) map[string][]Breakpoint {
+	specs := make([]debugger.BreakpointSpec, len(args.Breakpoints))
+	for idx, bp := range args.Breakpoints {
+		specs[idx] = debugger.BreakpointSpec{Line: bp.Line, Condition: bp.Condition}
+	}
+
+	result := []Breakpoint{}
+	for _, bp := range s.d.SetBreakpoints(args.Source.Path, specs) {
+		result = append(result, Breakpoint{
+			ID:       bp.ID,
+			Verified: bp.Verified,
+			Line:     bp.Line,
+			Message:  bp.Message,
+			Source:   source(bp.File),
+		})
+	}
+	return map[string][]Breakpoint{"breakpoints": result}
+}
+
+// terminate stops the program: straight away if it is paused, otherwise at
+// the next statement it reaches.
+func (s *Server) terminate() {
+	if s.d.Terminate() == nil {
+		return
+	}
+
+	s.state.Lock()
+	s.terminating = true
+	s.state.Unlock()
+	s.d.Pause()
+}
+
+// forwardEvents turns debugger events into DAP events until the program
+// finishes.
+func (s *Server) forwardEvents() {
+	for ev := range s.d.Events() {
+		if ev.Reason == debugger.ReasonExited {
+			s.exited(ev)
+			return
+		}
+
+		s.state.Lock()
+		terminating := s.terminating
+		s.state.Unlock()
+		if terminating {
+			s.d.Terminate()
+			continue
+		}
+
+		s.mu.Lock()
+		s.scopes = nil
+		s.mu.Unlock()
+
+		stopped := StoppedEvent{Reason: ev.Reason, ThreadID: threadID, AllThreadsStopped: true, Text: ev.Message}
+		if ev.Breakpoint != nil {
+			stopped.HitBreakpointIDs = []int{ev.Breakpoint.ID}
+		}
+		if ev.Message != "" {
+			s.output("console", ev.Message+"\n")
+		}
+		s.event("stopped", stopped)
+	}
+}
+
+func (s *Server) exited(ev debugger.Event) {
+	switch {
+	case ev.Err != nil:
+		s.output("stderr", "error: "+ev.Err.Error()+"\n")
+	case ev.Exited:
+		s.output("console", fmt.Sprintf("Program exited with value: %v\n", ev.ExitCode))
+	case ev.Result != nil:
+		s.output("console", fmt.Sprintf("Result: %v\n", ev.Result))
+	}
+
+	code := ev.ExitCode
+	if ev.Err != nil {
+		code = 1
+	}
+	s.event("exited", ExitedEvent{ExitCode: code})
+	s.event("terminated", nil)
+}
+
+func (s *Server) stackTrace() (interface{}, error) {
+	stack, err := s.d.Stack()
+	if err != nil {
+		return nil, err
+	}
+
+	frames := []StackFrame{}
+	for idx, frame := range stack {
+		name := frame.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		frames = append(frames, StackFrame{
+			ID:     idx,
+			Name:   name,
+			Source: source(frame.File),
+			Line:   frame.Pos.Line,
+			Column: frame.Pos.Column,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) scopesFor(frame int) (interface{}, error) {
+	scopes, err := s.d.Scopes(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Scope{}
+	for idx, scope := range scopes {
+		s.scopes = append(s.scopes, scopeRef{frame: frame, scope: idx})
+		result = append(result, Scope{
+			Name:               scope.Name,
+			VariablesReference: len(s.scopes),
+			Expensive:          scope.Name == "Globals",
+		})
+	}
+	return map[string][]Scope{"scopes": result}, nil
+}
+
+func (s *Server) variables(ref int) (interface{}, error) {
+	s.mu.Lock()
+	if ref < 1 || ref > len(s.scopes) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("unknown variables reference %d", ref)
+	}
+	sr := s.scopes[ref-1]
+	s.mu.Unlock()
+
+	scopes, err := s.d.Scopes(sr.frame)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := []Variable{}
+	for _, v := range scopes[sr.scope].Variables {
+		vars = append(vars, Variable{Name: v.Name, Value: v.Value})
+	}
+	return map[string][]Variable{"variables": vars}, nil
+}
+
+func source(file string) Source {
+	return Source{Name: filepath.Base(file), Path: file}
+}
@@ -0,0 +1,287 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const program = `gorlami square(n) {
+    var sq = n * n;
+    dicocco sq;
+}
+
+for (i in range(3)) {
+    var s = square(i);
+    var t = s + 1;
+}
+exit 7;
+`
+
+// client drives a server over pipes, as an editor would. Responses and
+// events are read as they come, in a goroutine of their own, since the
+// server sends events whenever the program stops.
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan reply
+	events   []reply // read while waiting for something else
+	seq      int
+	done     chan int
+	file     string // the program launched
+}
+
+// reply is a response or event as the client sees it, its body left for
+// the test to decode.
+type reply struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    *bool           `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func start(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, messages: make(chan reply, 100), done: make(chan int, 1)}
+
+	go func() {
+		c.done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(outR)
+		for {
+			header, err := textproto.NewReader(r).ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			body := make([]byte, length)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			var msg reply
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Errorf("%s: %v", body, err)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) read() reply {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server stopped writing")
+		}
+		return msg
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	panic("unreachable")
+}
+
+// request sends a request and waits for its response, decoding the body of
+// a successful one into body if it is not nil.
+func (c *client) request(command string, args interface{}, body interface{}) reply {
+	c.t.Helper()
+	c.seq++
+	raw, _ := json.Marshal(args)
+	msg, _ := json.Marshal(message{Seq: c.seq, Type: "request", Command: command, Arguments: raw})
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq {
+			c.t.Fatalf("response to request %d while waiting for %d", msg.RequestSeq, c.seq)
+		}
+		return c.decode(msg, body)
+	}
+}
+
+// event waits for the next event called name, skipping output.
+func (c *client) event(name string, body interface{}) reply {
+	c.t.Helper()
+	for {
+		var msg reply
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type == "event" && msg.Event == "output" && name != "output" {
+			continue
+		}
+		if msg.Type != "event" || msg.Event != name {
+			c.t.Fatalf("got %s %s%s, want a %s event", msg.Type, msg.Event, msg.Command, name)
+		}
+		return c.decode(msg, body)
+	}
+}
+
+// decode unpacks the body of r into body, unless body is nil or r is a
+// failed response.
+func (c *client) decode(r reply, body interface{}) reply {
+	c.t.Helper()
+	if body != nil && (r.Success == nil || *r.Success) {
+		if err := json.Unmarshal(r.Body, body); err != nil {
+			c.t.Fatalf("%s: %v", r.Body, err)
+		}
+	}
+	return r
+}
+
+func (c *client) ok(r reply) {
+	c.t.Helper()
+	if r.Success == nil || !*r.Success {
+		c.t.Fatalf("%s failed: %s", r.Command, r.Message)
+	}
+}
+
+// stopped waits for the program to stop and checks why and where.
+func (c *client) stopped(reason string, line int) StoppedEvent {
+	c.t.Helper()
+	var ev StoppedEvent
+	c.event("stopped", &ev)
+	var trace struct{ StackFrames []StackFrame }
+	c.ok(c.request("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace))
+	if ev.Reason != reason || len(trace.StackFrames) == 0 || trace.StackFrames[0].Line != line {
+		c.t.Fatalf("stopped (%s) at %+v, want line %d (%s)", ev.Reason, trace.StackFrames, line, reason)
+	}
+	return ev
+}
+
+func (c *client) evaluate(expr string) string {
+	c.t.Helper()
+	var result struct{ Result string }
+	c.ok(c.request("evaluate", EvaluateArguments{Expression: expr}, &result))
+	return result.Result
+}
+
+func (c *client) launch(stopOnEntry bool, breakpoints ...SourceBreakpoint) {
+	c.t.Helper()
+	c.file = filepath.Join(c.t.TempDir(), "main.salami")
+	if err := os.WriteFile(c.file, []byte(program), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var caps Capabilities
+	c.ok(c.request("initialize", map[string]string{"adapterID": "salami"}, &caps))
+	if !caps.SupportsConditionalBreakpoints {
+		c.t.Errorf("capabilities: got %+v", caps)
+	}
+	c.ok(c.request("launch", LaunchArguments{Program: c.file, StopOnEntry: stopOnEntry}, nil))
+	c.event("initialized", nil)
+	if breakpoints != nil {
+		var set struct{ Breakpoints []Breakpoint }
+		c.ok(c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: c.file}, Breakpoints: breakpoints}, &set))
+		for _, bp := range set.Breakpoints {
+			if !bp.Verified {
+				c.t.Errorf("breakpoint not verified: %+v", bp)
+			}
+		}
+	}
+	c.ok(c.request("configurationDone", nil, nil))
+}
+
+// finish waits for the program to exit 7, checks that it can no longer be
+// resumed and disconnects.
+func (c *client) finish() {
+	c.t.Helper()
+	var exited ExitedEvent
+	c.event("exited", &exited)
+	if exited.ExitCode != 7 {
+		c.t.Errorf("exit code: got %d, want 7", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	r := c.request("continue", map[string]int{"threadId": threadID}, nil)
+	if r.Success == nil || *r.Success || r.Message != "the program has ended" {
+		c.t.Errorf("continue after the end: got %+v, want an error saying the program has ended", r)
+	}
+
+	c.ok(c.request("disconnect", nil, nil))
+	if code := <-c.done; code != 0 {
+		c.t.Errorf("exit code %d after disconnect, want 0", code)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	c := start(t)
+	c.launch(false, SourceBreakpoint{Line: 2, Condition: "n > 0"}, SourceBreakpoint{Line: 8})
+
+	c.stopped("breakpoint", 8)
+	if got := c.evaluate("s + 10"); got != "10" {
+		t.Errorf("s + 10: got %s, want 10", got)
+	}
+	c.ok(c.request("continue", nil, nil))
+	ev := c.stopped("breakpoint", 2)
+	if len(ev.HitBreakpointIDs) != 1 {
+		t.Errorf("hit breakpoints: got %v, want the one on line 2", ev.HitBreakpointIDs)
+	}
+	if got := c.evaluate("n"); got != "1" {
+		t.Errorf("n: got %s, want 1", got)
+	}
+
+	var scopes struct{ Scopes []Scope }
+	c.ok(c.request("scopes", ScopesArguments{FrameID: 0}, &scopes))
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("scopes: got %+v", scopes.Scopes)
+	}
+	var vars struct{ Variables []Variable }
+	c.ok(c.request("variables", VariablesArguments{VariablesReference: scopes.Scopes[0].VariablesReference}, &vars))
+	if fmt.Sprint(vars.Variables) != fmt.Sprint([]Variable{{"n", "1", 0}, {"sq", "null", 0}}) {
+		t.Errorf("locals: got %+v", vars.Variables)
+	}
+
+	// Disable the breakpoints and run to the end.
+	c.ok(c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: c.file}}, nil))
+	c.ok(c.request("continue", nil, nil))
+	c.finish()
+}
+
+func TestStepping(t *testing.T) {
+	c := start(t)
+	c.launch(true)
+
+	c.stopped("entry", 1)
+	for _, step := range []struct {
+		command string
+		line    int
+	}{
+		{"next", 6},
+		{"next", 7},
+		{"stepIn", 2},
+		{"next", 3},
+		{"next", 7},
+		{"next", 8},
+		{"next", 7},
+		{"stepIn", 2},
+		{"stepOut", 7},
+	} {
+		c.ok(c.request(step.command, map[string]int{"threadId": threadID}, nil))
+		c.stopped("step", step.line)
+	}
+	c.ok(c.request("continue", nil, nil))
+	c.finish()
+}
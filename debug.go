@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/afoley/salami-lang/debugger"
+)
+
+const debugHelp = `commands:
+  break [file:]line [if cond]   set a breakpoint (b)
+  delete id                     remove a breakpoint (d)
+  breakpoints                   list breakpoints
+  continue                      run to the next breakpoint (c)
+  step                          step into calls (s)
+  next                          step over calls (n)
+  out                           run until the current function returns (o)
+  backtrace                     show the call stack (bt)
+  frame n                       select frame n for locals and print (f)
+  locals                        show the variables visible in the frame
+  print expr                    evaluate an expression (p)
+  list                          show source around the current line (l)
+  quit                          stop the program and exit (q)`
+
+// debugCommand runs a program under the terminal debugger. It stops before
+// the first statement so breakpoints can be set.
+func debugCommand(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	program, ok := parseFile(args[0])
+	if !ok {
+		os.Exit(1)
+	}
+
+	d := debugger.New(program, args[0])
+	d.StopOnEntry = true
+	d.Start()
+
+	t := &terminal{d: d, in: bufio.NewScanner(os.Stdin), sources: map[string][]string{}}
+	fmt.Println(`salami debugger, type "help" for commands`)
+
+	for ev := range d.Events() {
+		if ev.Reason == debugger.ReasonExited {
+			switch {
+			case ev.Err != nil:
+				fmt.Println("error:", ev.Err)
+			case ev.Exited || ev.Result != nil:
+				printResult(ev.Exited, ev.ExitCode, ev.Result)
+			}
+			return
+		}
+
+		t.frame = 0
+		t.stopped(ev)
+		t.prompt()
+	}
+}
+
+type terminal struct {
+	d       *debugger.Debugger
+	in      *bufio.Scanner
+	frame   int
+	sources map[string][]string
+}
+
+func (t *terminal) stopped(ev debugger.Event) {
+	where := fmt.Sprintf("%s:%d", filepath.Base(ev.File), ev.Pos.Line)
+	switch ev.Reason {
+	case debugger.ReasonBreakpoint:
+		fmt.Printf("breakpoint %d at %s\n", ev.Breakpoint.ID, where)
+	default:
+		fmt.Printf("stopped at %s (%s)\n", where, ev.Reason)
+	}
+	if ev.Message != "" {
+		fmt.Println("note:", ev.Message)
+	}
+	t.showLines(ev.File, ev.Pos.Line, 0)
+}
+
+// prompt reads commands until one of them resumes the program.
+func (t *terminal) prompt() {
+	for {
+		fmt.Print("(salami) ")
+		if !t.in.Scan() {
+			t.d.Terminate()
+			return
+		}
+
+		fields := strings.Fields(t.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t.in.Text()), fields[0]))
+
+		switch fields[0] {
+		case "continue", "c":
+			t.d.Continue()
+			return
+		case "step", "s":
+			t.d.StepIn()
+			return
+		case "next", "n":
+			t.d.StepOver()
+			return
+		case "out", "o":
+			t.d.StepOut()
+			return
+		case "quit", "q":
+			t.d.Terminate()
+			return
+		case "break", "b":
+			t.setBreakpoint(rest)
+		case "delete", "d":
+			id, err := strconv.Atoi(rest)
+			if err != nil || !t.d.RemoveBreakpoint(id) {
+				fmt.Printf("no breakpoint %q\n", rest)
+			}
+		case "breakpoints":
+			for _, bp := range t.d.Breakpoints() {
+				fmt.Println(describeBreakpoint(bp))
+			}
+		case "backtrace", "bt":
+			t.backtrace()
+		case "frame", "f":
+			t.selectFrame(rest)
+		case "locals":
+			t.locals()
+		case "print", "p":
+			value, err := t.d.Evaluate(rest, t.frame)
+			if err != nil {
+				fmt.Println("error:", err)
+				continue
+			}
+			fmt.Println(debugger.FormatValue(value))
+		case "list", "l":
+			if stack, err := t.d.Stack(); err == nil {
+				frame := stack[t.frame]
+				t.showLines(frame.File, frame.Pos.Line, 5)
+			}
+		case "help", "h":
+			fmt.Println(debugHelp)
+		default:
+			fmt.Printf("unknown command %q, type \"help\" for commands\n", fields[0])
+		}
+	}
+}
+
+func (t *terminal) setBreakpoint(arg string) {
+	spec := debugger.BreakpointSpec{}
+	if idx := strings.Index(arg, " if "); idx >= 0 {
+		spec.Condition = arg[idx+len(" if "):]
+		arg = strings.TrimSpace(arg[:idx])
+	}
+
+	file := t.d.File()
+	if idx := strings.LastIndex(arg, ":"); idx >= 0 {
+		file, arg = arg[:idx], arg[idx+1:]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(t.d.File()), file)
+		}
+	}
+
+	line, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Println("usage: break [file:]line [if cond]")
+		return
+	}
+
+	spec.Line = line
+	fmt.Println(describeBreakpoint(t.d.AddBreakpoint(file, spec)))
+}
+
+func describeBreakpoint(bp *debugger.Breakpoint) string {
+	s := fmt.Sprintf("breakpoint %d at %s:%d", bp.ID, filepath.Base(bp.File), bp.Line)
+	if bp.Condition != "" {
+		s += " if " + bp.Condition
+	}
+	if !bp.Verified {
+		s += " (not set: " + bp.Message + ")"
+	}
+	return s
+}
+
+func (t *terminal) backtrace() {
+	stack, err := t.d.Stack()
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	for idx, frame := range stack {
+		marker := " "
+		if idx == t.frame {
+			marker = "*"
+		}
+		name := frame.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Printf("%s #%d %s at %s:%d\n", marker, idx, name, filepath.Base(frame.File), frame.Pos.Line)
+	}
+}
+
+func (t *terminal) selectFrame(arg string) {
+	stack, err := t.d.Stack()
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 || n >= len(stack) {
+		fmt.Printf("no frame %q\n", arg)
+		return
+	}
+	t.frame = n
+	t.backtrace()
+}
+
+func (t *terminal) locals() {
+	scopes, err := t.d.Scopes(t.frame)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	for _, scope := range scopes {
+		fmt.Printf("%s:\n", scope.Name)
+		for _, v := range scope.Variables {
+			fmt.Printf("  %s = %s\n", v.Name, v.Value)
+		}
+	}
+}
+
+// showLines prints line from file with context lines either side of it.
+func (t *terminal) showLines(file string, line, context int) {
+	lines, ok := t.sources[file]
+	if !ok {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return
+		}
+		lines = strings.Split(string(src), "\n")
+		t.sources[file] = lines
+	}
+
+	for n := line - context; n <= line+context; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		marker := "  "
+		if n == line {
+			marker = "=>"
+		}
+		fmt.Printf("%s %4d  %s\n", marker, n, lines[n-1])
+	}
+}
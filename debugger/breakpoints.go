@@ -0,0 +1,201 @@
+package debugger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+// Breakpoint pauses the program before the first statement on Line. With a
+// Condition it only pauses when the condition evaluates to true.
+type Breakpoint struct {
+	ID        int
+	File      string
+	Line      int
+	Condition string
+
+	// Verified is false when no statement starts on or after the requested
+	// line, or the condition does not parse; Message says why.
+	Verified bool
+	Message  string
+
+	cond ast.Expression
+}
+
+// BreakpointSpec is a requested breakpoint.
+type BreakpointSpec struct {
+	Line      int
+	Condition string
+}
+
+// SetBreakpoints replaces every breakpoint in file. A breakpoint on a line
+// with no statement moves down to the next line that has one.
+func (d *Debugger) SetBreakpoints(file string, specs []BreakpointSpec) []*Breakpoint {
+	file = d.absolute(file)
+	lines := d.statementLines(file)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bps := []*Breakpoint{}
+	for _, spec := range specs {
+		bps = append(bps, d.newBreakpoint(file, spec, lines))
+	}
+	d.breakpoints[file] = bps
+	return bps
+}
+
+// AddBreakpoint adds a single breakpoint to file.
+func (d *Debugger) AddBreakpoint(file string, spec BreakpointSpec) *Breakpoint {
+	file = d.absolute(file)
+	lines := d.statementLines(file)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bp := d.newBreakpoint(file, spec, lines)
+	d.breakpoints[file] = append(d.breakpoints[file], bp)
+	return bp
+}
+
+// RemoveBreakpoint deletes the breakpoint with the given ID and reports
+// whether there was one.
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for file, bps := range d.breakpoints {
+		for idx, bp := range bps {
+			if bp.ID == id {
+				d.breakpoints[file] = append(bps[:idx:idx], bps[idx+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Breakpoints returns every breakpoint, ordered by ID.
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	all := []*Breakpoint{}
+	for _, bps := range d.breakpoints {
+		all = append(all, bps...)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].ID < all[b].ID })
+	return all
+}
+
+func (d *Debugger) newBreakpoint(file string, spec BreakpointSpec, lines []int) *Breakpoint {
+	d.nextID++
+	bp := &Breakpoint{ID: d.nextID, File: file, Line: spec.Line, Condition: strings.TrimSpace(spec.Condition)}
+
+	if lines == nil {
+		bp.Message = "cannot read " + filepath.Base(file)
+		return bp
+	}
+
+	idx := sort.SearchInts(lines, spec.Line)
+	if idx == len(lines) {
+		bp.Message = fmt.Sprintf("no statement on or after line %d", spec.Line)
+		return bp
+	}
+	bp.Line = lines[idx]
+
+	if bp.Condition != "" {
+		cond, err := parseExpression(bp.Condition)
+		if err != nil {
+			bp.Message = "bad condition: " + err.Error()
+			return bp
+		}
+		bp.cond = cond
+	}
+
+	bp.Verified = true
+	return bp
+}
+
+// breakpointAt returns the breakpoint that should pause frame at its
+// current line, along with a note if its condition failed to evaluate.
+func (d *Debugger) breakpointAt(frame *interpreter.Frame) (*Breakpoint, string) {
+	d.mu.Lock()
+	var hit []*Breakpoint
+	for _, bp := range d.breakpoints[frame.File] {
+		if bp.Verified && bp.Line == frame.Pos.Line {
+			hit = append(hit, bp)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, bp := range hit {
+		if bp.cond == nil {
+			return bp, ""
+		}
+
+		value, err := d.evaluate(bp.cond, frame.Env)
+		if err != nil {
+			return bp, fmt.Sprintf("condition %q failed: %s", bp.Condition, err)
+		}
+		if b, ok := value.(bool); !ok {
+			return bp, fmt.Sprintf("condition %q is %s, not a boolean", bp.Condition, FormatValue(value))
+		} else if b {
+			return bp, ""
+		}
+	}
+	return nil, ""
+}
+
+func (d *Debugger) absolute(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// statementLines returns the sorted lines on which a statement starts in
+// file, or nil if it cannot be read or parsed.
+func (d *Debugger) statementLines(file string) []int {
+	program := d.program
+	if file != d.interp.File {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+		program = p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return nil
+		}
+	}
+
+	seen := map[int]bool{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		var stmts []ast.Statement
+		switch n := n.(type) {
+		case *ast.Program:
+			stmts = n.Statements
+		case *ast.BlockStatement:
+			stmts = n.Statements
+		}
+		for _, stmt := range stmts {
+			seen[stmt.Pos().Line] = true
+		}
+		return true
+	})
+
+	lines := []int{}
+	for line := range seen {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
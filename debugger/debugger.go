@@ -0,0 +1,271 @@
+// Package debugger pauses a running interpreter at statement boundaries.
+// It implements line and conditional breakpoints, stepping in, over and out
+// of calls, and inspection of the call stack and variables. The terminal
+// front end (salami debug) and the Debug Adapter Protocol server (package
+// dap) are both built on it.
+package debugger
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// Reasons an Event is sent.
+const (
+	ReasonEntry      = "entry"
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+	ReasonPause      = "pause"
+	ReasonExited     = "exited"
+)
+
+// Event reports that the program stopped, either paused at a statement or
+// finished. After ReasonExited no more events are sent.
+type Event struct {
+	Reason     string
+	File       string
+	Pos        tok.Position
+	Breakpoint *Breakpoint
+	Message    string // why a conditional breakpoint could not be checked
+
+	// Set when Reason is ReasonExited.
+	Result   interface{}
+	Exited   bool
+	ExitCode int64
+	Err      error
+}
+
+type stepMode int
+
+const (
+	running stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+type command struct {
+	mode      stepMode
+	terminate bool
+}
+
+// Errors from the methods that need the program to be paused.
+var (
+	ErrRunning = errors.New("the program is running")
+	ErrEnded   = errors.New("the program has ended")
+)
+
+// Debugger drives one run of a program. Create it with New, set any
+// breakpoints, call Start and then read Events. While the program is paused
+// Stack, Scopes and Evaluate may be called; Continue and the Step methods
+// resume it.
+type Debugger struct {
+	StopOnEntry bool
+
+	interp  *interpreter.Interpreter
+	program *ast.Program
+
+	mu          sync.Mutex
+	breakpoints map[string][]*Breakpoint
+	nextID      int
+	pause       bool
+
+	events   chan Event
+	commands chan command
+	paused   bool
+	ended    bool
+
+	// stepping state, only touched by the interpreter goroutine: the mode
+	// and the call stack when the program was last resumed
+	mode      stepMode
+	stack     []*interpreter.Frame
+	lastFrame *interpreter.Frame
+	lastLine  int
+}
+
+// New prepares program, which must have been parsed and resolved, to run
+// under the debugger. file is the path the program was read from.
+func New(program *ast.Program, file string) *Debugger {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	interp := interpreter.New()
+	interp.File = file
+
+	d := &Debugger{
+		interp:      interp,
+		program:     program,
+		breakpoints: map[string][]*Breakpoint{},
+		events:      make(chan Event),
+		commands:    make(chan command),
+	}
+	interp.Hook = d
+	return d
+}
+
+// File returns the absolute path of the program being debugged.
+func (d *Debugger) File() string {
+	return d.interp.File
+}
+
+// Events delivers a stop event each time the program pauses, then a final
+// ReasonExited event, after which it is closed.
+func (d *Debugger) Events() <-chan Event {
+	return d.events
+}
+
+// Start runs the program in the background.
+func (d *Debugger) Start() {
+	if d.StopOnEntry {
+		d.mode = stepIn
+	}
+
+	go func() {
+		defer close(d.events)
+
+		result, err := d.interp.Run(d.program)
+		if errors.Is(err, errTerminated) {
+			err = nil
+		}
+		d.mu.Lock()
+		d.ended = true
+		d.mu.Unlock()
+		d.events <- Event{
+			Reason:   ReasonExited,
+			File:     d.interp.File,
+			Result:   result,
+			Exited:   d.interp.Exited,
+			ExitCode: d.interp.ExitCode,
+			Err:      err,
+		}
+	}()
+}
+
+// Continue resumes until the next breakpoint.
+func (d *Debugger) Continue() error { return d.resume(command{mode: running}) }
+
+// StepIn resumes until the next statement, entering any function called.
+func (d *Debugger) StepIn() error { return d.resume(command{mode: stepIn}) }
+
+// StepOver resumes until the next statement in the current function or one
+// of its callers.
+func (d *Debugger) StepOver() error { return d.resume(command{mode: stepOver}) }
+
+// StepOut resumes until the current function returns to its caller.
+func (d *Debugger) StepOut() error { return d.resume(command{mode: stepOut}) }
+
+// Terminate stops a paused program. Its final event reports no error.
+func (d *Debugger) Terminate() error { return d.resume(command{terminate: true}) }
+
+// Pause asks a running program to stop at its next statement.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	d.pause = true
+	d.mu.Unlock()
+}
+
+func (d *Debugger) resume(cmd command) error {
+	if err := d.checkPaused(); err != nil {
+		return err
+	}
+
+	d.commands <- cmd
+	return nil
+}
+
+var errTerminated = &interpreter.RuntimeError{Message: "terminated by the debugger"}
+
+// Statement implements interpreter.Hook. It runs on the interpreter's
+// goroutine and blocks there while the program is paused.
+func (d *Debugger) Statement(i *interpreter.Interpreter, stmt ast.Statement) {
+	frames := i.Frames()
+	frame := frames[len(frames)-1]
+
+	// Several statements on one line are a single stop, as far as breakpoints
+	// and stepping are concerned.
+	if frame == d.lastFrame && frame.Pos.Line == d.lastLine {
+		return
+	}
+	d.lastFrame, d.lastLine = frame, frame.Pos.Line
+
+	event := Event{File: frame.File, Pos: frame.Pos}
+
+	switch {
+	case d.takePause():
+		event.Reason = ReasonPause
+	case d.mode == stepIn,
+		d.mode == stepOver && d.inStack(frames, len(d.stack)),
+		d.mode == stepOut && d.inStack(frames, len(d.stack)-1):
+		event.Reason = ReasonStep
+		if d.StopOnEntry {
+			event.Reason = ReasonEntry
+			d.StopOnEntry = false
+		}
+	}
+
+	if bp, msg := d.breakpointAt(frame); bp != nil {
+		event.Reason, event.Breakpoint, event.Message = ReasonBreakpoint, bp, msg
+	}
+
+	if event.Reason != "" {
+		d.stop(frames, event)
+	}
+}
+
+// Returned implements interpreter.Hook. Stepping out of a function, or over
+// or into its last statement, stops back in the caller as soon as the call
+// returns rather than at the caller's next statement.
+func (d *Debugger) Returned(i *interpreter.Interpreter) {
+	frames := i.Frames()
+	frame := frames[len(frames)-1]
+
+	if d.mode == running || len(frames) >= len(d.stack) || !d.inStack(frames, len(frames)) {
+		return
+	}
+
+	d.lastFrame, d.lastLine = frame, frame.Pos.Line
+	d.stop(frames, Event{Reason: ReasonStep, File: frame.File, Pos: frame.Pos})
+}
+
+// inStack reports whether the innermost frame is one of the outermost max
+// frames that were active when the program was resumed, meaning the step
+// has not wandered into some other call.
+func (d *Debugger) inStack(frames []*interpreter.Frame, max int) bool {
+	depth := len(frames)
+	return depth <= max && d.stack[depth-1] == frames[depth-1]
+}
+
+func (d *Debugger) takePause() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pause := d.pause
+	d.pause = false
+	return pause
+}
+
+// stop reports event and blocks until a front end resumes the program.
+func (d *Debugger) stop(frames []*interpreter.Frame, event Event) {
+	d.mu.Lock()
+	d.paused = true
+	d.mu.Unlock()
+
+	d.events <- event
+	cmd := <-d.commands
+
+	d.mu.Lock()
+	d.paused = false
+	d.mu.Unlock()
+
+	if cmd.terminate {
+		panic(errTerminated)
+	}
+	d.mode = cmd.mode
+	d.stack = append(d.stack[:0], frames...)
+}
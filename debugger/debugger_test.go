@@ -0,0 +1,211 @@
+package debugger_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afoley/salami-lang/debugger"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+const program = `gorlami square(n) {
+    var sq = n * n;
+    dicocco sq;
+}
+
+for (i in range(3)) {
+    var s = square(i);
+    var t = s + 1;
+}
+exit 7;
+`
+
+// load writes program to a file and prepares it to run under a debugger.
+func load(t *testing.T) *debugger.Debugger {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "main.salami")
+	if err := os.WriteFile(file, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.NewLexer(strings.NewReader(program)))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	if errs := resolver.Resolve(prog); len(errs) != 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+	return debugger.New(prog, file)
+}
+
+func next(t *testing.T, d *debugger.Debugger) debugger.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-d.Events():
+		if !ok {
+			t.Fatal("no more events")
+		}
+		return ev
+	case <-time.After(10 * time.Second):
+		t.Fatal("the program did not stop")
+	}
+	panic("unreachable")
+}
+
+// stopAt waits for the program to stop and checks where and why.
+func stopAt(t *testing.T, d *debugger.Debugger, reason string, line int) debugger.Event {
+	t.Helper()
+	ev := next(t, d)
+	if ev.Reason != reason || ev.Pos.Line != line {
+		t.Fatalf("stopped at line %d (%s), want line %d (%s)", ev.Pos.Line, ev.Reason, line, reason)
+	}
+	return ev
+}
+
+func eval(t *testing.T, d *debugger.Debugger, src string) string {
+	t.Helper()
+	value, err := d.Evaluate(src, 0)
+	if err != nil {
+		t.Fatalf("evaluate %s: %v", src, err)
+	}
+	return debugger.FormatValue(value)
+}
+
+// exits checks that the program ends with exit 7, after which it cannot be
+// resumed or inspected.
+func exits(t *testing.T, d *debugger.Debugger) {
+	t.Helper()
+	ev := next(t, d)
+	if ev.Reason != debugger.ReasonExited || !ev.Exited || ev.ExitCode != 7 || ev.Err != nil {
+		t.Fatalf("got %+v, want exit 7", ev)
+	}
+	if err := d.Continue(); err != debugger.ErrEnded {
+		t.Errorf("continue after the end: got %v, want %v", err, debugger.ErrEnded)
+	}
+	if _, err := d.Stack(); err != debugger.ErrEnded {
+		t.Errorf("stack after the end: got %v, want %v", err, debugger.ErrEnded)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := load(t)
+	bps := d.SetBreakpoints(d.File(), []debugger.BreakpointSpec{{Line: 2}, {Line: 4}, {Line: 40}})
+	if !bps[0].Verified || bps[0].Line != 2 {
+		t.Errorf("breakpoint on a statement: got %+v", bps[0])
+	}
+	if !bps[1].Verified || bps[1].Line != 6 {
+		t.Errorf("breakpoint on a line without a statement: got %+v, want it moved to line 6", bps[1])
+	}
+	if bps[2].Verified || bps[2].Message != "no statement on or after line 40" {
+		t.Errorf("breakpoint past the end: got %+v", bps[2])
+	}
+
+	d.Start()
+	stopAt(t, d, debugger.ReasonBreakpoint, 6)
+	for n := 0; n < 3; n++ {
+		if err := d.Continue(); err != nil {
+			t.Fatal(err)
+		}
+		ev := stopAt(t, d, debugger.ReasonBreakpoint, 2)
+		if ev.Breakpoint != bps[0] {
+			t.Errorf("hit %+v, want the breakpoint on line 2", ev.Breakpoint)
+		}
+		if got, want := eval(t, d, "n"), []string{"0", "1", "2"}[n]; got != want {
+			t.Errorf("n on call %d: got %s, want %s", n+1, got, want)
+		}
+	}
+
+	stack, err := d.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stack) != 2 || stack[0].Name != "square" || stack[1].Pos.Line != 7 {
+		t.Errorf("stack: got %d frames, innermost %q, want square called from line 7", len(stack), stack[0].Name)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	exits(t, d)
+}
+
+func TestConditionalBreakpoints(t *testing.T) {
+	d := load(t)
+	d.SetBreakpoints(d.File(), []debugger.BreakpointSpec{{Line: 8, Condition: "i > 0"}, {Line: 3, Condition: "sq > 1"}})
+	bad := d.AddBreakpoint(d.File(), debugger.BreakpointSpec{Line: 2, Condition: "n >"})
+	if bad.Verified || !strings.HasPrefix(bad.Message, "bad condition") {
+		t.Errorf("condition that does not parse: got %+v", bad)
+	}
+
+	d.Start()
+	stopAt(t, d, debugger.ReasonBreakpoint, 8)
+	if got := eval(t, d, "s"); got != "1" {
+		t.Errorf("s: got %s, want 1", got)
+	}
+	d.Continue()
+	stopAt(t, d, debugger.ReasonBreakpoint, 3)
+	if got := eval(t, d, "sq"); got != "4" {
+		t.Errorf("sq: got %s, want 4", got)
+	}
+	d.Continue()
+	stopAt(t, d, debugger.ReasonBreakpoint, 8)
+	if got := eval(t, d, "s"); got != "4" {
+		t.Errorf("s: got %s, want 4", got)
+	}
+	d.Continue()
+	exits(t, d)
+}
+
+// A condition that is not a boolean stops the program and says why.
+func TestBreakpointConditionNotBoolean(t *testing.T) {
+	d := load(t)
+	d.SetBreakpoints(d.File(), []debugger.BreakpointSpec{{Line: 2, Condition: "n + 1"}})
+	d.Start()
+	ev := stopAt(t, d, debugger.ReasonBreakpoint, 2)
+	if ev.Message != `condition "n + 1" is 1, not a boolean` {
+		t.Errorf("got message %q", ev.Message)
+	}
+	d.Terminate()
+	if ev := next(t, d); ev.Reason != debugger.ReasonExited || ev.Exited || ev.Err != nil {
+		t.Errorf("after terminate: got %+v, want a quiet end", ev)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	d := load(t)
+	d.StopOnEntry = true
+	d.Start()
+
+	stopAt(t, d, debugger.ReasonEntry, 1)
+	steps := []struct {
+		step func() error
+		line int
+	}{
+		{d.StepIn, 6},
+		{d.StepIn, 7},
+		{d.StepIn, 2}, // into square
+		{d.StepOver, 3},
+		{d.StepOver, 7}, // back in the caller once square returns
+		{d.StepOver, 8},
+		{d.StepOver, 7}, // over the call to square
+		{d.StepOver, 8},
+		{d.StepIn, 7},
+		{d.StepIn, 2},
+		{d.StepOut, 7},
+		{d.StepOut, 0},
+	}
+	for _, s := range steps {
+		if err := s.step(); err != nil {
+			t.Fatal(err)
+		}
+		if s.line == 0 {
+			break
+		}
+		stopAt(t, d, debugger.ReasonStep, s.line)
+	}
+	exits(t, d)
+}
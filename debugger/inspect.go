@@ -0,0 +1,202 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+// Scope is one level of the environment chain visible from a frame.
+type Scope struct {
+	Name      string // "Locals", "Closure" or "Globals"
+	Variables []Variable
+}
+
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// Stack returns the active calls, innermost first.
+func (d *Debugger) Stack() ([]*interpreter.Frame, error) {
+	if err := d.checkPaused(); err != nil {
+		return nil, err
+	}
+
+	frames := d.interp.Frames()
+	stack := make([]*interpreter.Frame, len(frames))
+	for idx, frame := range frames {
+		stack[len(frames)-1-idx] = frame
+	}
+	return stack, nil
+}
+
+// Scopes returns the variables visible from frame n of Stack, innermost
+// scope first.
+func (d *Debugger) Scopes(n int) ([]Scope, error) {
+	frame, err := d.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []Scope{}
+	for env := frame.Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case env == frame.Env:
+			name = "Locals"
+		}
+
+		scope := Scope{Name: name, Variables: []Variable{}}
+		for idx, varName := range env.Names {
+			scope.Variables = append(scope.Variables, Variable{
+				Name:  varName,
+				Value: FormatValue(env.Get(0, idx)),
+			})
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// Evaluate evaluates src as an expression in frame n of Stack.
+func (d *Debugger) Evaluate(src string, n int) (interface{}, error) {
+	frame, err := d.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := parseExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	return d.evaluate(expr, frame.Env)
+}
+
+func (d *Debugger) evaluate(expr ast.Expression, env *interpreter.Environment) (interface{}, error) {
+	if err := bind(expr, env); err != nil {
+		return nil, err
+	}
+	return d.interp.Evaluate(expr, env)
+}
+
+func (d *Debugger) frame(n int) (*interpreter.Frame, error) {
+	stack, err := d.Stack()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= len(stack) {
+		return nil, fmt.Errorf("no frame %d", n)
+	}
+	return stack[n], nil
+}
+
+// checkPaused returns ErrRunning or ErrEnded unless the program is paused.
+func (d *Debugger) checkPaused() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case d.paused:
+		return nil
+	case d.ended:
+		return ErrEnded
+	}
+	return ErrRunning
+}
+
+func parseExpression(src string) (ast.Expression, error) {
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	expr := p.ParseExpression()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, errors.New(errs[0])
+	}
+	return expr, nil
+}
+
+// bind resolves the identifiers in expr by name against env and its outer
+// scopes, the way the resolver would have had the expression been written
+// at that point in the program.
+func bind(expr ast.Expression, env *interpreter.Environment) error {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		depth := 0
+		for e := env; e != nil; e = e.Outer() {
+			for idx, name := range e.Names {
+				if name == expr.Value {
+					expr.Depth, expr.Index, expr.Resolved = depth, idx, true
+					return nil
+				}
+			}
+			depth++
+		}
+		return fmt.Errorf("%s is not defined here", expr.Value)
+
+	case *ast.InfixExpression:
+		if err := bind(expr.Left, env); err != nil {
+			return err
+		}
+		return bind(expr.Right, env)
+
+	case *ast.CallExpression:
+		if err := bind(expr.Function, env); err != nil {
+			return err
+		}
+		for _, arg := range expr.Arguments {
+			if err := bind(arg, env); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.MemberExpression:
+		return bind(expr.Object, env)
+
+	case *ast.NamedArgument:
+		return bind(expr.Value, env)
+
+	case *ast.SpreadExpression:
+		return bind(expr.Value, env)
+
+	case *ast.ArrayLiteral:
+		for _, e := range expr.Elements {
+			if err := bind(e, env); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.HashLiteral:
+		for idx := range expr.Keys {
+			if err := bind(expr.Keys[idx], env); err != nil {
+				return err
+			}
+			if err := bind(expr.Values[idx], env); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.IndexExpression:
+		if err := bind(expr.Left, env); err != nil {
+			return err
+		}
+		return bind(expr.Index, env)
+
+	case *ast.FunctionLiteral, *ast.IfExpression, *ast.MatchExpression:
+		return errors.New("only simple expressions can be evaluated in the debugger")
+	}
+	return nil
+}
+
+// FormatValue renders a runtime value the way the debugger shows it.
+func FormatValue(v interface{}) string {
+	return interpreter.Inspect(v)
+}
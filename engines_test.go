@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/testrunner"
+	"github.com/afoley/salami-lang/vm"
+)
+
+// slowExamples take seconds on each engine.
+var slowExamples = map[string]bool{
+	"countdown.salami":        true,
+	"mutual_recursion.salami": true,
+}
+
+// examplePaths returns the example programs, skipping the slow ones with
+// -short.
+func examplePaths(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob("examples/*.salami")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	paths = append(paths, "examples/modules/main.salami")
+	if !testing.Short() {
+		return paths
+	}
+	var fast []string
+	for _, path := range paths {
+		if !slowExamples[filepath.Base(path)] {
+			fast = append(fast, path)
+		}
+	}
+	return fast
+}
+
+// exampleSource returns the source of the example at path. A test file
+// runs its tests too, in a last statement whose value is what each of
+// them returned or the message of the error it failed with.
+func exampleSource(t *testing.T, path string) string {
+	t.Helper()
+	src := exampleFile(t, path)
+	if strings.HasSuffix(path, "_test.salami") {
+		var calls []string
+		for _, fn := range testrunner.Tests(parseSource(t, src)) {
+			calls = append(calls, "run_example_test("+fn.Name.Value+")")
+		}
+		src += `
+gorlami run_example_test(test) {
+    try {
+        dicocco test();
+    } catch (e) {
+        dicocco e.message;
+    }
+}
+[` + strings.Join(calls, ", ") + "];\n"
+	}
+	return src
+}
+
+// TestEnginesAgree runs every example on the interpreter and the VM and
+// checks that the two end it the same way.
+func TestEnginesAgree(t *testing.T) {
+	for _, path := range examplePaths(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src := exampleSource(t, path)
+			interp := outcome(t, "interp", path, src, false)
+			machine := outcome(t, "vm", path, src, false)
+			if interp != machine {
+				t.Errorf("the engines disagree\ninterp: %s\nvm:     %s", interp, machine)
+			}
+		})
+	}
+}
+
+func BenchmarkInterpFib(b *testing.B) {
+	program := parseSource(b, exampleFile(b, "examples/fib.salami"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		interp := interpreter.New()
+		if _, err := interp.Run(program); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVMFib(b *testing.B) {
+	path := "examples/fib.salami"
+	bytecode, err := compileProgram(path, parseSource(b, exampleFile(b, path)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine, err := vm.New(bytecode)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := machine.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func exampleFile(tb testing.TB, path string) string {
+	tb.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(data)
+}
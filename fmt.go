@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/afoley/salami-lang/format"
+)
+
+// fmtCommand prints a program in the canonical layout, or rewrites the file
+// in place with -w.
+func fmtCommand(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result back to the source file")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	program, ok := parseFile(fs.Arg(0))
+	if !ok {
+		os.Exit(1)
+	}
+
+	out := format.Source(program)
+	if !*write {
+		fmt.Print(out)
+		return
+	}
+
+	if err := os.WriteFile(fs.Arg(0), []byte(out), 0644); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,682 @@
+// Package format prints a salami syntax tree back out as source code in
+// the canonical layout: four space indentation, one statement per line and
+// a blank line around top level gorlami declarations. Blank lines the
+// author left between statements are kept, though never more than one.
+package format
+
+import (
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/tok"
+)
+
+const indent = "    "
+
+type printer struct {
+	buf   strings.Builder
+	depth int
+
+	comments []tok.Comment // not yet printed, in source order
+
+	// the source line the last statement or comment printed ended on, or
+	// 0 at the start of a block, where no blank line goes
+	last int
+}
+
+// Source returns the formatted source of program. Comments on a line of
+// their own stay before the statement that follows them; a comment after
+// code stays at the end of that line. A list with a comment inside it is
+// printed one item per line, so that its comments stay by their items.
+func Source(program *ast.Program) string {
+	p := &printer{comments: program.Comments}
+
+	for idx, stmt := range program.Statements {
+		if idx > 0 && (separated(stmt) || separated(program.Statements[idx-1])) {
+			p.buf.WriteString("\n")
+			p.last = 0
+		}
+		p.statement(stmt)
+	}
+	p.commentsBefore(tok.Position{Line: 1 << 30})
+
+	return p.buf.String()
+}
+
+// Node returns the formatted source of a single statement or expression.
+func Node(node ast.Node) string {
+	p := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		return Source(node)
+	case ast.Statement:
+		p.statement(node)
+		return strings.TrimSuffix(p.buf.String(), "\n")
+	case ast.Expression:
+		p.expression(node)
+	}
+	return p.buf.String()
+}
+
+func separated(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.FunctionStatement, *ast.StructStatement, *ast.EnumStatement:
+		return true
+	case *ast.ExportStatement:
+		return separated(stmt.Declaration)
+	}
+	return false
+}
+
+func (p *printer) line(parts ...string) {
+	p.buf.WriteString(strings.Repeat(indent, p.depth))
+	for _, s := range parts {
+		p.buf.WriteString(s)
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	start := ast.Start(stmt)
+	p.commentsBefore(start)
+	p.space(start.Line)
+	p.line()
+	p.statementBody(stmt)
+	p.last = ast.End(stmt).Line
+	p.trailingComment(p.last)
+	p.buf.WriteString("\n")
+}
+
+// space prints a blank line if the source had one or more between what
+// was printed last and line.
+func (p *printer) space(line int) {
+	if p.last > 0 && line > p.last+1 {
+		p.buf.WriteString("\n")
+	}
+}
+
+// commentsBefore prints, each on its own line, the comments that come
+// before pos.
+func (p *printer) commentsBefore(pos tok.Position) {
+	for len(p.comments) > 0 && before(p.comments[0].Pos, pos) {
+		p.space(p.comments[0].Pos.Line)
+		p.line(p.comments[0].Text + "\n")
+		p.last = p.comments[0].Pos.Line
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailingComment appends the next comment to the current line if it is on
+// source line line, the line the code just printed ended on.
+func (p *printer) trailingComment(line int) {
+	if len(p.comments) > 0 && p.comments[0].Pos.Line == line {
+		p.buf.WriteString(" " + p.comments[0].Text)
+		p.comments = p.comments[1:]
+	}
+}
+
+func before(a, b tok.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// statementBody prints stmt from the current column without the leading
+// indent or trailing newline.
+func (p *printer) statementBody(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VarStatement:
+		p.buf.WriteString("var " + stmt.Name.Value)
+		if stmt.Type != nil {
+			p.buf.WriteString(": " + stmt.Type.String())
+		}
+		p.buf.WriteString(" = ")
+		p.expression(stmt.Value)
+		p.buf.WriteString(";")
+
+	case *ast.FunctionStatement:
+		p.buf.WriteString("gorlami ")
+		if stmt.Receiver != nil {
+			p.buf.WriteString("(" + stmt.Receiver.Value + " " + stmt.ReceiverType.Value + ") ")
+		}
+		p.buf.WriteString(stmt.Name.Value)
+		p.signature(stmt.Parameters, stmt.ReturnType)
+		p.buf.WriteString(" ")
+		p.block(stmt.Body)
+
+	case *ast.StructStatement:
+		items := make([]item, len(stmt.Fields))
+		for idx, f := range stmt.Fields {
+			field := f
+			items[idx] = item{field.Pos(), ast.End(field), func() { p.buf.WriteString(field.Value) }}
+		}
+		if start := ast.End(stmt.Name); p.commentBetween(start, stmt.End, items) {
+			p.buf.WriteString("struct " + stmt.Name.Value + " ")
+			p.list("{", "}", start, stmt.End, items)
+			break
+		}
+
+		fields := make([]string, len(stmt.Fields))
+		for idx, f := range stmt.Fields {
+			fields[idx] = f.Value
+		}
+		if len(fields) == 0 {
+			p.buf.WriteString("struct " + stmt.Name.Value + " {}")
+		} else {
+			p.buf.WriteString("struct " + stmt.Name.Value + " { " + strings.Join(fields, ", ") + " }")
+		}
+
+	case *ast.EnumStatement:
+		variants := make([]string, len(stmt.Variants))
+		items := make([]item, len(stmt.Variants))
+		for idx, v := range stmt.Variants {
+			variants[idx] = v.Name.Value
+			if v.Fields != nil {
+				fields := make([]string, len(v.Fields))
+				for fidx, f := range v.Fields {
+					fields[fidx] = f.Value
+				}
+				variants[idx] += "(" + strings.Join(fields, ", ") + ")"
+			}
+			variant := variants[idx]
+			items[idx] = item{v.Pos(), ast.End(v), func() { p.buf.WriteString(variant) }}
+		}
+		if start := ast.End(stmt.Name); p.commentBetween(start, stmt.End, items) {
+			p.buf.WriteString("enum " + stmt.Name.Value + " ")
+			p.list("{", "}", start, stmt.End, items)
+			break
+		}
+		p.buf.WriteString("enum " + stmt.Name.Value + " { " + strings.Join(variants, ", ") + " }")
+
+	case *ast.AssignStatement:
+		p.expression(stmt.Target)
+		p.buf.WriteString(" = ")
+		p.expression(stmt.Value)
+		p.buf.WriteString(";")
+
+	case *ast.ReturnStatement:
+		p.buf.WriteString("dicocco ")
+		p.expression(stmt.ReturnValue)
+		p.buf.WriteString(";")
+
+	case *ast.ExitStatement:
+		p.buf.WriteString("exit ")
+		p.expression(stmt.Value)
+		p.buf.WriteString(";")
+
+	case *ast.ThrowStatement:
+		p.buf.WriteString("throw ")
+		p.expression(stmt.Value)
+		p.buf.WriteString(";")
+
+	case *ast.YieldStatement:
+		p.buf.WriteString("yield ")
+		p.expression(stmt.Value)
+		p.buf.WriteString(";")
+
+	case *ast.ForStatement:
+		p.buf.WriteString("for (" + stmt.Name.Value + " in ")
+		p.expression(stmt.Iterable)
+		p.buf.WriteString(") ")
+		p.block(stmt.Body)
+
+	case *ast.TryStatement:
+		p.buf.WriteString("try ")
+		p.block(stmt.Body)
+		if stmt.Catch != nil {
+			p.buf.WriteString(" catch (" + stmt.Param.Value + ") ")
+			p.block(stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			p.buf.WriteString(" finally ")
+			p.block(stmt.Finally)
+		}
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		if _, ok := stmt.Expression.(*ast.MatchExpression); !ok {
+			p.buf.WriteString(";")
+		}
+
+	case *ast.IfExpression:
+		p.ifExpression(stmt)
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+
+	case *ast.ImportStatement:
+		p.buf.WriteString("import " + quote(stmt.Path.Value) + " as " + stmt.Alias.Value + ";")
+
+	case *ast.ExportStatement:
+		p.buf.WriteString("export ")
+		p.statementBody(stmt.Declaration)
+	}
+}
+
+func (p *printer) ifExpression(ie *ast.IfExpression) {
+	p.buf.WriteString("if (")
+	p.expression(ie.Condition)
+	p.buf.WriteString(") ")
+	p.block(ie.Consequence)
+
+	if next := ie.ElseIf(); next != nil {
+		p.buf.WriteString(" else ")
+		p.ifExpression(next)
+	} else if ie.Alternative != nil {
+		p.buf.WriteString(" else ")
+		p.block(ie.Alternative)
+	}
+}
+
+// matchExpression prints me with one arm per line. An arm whose value is a
+// block needs no comma after it.
+func (p *printer) matchExpression(me *ast.MatchExpression) {
+	p.buf.WriteString("match (")
+	p.expression(me.Value)
+	p.buf.WriteString(") {")
+	p.trailingComment(me.Pos().Line)
+	p.buf.WriteString("\n")
+	p.depth++
+	p.last = 0
+	for _, arm := range me.Arms {
+		p.commentsBefore(arm.Pos())
+		p.space(arm.Pos().Line)
+		p.line()
+		for idx, pattern := range arm.Patterns {
+			if idx > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expression(pattern)
+		}
+		if arm.Guard != nil {
+			p.buf.WriteString(" if ")
+			p.expression(arm.Guard)
+		}
+		p.buf.WriteString(" => ")
+		if arm.Body != nil {
+			p.block(arm.Body)
+		} else if startsWithHash(arm.Value) {
+			// or the { would open a body
+			p.buf.WriteString("(")
+			p.expression(arm.Value)
+			p.buf.WriteString("),")
+		} else {
+			p.expression(arm.Value)
+			p.buf.WriteString(",")
+		}
+		p.last = ast.End(arm).Line
+		p.trailingComment(p.last)
+		p.buf.WriteString("\n")
+	}
+	p.commentsBefore(me.End)
+	p.depth--
+	p.line("}")
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.commentBetween(block.Pos(), block.End, nil) {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	p.buf.WriteString("{")
+	p.trailingComment(block.Pos().Line)
+	p.buf.WriteString("\n")
+	p.depth++
+	p.last = 0
+	for _, stmt := range block.Statements {
+		p.statement(stmt)
+	}
+	p.commentsBefore(block.End)
+	p.depth--
+	p.line("}")
+}
+
+func (p *printer) signature(params []*ast.Identifier, ret *ast.TypeAnnotation) {
+	p.buf.WriteString("(")
+	for idx, param := range params {
+		if idx > 0 {
+			p.buf.WriteString(", ")
+		}
+		if param.Variadic {
+			p.buf.WriteString("...")
+		}
+		p.buf.WriteString(param.Value)
+		if param.Type != nil {
+			p.buf.WriteString(": " + param.Type.String())
+		}
+		if param.Default != nil {
+			p.buf.WriteString(" = ")
+			p.expression(param.Default)
+		}
+	}
+	p.buf.WriteString(")")
+
+	if ret != nil {
+		p.buf.WriteString(": " + ret.String())
+	}
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.buf.WriteString(exp.Value)
+
+	case *ast.IntegerLiteral:
+		p.buf.WriteString(exp.Token.Literal)
+
+	case *ast.BooleanLiteral:
+		if exp.Value {
+			p.buf.WriteString("true")
+		} else {
+			p.buf.WriteString("false")
+		}
+
+	case *ast.StringLiteral:
+		p.buf.WriteString(quote(exp.Value))
+
+	case *ast.NullLiteral:
+		p.buf.WriteString("null")
+
+	case *ast.InfixExpression:
+		prec := parser.Precedence(exp.Token.Type)
+		p.operand(exp.Left, prec, false)
+		p.buf.WriteString(" " + exp.Operator)
+		if len(p.comments) > 0 && before(p.comments[0].Pos, ast.Start(exp.Right)) {
+			// a comment after the operator keeps the right operand on
+			// the next line
+			p.buf.WriteString(" " + p.comments[0].Text + "\n")
+			p.comments = p.comments[1:]
+			p.depth++
+			p.line()
+			p.operand(exp.Right, prec, true)
+			p.depth--
+			break
+		}
+		p.buf.WriteString(" ")
+		p.operand(exp.Right, prec, true)
+
+	case *ast.FunctionLiteral:
+		p.buf.WriteString("gorlami")
+		p.signature(exp.Parameters, exp.ReturnType)
+		p.buf.WriteString(" ")
+		p.block(exp.Body)
+
+	case *ast.CallExpression:
+		p.operand(exp.Function, parser.CALL, false)
+		if exp.Optional {
+			p.buf.WriteString("?.")
+		}
+		args := make([]item, len(exp.Arguments))
+		for idx, arg := range exp.Arguments {
+			args[idx] = p.item(arg)
+		}
+		p.list("(", ")", exp.Token.Pos, exp.End, args)
+
+	case *ast.NamedArgument:
+		p.buf.WriteString(exp.Name + ": ")
+		p.expression(exp.Value)
+
+	case *ast.SpreadExpression:
+		p.buf.WriteString("...")
+		p.expression(exp.Value)
+
+	case *ast.ArrayLiteral:
+		elements := make([]item, len(exp.Elements))
+		for idx, e := range exp.Elements {
+			elements[idx] = p.item(e)
+		}
+		p.list("[", "]", exp.Token.Pos, exp.End, elements)
+
+	case *ast.HashLiteral:
+		pairs := make([]item, len(exp.Keys))
+		for idx := range exp.Keys {
+			key, value := exp.Keys[idx], exp.Values[idx]
+			pairs[idx] = item{ast.Start(key), ast.End(value), func() {
+				p.expression(key)
+				p.buf.WriteString(": ")
+				p.expression(value)
+			}}
+		}
+		p.list("{", "}", exp.Token.Pos, exp.End, pairs)
+
+	case *ast.StructLiteral:
+		p.operand(exp.Type, parser.CALL, false)
+		fields := make([]item, len(exp.Fields))
+		for idx, f := range exp.Fields {
+			field, value := f, exp.Values[idx]
+			fields[idx] = item{field.Pos(), ast.End(value), func() {
+				p.buf.WriteString(field.Value + ": ")
+				p.expression(value)
+			}}
+		}
+		p.list("{", "}", exp.Token.Pos, exp.End, fields)
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, parser.INDEX, false)
+		p.buf.WriteString("[")
+		p.expression(exp.Index)
+		p.buf.WriteString("]")
+
+	case *ast.MemberExpression:
+		p.operand(exp.Object, parser.CALL, false)
+		p.buf.WriteString(exp.Token.Literal + exp.Member.Value)
+
+	case *ast.VariantPattern:
+		p.expression(exp.Type)
+		p.buf.WriteString("(")
+		for idx, sub := range exp.Patterns {
+			if idx > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expression(sub)
+		}
+		p.buf.WriteString(")")
+
+	case *ast.ArrayPattern:
+		p.buf.WriteString(exp.String())
+
+	case *ast.HashPattern:
+		p.buf.WriteString(exp.String())
+
+	case *ast.IfExpression:
+		if p.short(exp) {
+			p.shortIf(exp)
+		} else {
+			p.ifExpression(exp)
+		}
+
+	case *ast.MatchExpression:
+		p.matchExpression(exp)
+	}
+}
+
+// short reports whether ie, an if used as a value, stays on one line: it
+// was written on one, with no comment in it, and each of its branches is
+// a single expression.
+func (p *printer) short(ie *ast.IfExpression) bool {
+	if ie.Pos().Line != ast.End(ie).Line || p.commentBetween(ie.Pos(), ast.End(ie), nil) {
+		return false
+	}
+	for {
+		if _, ok := single(ie.Consequence); !ok {
+			return false
+		}
+		if next := ie.ElseIf(); next != nil {
+			ie = next
+			continue
+		}
+		if ie.Alternative != nil {
+			_, ok := single(ie.Alternative)
+			return ok
+		}
+		return true
+	}
+}
+
+// single returns the expression that is all of block, if it is one.
+func single(block *ast.BlockStatement) (ast.Expression, bool) {
+	if len(block.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	return stmt.Expression, true
+}
+
+// shortIf prints ie on one line, each branch's expression in braces
+// without a semicolon.
+func (p *printer) shortIf(ie *ast.IfExpression) {
+	branch := func(block *ast.BlockStatement) {
+		exp, _ := single(block)
+		p.buf.WriteString("{ ")
+		p.expression(exp)
+		p.buf.WriteString(" }")
+	}
+
+	p.buf.WriteString("if (")
+	p.expression(ie.Condition)
+	p.buf.WriteString(") ")
+	branch(ie.Consequence)
+	if next := ie.ElseIf(); next != nil {
+		p.buf.WriteString(" else ")
+		p.shortIf(next)
+	} else if ie.Alternative != nil {
+		p.buf.WriteString(" else ")
+		branch(ie.Alternative)
+	}
+}
+
+// An item is one element, argument or entry of a list, with where it
+// starts and ends in the source.
+type item struct {
+	start, end tok.Position
+	print      func()
+}
+
+func (p *printer) item(exp ast.Expression) item {
+	return item{ast.Start(exp), ast.End(exp), func() { p.expression(exp) }}
+}
+
+// list prints items between open and close, the brackets at start and
+// end in the source. Comments inside an item are its own to print; any
+// other comment before end puts each item on a line of its own, with the
+// comment by the item it followed or before the one it preceded.
+func (p *printer) list(open, close string, start, end tok.Position, items []item) {
+	p.buf.WriteString(open)
+	if !p.commentBetween(start, end, items) {
+		for idx, it := range items {
+			if idx > 0 {
+				p.buf.WriteString(", ")
+			}
+			it.print()
+		}
+		p.buf.WriteString(close)
+		return
+	}
+
+	// a comment on the same line as what it follows, and before what
+	// comes next
+	trailing := func(line int, next tok.Position) {
+		if len(p.comments) > 0 && before(p.comments[0].Pos, next) {
+			p.trailingComment(line)
+		}
+	}
+
+	p.depth++
+	line := start.Line
+	for idx, it := range items {
+		trailing(line, it.start)
+		p.buf.WriteString("\n")
+		p.last = 0
+		p.commentsBefore(it.start)
+		p.line()
+		it.print()
+		if idx < len(items)-1 {
+			p.buf.WriteString(",")
+		}
+		line = it.end.Line
+	}
+	trailing(line, end)
+	p.buf.WriteString("\n")
+	p.last = 0
+	p.commentsBefore(end)
+	p.depth--
+	p.line(close)
+}
+
+// commentBetween reports whether a comment not yet printed lies between
+// start and end but outside each of items.
+func (p *printer) commentBetween(start, end tok.Position, items []item) bool {
+	for _, c := range p.comments {
+		if !before(c.Pos, end) {
+			return false
+		}
+		if !before(start, c.Pos) {
+			continue
+		}
+		inside := false
+		for _, it := range items {
+			if before(it.start, c.Pos) && before(c.Pos, it.end) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return true
+		}
+	}
+	return false
+}
+
+// operand prints exp as a child of an operator with precedence prec, adding
+// parentheses where the parser would otherwise group it differently.
+// Operators are left associative, so a right operand of equal precedence
+// needs them too.
+func (p *printer) operand(exp ast.Expression, prec int, right bool) {
+	inner := parser.LOWEST
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		inner = parser.Precedence(exp.Token.Type)
+	case *ast.FunctionLiteral, *ast.IfExpression, *ast.MatchExpression:
+	default:
+		p.expression(exp)
+		return
+	}
+
+	if inner < prec || (right && inner == prec) {
+		p.buf.WriteString("(")
+		p.expression(exp)
+		p.buf.WriteString(")")
+		return
+	}
+	p.expression(exp)
+}
+
+// startsWithHash reports whether the first token of exp opens a hash
+// literal.
+func startsWithHash(exp ast.Expression) bool {
+	for {
+		switch e := exp.(type) {
+		case *ast.HashLiteral:
+			return true
+		case *ast.InfixExpression:
+			exp = e.Left
+		case *ast.IndexExpression:
+			exp = e.Left
+		case *ast.CallExpression:
+			exp = e.Function
+		case *ast.MemberExpression:
+			exp = e.Object
+		case *ast.StructLiteral:
+			exp = e.Type
+		default:
+			return false
+		}
+	}
+}
+
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,239 @@
+package format_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/format"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+func source(t *testing.T, src string) string {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return format.Source(program)
+}
+
+var layouts = []struct {
+	name string
+	src  string
+	want string
+}{
+	{"blank lines kept", `var a = 1;
+
+var b = 2;
+var c = 3;
+`, `var a = 1;
+
+var b = 2;
+var c = 3;
+`},
+	{"blank lines collapsed", `var a = 1;
+
+
+
+var b = 2;
+`, `var a = 1;
+
+var b = 2;
+`},
+	{"blank lines in a block and a match", `gorlami f(n) {
+
+    var a = n;
+
+    // why
+    dicocco match (a) {
+        1 => 2,
+
+        _ => 3,
+    };
+
+}
+`, `gorlami f(n) {
+    var a = n;
+
+    // why
+    dicocco match (a) {
+        1 => 2,
+
+        _ => 3,
+    };
+}
+`},
+	{"blank line around a declaration", `var a = 1;
+gorlami f() {}
+var b = 2;
+`, `var a = 1;
+
+gorlami f() {}
+
+var b = 2;
+`},
+	{"comment in an array", `var xs = [1, // one
+    2];
+`, `var xs = [
+    1, // one
+    2
+];
+`},
+	{"comments on their own lines in a call", `f(
+    // first
+    1,
+    g(2, // two
+      3)
+    // last
+);
+`, `f(
+    // first
+    1,
+    g(
+        2, // two
+        3
+    )
+    // last
+);
+`},
+	{"comment in a hash", `var h = {"a": 1, // a
+    "b": 2};
+`, `var h = {
+    "a": 1, // a
+    "b": 2
+};
+`},
+	{"comment inside an argument", `map(gorlami(x) {
+    // inside
+    dicocco x;
+}, xs);
+`, `map(gorlami(x) {
+    // inside
+    dicocco x;
+}, xs);
+`},
+	{"comment after an operator", `var z = 1 + // plus
+    2; // sum
+`, `var z = 1 + // plus
+    2; // sum
+`},
+	{"comment in an empty function", `gorlami f() {
+    // nothing here
+}
+`, `gorlami f() {
+    // nothing here
+}
+`},
+	{"comment in an empty if", `if (true) {
+    // nothing yet
+} else {
+    1;
+}
+`, `if (true) {
+    // nothing yet
+} else {
+    1;
+}
+`},
+	{"comments in an empty try", `try {
+    // a
+} catch (e) {
+    // b
+} finally {
+    // c
+}
+`, `try {
+    // a
+} catch (e) {
+    // b
+} finally {
+    // c
+}
+`},
+	{"comments in a struct", `struct Point {
+    x, // across
+    y // down
+}
+`, `struct Point {
+    x, // across
+    y // down
+}
+`},
+	{"comments in an enum", `enum Color { // colors
+    // warm
+    Red, Green(shade) // cool
+}
+`, `enum Color { // colors
+    // warm
+    Red,
+    Green(shade) // cool
+}
+`},
+	{"struct and enum without comments", `struct Point {
+    x,
+    y
+}
+enum Color { Red,
+    Green(shade) }
+`, `struct Point { x, y }
+
+enum Color { Red, Green(shade) }
+`},
+	{"short if values", `var sign = if (n < 0) { 0 - 1 } else if (n > 0) { 1 } else { 0 };
+var x = 1 + (if (n > 5) { 2; } else { 3; });
+var y = if (n) {
+    1;
+};
+if (n) { 1 }
+var z = if (n) { var a = 1; a };
+`, `var sign = if (n < 0) { 0 - 1 } else if (n > 0) { 1 } else { 0 };
+var x = 1 + (if (n > 5) { 2 } else { 3 });
+var y = if (n) {
+    1;
+};
+if (n) {
+    1;
+}
+var z = if (n) {
+    var a = 1;
+    a;
+};
+`},
+}
+
+func TestLayout(t *testing.T) {
+	for _, tc := range layouts {
+		t.Run(tc.name, func(t *testing.T) {
+			got := source(t, tc.src)
+			if got != tc.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tc.want)
+			}
+			if again := source(t, got); again != got {
+				t.Errorf("formatting again gives\n%s", again)
+			}
+		})
+	}
+}
+
+// The examples are written in the canonical layout, so fmt leaves them be.
+func TestExamplesFormatted(t *testing.T) {
+	paths, err := filepath.Glob("../examples/*.salami")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	modules, _ := filepath.Glob("../examples/modules/*.salami")
+
+	for _, path := range append(paths, modules...) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := source(t, string(src)); got != string(src) {
+			t.Errorf("%s is not formatted; run salami fmt -w on it", path)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/code"
+)
+
+// Builtin is a function implemented in Go. call is the expression that
+// invoked it, for error positions.
+type Builtin struct {
+	Name string
+	Fn   func(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{}
+}
+
+func (b *Builtin) String() string { return "<builtin " + b.Name + ">" }
+
+// builtins are visible in every program unless a declaration shadows them.
+var builtins = map[string]*Builtin{}
+
+func init() {
+	for _, b := range []*Builtin{
+		{Name: "assert", Fn: builtinAssert},
+		{Name: "assert_eq", Fn: builtinAssertEq},
+		{Name: "bool", Fn: builtinBool},
+		{Name: "len", Fn: builtinLen},
+		{Name: "next", Fn: builtinNext},
+		{Name: "range", Fn: builtinRange},
+		{Name: "map", Fn: builtinMap},
+		{Name: "filter", Fn: builtinFilter},
+		{Name: "take", Fn: builtinTake},
+		{Name: "zip", Fn: builtinZip},
+	} {
+		builtins[b.Name] = b
+	}
+	for _, name := range code.Builtins {
+		if builtins[name] == nil {
+			panic("interpreter: no builtin " + name)
+		}
+	}
+}
+
+// StandardBuiltin returns the standard builtin called name, or nil. The vm
+// uses it to print and compare its own builtins as the interpreter's.
+func StandardBuiltin(name string) *Builtin {
+	return builtins[name]
+}
+
+// lookupBuiltin finds an undeclared name among the interpreter's own
+// builtins, then the standard ones.
+func (i *Interpreter) lookupBuiltin(name string) interface{} {
+	if b, ok := i.Builtins[name]; ok {
+		return b
+	}
+	if b, ok := builtins[name]; ok {
+		return b
+	}
+	return nil
+}
+
+func (i *Interpreter) checkArgs(call *ast.CallExpression, name string, args []interface{}, want int) {
+	if len(args) != want {
+		i.errorf(call, "%s: want %d arguments, got %d", name, want, len(args))
+	}
+}
+
+func builtinAssert(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "assert", args, 1)
+	if ok, isBool := args[0].(bool); !isBool || !ok {
+		i.errorf(call, "assertion failed: %s", Inspect(args[0]))
+	}
+	return true
+}
+
+func builtinAssertEq(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "assert_eq", args, 2)
+	if !Equal(args[0], args[1]) {
+		i.errorf(call, "assert_eq: got %s, want %s", Inspect(args[0]), Inspect(args[1]))
+	}
+	return true
+}
+
+func builtinBool(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "bool", args, 1)
+	return Truthy(args[0])
+}
+
+func builtinLen(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "len", args, 1)
+	switch v := args[0].(type) {
+	case *Array:
+		return int64(len(v.Elements))
+	case *Hash:
+		return int64(v.Len())
+	case string:
+		return int64(len(v))
+	}
+	i.errorf(call, "len: cannot take the length of %s", Inspect(args[0]))
+	return nil
+}
+
+// Truthy reports whether v counts as true where a boolean is wanted but
+// something else was given. false, 0, "", null and an empty array or hash
+// are false; every other value, functions and modules included, is true.
+func Truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case string:
+		return v != ""
+	case *Array:
+		return len(v.Elements) > 0
+	case *Hash:
+		return v.Len() > 0
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// Inspect renders a runtime value for error messages and debuggers.
+func Inspect(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case *Array:
+		return inspectArray(v)
+	case *Hash:
+		return inspectHash(v)
+	case *Struct:
+		return inspectStruct(v)
+	case *EnumValue:
+		return inspectEnumValue(v)
+	case *Function:
+		params := make([]string, len(v.Parameters))
+		for idx, p := range v.Parameters {
+			params[idx] = p.Value
+			if p.Variadic {
+				params[idx] = "..." + p.Value
+			}
+		}
+		return fmt.Sprintf("gorlami %s(%s)", v.Name, strings.Join(params, ", "))
+	default:
+		return fmt.Sprint(v)
+	}
+}
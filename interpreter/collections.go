@@ -0,0 +1,234 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// Array is an array value. Arrays are shared, not copied, when assigned or
+// passed.
+type Array struct {
+	Elements []interface{}
+}
+
+func (a *Array) String() string { return Inspect(a) }
+
+// Hash is a hash value. Its keys are integers, strings or booleans, and it
+// remembers the order they were first set in.
+type Hash struct {
+	keys  []interface{}
+	pairs map[interface{}]interface{}
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: map[interface{}]interface{}{}}
+}
+
+// Get returns the value of key, and whether h has it.
+func (h *Hash) Get(key interface{}) (interface{}, bool) {
+	v, ok := h.pairs[key]
+	return v, ok
+}
+
+// Set sets the value of key, which must be usable as one.
+func (h *Hash) Set(key, value interface{}) {
+	if _, ok := h.pairs[key]; !ok {
+		h.keys = append(h.keys, key)
+	}
+	h.pairs[key] = value
+}
+
+// Keys returns the keys of h in the order they were first set.
+func (h *Hash) Keys() []interface{} { return h.keys }
+
+func (h *Hash) Len() int { return len(h.keys) }
+
+func (h *Hash) String() string { return Inspect(h) }
+
+// HashKey reports whether v can be a key in a hash.
+func HashKey(v interface{}) bool {
+	switch v.(type) {
+	case int64, string, bool:
+		return true
+	}
+	return false
+}
+
+func inspectArray(a *Array) string {
+	parts := make([]string, len(a.Elements))
+	for idx, e := range a.Elements {
+		parts[idx] = Inspect(e)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func inspectHash(h *Hash) string {
+	parts := make([]string, len(h.keys))
+	for idx, k := range h.keys {
+		parts[idx] = Inspect(k) + ": " + Inspect(h.pairs[k])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Equal reports whether a and b are the same value. Arrays, hashes,
+// structs of the same type and enum values of the same variant are equal
+// if their contents are; everything else compares as Go values.
+func Equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for idx := range a.Elements {
+			if !Equal(a.Elements[idx], b.Elements[idx]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.keys {
+			v, ok := b.Get(k)
+			if !ok || !Equal(a.pairs[k], v) {
+				return false
+			}
+		}
+		return true
+	case *Struct:
+		b, ok := b.(*Struct)
+		if !ok || a.Type != b.Type {
+			return false
+		}
+		for idx := range a.Fields {
+			if !Equal(a.Fields[idx], b.Fields[idx]) {
+				return false
+			}
+		}
+		return true
+	case *EnumValue:
+		b, ok := b.(*EnumValue)
+		if !ok || a.Variant != b.Variant {
+			return false
+		}
+		for idx := range a.Values {
+			if !Equal(a.Values[idx], b.Values[idx]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func (i *Interpreter) evalArrayLiteral(node *ast.ArrayLiteral) interface{} {
+	elements := make([]interface{}, len(node.Elements))
+	for idx, e := range node.Elements {
+		elements[idx] = i.Interpret(e)
+	}
+	return &Array{Elements: elements}
+}
+
+func (i *Interpreter) evalHashLiteral(node *ast.HashLiteral) interface{} {
+	hash := NewHash()
+	for idx, k := range node.Keys {
+		key := i.Interpret(k)
+		if !HashKey(key) {
+			i.errorf(k, "unusable as hash key: %s", Inspect(key))
+		}
+		hash.Set(key, i.Interpret(node.Values[idx]))
+	}
+	return hash
+}
+
+// evalIndexExpression returns an element of an array or the value of a key
+// in a hash, or null if there is none.
+func (i *Interpreter) evalIndexExpression(node *ast.IndexExpression) interface{} {
+	left := i.Interpret(node.Left)
+	index := i.Interpret(node.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		idx, ok := index.(int64)
+		if !ok {
+			i.errorf(node.Index, "array index must be an integer, got %s", Inspect(index))
+		}
+		if idx < 0 || idx >= int64(len(left.Elements)) {
+			return NULL
+		}
+		return left.Elements[idx]
+	case *Hash:
+		if !HashKey(index) {
+			i.errorf(node.Index, "unusable as hash key: %s", Inspect(index))
+		}
+		if v, ok := left.Get(index); ok {
+			return v
+		}
+		return NULL
+	}
+
+	i.errorf(node, "cannot index %s", Inspect(left))
+	return nil
+}
+
+// destructure binds the names in pattern, in env, to the parts of value
+// they stand for.
+func (i *Interpreter) destructure(env *Environment, pattern ast.Pattern, value interface{}) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Pattern != nil {
+			i.destructure(env, p.Pattern, value)
+		} else if p.Value != "_" {
+			env.Set(p.Index, value)
+		}
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*Array)
+		if !ok {
+			i.errorf(p, "cannot destructure %s as an array", Inspect(value))
+		}
+		n := len(p.Elements)
+		if p.Rest == nil && len(array.Elements) != n {
+			i.errorf(p, "cannot destructure an array of length %d into %d elements", len(array.Elements), n)
+		}
+		if p.Rest != nil && len(array.Elements) < n {
+			i.errorf(p, "cannot destructure an array of length %d into at least %d elements", len(array.Elements), n)
+		}
+		for idx, e := range p.Elements {
+			i.destructure(env, e, array.Elements[idx])
+		}
+		if p.Rest != nil {
+			rest := append([]interface{}{}, array.Elements[n:]...)
+			i.destructure(env, p.Rest, &Array{Elements: rest})
+		}
+
+	case *ast.HashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			i.errorf(p, "cannot destructure %s as a hash", Inspect(value))
+		}
+		taken := map[interface{}]bool{}
+		for _, k := range p.Keys {
+			v, ok := hash.Get(k.Value)
+			if !ok {
+				i.errorf(k, "cannot destructure a hash without the key %q", k.Value)
+			}
+			taken[k.Value] = true
+			i.destructure(env, k, v)
+		}
+		if p.Rest != nil {
+			rest := NewHash()
+			for _, k := range hash.Keys() {
+				if !taken[k] {
+					v, _ := hash.Get(k)
+					rest.Set(k, v)
+				}
+			}
+			i.destructure(env, p.Rest, rest)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// Hook is called before every statement the interpreter runs, and again
+// when a call returns to its caller part way through a statement. A
+// debugger implements it and blocks inside either method to pause the
+// program.
+type Hook interface {
+	Statement(i *Interpreter, stmt ast.Statement)
+	Returned(i *Interpreter)
+}
+
+// Tracer observes calls and statements without being able to stop them,
+// for profilers and coverage tools. Program is called as each program (the
+// main one, or an imported module when the Loader has the tracer) starts to
+// run. Enter and Exit bracket every call of a gorlami; a tail call exits its
+// caller before entering the callee, since it replaces it. Branch reports
+// which way an if went.
+type Tracer interface {
+	Program(file string, program *ast.Program)
+	Enter(fn *Function)
+	Exit(fn *Function)
+	Statement(stmt ast.Statement)
+	Branch(expr *ast.IfExpression, consequence bool)
+}
+
+// Frame is one active function call. Frames are only tracked while a Hook
+// is set. A tail call replaces the frame of its caller rather than pushing
+// a new one, mirroring how it runs.
+type Frame struct {
+	Name string
+	File string
+	Env  *Environment
+	Pos  tok.Position // start of the statement being run
+}
+
+// Frames returns the active calls, outermost (the top level program) first.
+func (i *Interpreter) Frames() []*Frame {
+	return i.frames
+}
+
+// Outer returns the enclosing scope, or nil for the globals.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+func (i *Interpreter) pushFrame(fn *Function, env *Environment) *Frame {
+	frame := &Frame{Name: fn.Name, File: fn.File, Env: env, Pos: fn.Body.Pos()}
+	i.frames = append(i.frames, frame)
+	return frame
+}
+
+func (i *Interpreter) popFrame() {
+	i.frames = i.frames[:len(i.frames)-1]
+}
+
+// step runs before each statement: it tells the tracer, records where the
+// innermost frame is and hands control to the hook.
+func (i *Interpreter) step(stmt ast.Statement) {
+	if i.Tracer != nil {
+		i.Tracer.Statement(stmt)
+	}
+	if i.Hook == nil || len(i.frames) == 0 {
+		return
+	}
+	i.frames[len(i.frames)-1].Pos = stmt.Pos()
+	i.Hook.Statement(i, stmt)
+}
+
+// Evaluate evaluates expr in env for a paused debugger. Identifiers in expr
+// must already be resolved relative to env. The hook is not called while it
+// runs, and any failure comes back as an error rather than stopping the
+// program.
+func (i *Interpreter) Evaluate(expr ast.Expression, env *Environment) (result interface{}, err error) {
+	savedEnv, savedHook := i.env, i.Hook
+	savedExited, savedCode := i.Exited, i.ExitCode
+	i.env, i.Hook = env, nil
+
+	defer func() {
+		i.env, i.Hook = savedEnv, savedHook
+		i.Exited, i.ExitCode = savedExited, savedCode
+
+		if r := recover(); r != nil {
+			if rtErr, ok := r.(*RuntimeError); ok {
+				err = rtErr
+				return
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	result = i.Interpret(expr)
+	if tail, ok := result.(*TailCall); ok {
+		result = i.applyFunction(tail.Fn, tail.Args, tail.Line)
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// Enum is what an enum declaration binds its name to: its variants, in
+// order.
+type Enum struct {
+	Name     string
+	Variants []*Variant
+}
+
+func (e *Enum) String() string { return "<enum " + e.Name + ">" }
+
+// variant returns the variant called name, or nil.
+func (e *Enum) variant(name string) *Variant {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Variant is one variant of an enum. One without fields has a single
+// value, Value, which Color.Red evaluates to; one with fields is called
+// like a function, Result.Ok(5), to make a value of it.
+type Variant struct {
+	Enum   *Enum
+	Name   string
+	Fields []string
+	Value  *EnumValue // nil if the variant has fields
+}
+
+func (v *Variant) String() string { return "<variant " + v.Enum.Name + "." + v.Name + ">" }
+
+// EnumValue is a value of an enum: its variant and one value per field of
+// the variant.
+type EnumValue struct {
+	Variant *Variant
+	Values  []interface{}
+}
+
+func (v *EnumValue) String() string { return Inspect(v) }
+
+func inspectEnumValue(v *EnumValue) string {
+	name := v.Variant.Enum.Name + "." + v.Variant.Name
+	if v.Variant.Value != nil {
+		return name
+	}
+	parts := make([]string, len(v.Values))
+	for idx, value := range v.Values {
+		parts[idx] = Inspect(value)
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// NewEnum makes the enum a declaration of name with variants describes:
+// each variant's name and the names of its fields, nil for none.
+func NewEnum(name string, variants []string, fields [][]string) *Enum {
+	e := &Enum{Name: name}
+	for idx, name := range variants {
+		v := &Variant{Enum: e, Name: name, Fields: fields[idx]}
+		if v.Fields == nil {
+			v.Value = &EnumValue{Variant: v}
+		}
+		e.Variants = append(e.Variants, v)
+	}
+	return e
+}
+
+func (i *Interpreter) evalEnumStatement(stmt *ast.EnumStatement) interface{} {
+	names := make([]string, len(stmt.Variants))
+	fields := make([][]string, len(stmt.Variants))
+	for idx, v := range stmt.Variants {
+		names[idx] = v.Name.Value
+		for _, f := range v.Fields {
+			fields[idx] = append(fields[idx], f.Value)
+		}
+	}
+	e := NewEnum(stmt.Name.Value, names, fields)
+	i.env.Set(stmt.Name.Index, e)
+	return e
+}
+
+// enumMember is the value of e.name: a variant's value if it has no
+// fields, or the variant to call if it has.
+func (i *Interpreter) enumMember(me *ast.MemberExpression, e *Enum) interface{} {
+	v := e.variant(me.Member.Value)
+	if v == nil {
+		i.errorf(me, "%s has no variant %s", e.Name, me.Member.Value)
+	}
+	if v.Value != nil {
+		return v.Value
+	}
+	return v
+}
+
+// enumValueMember is the value of v.name, one of the fields of its
+// variant.
+func (i *Interpreter) enumValueMember(me *ast.MemberExpression, v *EnumValue) interface{} {
+	for idx, f := range v.Variant.Fields {
+		if f == me.Member.Value {
+			return v.Values[idx]
+		}
+	}
+	i.errorf(me, "%s.%s has no field %s", v.Variant.Enum.Name, v.Variant.Name, me.Member.Value)
+	return nil
+}
+
+// construct makes a value of v from the arguments of call, one per field.
+func (i *Interpreter) construct(call *ast.CallExpression, v *Variant, args []interface{}) interface{} {
+	if len(args) != len(v.Fields) {
+		i.errorf(call, "%s.%s: want %d arguments, got %d", v.Enum.Name, v.Name, len(v.Fields), len(args))
+	}
+	return &EnumValue{Variant: v, Values: args}
+}
+
+// matchVariant reports whether value is a value of the variant pattern
+// names whose values each match the pattern's own patterns, binding their
+// names as it goes.
+func (i *Interpreter) matchVariant(pattern *ast.VariantPattern, value interface{}) bool {
+	typ := i.Interpret(pattern.Type)
+	v, ok := typ.(*Variant)
+	if !ok {
+		i.errorf(pattern.Type, "%s is not an enum variant with fields", Inspect(typ))
+	}
+	if len(pattern.Patterns) != len(v.Fields) {
+		i.errorf(pattern, "pattern for %s.%s: want %d patterns, got %d", v.Enum.Name, v.Name, len(v.Fields), len(pattern.Patterns))
+	}
+
+	ev, ok := value.(*EnumValue)
+	if !ok || ev.Variant != v {
+		return false
+	}
+	for idx, p := range pattern.Patterns {
+		if !i.matchPattern(p, ev.Values[idx]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// RuntimeError stops a running program. The interpreter raises it as a
+// panic so it unwinds through any depth of evaluation; Run recovers it and
+// hands it back as an ordinary error.
+type RuntimeError struct {
+	Message string
+	File    string
+	Pos     tok.Position
+	Err     *Error // what a catch binds; set by throw, or once caught
+}
+
+func (e *RuntimeError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Pos.Line, e.Pos.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+func (i *Interpreter) errorf(node ast.Node, format string, args ...interface{}) {
+	panic(&RuntimeError{
+		Message: fmt.Sprintf(format, args...),
+		File:    i.File,
+		Pos:     node.Pos(),
+	})
+}
+
+// Run interprets program and returns its result, or the runtime error that
+// stopped it. A program that has not been through the resolver is resolved
+// first, and does not run if the resolver finds errors.
+func (i *Interpreter) Run(program *ast.Program) (result interface{}, err error) {
+	if !program.Resolved {
+		if errs := resolver.Resolve(program); len(errs) != 0 {
+			if i.File != "" {
+				return nil, fmt.Errorf("%s: resolver errors: %s", i.File, strings.Join(errs, "; "))
+			}
+			return nil, fmt.Errorf("resolver errors: %s", strings.Join(errs, "; "))
+		}
+	}
+	if i.File != "" {
+		l := i.loader()
+		l.loading = append(l.loading, i.File)
+		defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+	}
+
+	raiseStackLimit()
+	defer recoverRuntimeError(&err)
+
+	return i.Interpret(program), nil
+}
+
+// Call calls the global function name, declared by a program this
+// interpreter has already run, and returns its result or the runtime error
+// that stopped it.
+func (i *Interpreter) Call(name string, args ...interface{}) (result interface{}, err error) {
+	var fn *Function
+	for idx, global := range i.env.Names {
+		if global == name {
+			fn, _ = i.env.Get(0, idx).(*Function)
+		}
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	args, err = bindArguments(fn, args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	raiseStackLimit()
+	defer recoverRuntimeError(&err)
+
+	i.calls, i.tries = nil, 0
+	return i.applyFunction(fn, args, 0), nil
+}
+
+func recoverRuntimeError(err *error) {
+	if r := recover(); r != nil {
+		rtErr, ok := r.(*RuntimeError)
+		if !ok {
+			panic(r)
+		}
+		*err = rtErr
+	}
+}
@@ -0,0 +1,152 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// Error is the value a catch binds: what a throw raised, or a runtime
+// error such as a division by zero.
+type Error struct {
+	Message string
+	Value   interface{} // the value thrown, or the message of a runtime error
+	Stack   []string    // the calls it unwound, innermost first, as "f (line 3)"
+}
+
+func (e *Error) String() string { return "<error: " + e.Message + ">" }
+
+// call is an active call of a gorlami, kept for the stacks of errors. line
+// is the line of the call in its caller.
+type call struct {
+	fn   *Function
+	line int
+}
+
+// stack describes the active calls, innermost first, with line as the line
+// the innermost one has reached.
+func (i *Interpreter) stack(line int) []string {
+	stack := []string{}
+	for idx := len(i.calls) - 1; idx >= 0; idx-- {
+		stack = append(stack, fmt.Sprintf("%s (line %d)", functionName(i.calls[idx].fn), line))
+		line = i.calls[idx].line
+	}
+	if line > 0 {
+		stack = append(stack, fmt.Sprintf("main (line %d)", line))
+	}
+	return stack
+}
+
+func (i *Interpreter) evalThrowStatement(stmt *ast.ThrowStatement) interface{} {
+	value := i.Interpret(stmt.Value)
+	err, ok := value.(*Error)
+	if !ok {
+		message, isString := value.(string)
+		if !isString {
+			message = Inspect(value)
+		}
+		err = &Error{Message: message, Value: value, Stack: i.stack(stmt.Pos().Line)}
+	}
+	panic(&RuntimeError{Message: err.Message, File: i.File, Pos: stmt.Pos(), Err: err})
+}
+
+// errorValue returns the Error a catch binds for rtErr, making one for a
+// runtime error the first time it is caught. It must run before the calls
+// the error unwound are forgotten.
+func (i *Interpreter) errorValue(rtErr *RuntimeError) *Error {
+	if rtErr.Err == nil {
+		rtErr.Err = &Error{Message: rtErr.Message, Value: rtErr.Message, Stack: i.stack(rtErr.Pos.Line)}
+	}
+	return rtErr.Err
+}
+
+// evalTryStatement runs the body of ts, then the catch if the body raised
+// an error, then the finally whatever happened, unless the program exited.
+// An error the catch doesn't handle, or raises itself, is raised again
+// after the finally; a dicocco in the finally replaces it, as it replaces
+// a dicocco in the body or catch. The value of a try is that of the last
+// block it ran.
+func (i *Interpreter) evalTryStatement(ts *ast.TryStatement) interface{} {
+	result, rtErr := i.protect(ts.Body)
+	if i.Exited {
+		return result
+	}
+
+	if rtErr != nil && ts.Catch != nil {
+		i.env.Set(ts.Param.Index, i.errorValue(rtErr))
+		if ts.Finally == nil {
+			return i.evalBlockStatement(ts.Catch)
+		}
+		if result, rtErr = i.protect(ts.Catch); i.Exited {
+			return result
+		}
+	}
+
+	if ts.Finally == nil {
+		return result
+	}
+	final := i.evalBlockStatement(ts.Finally)
+	if _, ok := final.(*ReturnValue); ok || i.Exited {
+		return final
+	}
+	if rtErr != nil {
+		panic(rtErr)
+	}
+	if _, ok := result.(*ReturnValue); ok {
+		return result
+	}
+	return final
+}
+
+// protect runs block and recovers any runtime error it raises, putting
+// back the environment and calls the error unwound past. A dicocco in
+// block is never a tail call, so that the call runs inside the try.
+func (i *Interpreter) protect(block *ast.BlockStatement) (result interface{}, err *RuntimeError) {
+	baseCalls, baseFrames := i.base()
+	env, calls, frames, tries := i.env, len(i.calls)-baseCalls, len(i.frames)-baseFrames, i.tries
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		rtErr, ok := r.(*RuntimeError)
+		if !ok {
+			panic(r)
+		}
+		i.errorValue(rtErr)
+		// a yield in block may have left the body to be resumed from
+		// further up or down the stack
+		baseCalls, baseFrames := i.base()
+		calls, frames = calls+baseCalls, frames+baseFrames
+		if i.Tracer != nil {
+			for idx := len(i.calls) - 1; idx >= calls; idx-- {
+				i.Tracer.Exit(i.calls[idx].fn)
+			}
+		}
+		i.env, i.calls, i.frames, i.tries = env, i.calls[:calls], i.frames[:frames], tries
+		err = rtErr
+	}()
+
+	i.tries++
+	result = i.evalBlockStatement(block)
+	i.tries--
+	return result, nil
+}
+
+// errorMember is the value of e.name: the message, value or stack of e.
+func (i *Interpreter) errorMember(me *ast.MemberExpression, e *Error) interface{} {
+	switch me.Member.Value {
+	case "message":
+		return e.Message
+	case "value":
+		return e.Value
+	case "stack":
+		stack := make([]interface{}, len(e.Stack))
+		for idx, s := range e.Stack {
+			stack[idx] = s
+		}
+		return &Array{Elements: stack}
+	}
+	i.errorf(me, "an error has no member %s", me.Member.Value)
+	return nil
+}
@@ -0,0 +1,401 @@
+package interpreter
+
+import (
+	"runtime"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// Generator is a lazy sequence of values: what calling a gorlami that
+// yields returns, or what range, map, filter, take and zip make. Each
+// value is worked out only when it is asked for.
+type Generator struct {
+	Name string
+
+	// next returns the next value and true, or false once there are none
+	// left. at is the node asking, for the positions of errors and the
+	// line in the stacks of calls made to work the value out.
+	next func(at ast.Node) (interface{}, bool)
+}
+
+func (g *Generator) String() string { return "<generator " + g.Name + ">" }
+
+// NewGenerator makes a generator named name whose values next returns.
+func NewGenerator(name string, next func(at ast.Node) (interface{}, bool)) *Generator {
+	return &Generator{Name: name, next: next}
+}
+
+// advance returns the next value of g. Every value is asked for through it
+// rather than through next, which keeps g alive until the value is in: a
+// generator function's body stops for good once g is garbage.
+func (g *Generator) advance(at ast.Node) (interface{}, bool) {
+	value, ok := g.next(at)
+	runtime.KeepAlive(g)
+	return value, ok
+}
+
+// coroutine runs the body of a generator function. A tree walker keeps
+// where it is in a body on the Go stack, so the body runs on a goroutine
+// of its own, which a yield parks until the next value is wanted. Only one
+// of the goroutines of an interpreter runs at a time: whoever resumes a
+// body waits for it to yield or finish, so the interpreter's state is
+// never touched by two at once.
+type coroutine struct {
+	i     *Interpreter
+	fn    *Function
+	env   *Environment
+	frame *Frame // pushed while the body runs, if there is a hook
+	tries int    // try bodies the yield it is parked at is inside
+
+	// the calls and frames below the body's while it runs, which change
+	// with whoever resumed it
+	calls, frames int
+
+	resume chan struct{} // closed once the generator is garbage
+	out    chan signal
+
+	started, running, done bool
+}
+
+// signal is what a body hands back to whoever resumed it: a value it
+// yielded, or that it finished, and how.
+type signal struct {
+	value interface{}
+	done  bool
+	panic interface{} // what it raised on the way, if anything
+}
+
+// abandoned unwinds the goroutine of a generator nothing can resume any
+// more. Nothing recovers it but the goroutine itself, so it passes through
+// try and catch without running any of them.
+type abandoned struct{}
+
+// newGenerator returns the generator for a call of fn, whose parameters
+// are already bound in env.
+func (i *Interpreter) newGenerator(fn *Function, env *Environment) *Generator {
+	co := &coroutine{
+		i:      i,
+		fn:     fn,
+		env:    env,
+		frame:  &Frame{Name: fn.Name, File: fn.File, Env: env, Pos: fn.Body.Pos()},
+		resume: make(chan struct{}),
+		out:    make(chan signal),
+	}
+	g := NewGenerator(functionName(fn), co.next)
+	// the goroutine only holds on to co, so g becomes garbage once the
+	// program drops it, and the goroutine is let go
+	runtime.SetFinalizer(g, func(*Generator) { close(co.resume) })
+	return g
+}
+
+// next runs the body from where it last stopped to its next yield, as a
+// call of the generator's function made by at.
+func (co *coroutine) next(at ast.Node) (interface{}, bool) {
+	i := co.i
+	if co.done {
+		return nil, false
+	}
+	if co.running {
+		i.errorf(at, "generator %s is already running", functionName(co.fn))
+	}
+	if !co.started {
+		co.started = true
+		go co.run()
+	}
+
+	env, tries, gen := i.env, i.tries, i.gen
+	co.calls, co.frames = len(i.calls), len(i.frames)
+	i.calls = append(i.calls, call{fn: co.fn, line: at.Pos().Line})
+	if i.Hook != nil {
+		i.frames = append(i.frames, co.frame)
+	}
+	if i.Tracer != nil {
+		i.Tracer.Enter(co.fn)
+	}
+	i.env, i.tries, i.gen = co.env, co.tries, co
+
+	co.running = true
+	co.resume <- struct{}{}
+	s := <-co.out
+	co.running = false
+
+	i.gen = gen
+	if s.panic != nil {
+		// the body left the calls it unwound for whoever catches it to
+		// put back, as a runtime error does anywhere else
+		co.done = true
+		panic(s.panic)
+	}
+
+	co.tries = i.tries
+	i.env, i.tries = env, tries
+	i.calls = i.calls[:len(i.calls)-1]
+	if i.Hook != nil {
+		i.popFrame()
+	}
+	if i.Tracer != nil {
+		i.Tracer.Exit(co.fn)
+	}
+
+	if s.done {
+		co.done = true
+		return nil, false
+	}
+	return s.value, true
+}
+
+// run is the goroutine of the generator. It waits to be resumed the first
+// time, then runs the body and reports how it finished.
+func (co *coroutine) run() {
+	i := co.i
+	defer func() {
+		r := recover()
+		if _, ok := r.(abandoned); ok {
+			return
+		}
+		if rtErr, ok := r.(*RuntimeError); ok {
+			i.errorValue(rtErr)
+		}
+		co.out <- signal{done: true, panic: r}
+	}()
+
+	co.wait()
+	result := i.evalBlockStatementWithEnv(co.fn.Body, co.env)
+	// dicocco ends a generator, but the call it makes still runs
+	if tail, ok := result.(*TailCall); ok && !i.Exited {
+		i.applyFunction(tail.Fn, tail.Args, tail.Line)
+	}
+}
+
+// base returns the number of calls and frames below those of the running
+// generator body, if any. Marks in the call stack a body keeps across a
+// yield are kept relative to it.
+func (i *Interpreter) base() (calls, frames int) {
+	if i.gen == nil {
+		return 0, 0
+	}
+	return i.gen.calls, i.gen.frames
+}
+
+// wait parks the goroutine until the generator is resumed.
+func (co *coroutine) wait() {
+	if _, ok := <-co.resume; !ok {
+		panic(abandoned{})
+	}
+}
+
+func (i *Interpreter) evalYieldStatement(stmt *ast.YieldStatement) interface{} {
+	value := i.Interpret(stmt.Value)
+	co := i.gen
+	if co == nil {
+		i.errorf(stmt, "yield outside of a generator")
+	}
+	co.out <- signal{value: value}
+	co.wait()
+	return NULL
+}
+
+// evalForStatement runs the body of a for once per value of its iterable.
+// Its value is null, unless a dicocco in the body returns.
+func (i *Interpreter) evalForStatement(stmt *ast.ForStatement) interface{} {
+	next := i.iterate(stmt.Iterable, i.Interpret(stmt.Iterable))
+	for !i.Exited {
+		value, ok := next(stmt)
+		if !ok || i.Exited {
+			break
+		}
+		i.env.Set(stmt.Name.Index, value)
+		if stmt.Name.Pattern != nil {
+			i.destructure(i.env, stmt.Name.Pattern, value)
+		}
+
+		result := i.evalBlockStatement(stmt.Body)
+		if _, ok := result.(*ReturnValue); ok || i.Exited {
+			return result
+		}
+	}
+	return NULL
+}
+
+// iterate returns a function that returns the values of value one by one:
+// the elements of an array, the keys of a hash or the values of a
+// generator. Anything else is an error at node.
+func (i *Interpreter) iterate(node ast.Node, value interface{}) func(at ast.Node) (interface{}, bool) {
+	switch v := value.(type) {
+	case *Array:
+		idx := 0
+		return func(ast.Node) (interface{}, bool) {
+			if idx >= len(v.Elements) {
+				return nil, false
+			}
+			idx++
+			return v.Elements[idx-1], true
+		}
+	case *Hash:
+		idx := 0
+		return func(ast.Node) (interface{}, bool) {
+			if idx >= v.Len() {
+				return nil, false
+			}
+			idx++
+			return v.Keys()[idx-1], true
+		}
+	case *Generator:
+		return v.advance
+	}
+	i.errorf(node, "%s is not iterable", Inspect(value))
+	return nil
+}
+
+// callValue calls fn, a function, builtin or variant, with args on behalf
+// of a builtin that call invoked.
+func (i *Interpreter) callValue(call *ast.CallExpression, fn interface{}, args []interface{}) interface{} {
+	switch fn := fn.(type) {
+	case *Function:
+		args, err := bindArguments(fn, args, nil)
+		if err != nil {
+			i.errorf(call, "%s", err)
+		}
+		return i.applyFunction(fn, args, call.Pos().Line)
+	case *Builtin:
+		return fn.Fn(i, call, args)
+	case *Variant:
+		return i.construct(call, fn, args)
+	}
+	i.errorf(call, "calling non-function %s", Inspect(fn))
+	return nil
+}
+
+// builtinNext returns the next value of a generator. Once there are none
+// left it returns its second argument, if given, and is an error if not.
+func builtinNext(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	if len(args) != 1 && len(args) != 2 {
+		i.errorf(call, "next: want 1 or 2 arguments, got %d", len(args))
+	}
+	g, ok := args[0].(*Generator)
+	if !ok {
+		i.errorf(call, "next: %s is not a generator", Inspect(args[0]))
+	}
+	if value, ok := g.advance(call); ok {
+		return value
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	i.errorf(call, "next: generator %s is exhausted", g.Name)
+	return nil
+}
+
+// builtinRange counts from start up to, but not including, stop, by step:
+// range(stop) from 0 by 1, range(start, stop) by 1 or range(start, stop,
+// step). A negative step counts down.
+func builtinRange(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	if len(args) < 1 || len(args) > 3 {
+		i.errorf(call, "range: want 1 to 3 arguments, got %d", len(args))
+	}
+	bounds := make([]int64, len(args))
+	for idx, arg := range args {
+		n, ok := arg.(int64)
+		if !ok {
+			i.errorf(call, "range: arguments must be integers, got %s", Inspect(arg))
+		}
+		bounds[idx] = n
+	}
+
+	start, stop, step := int64(0), bounds[0], int64(1)
+	if len(bounds) > 1 {
+		start, stop = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		i.errorf(call, "range: step must not be 0")
+	}
+
+	n := start
+	return NewGenerator("range", func(ast.Node) (interface{}, bool) {
+		if (step > 0 && n >= stop) || (step < 0 && n <= stop) {
+			return nil, false
+		}
+		n += step
+		return n - step, true
+	})
+}
+
+// builtinMap calls a function on each value of an iterable as it is
+// wanted.
+func builtinMap(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "map", args, 2)
+	fn, next := args[0], i.iterate(call, args[1])
+	return NewGenerator("map", func(at ast.Node) (interface{}, bool) {
+		value, ok := next(at)
+		if !ok {
+			return nil, false
+		}
+		return i.callValue(call, fn, []interface{}{value}), true
+	})
+}
+
+// builtinFilter keeps the values of an iterable a function is truthy for.
+func builtinFilter(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "filter", args, 2)
+	fn, next := args[0], i.iterate(call, args[1])
+	return NewGenerator("filter", func(at ast.Node) (interface{}, bool) {
+		for {
+			value, ok := next(at)
+			if !ok {
+				return nil, false
+			}
+			if Truthy(i.callValue(call, fn, []interface{}{value})) {
+				return value, true
+			}
+		}
+	})
+}
+
+// builtinTake stops an iterable after its first n values, without asking
+// it for any more.
+func builtinTake(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	i.checkArgs(call, "take", args, 2)
+	n, ok := args[0].(int64)
+	if !ok || n < 0 {
+		i.errorf(call, "take: count must be a non-negative integer, got %s", Inspect(args[0]))
+	}
+	next := i.iterate(call, args[1])
+	return NewGenerator("take", func(at ast.Node) (interface{}, bool) {
+		if n == 0 {
+			return nil, false
+		}
+		n--
+		return next(at)
+	})
+}
+
+// builtinZip pairs up the values of its iterables in arrays, one value
+// from each, until the shortest runs out.
+func builtinZip(i *Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+	if len(args) == 0 {
+		i.errorf(call, "zip: want at least 1 argument, got 0")
+	}
+	nexts := make([]func(ast.Node) (interface{}, bool), len(args))
+	for idx, arg := range args {
+		nexts[idx] = i.iterate(call, arg)
+	}
+	done := false
+	return NewGenerator("zip", func(at ast.Node) (interface{}, bool) {
+		if done {
+			return nil, false
+		}
+		values := make([]interface{}, len(nexts))
+		for idx, next := range nexts {
+			value, ok := next(at)
+			if !ok {
+				done = true
+				return nil, false
+			}
+			values[idx] = value
+		}
+		return &Array{Elements: values}, true
+	})
+}
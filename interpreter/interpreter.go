@@ -1,53 +1,128 @@
 package interpreter
 
 import (
-	"fmt"
+	"runtime/debug"
+	"sync"
 
 	"github.com/afoley/salami-lang/ast"
 )
 
+// Environment holds the variable slots of one scope, laid out by the
+// resolver. Names is kept alongside so the slots can be inspected.
 type Environment struct {
-	store map[string]interface{}
+	Names []string
+	slots []interface{}
 	outer *Environment
 }
 
-func NewEnvironment() *Environment {
-	return &Environment{store: make(map[string]interface{})}
+func NewEnvironment(names []string) *Environment {
+	return &Environment{Names: names, slots: make([]interface{}, len(names))}
 }
 
-func (e *Environment) Get(name string) (interface{}, bool) {
-	value, ok := e.store[name]
-	if !ok && e.outer != nil {
-		value, ok = e.outer.Get(name)
+// Get returns the value in a slot, or NULL if nothing has been stored there
+// yet, such as a name whose declaration has not run.
+func (e *Environment) Get(depth, index int) interface{} {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
 	}
-	return value, ok
+	if env.slots[index] == nil {
+		return NULL
+	}
+	return env.slots[index]
 }
 
-func (e *Environment) Set(name string, value interface{}) interface{} {
-	e.store[name] = value
+func (e *Environment) Set(index int, value interface{}) interface{} {
+	e.slots[index] = value
 	return value
 }
 
 type Function struct {
+	Name       string // empty for anonymous literals
+	File       string // file the function was defined in, if known
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
+	Locals     []string
 	Env        *Environment
+	Receiver   *ast.Identifier // for a method, the name its struct is bound to
+	Self       interface{}     // for a method read off a struct, that struct
+	Generator  bool            // calling it returns a *Generator over its body
 }
 
 func (fn *Function) Literal() string { return "gorlami" }
 
+// Null is the type of null, the value of nothing: a declared name that has
+// not been set, an if that ran no branch, an empty block. NULL is its only
+// value, so a value is null exactly when it == NULL.
+type Null struct{}
+
+func (*Null) String() string { return "null" }
+
+var NULL = &Null{}
+
 type ReturnValue struct {
 	Value interface{}
 }
 
+// TailCall is returned in place of the result of a call in tail position
+// (dicocco f(x)). The caller that is already running a function loops on it
+// instead of nesting another Go stack frame.
+type TailCall struct {
+	Fn   *Function
+	Args []interface{}
+	Line int // of the call
+}
+
+// MaxCallDepth is how deeply calls can nest before the interpreter stops
+// the program with a stack overflow error. The VM allows as many frames,
+// so a deep recursion runs, or fails, the same on either engine.
+const MaxCallDepth = 1 << 18
+
+// maxGoStack is how far the Go stack may grow under MaxCallDepth calls.
+// A call nested in blocks and expressions takes a few kilobytes of it, so
+// Go's default limit of 1GB would crash a deep recursion before it got
+// there; a raised limit only costs memory a program actually recurses into.
+const maxGoStack = 8 << 30
+
+var raiseStackOnce sync.Once
+
+// raiseStackLimit lets Go's stack grow to maxGoStack, unless something
+// has already allowed it more.
+func raiseStackLimit() {
+	raiseStackOnce.Do(func() {
+		if previous := debug.SetMaxStack(maxGoStack); previous > maxGoStack {
+			debug.SetMaxStack(previous)
+		}
+	})
+}
+
 type Interpreter struct {
 	env      *Environment
 	ExitCode int64
 	Exited   bool
+
+	File   string  // path of the program being run, if it came from a file
+	Loader *Loader // resolves imports; created on first use if nil
+	Hook   Hook    // called before each statement, for debuggers
+	Tracer Tracer  // told about every call and statement, for profilers
+	Strict bool    // reading an undefined name is an error rather than null
+
+	// StrictBooleans makes an if condition that is not a boolean an error
+	// rather than true or false by Truthy.
+	StrictBooleans bool
+
+	// Builtins adds to or overrides the standard builtins for this
+	// interpreter, such as the test runner's skip.
+	Builtins map[string]*Builtin
+
+	frames []*Frame
+	calls  []call
+	tries  int        // try bodies the current call is inside
+	gen    *coroutine // the generator whose body is running, if any
 }
 
 func New() *Interpreter {
-	return &Interpreter{env: NewEnvironment()}
+	return &Interpreter{env: NewEnvironment(nil)}
 }
 
 func (i *Interpreter) Interpret(node ast.Node) interface{} {
@@ -67,51 +142,132 @@ func (i *Interpreter) Interpret(node ast.Node) interface{} {
 		return node.Value
 	case *ast.BooleanLiteral:
 		return node.Value
+	case *ast.StringLiteral:
+		return node.Value
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.IfExpression:
 		return i.evalIfExpression(node)
+	case *ast.MatchExpression:
+		return i.evalMatchExpression(node)
 	case *ast.BlockStatement:
 		return i.evalBlockStatement(node)
 	case *ast.InfixExpression:
 		return i.evalInfixExpression(node)
+	case *ast.ArrayLiteral:
+		return i.evalArrayLiteral(node)
+	case *ast.HashLiteral:
+		return i.evalHashLiteral(node)
+	case *ast.IndexExpression:
+		return i.evalIndexExpression(node)
 	case *ast.FunctionLiteral:
 		return i.evalFunctionLiteral(node)
 	case *ast.CallExpression:
-		return i.evalCallExpression(node)
+		value, _ := i.evalCallExpression(node)
+		return value
 	case *ast.ReturnStatement:
 		return i.evalReturnStatement(node)
 	case *ast.ExitStatement:
 		return i.evalExitStatement(node)
+	case *ast.TryStatement:
+		return i.evalTryStatement(node)
+	case *ast.ThrowStatement:
+		return i.evalThrowStatement(node)
+	case *ast.ForStatement:
+		return i.evalForStatement(node)
+	case *ast.YieldStatement:
+		return i.evalYieldStatement(node)
+	case *ast.ExpressionStatement:
+		return i.Interpret(node.Expression)
+	case *ast.ImportStatement:
+		return i.evalImportStatement(node)
+	case *ast.ExportStatement:
+		return i.Interpret(node.Declaration)
+	case *ast.MemberExpression:
+		value, _ := i.evalMemberExpression(node)
+		return value
+	case *ast.StructStatement:
+		return i.evalStructStatement(node)
+	case *ast.StructLiteral:
+		return i.evalStructLiteral(node)
+	case *ast.EnumStatement:
+		return i.evalEnumStatement(node)
+	case *ast.AssignStatement:
+		return i.evalAssignStatement(node)
 	default:
 		return nil
 	}
 }
 
 func (i *Interpreter) evalProgram(program *ast.Program) interface{} {
-	var result interface{}
+	i.env = NewEnvironment(program.Globals)
+	i.frames, i.calls = nil, nil
+	if i.Tracer != nil {
+		i.Tracer.Program(i.File, program)
+	}
+	if i.Hook != nil {
+		i.frames = []*Frame{{Name: "main", File: i.File, Env: i.env}}
+	}
+
+	var result interface{} = NULL
 	for _, stmt := range program.Statements {
+		i.step(stmt)
 		result = i.Interpret(stmt)
+
+		if returnValue, ok := result.(*ReturnValue); ok {
+			if tail, ok := returnValue.Value.(*TailCall); ok {
+				return i.applyFunction(tail.Fn, tail.Args, tail.Line)
+			}
+			return returnValue.Value
+		}
 	}
 	return result
 }
 
 func (i *Interpreter) evalVarStatement(stmt *ast.VarStatement) interface{} {
 	val := i.Interpret(stmt.Value)
-	if val != nil {
-		i.env.Set(stmt.Name.Value, val)
+	if fn, ok := val.(*Function); ok && fn.Name == "" {
+		if _, literal := stmt.Value.(*ast.FunctionLiteral); literal {
+			fn.Name = stmt.Name.Value
+		}
+	}
+	i.env.Set(stmt.Name.Index, val)
+	if stmt.Name.Pattern != nil {
+		i.destructure(i.env, stmt.Name.Pattern, val)
 	}
 	return val
 }
 
 func (i *Interpreter) evalIdentifier(node *ast.Identifier) interface{} {
-	if val, ok := i.env.Get(node.Value); ok {
-		return val
+	if !node.Resolved {
+		if b := i.lookupBuiltin(node.Value); b != nil {
+			return b
+		}
+		if i.Strict {
+			i.errorf(node, "undefined variable %s", node.Value)
+		}
+		return NULL
 	}
-	return nil
+	return i.env.Get(node.Depth, node.Index)
 }
 
+// evalInfixExpression applies an operator. ?? takes any operands and only
+// evaluates its right one if the left is null; the rest take integers.
 func (i *Interpreter) evalInfixExpression(node *ast.InfixExpression) interface{} {
-	left := i.Interpret(node.Left).(int64)
-	right := i.Interpret(node.Right).(int64)
+	if node.Operator == "??" {
+		if left := i.Interpret(node.Left); left != NULL {
+			return left
+		}
+		return i.Interpret(node.Right)
+	}
+
+	leftValue := i.Interpret(node.Left)
+	rightValue := i.Interpret(node.Right)
+	left, leftOk := leftValue.(int64)
+	right, rightOk := rightValue.(int64)
+	if !leftOk || !rightOk {
+		i.errorf(node, "unsupported operand types for %s: %s and %s", node.Operator, Inspect(leftValue), Inspect(rightValue))
+	}
 
 	switch node.Operator {
 	case "+":
@@ -121,36 +277,154 @@ func (i *Interpreter) evalInfixExpression(node *ast.InfixExpression) interface{}
 	case "*":
 		return left * right
 	case "/":
+		if right == 0 {
+			i.errorf(node, "division by zero")
+		}
 		return left / right
 	case ">":
 		return left > right
 	case "<":
 		return left < right
-
-	default:
-		return nil
 	}
+
+	i.errorf(node, "unknown operator %s", node.Operator)
+	return nil
 }
 
 func (i *Interpreter) evalIfExpression(node *ast.IfExpression) interface{} {
-	condition := i.Interpret(node.Condition).(bool)
+	condition := i.evalCondition(node.Condition, "if condition")
+	if i.Tracer != nil {
+		i.Tracer.Branch(node, condition)
+	}
 
 	if condition {
 		return i.Interpret(node.Consequence)
 	} else if node.Alternative != nil {
 		return i.Interpret(node.Alternative)
 	} else {
-		return nil
+		return NULL
+	}
+}
+
+// evalCondition evaluates an if condition or a match guard, which must be a
+// boolean in strict booleans mode and is otherwise judged by Truthy.
+func (i *Interpreter) evalCondition(expr ast.Expression, what string) bool {
+	value := i.Interpret(expr)
+	condition, ok := value.(bool)
+	if !ok {
+		if i.StrictBooleans {
+			i.errorf(expr, "%s must be a boolean, got %s", what, Inspect(value))
+		}
+		condition = Truthy(value)
+	}
+	return condition
+}
+
+// evalMatchExpression evaluates the value of the first arm whose pattern
+// matches and whose guard, if it has one, holds. A binding pattern sets its
+// variable before the guard runs, even if the guard then fails.
+func (i *Interpreter) evalMatchExpression(node *ast.MatchExpression) interface{} {
+	arm := i.matchedArm(node)
+	if arm.Body != nil {
+		return i.evalBlockStatement(arm.Body)
+	}
+	return i.Interpret(arm.Value)
+}
+
+// matchedArm returns the arm of node that runs, with the names its pattern
+// binds set. It is an error if there is none.
+func (i *Interpreter) matchedArm(node *ast.MatchExpression) *ast.MatchArm {
+	value := i.Interpret(node.Value)
+
+	for _, arm := range node.Arms {
+		if !i.matchArm(arm, value) {
+			continue
+		}
+		if arm.Guard != nil && !i.evalCondition(arm.Guard, "match guard") {
+			continue
+		}
+		return arm
+	}
+
+	i.errorf(node, "no match arm matches %s", Inspect(value))
+	return nil
+}
+
+func (i *Interpreter) matchArm(arm *ast.MatchArm, value interface{}) bool {
+	for _, pattern := range arm.Patterns {
+		if i.matchPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Interpreter) matchPattern(pattern ast.Expression, value interface{}) bool {
+	if ast.IsWildcard(pattern) {
+		return true
+	}
+	if name := ast.Binding(pattern); name != nil {
+		i.env.Set(name.Index, value)
+		return true
+	}
+	if vp, ok := pattern.(*ast.VariantPattern); ok {
+		return i.matchVariant(vp, value)
+	}
+	if p, ok := pattern.(ast.Pattern); ok {
+		if !fits(p, value) {
+			return false
+		}
+		i.destructure(i.env, p, value)
+		return true
+	}
+	return i.Interpret(pattern) == value
+}
+
+// fits reports whether value has the shape of pattern, so that destructure
+// can take it apart: an array of the right length or a hash with every key
+// the pattern names, all the way down.
+func fits(pattern ast.Pattern, value interface{}) bool {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		return p.Pattern == nil || fits(p.Pattern, value)
+	case *ast.ArrayPattern:
+		array, ok := value.(*Array)
+		if !ok {
+			return false
+		}
+		n := len(p.Elements)
+		if len(array.Elements) < n || p.Rest == nil && len(array.Elements) != n {
+			return false
+		}
+		for idx, e := range p.Elements {
+			if !fits(e, array.Elements[idx]) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return false
+		}
+		for _, k := range p.Keys {
+			if _, ok := hash.Get(k.Value); !ok {
+				return false
+			}
+		}
+		return true
 	}
+	return false
 }
 
 func (i *Interpreter) evalBlockStatement(block *ast.BlockStatement) interface{} {
-	var result interface{}
+	var result interface{} = NULL
 
 	for _, stmt := range block.Statements {
+		i.step(stmt)
 		result = i.Interpret(stmt)
 
-		if i.Exited {
+		if _, ok := result.(*ReturnValue); ok || i.Exited {
 			return result
 		}
 	}
@@ -163,64 +437,242 @@ func (i *Interpreter) evalFunctionLiteral(fl *ast.FunctionLiteral) interface{} {
 	body := fl.Body
 	env := i.env
 
-	fmt.Println("parsed fn literal")
+	return &Function{File: i.File, Parameters: params, Body: body, Locals: fl.Locals, Env: env, Generator: fl.Generator}
+}
+
+// evalChain evaluates a call, a member access or, at the head of a chain of
+// them, any other expression. short reports that a ?. somewhere in the
+// chain met null, which makes the value of the whole chain null without
+// evaluating the rest of it: in a?.b.c(x), neither .c nor x is evaluated
+// if a is null.
+func (i *Interpreter) evalChain(expr ast.Expression) (value interface{}, short bool) {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		return i.evalCallExpression(expr)
+	case *ast.MemberExpression:
+		return i.evalMemberExpression(expr)
+	}
+	return i.Interpret(expr), false
+}
+
+func (i *Interpreter) evalCallExpression(ce *ast.CallExpression) (interface{}, bool) {
+	callee, args, short := i.evalCallee(ce)
+	if short {
+		return NULL, true
+	}
+	if len(i.calls) >= MaxCallDepth {
+		i.errorf(ce, "stack overflow")
+	}
+
+	if b, ok := callee.(*Builtin); ok {
+		return b.Fn(i, ce, args), false
+	}
+	if v, ok := callee.(*Variant); ok {
+		return i.construct(ce, v, args), false
+	}
 
-	return &Function{Parameters: params, Body: body, Env: env}
+	result := i.applyFunction(callee.(*Function), args, ce.Pos().Line)
+	if i.Hook != nil && !i.Exited {
+		i.Hook.Returned(i)
+	}
+	return result, false
 }
 
-func (i *Interpreter) evalCallExpression(ce *ast.CallExpression) interface{} {
-	function := i.Interpret(ce.Function)
+// evalCallee evaluates the function and arguments of a call. The callee is
+// a *Function, a *Builtin or a *Variant; calling anything else is an error. The
+// arguments to a *Function are bound to its parameters, one per parameter. short is
+// true, with nothing else evaluated, if the call is a safe call of null or
+// part of a chain cut short by one.
+func (i *Interpreter) evalCallee(ce *ast.CallExpression) (interface{}, []interface{}, bool) {
+	callee, short := i.evalChain(ce.Function)
+	if short || (ce.Optional && callee == NULL) {
+		return nil, nil, true
+	}
 
-	if function == nil {
-		return nil
+	switch callee.(type) {
+	case *Function, *Builtin, *Variant:
+	default:
+		i.errorf(ce, "calling non-function %s", Inspect(callee))
 	}
 
-	fn, ok := function.(*Function)
-	if !ok {
-		return nil
+	args, named := i.evalArguments(ce.Arguments)
+	switch callee := callee.(type) {
+	case *Builtin:
+		if len(named) != 0 {
+			i.errorf(ce, "%s takes no named arguments", callee.Name)
+		}
+	case *Variant:
+		if len(named) != 0 {
+			i.errorf(ce, "%s.%s takes no named arguments", callee.Enum.Name, callee.Name)
+		}
+	case *Function:
+		var err error
+		if args, err = bindArguments(callee, args, named); err != nil {
+			i.errorf(ce, "%s", err)
+		}
 	}
 
-	args := []interface{}{}
-	for _, arg := range ce.Arguments {
-		args = append(args, i.Interpret(arg))
+	return callee, args, false
+}
+
+// applyFunction runs fn, called on line, then keeps running whatever tail
+// calls it returns in this same Go frame, so self and mutual recursion in
+// tail position use constant stack space. A generator's body does not run
+// yet: once its parameters are bound, the call returns a *Generator.
+func (i *Interpreter) applyFunction(fn *Function, args []interface{}, line int) interface{} {
+	var frame *Frame
+	if i.Hook != nil {
+		frame = i.pushFrame(fn, nil)
 	}
+	i.calls = append(i.calls, call{fn: fn, line: line})
+	tries := i.tries
+	i.tries = 0
+
+	for {
+		extendedEnv := extendFunctionEnv(fn, args)
+		i.bindParameters(fn, extendedEnv, args)
+		if frame != nil {
+			frame.Name, frame.File, frame.Env = fn.Name, fn.File, extendedEnv
+		}
+		var evaluated interface{}
+		if fn.Generator {
+			evaluated = i.newGenerator(fn, extendedEnv)
+		} else {
+			if i.Tracer != nil {
+				i.Tracer.Enter(fn)
+			}
+			evaluated = i.evalBlockStatementWithEnv(fn.Body, extendedEnv)
+			if i.Tracer != nil {
+				i.Tracer.Exit(fn)
+			}
+		}
 
-	extendedEnv := extendFunctionEnv(fn, args)
-	evaluated := i.evalBlockStatementWithEnv(fn.Body, extendedEnv)
-	return evaluated
+		tail, ok := evaluated.(*TailCall)
+		if !ok || i.Exited {
+			if frame != nil {
+				i.popFrame()
+			}
+			i.calls = i.calls[:len(i.calls)-1]
+			i.tries = tries
+			return evaluated
+		}
+		fn, args = tail.Fn, tail.Args
+		i.calls[len(i.calls)-1].fn = fn
+	}
 }
 
 func (i *Interpreter) evalExitStatement(stmt *ast.ExitStatement) interface{} {
 	val := i.Interpret(stmt.Value)
-	if val != nil {
-		i.ExitCode = val.(int64)
-		i.Exited = true
+	code, ok := val.(int64)
+	if !ok {
+		i.errorf(stmt.Value, "exit value must be an integer, got %s", Inspect(val))
 	}
+	i.ExitCode = code
+	i.Exited = true
 	return val
 }
 
 func (i *Interpreter) evalFunctionStatement(stmt *ast.FunctionStatement) interface{} {
+	if stmt.Receiver != nil {
+		return i.evalMethod(stmt)
+	}
 	fn := &Function{
+		Name:       stmt.Name.Value,
+		File:       i.File,
 		Parameters: stmt.Parameters,
 		Body:       stmt.Body,
+		Locals:     stmt.Locals,
 		Env:        i.env,
+		Generator:  stmt.Generator,
 	}
 
-	i.env.Set(stmt.Name.Value, fn)
+	i.env.Set(stmt.Name.Index, fn)
 	return fn
 }
 
 func (i *Interpreter) evalReturnStatement(rs *ast.ReturnStatement) interface{} {
-	value := i.Interpret(rs.ReturnValue)
-	return &ReturnValue{Value: value}
+	// a call in a try body is not a tail call, so that the try catches
+	// what it raises
+	if i.tries == 0 {
+		return &ReturnValue{Value: i.evalTail(rs.ReturnValue)}
+	}
+	return &ReturnValue{Value: i.Interpret(rs.ReturnValue)}
+}
+
+// evalTail evaluates expr in tail position. A call there is returned as a
+// TailCall for applyFunction to make in place of the current one, and so
+// is one that is the value of a branch of an if or an arm of a match there.
+func (i *Interpreter) evalTail(expr ast.Expression) interface{} {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		callee, args, short := i.evalCallee(expr)
+		if short {
+			return NULL
+		}
+		if b, ok := callee.(*Builtin); ok {
+			return b.Fn(i, expr, args)
+		}
+		if v, ok := callee.(*Variant); ok {
+			return i.construct(expr, v, args)
+		}
+		return &TailCall{Fn: callee.(*Function), Args: args, Line: expr.Pos().Line}
+
+	case *ast.IfExpression:
+		condition := i.evalCondition(expr.Condition, "if condition")
+		if i.Tracer != nil {
+			i.Tracer.Branch(expr, condition)
+		}
+		if condition {
+			return i.evalTailBlock(expr.Consequence)
+		} else if expr.Alternative != nil {
+			return i.evalTailBlock(expr.Alternative)
+		}
+		return NULL
+
+	case *ast.MatchExpression:
+		arm := i.matchedArm(expr)
+		if arm.Body != nil {
+			return i.evalTailBlock(arm.Body)
+		}
+		return i.evalTail(arm.Value)
+	}
+	return i.Interpret(expr)
+}
+
+// evalTailBlock evaluates block in tail position, which its last statement
+// is in too.
+func (i *Interpreter) evalTailBlock(block *ast.BlockStatement) interface{} {
+	n := len(block.Statements)
+	if n == 0 {
+		return NULL
+	}
+	var last ast.Expression
+	switch stmt := block.Statements[n-1].(type) {
+	case *ast.ExpressionStatement:
+		last = stmt.Expression
+	case *ast.IfExpression:
+		last = stmt
+	default:
+		return i.evalBlockStatement(block)
+	}
+
+	for _, stmt := range block.Statements[:n-1] {
+		i.step(stmt)
+		if result := i.Interpret(stmt); i.Exited {
+			return result
+		}
+	}
+	i.step(block.Statements[n-1])
+	return i.evalTail(last)
 }
 
 func (i *Interpreter) evalBlockStatementWithEnv(block *ast.BlockStatement, env *Environment) interface{} {
 	previousEnv := i.env
 	i.env = env
 
-	var result interface{}
+	var result interface{} = NULL
 	for _, stmt := range block.Statements {
+		i.step(stmt)
 		result = i.Interpret(stmt)
 		if returnValue, ok := result.(*ReturnValue); ok {
 			i.env = previousEnv
@@ -236,17 +688,20 @@ func (i *Interpreter) evalBlockStatementWithEnv(block *ast.BlockStatement, env *
 }
 
 func extendFunctionEnv(fn *Function, args []interface{}) *Environment {
-	env := NewEnclosedEnvironment(fn.Env)
+	env := NewEnclosedEnvironment(fn.Env, fn.Locals)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, (args[paramIdx]).(int64))
+		env.Set(param.Index, args[paramIdx])
+	}
+	if fn.Receiver != nil {
+		env.Set(fn.Receiver.Index, fn.Self)
 	}
 
 	return env
 }
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
+func NewEnclosedEnvironment(outer *Environment, names []string) *Environment {
+	env := NewEnvironment(names)
 	env.outer = outer
 	return env
 }
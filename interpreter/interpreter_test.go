@@ -0,0 +1,27 @@
+package interpreter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+// A program the resolver rejects does not run at all.
+func TestRunResolverErrors(t *testing.T) {
+	p := parser.New(lexer.NewLexer(strings.NewReader("puts(\"ran\");\nvar a = b;\nvar b = 1;\n")))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	interp := interpreter.New()
+	interp.File = "main.salami"
+	_, err := interp.Run(program)
+	want := "main.salami: resolver errors: 2:9: b used before declaration"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,219 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+// Module is the value an import statement binds: the exported globals of
+// one salami file after it has run.
+type Module struct {
+	Path    string
+	Exports map[string]interface{}
+
+	exited   bool
+	exitCode int64
+}
+
+func (m *Module) String() string { return fmt.Sprintf("<module %s>", m.Path) }
+
+// Loader finds imported files, runs each of them once and caches the
+// resulting modules. Every interpreter taking part in one program shares a
+// Loader.
+type Loader struct {
+	SearchPath     []string
+	Tracer         Tracer // given to the interpreters running modules, if set
+	Strict         bool   // run modules in strict mode
+	StrictBooleans bool   // run modules with strict booleans
+
+	modules map[string]*Module
+	loading []string // files currently being run, outermost first
+}
+
+func NewLoader(searchPath []string) *Loader {
+	return &Loader{SearchPath: searchPath, modules: make(map[string]*Module)}
+}
+
+// SearchPath returns the directories listed in the SALAMI_PATH environment
+// variable followed by the project root. Salami has no project file to mark
+// a root, so callers pass the directory of the file the program starts
+// from: an import then finds the same files whatever directory salami is
+// run in.
+func SearchPath(root string) []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("SALAMI_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, root)
+}
+
+// Load returns the module for path as imported from a file in fromDir.
+// Paths starting with ./ or ../ are relative to fromDir; any other relative
+// path is looked up along the search path.
+func (l *Loader) Load(fromDir, path string) (*Module, error) {
+	file, err := l.Find(fromDir, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := l.modules[file]; ok {
+		return m, nil
+	}
+
+	for idx, loading := range l.loading {
+		if loading == file {
+			cycle := []string{}
+			for _, f := range append(l.loading[idx:], file) {
+				cycle = append(cycle, filepath.Base(f))
+			}
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, err := ParseModule(file)
+	if err != nil {
+		return nil, err
+	}
+
+	interp := New()
+	interp.Loader = l
+	interp.File = file
+	interp.Tracer = l.Tracer
+	interp.Strict = l.Strict
+	interp.StrictBooleans = l.StrictBooleans
+
+	if _, err := interp.Run(program); err != nil {
+		return nil, err
+	}
+
+	m := &Module{Path: file, Exports: make(map[string]interface{}), exited: interp.Exited, exitCode: interp.ExitCode}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			name := export.Name()
+			m.Exports[name.Value] = interp.env.Get(0, name.Index)
+		}
+	}
+
+	l.modules[file] = m
+	return m, nil
+}
+
+// Find returns the absolute path of the file path names, imported from a
+// file in fromDir.
+func (l *Loader) Find(fromDir, path string) (string, error) {
+	var candidates []string
+	switch {
+	case filepath.IsAbs(path):
+		candidates = []string{path}
+	case strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../"):
+		candidates = []string{filepath.Join(fromDir, path)}
+	default:
+		for _, dir := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			return filepath.Abs(c)
+		}
+	}
+
+	return "", fmt.Errorf("cannot find module %q (looked in %s)", path, strings.Join(candidates, ", "))
+}
+
+// ParseModule parses and resolves the file of a module.
+func ParseModule(file string) (*ast.Program, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := parser.New(lexer.NewLexer(f))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s: parser errors: %s", file, strings.Join(errs, "; "))
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		return nil, fmt.Errorf("%s: resolver errors: %s", file, strings.Join(errs, "; "))
+	}
+
+	return program, nil
+}
+
+// loader returns the interpreter's Loader, making one rooted at the
+// directory of its file, or at the working directory if it has none, the
+// first time it is needed. The interpreter that makes it runs the entry
+// file; those running modules share it.
+func (i *Interpreter) loader() *Loader {
+	if i.Loader == nil {
+		root, _ := os.Getwd()
+		if i.File != "" {
+			root = filepath.Dir(i.File)
+		}
+		i.Loader = NewLoader(SearchPath(root))
+		i.Loader.Strict = i.Strict
+		i.Loader.StrictBooleans = i.StrictBooleans
+	}
+	return i.Loader
+}
+
+func (i *Interpreter) evalImportStatement(stmt *ast.ImportStatement) interface{} {
+	fromDir := "."
+	if i.File != "" {
+		fromDir = filepath.Dir(i.File)
+	}
+
+	m, err := i.loader().Load(fromDir, stmt.Path.Value)
+	if err != nil {
+		i.errorf(stmt, "import %q: %s", stmt.Path.Value, err)
+	}
+
+	if m.exited {
+		i.ExitCode = m.exitCode
+		i.Exited = true
+	}
+
+	i.env.Set(stmt.Alias.Index, m)
+	return m
+}
+
+func (i *Interpreter) evalMemberExpression(me *ast.MemberExpression) (interface{}, bool) {
+	object, short := i.evalChain(me.Object)
+	if short || (me.Optional && object == NULL) {
+		return NULL, true
+	}
+
+	if e, ok := object.(*Error); ok {
+		return i.errorMember(me, e), false
+	}
+	if s, ok := object.(*Struct); ok {
+		return i.structMember(me, s), false
+	}
+	if e, ok := object.(*Enum); ok {
+		return i.enumMember(me, e), false
+	}
+	if v, ok := object.(*EnumValue); ok {
+		return i.enumValueMember(me, v), false
+	}
+	m, ok := object.(*Module)
+	if !ok {
+		i.errorf(me, "cannot access .%s on %s, it is not a struct, enum, module or error", me.Member.Value, Inspect(object))
+	}
+
+	value, ok := m.Exports[me.Member.Value]
+	if !ok {
+		i.errorf(me, "%s does not export %s", filepath.Base(m.Path), me.Member.Value)
+	}
+	return value, false
+}
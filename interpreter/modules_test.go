@@ -0,0 +1,132 @@
+package interpreter_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+// writeFiles writes each file, by its path relative to dir, creating the
+// directories it is in.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runFile runs the program in path and returns its exit code.
+func runFile(t *testing.T, path string) (int64, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p := parser.New(lexer.NewLexer(f))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	interp := interpreter.New()
+	interp.File = path
+	_, err = interp.Run(program)
+	return interp.ExitCode, err
+}
+
+// A module imported from several files, by different paths, runs once and
+// is the same module each time.
+func TestModuleCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib/counter.salami": "struct Counter { count }\nexport var state = Counter{count: 0};\nstate.count = state.count + 1;\n",
+		"lib/other.salami":   "import \"./counter.salami\" as counter;\nexport var state = counter.state;\n",
+		"main.salami": `import "./lib/counter.salami" as a;
+import "./lib/other.salami" as b;
+import "./lib/../lib/counter.salami" as c;
+a.state.count = a.state.count + 4;
+exit c.state.count * 10 + b.state.count;
+`,
+	})
+	code, err := runFile(t, filepath.Join(dir, "main.salami"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 55 {
+		t.Errorf("got exit code %d, want 55: the module ran more than once", code)
+	}
+
+	l := interpreter.NewLoader(nil)
+	first, err := l.Load(dir, "./lib/counter.salami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Load(filepath.Join(dir, "lib"), "./counter.salami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("loading the same file twice gave two modules")
+	}
+}
+
+func TestModuleCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.salami": "import \"./a.salami\" as a;\nexit 0;\n",
+		"a.salami":    "import \"./b.salami\" as b;\nexport var x = 1;\n",
+		"b.salami":    "import \"./a.salami\" as a;\nexport var y = 2;\n",
+	})
+	_, err := runFile(t, filepath.Join(dir, "main.salami"))
+	if err == nil || !strings.Contains(err.Error(), "import cycle: a.salami -> b.salami -> a.salami") {
+		t.Errorf("got %v, want an import cycle through a and b", err)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	dir := t.TempDir()
+	first, second, root := filepath.Join(dir, "first"), filepath.Join(dir, "second"), filepath.Join(dir, "project")
+	writeFiles(t, dir, map[string]string{
+		"second/shared.salami":   "export var from = 2;\n",
+		"project/shared.salami":  "export var from = 3;\n",
+		"project/local.salami":   "export var from = 3;\n",
+		"project/main.salami":    "import \"shared.salami\" as shared;\nimport \"local.salami\" as local;\nexit shared.from * 10 + local.from;\n",
+		"project/sub/dir.salami": "export var from = 4;\n",
+	})
+	t.Setenv("SALAMI_PATH", first+string(os.PathListSeparator)+string(os.PathListSeparator)+second)
+
+	if got, want := interpreter.SearchPath(root), []string{first, second, root}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search path: got %v, want %v", got, want)
+	}
+
+	// The directory of the file a program starts from is its project root,
+	// whatever the working directory.
+	code, err := runFile(t, filepath.Join(root, "main.salami"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 23 {
+		t.Errorf("got exit code %d, want 23: shared from SALAMI_PATH, local from the project root", code)
+	}
+
+	l := interpreter.NewLoader(interpreter.SearchPath(root))
+	if _, err := l.Find(root, "missing.salami"); err == nil || !strings.Contains(err.Error(), `cannot find module "missing.salami"`) {
+		t.Errorf("missing module: got %v", err)
+	}
+	if _, err := l.Find(dir, "sub/dir.salami"); err != nil {
+		t.Errorf("a path into a directory under the project root: %v", err)
+	}
+}
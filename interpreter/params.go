@@ -0,0 +1,132 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// namedArgument is an argument passed by name, as in f(b: 3).
+type namedArgument struct {
+	name  string
+	value interface{}
+}
+
+// unset fills the slot of a parameter the call left out, until applyFunction
+// evaluates the parameter's default in its place. It never reaches a
+// running program.
+type unset struct{}
+
+var missing = &unset{}
+
+// evalArguments evaluates the arguments of a call in order, expanding
+// spreads into the positional arguments and setting aside named ones.
+func (i *Interpreter) evalArguments(args []ast.Expression) ([]interface{}, []namedArgument) {
+	positional := []interface{}{}
+	var named []namedArgument
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case *ast.SpreadExpression:
+			value := i.Interpret(arg.Value)
+			arr, ok := value.(*Array)
+			if !ok {
+				i.errorf(arg, "cannot spread %s, it is not an array", Inspect(value))
+			}
+			positional = append(positional, arr.Elements...)
+		case *ast.NamedArgument:
+			named = append(named, namedArgument{arg.Name, i.Interpret(arg.Value)})
+		default:
+			positional = append(positional, i.Interpret(arg))
+		}
+	}
+	return positional, named
+}
+
+// bindArguments matches the arguments of a call to the parameters of fn
+// and returns one value per parameter. Positional arguments fill the
+// parameters in order and any left over are collected into an array for a
+// variadic last parameter; named arguments fill the parameters with their
+// names. A parameter left out gets missing if it has a default.
+func bindArguments(fn *Function, positional []interface{}, named []namedArgument) ([]interface{}, error) {
+	params := fn.Parameters
+	fixed := len(params)
+	variadic := fixed > 0 && params[fixed-1].Variadic
+	if variadic {
+		fixed--
+	}
+
+	if len(positional) > fixed && !variadic {
+		want := fmt.Sprint(fixed)
+		if fixed > 0 && params[fixed-1].Default != nil {
+			want = "at most " + want
+		}
+		return nil, fmt.Errorf("too many arguments to %s: want %s, got %d", functionName(fn), want, len(positional))
+	}
+
+	args := make([]interface{}, len(params))
+	given := make([]bool, len(params))
+	for idx := 0; idx < fixed && idx < len(positional); idx++ {
+		args[idx], given[idx] = positional[idx], true
+	}
+	if variadic {
+		rest := []interface{}{}
+		if len(positional) > fixed {
+			rest = append(rest, positional[fixed:]...)
+		}
+		args[fixed] = &Array{Elements: rest}
+	}
+
+	for _, arg := range named {
+		idx := -1
+		for pidx, p := range params[:fixed] {
+			if p.Value == arg.name {
+				idx = pidx
+			}
+		}
+		switch {
+		case idx < 0 && variadic && params[fixed].Value == arg.name:
+			return nil, fmt.Errorf("cannot pass ...%s by name", arg.name)
+		case idx < 0:
+			return nil, fmt.Errorf("%s has no parameter %s", functionName(fn), arg.name)
+		case given[idx]:
+			return nil, fmt.Errorf("argument %s given twice in call to %s", arg.name, functionName(fn))
+		}
+		args[idx], given[idx] = arg.value, true
+	}
+
+	for idx, p := range params[:fixed] {
+		if given[idx] {
+			continue
+		}
+		if p.Default == nil {
+			return nil, fmt.Errorf("missing argument %s in call to %s", p.Value, functionName(fn))
+		}
+		args[idx] = missing
+	}
+	return args, nil
+}
+
+// bindParameters evaluates the defaults of the parameters the call left
+// out and destructures pattern parameters, in parameter order, so a
+// default sees the parameters before it.
+func (i *Interpreter) bindParameters(fn *Function, env *Environment, args []interface{}) {
+	previousEnv := i.env
+	i.env = env
+	for idx, param := range fn.Parameters {
+		if args[idx] == missing {
+			args[idx] = i.Interpret(param.Default)
+			env.Set(param.Index, args[idx])
+		}
+		if param.Pattern != nil {
+			i.destructure(env, param.Pattern, args[idx])
+		}
+	}
+	i.env = previousEnv
+}
+
+func functionName(fn *Function) string {
+	if fn.Name == "" {
+		return "anonymous function"
+	}
+	return fn.Name
+}
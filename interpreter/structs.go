@@ -0,0 +1,133 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+// StructType is what a struct declaration binds its name to: the names of
+// its fields, in order, and the methods declared on it so far.
+type StructType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]*Function
+}
+
+func (t *StructType) String() string { return "<struct " + t.Name + ">" }
+
+// field returns the index of the field called name, or -1.
+func (t *StructType) field(name string) int {
+	for idx, f := range t.Fields {
+		if f == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Struct is a value of a struct, with one value per field of its type.
+// Like an array or hash it is shared, not copied, when it is passed
+// around, so setting a field shows through every name for it.
+type Struct struct {
+	Type   *StructType
+	Fields []interface{}
+}
+
+func (s *Struct) String() string { return Inspect(s) }
+
+func inspectStruct(s *Struct) string {
+	parts := make([]string, len(s.Fields))
+	for idx, v := range s.Fields {
+		parts[idx] = s.Type.Fields[idx] + ": " + Inspect(v)
+	}
+	return s.Type.Name + "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (i *Interpreter) evalStructStatement(stmt *ast.StructStatement) interface{} {
+	t := &StructType{Name: stmt.Name.Value, Methods: map[string]*Function{}}
+	for _, f := range stmt.Fields {
+		t.Fields = append(t.Fields, f.Value)
+	}
+	i.env.Set(stmt.Name.Index, t)
+	return t
+}
+
+func (i *Interpreter) evalStructLiteral(node *ast.StructLiteral) interface{} {
+	typ := i.Interpret(node.Type)
+	t, ok := typ.(*StructType)
+	if !ok {
+		i.errorf(node, "%s is not a struct", Inspect(typ))
+	}
+
+	s := &Struct{Type: t, Fields: make([]interface{}, len(t.Fields))}
+	for idx := range s.Fields {
+		s.Fields[idx] = NULL
+	}
+	for idx, f := range node.Fields {
+		field := t.field(f.Value)
+		if field < 0 {
+			i.errorf(f, "%s has no field %s", t.Name, f.Value)
+		}
+		s.Fields[field] = i.Interpret(node.Values[idx])
+	}
+	return s
+}
+
+// evalMethod adds a method to the struct its receiver names. The method's
+// name is not declared anywhere else.
+func (i *Interpreter) evalMethod(stmt *ast.FunctionStatement) interface{} {
+	typ := i.Interpret(stmt.ReceiverType)
+	t, ok := typ.(*StructType)
+	if !ok {
+		i.errorf(stmt.ReceiverType, "cannot declare method %s on %s, it is not a struct", stmt.Name.Value, Inspect(typ))
+	}
+	if t.field(stmt.Name.Value) >= 0 {
+		i.errorf(stmt.Name, "%s already has a field %s", t.Name, stmt.Name.Value)
+	}
+
+	fn := &Function{
+		Name:       t.Name + "." + stmt.Name.Value,
+		File:       i.File,
+		Parameters: stmt.Parameters,
+		Body:       stmt.Body,
+		Locals:     stmt.Locals,
+		Env:        i.env,
+		Receiver:   stmt.Receiver,
+		Generator:  stmt.Generator,
+	}
+	t.Methods[stmt.Name.Value] = fn
+	return fn
+}
+
+// structMember is the value of s.name: a field, or a method bound to s.
+func (i *Interpreter) structMember(me *ast.MemberExpression, s *Struct) interface{} {
+	name := me.Member.Value
+	if field := s.Type.field(name); field >= 0 {
+		return s.Fields[field]
+	}
+	if method, ok := s.Type.Methods[name]; ok {
+		bound := *method
+		bound.Self = s
+		return &bound
+	}
+	i.errorf(me, "%s has no field or method %s", s.Type.Name, name)
+	return nil
+}
+
+func (i *Interpreter) evalAssignStatement(stmt *ast.AssignStatement) interface{} {
+	name := stmt.Target.Member.Value
+	object := i.Interpret(stmt.Target.Object)
+	s, ok := object.(*Struct)
+	if !ok {
+		i.errorf(stmt, "cannot set .%s on %s, it is not a struct", name, Inspect(object))
+	}
+
+	field := s.Type.field(name)
+	if field < 0 {
+		i.errorf(stmt, "%s has no field %s", s.Type.Name, name)
+	}
+	value := i.Interpret(stmt.Value)
+	s.Fields[field] = value
+	return value
+}
@@ -3,6 +3,7 @@ package lexer
 import (
 	"bufio"
 	"io"
+	"strings"
 	"unicode"
 
 	"github.com/afoley/salami-lang/tok"
@@ -14,8 +15,9 @@ type LexPosition struct {
 }
 
 type Lexer struct {
-	pos    LexPosition
-	reader *bufio.Reader
+	pos      LexPosition
+	reader   *bufio.Reader
+	comments []tok.Comment
 }
 
 func NewLexer(reader io.Reader) *Lexer {
@@ -41,7 +43,15 @@ func (l *Lexer) Lex() (LexPosition, tok.TokenType, string) {
 		case '\n':
 			l.handleNewLine()
 		case '=':
-			return l.pos, tok.ASSIGN, "="
+			starts := l.pos
+			if next, _, err := l.reader.ReadRune(); err == nil {
+				if next == '>' {
+					l.pos.Column++
+					return starts, tok.ARROW, "=>"
+				}
+				l.reader.UnreadRune()
+			}
+			return starts, tok.ASSIGN, "="
 		case '+':
 			return l.pos, tok.PLUS, "+"
 		case '-':
@@ -49,6 +59,13 @@ func (l *Lexer) Lex() (LexPosition, tok.TokenType, string) {
 		case '*':
 			return l.pos, tok.ASTERISK, "*"
 		case '/':
+			if next, _, err := l.reader.ReadRune(); err == nil {
+				if next == '/' {
+					l.readComment()
+					continue
+				}
+				l.reader.UnreadRune()
+			}
 			return l.pos, tok.SLASH, "/"
 		case ';':
 			return l.pos, tok.SEMICOLON, ";"
@@ -60,12 +77,57 @@ func (l *Lexer) Lex() (LexPosition, tok.TokenType, string) {
 			return l.pos, tok.LBRACE, "{"
 		case '}':
 			return l.pos, tok.RBRACE, "}"
+		case '[':
+			return l.pos, tok.LBRACKET, "["
+		case ']':
+			return l.pos, tok.RBRACKET, "]"
 		case '>':
 			return l.pos, tok.GT, ">"
 		case '<':
 			return l.pos, tok.LT, "<"
 		case ',':
 			return l.pos, tok.COMMA, ","
+		case ':':
+			return l.pos, tok.COLON, ":"
+		case '.':
+			starts := l.pos
+			if next, _, err := l.reader.ReadRune(); err == nil {
+				if next != '.' {
+					l.reader.UnreadRune()
+					return starts, tok.DOT, "."
+				}
+				l.pos.Column++
+				if third, _, err := l.reader.ReadRune(); err == nil {
+					if third == '.' {
+						l.pos.Column++
+						return starts, tok.ELLIPSIS, "..."
+					}
+					l.reader.UnreadRune()
+				}
+				return starts, tok.ILLEGAL, ".."
+			}
+			return starts, tok.DOT, "."
+		case '?':
+			starts := l.pos
+			if next, _, err := l.reader.ReadRune(); err == nil {
+				switch next {
+				case '?':
+					l.pos.Column++
+					return starts, tok.COALESCE, "??"
+				case '.':
+					l.pos.Column++
+					return starts, tok.OPTIONAL_DOT, "?."
+				}
+				l.reader.UnreadRune()
+			}
+			return starts, tok.ILLEGAL, "?"
+		case '"':
+			starts := l.pos
+			literal, ok := l.readString()
+			if !ok {
+				return starts, tok.ILLEGAL, literal
+			}
+			return starts, tok.STRING, literal
 		default:
 			if unicode.IsSpace(r) {
 				continue // nothing to do here, just move on
@@ -74,7 +136,7 @@ func (l *Lexer) Lex() (LexPosition, tok.TokenType, string) {
 				l.goBack()
 				literal := l.readDigit()
 				return starts, tok.INT, literal
-			} else if unicode.IsPrint(r) {
+			} else if unicode.IsLetter(r) || r == '_' {
 				starts := l.pos
 				l.goBack()
 				literal := l.readIdentifier()
@@ -87,9 +149,42 @@ func (l *Lexer) Lex() (LexPosition, tok.TokenType, string) {
 	}
 }
 
+// Comments returns the comments skipped so far, in source order.
+func (l *Lexer) Comments() []tok.Comment {
+	return l.comments
+}
+
+// readComment reads the rest of a line comment whose first slash has just
+// been read and the second consumed, leaving the newline for Lex.
+func (l *Lexer) readComment() {
+	pos := tok.Position{Line: l.pos.Line, Column: l.pos.Column}
+	text := "//"
+	l.pos.Column++
+
+	for {
+		r, _, err := l.reader.ReadRune()
+		if err != nil {
+			break
+		}
+		if r == '\n' {
+			l.reader.UnreadRune()
+			break
+		}
+		l.pos.Column++
+		text += string(r)
+	}
+
+	l.comments = append(l.comments, tok.Comment{Pos: pos, Text: strings.TrimRight(text, " \t\r")})
+}
+
 func (l *Lexer) NextToken() tok.Tok {
-	_, tokType, literal := l.Lex()
-	return tok.Tok{Type: tokType, Literal: literal}
+	pos, tokType, literal := l.Lex()
+	return tok.Tok{
+		Type:    tokType,
+		Literal: literal,
+		Pos:     tok.Position{Line: pos.Line, Column: pos.Column},
+		End:     tok.Position{Line: l.pos.Line, Column: l.pos.Column + 1},
+	}
 }
 
 func (l *Lexer) handleNewLine() {
@@ -143,7 +238,7 @@ func (l *Lexer) readIdentifier() string {
 
 		l.pos.Column++
 
-		if unicode.IsLetter(r) {
+		if unicode.IsLetter(r) || r == '_' || (literal != "" && unicode.IsDigit(r)) {
 			literal += string(r)
 		} else {
 			l.goBack()
@@ -151,3 +246,41 @@ func (l *Lexer) readIdentifier() string {
 		}
 	}
 }
+
+// readString reads up to the closing quote, handling \", \\, \n and \t
+// escapes. It reports false if the input ends first.
+func (l *Lexer) readString() (string, bool) {
+	literal := ""
+	escaped := false
+
+	for {
+		r, _, err := l.reader.ReadRune()
+		if err != nil {
+			return literal, false
+		}
+
+		l.pos.Column++
+		if r == '\n' {
+			l.handleNewLine()
+		}
+
+		switch {
+		case escaped:
+			switch r {
+			case 'n':
+				literal += "\n"
+			case 't':
+				literal += "\t"
+			default:
+				literal += string(r)
+			}
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			return literal, true
+		default:
+			literal += string(r)
+		}
+	}
+}
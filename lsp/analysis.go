@@ -0,0 +1,506 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/format"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/tok"
+	"github.com/afoley/salami-lang/typecheck"
+	"github.com/afoley/salami-lang/vet"
+)
+
+type bindingKind int
+
+const (
+	variableBinding bindingKind = iota
+	functionBinding
+	parameterBinding
+	moduleBinding
+	structBinding
+	enumBinding
+)
+
+// binding is one variable slot found by the resolver, with every
+// identifier that declares or reads it.
+type binding struct {
+	name   string
+	kind   bindingKind
+	decl   *ast.Identifier
+	idents []*ast.Identifier // declarations and uses, in source order
+	fn     *ast.FunctionStatement
+	st     *ast.StructStatement
+	en     *ast.EnumStatement
+	scope  *scope
+	slot   int
+}
+
+type scope struct {
+	start, end tok.Position
+	slots      map[int]*binding
+}
+
+func (s *scope) contains(pos tok.Position) bool {
+	return !before(pos, s.start) && !before(s.end, pos)
+}
+
+type document struct {
+	uri  string
+	text string
+
+	// From the last version of the text that parsed cleanly, so navigation
+	// keeps working while the user is mid-edit.
+	program     *ast.Program
+	bindings    []*binding
+	idents      map[*ast.Identifier]*binding
+	scopes      []*scope
+	globalTypes []typecheck.Type
+
+	diagnostics []Diagnostic
+}
+
+func analyze(uri, text string, previous *document) *document {
+	doc := &document{uri: uri, text: text, diagnostics: []Diagnostic{}}
+
+	p := parser.New(lexer.NewLexer(strings.NewReader(text)))
+	program := p.ParseProgram()
+	doc.addDiagnostics(p.Errors(), "parser", SeverityError)
+
+	if len(p.Errors()) != 0 {
+		if previous != nil {
+			doc.program = previous.program
+			doc.bindings = previous.bindings
+			doc.idents = previous.idents
+			doc.scopes = previous.scopes
+			doc.globalTypes = previous.globalTypes
+		}
+		return doc
+	}
+
+	doc.addDiagnostics(resolver.Resolve(program), "resolver", SeverityError)
+
+	types, typeErrs := typecheck.Check(program, typecheck.Options{})
+	doc.addDiagnostics(typeErrs, "typecheck", SeverityWarning)
+
+	var findings []string
+	for _, d := range vet.Run(program, vet.Analyzers) {
+		findings = append(findings, d.String())
+	}
+	doc.addDiagnostics(findings, "vet", SeverityWarning)
+
+	doc.program = program
+	doc.globalTypes = types
+	doc.index()
+
+	return doc
+}
+
+// addDiagnostics converts "line:col: message" errors into diagnostics
+// spanning the rest of the word at that position.
+func (d *document) addDiagnostics(errs []string, source string, severity int) {
+	for _, e := range errs {
+		pos, msg := splitPosition(e)
+		start := toLSP(pos)
+		end := start
+		end.Character += wordLength(d.text, start)
+		if end == start {
+			end.Character++
+		}
+
+		d.diagnostics = append(d.diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: end},
+			Severity: severity,
+			Source:   "salami " + source,
+			Message:  msg,
+		})
+	}
+}
+
+func splitPosition(e string) (tok.Position, string) {
+	parts := strings.SplitN(e, ":", 3)
+	if len(parts) == 3 {
+		line, err1 := strconv.Atoi(parts[0])
+		col, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil {
+			return tok.Position{Line: line, Column: col}, strings.TrimSpace(parts[2])
+		}
+	}
+	return tok.Position{Line: 1, Column: 1}, e
+}
+
+func wordLength(text string, pos Position) int {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return 0
+	}
+	line := []rune(lines[pos.Line])
+	n := 0
+	for i := pos.Character; i < len(line) && isWordRune(line[i]); i++ {
+		n++
+	}
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
+
+// index records every binding in the program and which identifiers refer to
+// it, following the depth and slot annotations left by the resolver.
+func (d *document) index() {
+	d.idents = map[*ast.Identifier]*binding{}
+	d.bindings = nil
+	d.scopes = nil
+
+	ix := &indexer{doc: d}
+	ix.enter(tok.Position{Line: 1, Column: 1}, tok.Position{Line: 1 << 30})
+	ix.statements(d.program.Statements)
+}
+
+type indexer struct {
+	doc   *document
+	stack []*scope
+}
+
+func (ix *indexer) enter(start, end tok.Position) {
+	s := &scope{start: start, end: end, slots: map[int]*binding{}}
+	ix.stack = append(ix.stack, s)
+	ix.doc.scopes = append(ix.doc.scopes, s)
+}
+
+func (ix *indexer) leave() {
+	ix.stack = ix.stack[:len(ix.stack)-1]
+}
+
+func (ix *indexer) bindingFor(s *scope, slot int, name string) *binding {
+	b, ok := s.slots[slot]
+	if !ok {
+		b = &binding{name: name, scope: s, slot: slot}
+		s.slots[slot] = b
+		ix.doc.bindings = append(ix.doc.bindings, b)
+	}
+	return b
+}
+
+func (ix *indexer) declare(ident *ast.Identifier, kind bindingKind) *binding {
+	b := ix.bindingFor(ix.stack[len(ix.stack)-1], ident.Index, ident.Value)
+	if b.decl == nil {
+		b.decl = ident
+		b.kind = kind
+	}
+	b.idents = append(b.idents, ident)
+	ix.doc.idents[ident] = b
+	return b
+}
+
+// declareNames declares ident, or for the name standing in for a
+// destructuring pattern, each name in the pattern instead.
+func (ix *indexer) declareNames(ident *ast.Identifier, kind bindingKind) {
+	if ident.Pattern == nil {
+		ix.declare(ident, kind)
+		return
+	}
+	for _, name := range ast.PatternNames(ident) {
+		ix.declare(name, kind)
+	}
+}
+
+func (ix *indexer) use(ident *ast.Identifier) {
+	if !ident.Resolved || ident.Depth >= len(ix.stack) {
+		return
+	}
+	s := ix.stack[len(ix.stack)-1-ident.Depth]
+	b := ix.bindingFor(s, ident.Index, ident.Value)
+	b.idents = append(b.idents, ident)
+	ix.doc.idents[ident] = b
+}
+
+func (ix *indexer) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		ix.node(stmt)
+	}
+}
+
+// function indexes a gorlami, or a method if receiver is not nil.
+func (ix *indexer) function(start tok.Position, receiver *ast.Identifier, params []*ast.Identifier, body *ast.BlockStatement) {
+	ix.enter(start, body.End)
+	for _, p := range params {
+		if p.Default != nil {
+			ix.node(p.Default)
+		}
+		ix.declareNames(p, parameterBinding)
+	}
+	if receiver != nil {
+		ix.declare(receiver, parameterBinding)
+	}
+	ix.statements(body.Statements)
+	ix.leave()
+}
+
+// pattern declares the names a match pattern binds and uses those of the
+// variants it names.
+func (ix *indexer) pattern(pattern ast.Expression) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if name := ast.Binding(p); name != nil {
+			ix.declare(name, variableBinding)
+		}
+	case *ast.MemberExpression:
+		ix.node(p)
+	case *ast.VariantPattern:
+		ix.node(p.Type)
+		for _, sub := range p.Patterns {
+			ix.pattern(sub)
+		}
+	case *ast.ArrayPattern, *ast.HashPattern:
+		for _, name := range ast.PatternNames(p.(ast.Pattern)) {
+			ix.declare(name, variableBinding)
+		}
+	}
+}
+
+func (ix *indexer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.VarStatement:
+		ix.node(node.Value)
+		ix.declareNames(node.Name, variableBinding)
+
+	case *ast.FunctionStatement:
+		// a method's name is not declared in any scope
+		if node.Receiver != nil {
+			ix.use(node.ReceiverType)
+		} else if b := ix.declare(node.Name, functionBinding); b.fn == nil {
+			b.fn = node
+		}
+		ix.function(node.Pos(), node.Receiver, node.Parameters, node.Body)
+
+	case *ast.FunctionLiteral:
+		ix.function(node.Pos(), nil, node.Parameters, node.Body)
+
+	case *ast.StructStatement:
+		if b := ix.declare(node.Name, structBinding); b.st == nil {
+			b.st = node
+		}
+
+	case *ast.EnumStatement:
+		if b := ix.declare(node.Name, enumBinding); b.en == nil {
+			b.en = node
+		}
+
+	case *ast.StructLiteral:
+		ix.node(node.Type)
+		for _, v := range node.Values {
+			ix.node(v)
+		}
+
+	case *ast.AssignStatement:
+		ix.node(node.Target)
+		ix.node(node.Value)
+
+	case *ast.ImportStatement:
+		ix.declare(node.Alias, moduleBinding)
+
+	case *ast.ExportStatement:
+		ix.node(node.Declaration)
+
+	case *ast.ReturnStatement:
+		ix.node(node.ReturnValue)
+
+	case *ast.ExitStatement:
+		ix.node(node.Value)
+
+	case *ast.ThrowStatement:
+		ix.node(node.Value)
+
+	case *ast.YieldStatement:
+		ix.node(node.Value)
+
+	case *ast.ForStatement:
+		ix.node(node.Iterable)
+		ix.declareNames(node.Name, variableBinding)
+		ix.node(node.Body)
+
+	case *ast.TryStatement:
+		ix.node(node.Body)
+		if node.Catch != nil {
+			ix.declare(node.Param, variableBinding)
+			ix.node(node.Catch)
+		}
+		if node.Finally != nil {
+			ix.node(node.Finally)
+		}
+
+	case *ast.ExpressionStatement:
+		ix.node(node.Expression)
+
+	case *ast.IfExpression:
+		ix.node(node.Condition)
+		ix.node(node.Consequence)
+		if node.Alternative != nil {
+			ix.node(node.Alternative)
+		}
+
+	case *ast.MatchExpression:
+		ix.node(node.Value)
+		for _, arm := range node.Arms {
+			for _, p := range arm.Patterns {
+				ix.pattern(p)
+			}
+			if arm.Guard != nil {
+				ix.node(arm.Guard)
+			}
+			if arm.Body != nil {
+				ix.node(arm.Body)
+			} else {
+				ix.node(arm.Value)
+			}
+		}
+
+	case *ast.BlockStatement:
+		ix.statements(node.Statements)
+
+	case *ast.InfixExpression:
+		ix.node(node.Left)
+		ix.node(node.Right)
+
+	case *ast.CallExpression:
+		ix.node(node.Function)
+		for _, a := range node.Arguments {
+			ix.node(a)
+		}
+
+	case *ast.MemberExpression:
+		ix.node(node.Object)
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			ix.node(e)
+		}
+
+	case *ast.HashLiteral:
+		for idx := range node.Keys {
+			ix.node(node.Keys[idx])
+			ix.node(node.Values[idx])
+		}
+
+	case *ast.IndexExpression:
+		ix.node(node.Left)
+		ix.node(node.Index)
+
+	case *ast.NamedArgument:
+		ix.node(node.Value)
+
+	case *ast.SpreadExpression:
+		ix.node(node.Value)
+
+	case *ast.Identifier:
+		ix.use(node)
+	}
+}
+
+// identAt returns the identifier under pos, if any.
+func (d *document) identAt(pos Position) (*ast.Identifier, *binding) {
+	for ident, b := range d.idents {
+		r := identRange(ident)
+		if r.Start.Line == pos.Line && r.Start.Character <= pos.Character && pos.Character <= r.End.Character {
+			return ident, b
+		}
+	}
+	return nil, nil
+}
+
+// visible returns the bindings whose scope encloses pos, innermost first,
+// skipping names shadowed by an inner scope.
+func (d *document) visible(pos tok.Position) []*binding {
+	seen := map[string]bool{}
+	var out []*binding
+
+	for i := len(d.scopes) - 1; i >= 0; i-- {
+		s := d.scopes[i]
+		if !s.contains(pos) {
+			continue
+		}
+		for _, b := range d.bindings {
+			if b.scope == s && b.decl != nil && !seen[b.name] {
+				seen[b.name] = true
+				out = append(out, b)
+			}
+		}
+	}
+
+	return out
+}
+
+func (d *document) signature(b *binding) string {
+	switch b.kind {
+	case functionBinding:
+		// a default may hold a hash literal, so the header is printed
+		// with an empty body rather than cut at the first brace
+		header := *b.fn
+		header.Body = &ast.BlockStatement{}
+		return strings.TrimSpace(strings.TrimSuffix(format.Node(&header), "{}"))
+	case parameterBinding:
+		if b.decl.Type != nil {
+			return fmt.Sprintf("(parameter) %s: %s", b.name, b.decl.Type)
+		}
+		return "(parameter) " + b.name
+	case moduleBinding:
+		return "import as " + b.name
+	case structBinding:
+		if b.st != nil {
+			return format.Node(b.st)
+		}
+	case enumBinding:
+		if b.en != nil {
+			return format.Node(b.en)
+		}
+	}
+
+	if t := d.globalType(b); t != "" {
+		return fmt.Sprintf("var %s: %s", b.name, t)
+	}
+	return "var " + b.name
+}
+
+// globalType returns the inferred type of a global binding, if known.
+func (d *document) globalType(b *binding) string {
+	if len(d.scopes) == 0 || b.scope != d.scopes[0] || b.slot >= len(d.globalTypes) {
+		return ""
+	}
+	t := d.globalTypes[b.slot].String()
+	if strings.HasPrefix(t, "t") {
+		return "" // an unsolved type variable says nothing useful
+	}
+	return t
+}
+
+func identRange(ident *ast.Identifier) Range {
+	start := toLSP(ident.Pos())
+	end := start
+	end.Character += len([]rune(ident.Value))
+	return Range{Start: start, End: end}
+}
+
+func toLSP(pos tok.Position) Position {
+	line, col := pos.Line-1, pos.Column-1
+	if line < 0 {
+		line = 0
+	}
+	if col < 0 {
+		col = 0
+	}
+	return Position{Line: line, Character: col}
+}
+
+func fromLSP(pos Position) tok.Position {
+	return tok.Position{Line: pos.Line + 1, Column: pos.Character + 1}
+}
+
+func before(a, b tok.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
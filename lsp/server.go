@@ -0,0 +1,422 @@
+// Package lsp implements a Language Server Protocol server for salami over
+// stdio: diagnostics from the parser, resolver and type checker, plus go to
+// definition, references, hover, document symbols, completion, rename and
+// formatting.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/format"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/tok"
+)
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*document{},
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the stream.
+// It returns the process exit code the protocol asks for.
+func (s *Server) Serve() int {
+	for {
+		body, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 1
+			}
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+
+		result, rerr := s.handle(req)
+		if req.ID != nil {
+			s.reply(req.ID, result, rerr)
+		}
+	}
+}
+
+// read returns the body of the next Content-Length framed message.
+func (s *Server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) write(msg interface{}) {
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rerr != nil {
+		msg["error"] = rerr
+	} else {
+		msg["result"] = result
+	}
+	s.write(msg)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *Server) handle(req request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // full text on every change
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"hoverProvider":              true,
+				"documentSymbolProvider":     true,
+				"completionProvider":         map[string]interface{}{},
+				"renameProvider":             true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "salami"},
+		}, nil
+
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(params), nil
+
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.references(params), nil
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(params), nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.documentSymbols(params), nil
+
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(params), nil
+
+	case "textDocument/rename":
+		var params RenameParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.rename(params)
+
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.formatting(params)
+	}
+
+	if req.ID == nil {
+		return nil, nil // unknown notifications are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) update(uri, text string) {
+	doc := analyze(uri, text, s.docs[uri])
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+func (s *Server) lookup(params TextDocumentPositionParams) (*document, *ast.Identifier, *binding) {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || doc.idents == nil {
+		return nil, nil, nil
+	}
+	ident, b := doc.identAt(params.Position)
+	return doc, ident, b
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) interface{} {
+	doc, _, b := s.lookup(params)
+	if b == nil || b.decl == nil {
+		return nil
+	}
+	return Location{URI: doc.uri, Range: identRange(b.decl)}
+}
+
+func (s *Server) references(params ReferenceParams) []Location {
+	doc, _, b := s.lookup(params.TextDocumentPositionParams)
+	locations := []Location{}
+	if b == nil {
+		return locations
+	}
+
+	for _, ident := range b.idents {
+		if ident == b.decl && !params.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.uri, Range: identRange(ident)})
+	}
+	return locations
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) interface{} {
+	doc, ident, b := s.lookup(params)
+	if b == nil || b.decl == nil {
+		return nil
+	}
+
+	r := identRange(ident)
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```salami\n" + doc.signature(b) + "\n```"},
+		Range:    &r,
+	}
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || doc.program == nil {
+		return symbols
+	}
+
+	for _, stmt := range doc.program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Declaration
+		}
+
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStatement:
+			if stmt.Receiver != nil {
+				symbols = append(symbols, DocumentSymbol{
+					Name:           stmt.ReceiverType.Value + "." + stmt.Name.Value,
+					Kind:           SymbolKindMethod,
+					Range:          Range{Start: toLSP(stmt.Pos()), End: afterBrace(stmt.Body.End)},
+					SelectionRange: identRange(stmt.Name),
+				})
+				continue
+			}
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Detail:         doc.signature(doc.idents[stmt.Name]),
+				Kind:           SymbolKindFunction,
+				Range:          Range{Start: toLSP(stmt.Pos()), End: afterBrace(stmt.Body.End)},
+				SelectionRange: identRange(stmt.Name),
+			})
+		case *ast.StructStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Kind:           SymbolKindStruct,
+				Range:          Range{Start: toLSP(stmt.Pos()), End: afterBrace(stmt.End)},
+				SelectionRange: identRange(stmt.Name),
+			})
+		case *ast.EnumStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Kind:           SymbolKindEnum,
+				Range:          Range{Start: toLSP(stmt.Pos()), End: afterBrace(stmt.End)},
+				SelectionRange: identRange(stmt.Name),
+			})
+		case *ast.VarStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Kind:           SymbolKindVariable,
+				Range:          identRange(stmt.Name),
+				SelectionRange: identRange(stmt.Name),
+			})
+		case *ast.ImportStatement:
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Alias.Value,
+				Detail:         stmt.Path.Value,
+				Kind:           SymbolKindModule,
+				Range:          identRange(stmt.Alias),
+				SelectionRange: identRange(stmt.Alias),
+			})
+		}
+	}
+	return symbols
+}
+
+func afterBrace(pos tok.Position) Position {
+	p := toLSP(pos)
+	p.Character++
+	return p
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+	items := []CompletionItem{}
+	for _, kw := range tok.Keywords() {
+		items = append(items, CompletionItem{Label: kw, Kind: CompletionKindKeyword})
+	}
+
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || doc.scopes == nil {
+		return items
+	}
+
+	visible := doc.visible(fromLSP(params.Position))
+	sort.Slice(visible, func(i, j int) bool { return visible[i].name < visible[j].name })
+
+	for _, b := range visible {
+		kind := CompletionKindVariable
+		switch b.kind {
+		case functionBinding:
+			kind = CompletionKindFunction
+		case moduleBinding:
+			kind = CompletionKindModule
+		case structBinding:
+			kind = CompletionKindStruct
+		case enumBinding:
+			kind = CompletionKindEnum
+		}
+		items = append(items, CompletionItem{Label: b.name, Kind: kind, Detail: doc.signature(b)})
+	}
+	return items
+}
+
+func (s *Server) rename(params RenameParams) (interface{}, *responseError) {
+	doc, _, b := s.lookup(params.TextDocumentPositionParams)
+	if b == nil {
+		return nil, nil
+	}
+	if !validIdentifier(params.NewName) {
+		return nil, &responseError{Code: codeRequestFailed, Message: fmt.Sprintf("%q is not a valid identifier", params.NewName)}
+	}
+
+	edits := []TextEdit{}
+	for _, ident := range b.idents {
+		edits = append(edits, TextEdit{Range: identRange(ident), NewText: params.NewName})
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: edits}}, nil
+}
+
+// validIdentifier reports whether name lexes as a single identifier.
+func validIdentifier(name string) bool {
+	l := lexer.NewLexer(strings.NewReader(name))
+	first := l.NextToken()
+	return first.Type == tok.IDENT && first.Literal == name && l.NextToken().Type == tok.EOF
+}
+
+func (s *Server) formatting(params DocumentFormattingParams) (interface{}, *responseError) {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+
+	// Format from a fresh parse, never the last good one, so a half typed
+	// edit is not silently replaced by the previous version.
+	p := parser.New(lexer.NewLexer(strings.NewReader(doc.text)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &responseError{Code: codeRequestFailed, Message: "cannot format a file with parser errors"}
+	}
+
+	lines := strings.Split(doc.text, "\n")
+	end := Position{Line: len(lines) - 1, Character: len([]rune(lines[len(lines)-1]))}
+	return []TextEdit{{Range: Range{End: end}, NewText: format.Source(program)}}, nil
+}
@@ -0,0 +1,241 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+const uri = "file:///test.salami"
+
+// session scripts a conversation with a server: the messages a client
+// sends, then everything the server wrote back.
+type session struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func (s *session) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// request sends a request and returns its id.
+func (s *session) request(method string, params interface{}) int {
+	s.nextID++
+	s.send(map[string]interface{}{"id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(map[string]interface{}{"method": method, "params": params})
+}
+
+func (s *session) open(text string) {
+	s.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text}})
+}
+
+// run shuts the server down after what has been sent so far and returns
+// the replies, by id, and the notifications, in order.
+func (s *session) run(t *testing.T) (map[int]message, []message) {
+	t.Helper()
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+
+	var out bytes.Buffer
+	if code := NewServer(&s.in, &out).Serve(); code != 0 {
+		t.Errorf("exit code %d after shutdown, want 0", code)
+	}
+
+	replies := map[int]message{}
+	var notes []message
+	r := bufio.NewReader(&out)
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if msg.ID != nil {
+			replies[*msg.ID] = msg
+		} else {
+			notes = append(notes, msg)
+		}
+	}
+	return replies, notes
+}
+
+func decode(t *testing.T, msg message, v interface{}) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("error reply: %s", msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatalf("%s: %v", msg.Result, err)
+	}
+}
+
+const program = `var total = 1;
+gorlami add(n) {
+    dicocco total + n;
+}
+add(total);
+`
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{line, character}}
+}
+
+func span(line, start, end int) Range {
+	return Range{Position{line, start}, Position{line, end}}
+}
+
+func TestDefinition(t *testing.T) {
+	var s session
+	s.open(program)
+	use := s.request("textDocument/definition", at(4, 5))
+	param := s.request("textDocument/definition", at(2, 20))
+	nothing := s.request("textDocument/definition", at(1, 0))
+	replies, _ := s.run(t)
+
+	var loc Location
+	decode(t, replies[use], &loc)
+	if want := (Location{uri, span(0, 4, 9)}); loc != want {
+		t.Errorf("definition of total: got %+v, want %+v", loc, want)
+	}
+	decode(t, replies[param], &loc)
+	if want := (Location{uri, span(1, 12, 13)}); loc != want {
+		t.Errorf("definition of n: got %+v, want %+v", loc, want)
+	}
+	if got := string(replies[nothing].Result); got != "null" {
+		t.Errorf("definition of a keyword: got %s, want null", got)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	var s session
+	s.open(program)
+	with := ReferenceParams{TextDocumentPositionParams: at(2, 13)}
+	with.Context.IncludeDeclaration = true
+	all := s.request("textDocument/references", with)
+	uses := s.request("textDocument/references", ReferenceParams{TextDocumentPositionParams: at(2, 13)})
+	replies, _ := s.run(t)
+
+	var locs []Location
+	decode(t, replies[all], &locs)
+	want := []Location{{uri, span(0, 4, 9)}, {uri, span(2, 12, 17)}, {uri, span(4, 4, 9)}}
+	if fmt.Sprint(locs) != fmt.Sprint(want) {
+		t.Errorf("with the declaration: got %+v, want %+v", locs, want)
+	}
+	decode(t, replies[uses], &locs)
+	if fmt.Sprint(locs) != fmt.Sprint(want[1:]) {
+		t.Errorf("without the declaration: got %+v, want %+v", locs, want[1:])
+	}
+}
+
+func TestRename(t *testing.T) {
+	var s session
+	s.open(program)
+	ok := s.request("textDocument/rename", RenameParams{TextDocumentPositionParams: at(0, 6), NewName: "sum"})
+	bad := s.request("textDocument/rename", RenameParams{TextDocumentPositionParams: at(0, 6), NewName: "dicocco"})
+	replies, _ := s.run(t)
+
+	var edit WorkspaceEdit
+	decode(t, replies[ok], &edit)
+	want := []TextEdit{{span(0, 4, 9), "sum"}, {span(2, 12, 17), "sum"}, {span(4, 4, 9), "sum"}}
+	if fmt.Sprint(edit.Changes[uri]) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", edit.Changes[uri], want)
+	}
+	if replies[bad].Error == nil || replies[bad].Error.Code != codeRequestFailed {
+		t.Errorf("renaming to a keyword: got %+v, want a request failed error", replies[bad])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	var s session
+	s.open("var x = ;\n")
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: uri},
+		"contentChanges": []map[string]string{{"text": "var x = y;\nexit x;\n"}},
+	})
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: uri},
+		"contentChanges": []map[string]string{{"text": "var x = 1;\nexit x;\n"}},
+	})
+	s.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	unknown := s.request("textDocument/unknown", nil)
+	replies, notes := s.run(t)
+
+	var published []PublishDiagnosticsParams
+	for _, note := range notes {
+		if note.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(note.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, params)
+	}
+	if len(published) != 4 {
+		t.Fatalf("got %d diagnostics notifications, want one for each open, change and close: %+v", len(published), published)
+	}
+
+	// a parser error, then a name the checks do not know, then none
+	if d := published[0].Diagnostics; len(d) == 0 || d[0].Range.Start.Line != 0 || d[0].Severity != 1 {
+		t.Errorf("after open: got %+v, want an error on the first line", d)
+	}
+	if d := published[1].Diagnostics; len(d) != 1 || d[0].Range != span(0, 8, 9) || d[0].Message != "undefined: y" {
+		t.Errorf("after using an undefined name: got %+v, want an error on y", d)
+	}
+	for _, p := range published[2:] {
+		if len(p.Diagnostics) != 0 {
+			t.Errorf("got %+v, want no diagnostics", p.Diagnostics)
+		}
+	}
+
+	if replies[unknown].Error == nil || replies[unknown].Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method: got %+v, want method not found", replies[unknown])
+	}
+}
+
+// Format on save goes through the same printer as salami fmt, comments
+// and all.
+func TestFormatting(t *testing.T) {
+	var s session
+	s.open("gorlami f() {\n// nothing here\n}\nvar xs = [1, // one\n2];\n")
+	id := s.request("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	replies, _ := s.run(t)
+
+	var edits []TextEdit
+	decode(t, replies[id], &edits)
+	want := "gorlami f() {\n    // nothing here\n}\n\nvar xs = [\n    1, // one\n    2\n];\n"
+	if len(edits) != 1 || edits[0].NewText != want {
+		t.Errorf("got %+v, want the whole file replaced by\n%s", edits, want)
+	}
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/coverage"
+	"github.com/afoley/salami-lang/dap"
 	"github.com/afoley/salami-lang/interpreter"
 	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/lsp"
 	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/profile"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/vm"
 )
 
 func main() {
@@ -14,12 +24,217 @@ func main() {
 	args := os.Args
 
 	if len(args) < 2 {
-		panic("No file given...") // do some better cli/usage stuff here
+		usage()
 	}
-	file, err := os.Open(args[1])
+
+	switch args[1] {
+	case "run":
+		runCommand(args[2:])
+	case "check":
+		checkCommand(args[2:])
+	case "build":
+		buildCommand(args[2:])
+	case "disasm":
+		disasmCommand(args[2:])
+	case "bench":
+		benchCommand(args[2:])
+	case "test":
+		testCommand(args[2:])
+	case "debug":
+		debugCommand(args[2:])
+	case "dap":
+		os.Exit(dap.NewServer(os.Stdin, os.Stdout).Serve())
+	case "fmt":
+		fmtCommand(args[2:])
+	case "vet":
+		vetCommand(args[2:])
+	case "parse":
+		parseCommand(args[2:])
+	case "lsp":
+		os.Exit(lsp.NewServer(os.Stdin, os.Stdout).Serve())
+	default:
+		// salami path/to/file.salami is shorthand for salami run
+		runCommand(args[1:])
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: salami [run] [-engine=interp|vm] [-strict] [-strict-booleans] [-O] [-passes list] [-profile out]")
+	fmt.Fprintln(os.Stderr, "              [-profile-format text|pprof|folded] [-coverprofile out.lcov] [-coverhtml out.html] <file.salami|file.salc>")
+	fmt.Fprintln(os.Stderr, "       salami check [-strict-booleans] <file.salami>")
+	fmt.Fprintln(os.Stderr, "       salami build [-o out.salc] [-O] [-passes list] <file.salami>")
+	fmt.Fprintln(os.Stderr, "       salami disasm <file.salami|file.salc>")
+	fmt.Fprintln(os.Stderr, "       salami bench [-n count] <file>")
+	fmt.Fprintln(os.Stderr, "       salami test [-run regexp] [-format text|tap|junit] [-strict] [-strict-booleans] [-O] [-passes list] [-cover] [-coverprofile out.lcov] [-coverhtml out.html] [path ...]")
+	fmt.Fprintln(os.Stderr, "       salami debug <file.salami>")
+	fmt.Fprintln(os.Stderr, "       salami dap")
+	fmt.Fprintln(os.Stderr, "       salami fmt [-w] <file.salami>")
+	fmt.Fprintln(os.Stderr, "       salami vet [-enable rules] [-disable rules] [-list] [path ...]")
+	fmt.Fprintln(os.Stderr, "       salami parse [-format text|json] [-O] [-passes list] <file.salami>")
+	fmt.Fprintln(os.Stderr, "       salami lsp")
+	os.Exit(2)
+}
+
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	engine := fs.String("engine", "interp", "execution engine: interp or vm")
+	strict := fs.Bool("strict", false, "make reading an undefined name an error rather than null; the vm always does")
+	strictBooleans := fs.Bool("strict-booleans", false, "make an if condition that is not a boolean an error")
+	profilePath := fs.String("profile", "", "write an execution profile to this file, - for stdout")
+	profileFormat := fs.String("profile-format", "text", "profile format: text, pprof or folded")
+	coverProfile := fs.String("coverprofile", "", "write an LCOV coverage file")
+	coverHTML := fs.String("coverhtml", "", "write an annotated HTML coverage report")
+	opt := addOptimizeFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		usage()
+	}
+	defer runAtExit()
+
+	var prof *profile.Profile
+	if *profilePath != "" {
+		switch *profileFormat {
+		case "text", "pprof", "folded":
+		default:
+			fmt.Fprintf(os.Stderr, "unknown profile format %q\n", *profileFormat)
+			os.Exit(2)
+		}
+		path, _ := filepath.Abs(fs.Arg(0))
+		prof = profile.New(path)
+		atExit = append(atExit, func() { writeProfile(prof, *profilePath, *profileFormat) })
+	}
+
+	var cov *coverage.Profile
+	if *coverProfile != "" || *coverHTML != "" {
+		if *engine != "interp" || isCompiled(fs.Arg(0)) {
+			fmt.Fprintln(os.Stderr, "coverage needs the interp engine and a .salami file")
+			os.Exit(2)
+		}
+		cov = coverage.New()
+		atExit = append(atExit, func() {
+			if !writeCoverage(cov, os.Stderr, *coverProfile, *coverHTML) {
+				os.Exit(2)
+			}
+		})
+	}
+
+	// compiled artifacts skip lexing and parsing and always run on the vm
+	if isCompiled(fs.Arg(0)) {
+		bytecode, err := loadBytecode(fs.Arg(0))
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		machine, err := execBytecode(bytecode, vmTracer(prof), *strictBooleans)
+		if err != nil {
+			fmt.Println("error:", err)
+			exit(1)
+		}
+		printResult(machine.Exited, machine.ExitCode, machine.Result())
+		return
+	}
+
+	program, ok := parseFile(fs.Arg(0))
+	if !ok || !optimizeProgram(program, opt.Passes()) {
+		return
+	}
+
+	fmt.Printf("Parsed Program: %+v\n", program)
+
+	switch *engine {
+	case "interp":
+		interp := interpreter.New()
+		interp.File, _ = filepath.Abs(fs.Arg(0))
+		interp.Strict = *strict
+		interp.StrictBooleans = *strictBooleans
+		if prof != nil {
+			prof.Engine = "interp"
+			interp.Tracer = prof.Interpreter()
+		}
+		if cov != nil {
+			cov.Attach(interp)
+		}
+		result, err := interp.Run(program)
+		if err != nil {
+			fmt.Println("error:", err)
+			exit(1)
+		}
+		printResult(interp.Exited, interp.ExitCode, result)
+	case "vm":
+		machine, err := runVM(fs.Arg(0), program, vmTracer(prof), *strictBooleans)
+		if err != nil {
+			fmt.Println("error:", err)
+			exit(1)
+		}
+		printResult(machine.Exited, machine.ExitCode, machine.Result())
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		os.Exit(2)
+	}
+}
+
+// atExit holds the reports runCommand writes once the program is done,
+// whether or not it failed.
+var atExit []func()
+
+func runAtExit() {
+	for _, fn := range atExit {
+		fn()
+	}
+	atExit = nil
+}
+
+// exit writes any reports before exiting with code, as deferred calls do
+// not run on os.Exit.
+func exit(code int) {
+	runAtExit()
+	os.Exit(code)
+}
+
+func vmTracer(prof *profile.Profile) vm.Tracer {
+	if prof == nil {
+		return nil
+	}
+	prof.Engine = "vm"
+	return prof.VM()
+}
+
+func writeProfile(prof *profile.Profile, path, format string) {
+	prof.Stop()
+
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = prof.WriteText(out)
+	case "pprof":
+		err = prof.WritePprof(out)
+	case "folded":
+		err = prof.WriteFolded(out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error writing profile:", err)
+	}
+}
+
+func parseFile(path string) (*ast.Program, bool) {
+	file, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		fmt.Println("error:", err)
+		exit(1)
 	}
+	defer file.Close()
 
 	lexer := lexer.NewLexer(file)
 	p := parser.New(lexer)
@@ -30,18 +245,43 @@ func main() {
 		for _, e := range p.Errors() {
 			fmt.Println(e)
 		}
-		return
+		return nil, false
 	}
 
-	fmt.Printf("Parsed Program: %+v\n", program)
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		fmt.Println("resolver errors:")
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
+
+func runVM(path string, program *ast.Program, tracer vm.Tracer, strictBooleans bool) (*vm.VM, error) {
+	bytecode, err := compileProgram(path, program)
+	if err != nil {
+		return nil, err
+	}
+	return execBytecode(bytecode, tracer, strictBooleans)
+}
+
+func execBytecode(bytecode *compiler.Bytecode, tracer vm.Tracer, strictBooleans bool) (*vm.VM, error) {
+	machine, err := vm.New(bytecode)
+	if err != nil {
+		return nil, err
+	}
+	machine.Tracer = tracer
+	machine.StrictBooleans = strictBooleans
 
-	interp := interpreter.New()
-	result := interp.Interpret(program)
+	return machine, machine.Run()
+}
 
-	if interp.Exited {
-		fmt.Printf("Program exited with value: %v\n", interp.ExitCode)
+func printResult(exited bool, exitCode int64, result interface{}) {
+	if exited {
+		fmt.Printf("Program exited with value: %v\n", exitCode)
 	} else {
 		fmt.Printf("Result: %v\n", result)
 	}
-
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/optimize"
+)
+
+// optimizeFlags are the -O and -passes flags shared by the commands that
+// run or compile programs.
+type optimizeFlags struct {
+	on     *bool
+	passes *string
+}
+
+func addOptimizeFlags(fs *flag.FlagSet) *optimizeFlags {
+	return &optimizeFlags{
+		on:     fs.Bool("O", false, "optimize the program before running it"),
+		passes: fs.String("passes", "", "comma separated optimization passes to run instead of all of them; implies -O"),
+	}
+}
+
+// Passes returns the passes the flags ask for, or nil if optimization is
+// off. It exits if a pass is unknown.
+func (f *optimizeFlags) Passes() []*optimize.Pass {
+	if *f.passes == "" {
+		if *f.on {
+			return optimize.Passes
+		}
+		return nil
+	}
+
+	var passes []*optimize.Pass
+	for _, name := range strings.Split(*f.passes, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p := optimize.Lookup(name)
+		if p == nil {
+			names := make([]string, len(optimize.Passes))
+			for idx, p := range optimize.Passes {
+				names[idx] = p.Name
+			}
+			fmt.Fprintf(os.Stderr, "unknown pass %q; the passes are %s\n", name, strings.Join(names, ", "))
+			os.Exit(2)
+		}
+		passes = append(passes, p)
+	}
+	return passes
+}
+
+// optimizeProgram applies passes to program, printing any errors the way
+// parseFile does, and reports whether it worked.
+func optimizeProgram(program *ast.Program, passes []*optimize.Pass) bool {
+	if len(passes) == 0 {
+		return true
+	}
+	if errs := optimize.Run(program, passes); len(errs) != 0 {
+		fmt.Println("resolver errors after optimizing:")
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+		return false
+	}
+	return true
+}
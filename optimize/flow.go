@@ -0,0 +1,204 @@
+package optimize
+
+import (
+	"github.com/afoley/salami-lang/ast"
+)
+
+var DeadBranches = &Pass{
+	Name: "dead-branches",
+	Doc:  "replace an if on a literal true or false with the branch that runs",
+	Run: func(program *ast.Program) bool {
+		return rewriteLists(program, func(stmts []ast.Statement) ([]ast.Statement, bool) {
+			out := make([]ast.Statement, 0, len(stmts))
+			changed := false
+			for idx, stmt := range stmts {
+				kept, ok := pruneBranch(stmt, idx == len(stmts)-1)
+				if !ok {
+					out = append(out, stmt)
+					continue
+				}
+				out = append(out, kept...)
+				changed = true
+			}
+			return out, changed
+		})
+	},
+}
+
+// pruneBranch returns the statements that replace stmt if it is an if on
+// a literal, and whether it can be replaced. if blocks are not scopes, so
+// the branch that runs can take the if's place as it is. The one that
+// doesn't can only go if it declares nothing, as even an unassigned
+// variable shadows an outer one of the same name, and yields nothing, as
+// even a yield that never runs makes its function a generator.
+//
+// An if is a statement, but its value is that of the branch it ran, or nil
+// if none did, and the last statement's value is what a function without a
+// dicocco returns. So an if that would leave nothing behind stays when it
+// is last.
+func pruneBranch(stmt ast.Statement, last bool) ([]ast.Statement, bool) {
+	ie, ok := stmt.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	cond, ok := ie.Condition.(*ast.BooleanLiteral)
+	if !ok {
+		return nil, false
+	}
+
+	taken, dropped := ie.Consequence, ie.Alternative
+	if !cond.Value {
+		taken, dropped = dropped, taken
+	}
+	if dropped != nil && (declares(dropped.Statements) || yields(dropped.Statements)) {
+		return nil, false
+	}
+
+	var kept []ast.Statement
+	if taken != nil {
+		kept = taken.Statements
+	}
+	if len(kept) == 0 && last {
+		return nil, false
+	}
+	return kept, true
+}
+
+var Unreachable = &Pass{
+	Name: "unreachable",
+	Doc:  "remove statements after a dicocco, exit or throw, or after an if whose branches all end in one",
+	Run: func(program *ast.Program) bool {
+		return rewriteLists(program, func(stmts []ast.Statement) ([]ast.Statement, bool) {
+			for idx, stmt := range stmts[:len(stmts)-1] {
+				if terminates(stmt) {
+					if declares(stmts[idx+1:]) || yields(stmts[idx+1:]) {
+						break
+					}
+					return stmts[:idx+1], true
+				}
+			}
+			return stmts, false
+		})
+	},
+}
+
+// terminates reports whether control never continues past stmt: dicocco,
+// exit, which stops the program or fails if its value is not an integer,
+// throw, an if whose branches both terminate or a match whose arms all do,
+// or a try whose finally does, or whose body and catch both do.
+func terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ExitStatement, *ast.ThrowStatement:
+		return true
+	case *ast.TryStatement:
+		if stmt.Finally != nil && terminatesBlock(stmt.Finally.Statements) {
+			return true
+		}
+		return terminatesBlock(stmt.Body.Statements) &&
+			(stmt.Catch == nil || terminatesBlock(stmt.Catch.Statements))
+	case *ast.IfExpression:
+		return stmt.Alternative != nil &&
+			terminatesBlock(stmt.Consequence.Statements) &&
+			terminatesBlock(stmt.Alternative.Statements)
+	case *ast.BlockStatement:
+		return terminatesBlock(stmt.Statements)
+	case *ast.ExpressionStatement:
+		if me, ok := stmt.Expression.(*ast.MatchExpression); ok {
+			return armsTerminate(me)
+		}
+	}
+	return false
+}
+
+// armsTerminate reports whether every arm of me ends in a dicocco or exit.
+// A match that no arm matches fails, so it never continues either.
+func armsTerminate(me *ast.MatchExpression) bool {
+	for _, arm := range me.Arms {
+		if arm.Body == nil || !terminatesBlock(arm.Body.Statements) {
+			return false
+		}
+	}
+	return true
+}
+
+func terminatesBlock(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		if terminates(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// declares reports whether stmts declare a name in the enclosing scope,
+// the way the resolver hoists them: anywhere but inside a nested function,
+// including in the blocks of an if or match used as a value, as a match
+// arm's binding and as the error a catch binds.
+func declares(stmts []ast.Statement) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.VarStatement, *ast.ForStatement, *ast.FunctionStatement, *ast.StructStatement, *ast.EnumStatement, *ast.ImportStatement, *ast.ExportStatement:
+				found = true
+			case *ast.MatchArm:
+				found = len(armBindings(n)) > 0
+			case *ast.TryStatement:
+				found = n.Catch != nil
+			case *ast.FunctionLiteral:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// yields reports whether stmts yield, outside of any nested function.
+func yields(stmts []ast.Statement) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.YieldStatement:
+				found = true
+			case *ast.FunctionStatement, *ast.FunctionLiteral:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// armBindings returns the names arm binds, if any.
+func armBindings(arm *ast.MatchArm) []*ast.Identifier {
+	if len(arm.Patterns) != 1 {
+		return nil
+	}
+	return ast.Bindings(arm.Patterns[0])
+}
+
+// rewriteLists replaces the statement list of program and of every block
+// in it with what f returns for it, and reports whether f changed any.
+// Lists are rewritten before the statements in them are visited.
+func rewriteLists(program *ast.Program, f func([]ast.Statement) ([]ast.Statement, bool)) bool {
+	changed := false
+	rewrite := func(stmts []ast.Statement) []ast.Statement {
+		if len(stmts) == 0 {
+			return stmts
+		}
+		stmts, ok := f(stmts)
+		changed = changed || ok
+		return stmts
+	}
+
+	program.Statements = rewrite(program.Statements)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if block, ok := n.(*ast.BlockStatement); ok {
+			block.Statements = rewrite(block.Statements)
+		}
+		return true
+	})
+	return changed
+}
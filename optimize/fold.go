@@ -0,0 +1,90 @@
+package optimize
+
+import (
+	"strconv"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/tok"
+)
+
+var Fold = &Pass{
+	Name: "fold",
+	Doc:  "evaluate arithmetic and comparisons on integer literals, and ?? on literals, at compile time",
+	Run: func(program *ast.Program) bool {
+		changed := false
+		ast.Rewrite(program, func(n ast.Node) ast.Node {
+			infix, ok := n.(*ast.InfixExpression)
+			if !ok {
+				return n
+			}
+			if folded := fold(infix); folded != nil {
+				changed = true
+				return folded
+			}
+			return n
+		})
+		return changed
+	},
+}
+
+// fold returns the literal infix evaluates to, or nil if it cannot be
+// evaluated ahead of time. Division by zero is left for the program to
+// fail on when it gets there, if it does.
+func fold(infix *ast.InfixExpression) ast.Expression {
+	// a literal on the left decides ?? by itself
+	if infix.Operator == "??" {
+		switch infix.Left.(type) {
+		case *ast.NullLiteral:
+			return infix.Right
+		case *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.StringLiteral:
+			return infix.Left
+		}
+		return nil
+	}
+
+	left, ok := infix.Left.(*ast.IntegerLiteral)
+	if !ok {
+		return nil
+	}
+	right, ok := infix.Right.(*ast.IntegerLiteral)
+	if !ok {
+		return nil
+	}
+
+	// the same int64 arithmetic the interpreter and vm do, overflow and all
+	switch infix.Operator {
+	case "+":
+		return intLiteral(left.Value+right.Value, infix)
+	case "-":
+		return intLiteral(left.Value-right.Value, infix)
+	case "*":
+		return intLiteral(left.Value*right.Value, infix)
+	case "/":
+		if right.Value == 0 {
+			return nil
+		}
+		return intLiteral(left.Value/right.Value, infix)
+	case "<":
+		return boolLiteral(left.Value < right.Value, infix)
+	case ">":
+		return boolLiteral(left.Value > right.Value, infix)
+	}
+	return nil
+}
+
+// intLiteral returns a literal for value spanning the source of the
+// expression it replaces, so errors still point at the right place.
+func intLiteral(value int64, replaces ast.Node) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: literalToken(tok.INT, strconv.FormatInt(value, 10), replaces), Value: value}
+}
+
+func boolLiteral(value bool, replaces ast.Node) *ast.BooleanLiteral {
+	if value {
+		return &ast.BooleanLiteral{Token: literalToken(tok.TRUE, "true", replaces), Value: true}
+	}
+	return &ast.BooleanLiteral{Token: literalToken(tok.FALSE, "false", replaces), Value: false}
+}
+
+func literalToken(typ tok.TokenType, literal string, replaces ast.Node) tok.Tok {
+	return tok.Tok{Type: typ, Literal: literal, Pos: ast.Start(replaces), End: ast.End(replaces)}
+}
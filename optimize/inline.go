@@ -0,0 +1,296 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// maxInlineSize is the most nodes a function's result expression can have
+// for calls to it to be inlined.
+const maxInlineSize = 12
+
+var Inline = &Pass{
+	Name: "inline",
+	Doc:  "replace calls to small top level gorlamis with their bodies",
+	Run: func(program *ast.Program) bool {
+		candidates := inlinable(program)
+		if len(candidates) == 0 {
+			return false
+		}
+
+		calls := map[*ast.CallExpression]*ast.FunctionStatement{}
+		depth := 0
+		var stack []ast.Node
+		ast.Inspect(program, func(n ast.Node) bool {
+			if n == nil {
+				if isFunction(stack[len(stack)-1]) {
+					depth--
+				}
+				stack = stack[:len(stack)-1]
+				return false
+			}
+			stack = append(stack, n)
+			if isFunction(n) {
+				depth++
+			}
+
+			call, ok := n.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+			name, ok := call.Function.(*ast.Identifier)
+			if !ok || !name.Resolved {
+				return true
+			}
+			// only a name that reaches all the way out to the global slot
+			// is the function; anything closer shadows it
+			fn := candidates[name.Value]
+			if fn != nil && name.Depth == depth && name.Index == fn.Name.Index && inlinableArgs(call, fn) {
+				calls[call] = fn
+			}
+			return true
+		})
+		if len(calls) == 0 {
+			return false
+		}
+
+		ast.Rewrite(program, func(n ast.Node) ast.Node {
+			if call, ok := n.(*ast.CallExpression); ok {
+				if fn := calls[call]; fn != nil {
+					return substitute(fn, call)
+				}
+			}
+			return n
+		})
+		return true
+	},
+}
+
+func isFunction(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.FunctionStatement, *ast.FunctionLiteral:
+		return true
+	}
+	return false
+}
+
+// inlinable returns the top level functions, by name, whose calls can be
+// replaced by their bodies. A function qualifies if
+//
+//   - its body is a single dicocco of arithmetic on literals and its own
+//     parameters, no bigger than maxInlineSize, so it makes no calls (and
+//     so cannot recurse) and has no effects;
+//   - nothing else in the program declares its name, so the global always
+//     holds it; and
+//   - no top level statement before it makes a call, as one that did might
+//     reach a call to it before its declaration has run, when the call
+//     fails rather than returning anything.
+func inlinable(program *ast.Program) map[string]*ast.FunctionStatement {
+	declared := map[string]int{}
+	countDeclarations(program.Statements, declared)
+
+	candidates := map[string]*ast.FunctionStatement{}
+	for _, stmt := range program.Statements {
+		decl := stmt
+		if export, ok := decl.(*ast.ExportStatement); ok {
+			decl = export.Declaration
+		}
+		if fn, ok := decl.(*ast.FunctionStatement); ok && fn.Receiver == nil && declared[fn.Name.Value] == 1 && simpleBody(fn) {
+			candidates[fn.Name.Value] = fn
+		}
+		if makesCall(stmt) {
+			break
+		}
+	}
+	return candidates
+}
+
+// countDeclarations counts the declarations of each name in stmts, found
+// the same way declares finds them.
+func countDeclarations(stmts []ast.Statement, declared map[string]int) {
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.VarStatement:
+				declared[n.Name.Value]++
+				if n.Name.Pattern != nil {
+					for _, name := range ast.PatternNames(n.Name) {
+						declared[name.Value]++
+					}
+				}
+			case *ast.FunctionStatement:
+				if n.Receiver == nil {
+					declared[n.Name.Value]++
+				}
+				return false
+			case *ast.ForStatement:
+				declared[n.Name.Value]++
+				if n.Name.Pattern != nil {
+					for _, name := range ast.PatternNames(n.Name) {
+						declared[name.Value]++
+					}
+				}
+			case *ast.StructStatement:
+				declared[n.Name.Value]++
+			case *ast.EnumStatement:
+				declared[n.Name.Value]++
+			case *ast.ImportStatement:
+				declared[n.Alias.Value]++
+			case *ast.MatchArm:
+				for _, name := range armBindings(n) {
+					declared[name.Value]++
+				}
+			case *ast.TryStatement:
+				if n.Catch != nil {
+					declared[n.Param.Value]++
+				}
+			case *ast.FunctionLiteral:
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// makesCall reports whether running stmt calls anything. Declaring a
+// function does not run its body.
+func makesCall(stmt ast.Statement) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.CallExpression:
+			found = true
+		case *ast.FunctionStatement, *ast.FunctionLiteral:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+func simpleBody(fn *ast.FunctionStatement) bool {
+	if len(fn.Body.Statements) != 1 {
+		return false
+	}
+	ret, ok := fn.Body.Statements[0].(*ast.ReturnStatement)
+	if !ok {
+		return false
+	}
+
+	params := map[string]bool{}
+	for _, p := range fn.Parameters {
+		if p.Pattern != nil {
+			return false // destructuring the argument can fail
+		}
+		if p.Variadic {
+			return false // the argument is collected into an array
+		}
+		params[p.Value] = true
+	}
+
+	size := 0
+	simple := true
+	ast.Inspect(ret.ReturnValue, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			return false
+		case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral, *ast.InfixExpression:
+		case *ast.Identifier:
+			simple = simple && n.Resolved && n.Depth == 0 && params[n.Value]
+		default:
+			simple = false
+		}
+		size++
+		return simple
+	})
+	return simple && size <= maxInlineSize
+}
+
+// inlinableArgs reports whether call passes fn one argument per parameter,
+// each a literal or a declared variable. Reading either has no effect and
+// cannot fail, as an undefined name can in strict mode, so it doesn't
+// matter that the inlined body reads an argument once per use of its
+// parameter, or not at all, instead of once up front.
+func inlinableArgs(call *ast.CallExpression, fn *ast.FunctionStatement) bool {
+	if len(call.Arguments) != len(fn.Parameters) {
+		return false
+	}
+	for _, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		case *ast.Identifier:
+			if !arg.Resolved {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// substitute returns a copy of the result expression of fn with each of
+// its parameters replaced by a copy of the matching argument of call. The
+// copied nodes take the position of the call, so an error in them points
+// where the call was.
+func substitute(fn *ast.FunctionStatement, call *ast.CallExpression) ast.Expression {
+	bindings := map[string]ast.Expression{}
+	for idx, p := range fn.Parameters {
+		bindings[p.Value] = call.Arguments[idx]
+	}
+	c := &cloner{bindings: bindings, pos: ast.Start(call), end: ast.End(call)}
+	return c.clone(fn.Body.Statements[0].(*ast.ReturnStatement).ReturnValue)
+}
+
+type cloner struct {
+	bindings map[string]ast.Expression
+	pos, end tok.Position
+}
+
+// clone copies an expression made of literals, identifiers and infix
+// expressions, replacing the identifiers named in bindings.
+func (c *cloner) clone(expr ast.Expression) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		n := *e
+		n.Token = c.move(n.Token)
+		return &n
+	case *ast.StringLiteral:
+		n := *e
+		n.Token = c.move(n.Token)
+		return &n
+	case *ast.BooleanLiteral:
+		n := *e
+		n.Token = c.move(n.Token)
+		return &n
+	case *ast.NullLiteral:
+		n := *e
+		n.Token = c.move(n.Token)
+		return &n
+	case *ast.Identifier:
+		if bound, ok := c.bindings[e.Value]; ok {
+			arg := &cloner{}
+			return arg.clone(bound)
+		}
+		n := *e
+		n.Token = c.move(n.Token)
+		return &n
+	case *ast.InfixExpression:
+		n := *e
+		n.Token = c.move(n.Token)
+		n.Left = c.clone(e.Left)
+		n.Right = c.clone(e.Right)
+		return &n
+	}
+	panic(fmt.Sprintf("optimize: cannot clone %T", expr))
+}
+
+// move returns t at the cloner's position, or as it is if it has none.
+func (c *cloner) move(t tok.Tok) tok.Tok {
+	if c.pos.Line != 0 {
+		t.Pos, t.End = c.pos, c.end
+	}
+	return t
+}
@@ -0,0 +1,91 @@
+// Package optimize rewrites a parsed program into one that does less work
+// at runtime but behaves the same: same result, same output, same exit
+// code. Each transformation is a Pass; Run applies a set of them until the
+// program stops changing.
+//
+// Passes only change what they can prove is unobservable. Where proving it
+// would take more analysis than the pass is worth, such as a branch that
+// declares a variable, the code is left alone.
+package optimize
+
+import (
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+// Pass is one transformation. Run rewrites a resolved program in place and
+// reports whether it changed anything.
+type Pass struct {
+	Name string
+	Doc  string
+	Run  func(*ast.Program) bool
+}
+
+// Passes lists every pass, in the order Run applies them by default.
+var Passes = []*Pass{
+	Inline,
+	Fold,
+	DeadBranches,
+	Unreachable,
+}
+
+// Lookup returns the pass with the given name, or nil.
+func Lookup(name string) *Pass {
+	for _, p := range Passes {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// maxRounds bounds how many times Run goes through the passes. Each round
+// only makes the program smaller, except for inlining, which is limited to
+// small bodies, so in practice two or three rounds reach a fixed point.
+const maxRounds = 10
+
+// Run applies passes to program, in order, until a round changes nothing.
+// One pass often creates work for another: inlining sq(3) leaves 3 * 3 to
+// fold, and folding 9 > 10 leaves an if (false) to remove. The program is
+// resolved first if it has not been, and again at the end, since removing
+// declarations moves variable slots. Run returns any resolver errors.
+func Run(program *ast.Program, passes []*Pass) []string {
+	if !program.Resolved {
+		if errs := resolver.Resolve(program); len(errs) != 0 {
+			return errs
+		}
+	}
+
+	for round := 0; round < maxRounds; round++ {
+		changed := false
+		for _, p := range passes {
+			if p.Run(program) {
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	unresolve(program)
+	return resolver.Resolve(program)
+}
+
+// unresolve clears the resolver's annotations, so identifiers that no
+// longer resolve to anything read as builtins rather than stale slots.
+func unresolve(program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			n.Depth, n.Index, n.Resolved = 0, 0, false
+		case *ast.FunctionStatement:
+			n.Locals = nil
+		case *ast.FunctionLiteral:
+			n.Locals = nil
+		}
+		return true
+	})
+	program.Globals = nil
+	program.Resolved = false
+}
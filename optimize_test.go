@@ -0,0 +1,205 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/optimize"
+	"github.com/afoley/salami-lang/vm"
+)
+
+// Programs aimed at what the passes rewrite, and at where a careless
+// rewrite would change what a program does.
+var optimizerPrograms = []struct {
+	name string
+	src  string
+}{
+	{"fold arithmetic", `exit 2 * 3 + 10 / 2 - 4;`},
+	{"fold comparisons", `[1 < 2, 2 > 1, 3 < 3, null ?? 5, 7 ?? 8, "a" ?? 1];`},
+	{"fold overflow", `[9223372036854775807 + 1, 0 - 9223372036854775807 - 2, 4611686018427387904 * 4];`},
+	{"division by zero in a branch not taken", `
+gorlami safe(n) {
+    if (n > 0) {
+        dicocco 10 / n;
+    }
+    dicocco 1 / 0;
+}
+safe(5);
+`},
+	{"division by zero", `var a = 1 + 1; 1 / 0;`},
+	{"dead branch taken", `
+var x = 1;
+if (true) {
+    var x = 2;
+} else {
+    var y = 3;
+}
+[x, y];
+`},
+	{"dead branch dropped", `
+var x = 1;
+if (false) {
+    var x = 2;
+}
+x;
+`},
+	{"dead branch last in a function", `
+gorlami f() {
+    if (false) {
+        1;
+    }
+}
+gorlami g() {
+    if (true) {
+        2;
+    } else {
+        3;
+    }
+}
+[f(), g()];
+`},
+	{"dead branch with a yield", `
+gorlami g() {
+    if (false) {
+        yield 1;
+    }
+}
+next(g());
+`},
+	{"inline", `
+gorlami add(a, b) {
+    dicocco a + b;
+}
+gorlami twice(n) {
+    dicocco add(n, n);
+}
+exit add(1, twice(add(2, 3)));
+`},
+	{"inline under a shadowing name", `
+gorlami sq(n) {
+    dicocco n * n;
+}
+gorlami f(sq) {
+    dicocco sq(3);
+}
+gorlami g(n) {
+    var sq = gorlami(m) { dicocco m + 1; };
+    dicocco sq(n);
+}
+[sq(3), f(gorlami(m) { dicocco 0 - m; }), g(3)];
+`},
+	{"inline a parameter named like an argument", `
+gorlami sub(a, b) {
+    dicocco a - b;
+}
+gorlami f(b, a) {
+    dicocco sub(b, a);
+}
+f(10, 3);
+`},
+	{"inline recursion", `
+gorlami fact(n) {
+    dicocco if (n < 2) { 1; } else { n * fact(n - 1); };
+}
+fact(10);
+`},
+	{"inline an error", `
+gorlami div(a, b) {
+    dicocco a / b;
+}
+div(8, 2) + div(1, 0);
+`},
+	{"inline into a closure", `
+gorlami inc(n) {
+    dicocco n + 1;
+}
+gorlami counter() {
+    var n = 0;
+    dicocco gorlami() { dicocco inc(n); };
+}
+counter()();
+`},
+}
+
+var (
+	pointer = regexp.MustCompile(`0x[0-9a-f]+`)
+
+	// where an error is reported, which the engines write differently:
+	// inlined code takes the position of the call it replaces, so only the
+	// message has to stay the same
+	position = regexp.MustCompile(`^(\S+:)?(\d+:\d+|line \d+): `)
+)
+
+// outcome runs src on engine, optimized or not, and describes how it
+// ended: the value it exited with, its result or its error.
+func outcome(t *testing.T, engine, path, src string, optimized bool) string {
+	t.Helper()
+	program := parseSource(t, src)
+	if optimized {
+		if errs := optimize.Run(program, optimize.Passes); len(errs) != 0 {
+			t.Fatalf("resolver errors after optimizing: %v", errs)
+		}
+	}
+
+	var exited bool
+	var code int64
+	var result interface{}
+	var err error
+	if engine == "interp" {
+		interp := interpreter.New()
+		if path != "" {
+			interp.File, _ = filepath.Abs(path)
+		}
+		result, err = interp.Run(program)
+		exited, code = interp.Exited, interp.ExitCode
+	} else {
+		var machine *vm.VM
+		machine, err = runVM(path, program, nil, false)
+		if machine != nil {
+			exited, code, result = machine.Exited, machine.ExitCode, machine.Result()
+		}
+	}
+
+	switch {
+	case err != nil:
+		return "error: " + position.ReplaceAllString(err.Error(), "")
+	case exited:
+		return "exit " + strconv.FormatInt(code, 10)
+	}
+	// functions print as pointers, which differ from run to run
+	return pointer.ReplaceAllString(interpreter.Inspect(result), "0x")
+}
+
+// differential runs src with and without the optimizer on each engine
+// and fails t if optimizing changes how it ends.
+func differential(t *testing.T, path, src string) {
+	t.Helper()
+	for _, engine := range engines {
+		plain := outcome(t, engine, path, src, false)
+		optimized := outcome(t, engine, path, src, true)
+		if plain != optimized {
+			t.Errorf("%s: optimizing changes the outcome\nwithout: %s\nwith:    %s", engine, plain, optimized)
+		}
+	}
+}
+
+func TestOptimizerPrograms(t *testing.T) {
+	for _, tc := range optimizerPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			differential(t, "", tc.src)
+		})
+	}
+}
+
+// TestOptimizerExamples runs every example with and without the
+// optimizer.
+func TestOptimizerExamples(t *testing.T) {
+	for _, path := range examplePaths(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			differential(t, path, exampleSource(t, path))
+		})
+	}
+}
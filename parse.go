@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+)
+
+// parseCommand prints the syntax tree of a program, as an indented outline
+// or, with -format=json, in the encoding ast.ToJSON documents. The tree is
+// printed as the parser returns it, before the resolver runs, unless -O
+// asks for it to be optimized first.
+func parseCommand(args []string) {
+	fs := flag.NewFlagSet("parse", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	opt := addOptimizeFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	p := parser.New(lexer.NewLexer(file))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Println("parser errors:")
+		for _, e := range p.Errors() {
+			fmt.Println(e)
+		}
+		os.Exit(1)
+	}
+	if !optimizeProgram(program, opt.Passes()) {
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+		printTree(program)
+	case "json":
+		out, err := ast.ToJSON(program)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+}
+
+// printTree prints one line per node, indented by depth: its position, kind
+// and, for leaves and operators, what it holds.
+func printTree(program *ast.Program) {
+	depth := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+
+		line := strings.Repeat("  ", depth) + strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if n.Variadic {
+				line += " ..." + n.Value
+			} else {
+				line += " " + n.Value
+			}
+		case *ast.NamedArgument:
+			line += " " + n.Name
+		case *ast.IntegerLiteral:
+			line += " " + n.Token.Literal
+		case *ast.StringLiteral:
+			line += fmt.Sprintf(" %q", n.Value)
+		case *ast.BooleanLiteral:
+			line += fmt.Sprintf(" %t", n.Value)
+		case *ast.InfixExpression:
+			line += " " + n.Operator
+		case *ast.CallExpression:
+			if n.Optional {
+				line += " ?."
+			}
+		case *ast.MemberExpression:
+			line += " " + n.Token.Literal + n.Member.Value
+		case *ast.TypeAnnotation:
+			if n.Name != "" {
+				line += " " + n.Name
+			}
+		}
+		if _, ok := n.(*ast.Program); ok {
+			fmt.Printf("%9s%s\n", "", line)
+		} else {
+			pos := ast.Start(n)
+			fmt.Printf("%4d:%-3d %s\n", pos.Line, pos.Column, line)
+		}
+
+		depth++
+		return true
+	})
+}
@@ -39,6 +39,13 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.registerPrefix(tok.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(tok.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(tok.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(tok.STRING, p.parseStringLiteral)
+	p.registerPrefix(tok.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(tok.NULL, p.parseNullLiteral)
+	p.registerPrefix(tok.IF, p.parseIfExpression)
+	p.registerPrefix(tok.MATCH, p.parseMatchExpression)
+	p.registerPrefix(tok.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(tok.LBRACE, p.parseHashLiteral)
 
 	// Register infix parse functions
 	p.registerInfix(tok.PLUS, p.parseInfixExpression)
@@ -48,6 +55,11 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.registerInfix(tok.GT, p.parseInfixExpression)
 	p.registerInfix(tok.LT, p.parseInfixExpression)
 	p.registerInfix(tok.LPAREN, p.parseCallExpression) // Register call expression
+	p.registerInfix(tok.DOT, p.parseMemberExpression)
+	p.registerInfix(tok.OPTIONAL_DOT, p.parseOptionalExpression)
+	p.registerInfix(tok.COALESCE, p.parseInfixExpression)
+	p.registerInfix(tok.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(tok.LBRACE, p.parseStructLiteral)
 
 	return p
 }
@@ -74,8 +86,14 @@ func (p *Parser) expectPeek(t tok.TokenType) bool {
 }
 
 func (p *Parser) peekError(t tok.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
+}
+
+// errorf records an error prefixed with its line:column, the same shape
+// the resolver and type checker use.
+func (p *Parser) errorf(pos tok.Position, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.errors = append(p.errors, fmt.Sprintf("%d:%d: %s", pos.Line, pos.Column, msg))
 }
 
 func (p *Parser) Errors() []string {
@@ -94,34 +112,124 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	program.Comments = p.lexer.Comments()
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case tok.VAR:
-		return p.parseVarStatement()
+		if stmt := p.parseVarStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case tok.IF:
-		return p.parseIfExpression().(ast.Statement)
+		if stmt, ok := p.parseIfExpression().(ast.Statement); ok {
+			return stmt
+		}
+		return nil
 	case tok.FUNCTION:
 		return p.parseFunctionStatement()
 	case tok.RETURN:
 		return p.parseReturnStatement()
 	case tok.EXIT:
 		return p.parseExitStatement()
+	case tok.TRY:
+		if stmt := p.parseTryStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case tok.THROW:
+		return p.parseThrowStatement()
+	case tok.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case tok.YIELD:
+		return p.parseYieldStatement()
+	case tok.STRUCT:
+		if stmt := p.parseStructStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case tok.ENUM:
+		if stmt := p.parseEnumStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case tok.IMPORT:
+		return p.parseImportStatement()
+	case tok.EXPORT:
+		return p.parseExportStatement()
 	default:
+		if p.prefixParseFns[p.currentToken.Type] == nil {
+			return nil
+		}
+		return p.parseExpressionStatement()
+	}
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.currentToken}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
 		return nil
 	}
+	if p.peekTokenIs(tok.ASSIGN) {
+		return p.parseAssignStatement(stmt.Expression)
+	}
+
+	if p.peekTokenIs(tok.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseAssignStatement parses the = and value of an assignment to target,
+// which must be a field.
+func (p *Parser) parseAssignStatement(target ast.Expression) ast.Statement {
+	member, ok := target.(*ast.MemberExpression)
+	if !ok || member.Optional {
+		p.errorf(p.peekToken.Pos, "can only assign to a field, as in p.x = 1; use var to declare a name again")
+		return nil
+	}
+
+	p.nextToken()
+	stmt := &ast.AssignStatement{Token: p.currentToken, Target: member}
+	p.nextToken()
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(tok.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
 }
 
 func (p *Parser) parseVarStatement() *ast.VarStatement {
 	stmt := &ast.VarStatement{Token: p.currentToken}
 
-	if !p.expectPeek(tok.IDENT) {
+	if p.peekTokenIs(tok.LBRACKET) || p.peekTokenIs(tok.LBRACE) {
+		p.nextToken()
+		if stmt.Name = p.parsePatternName(); stmt.Name == nil {
+			return nil
+		}
+	} else if !p.expectPeek(tok.IDENT) {
 		return nil
+	} else {
+		stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if p.peekTokenIs(tok.COLON) && stmt.Name.Pattern == nil {
+		p.nextToken()
+		if stmt.Type = p.parseTypeAnnotation(); stmt.Type == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(tok.ASSIGN) {
 		return nil
@@ -140,11 +248,13 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 const (
 	_ int = iota
 	LOWEST
-	SUM     // +
-	PRODUCT // *
-	PREFIX  // -X or !X
-	COMPARE // > or <
+	COALESCE // ??
+	SUM      // +
+	PRODUCT  // *
+	PREFIX   // -X or !X
+	COMPARE  // > or <
 	CALL
+	INDEX // array[index]
 )
 
 var precedences = map[tok.TokenType]int{
@@ -155,11 +265,37 @@ var precedences = map[tok.TokenType]int{
 	tok.GT:       COMPARE,
 	tok.LT:       COMPARE,
 	tok.LPAREN:   CALL,
+	tok.DOT:      CALL,
+	tok.COALESCE: COALESCE,
+	tok.LBRACKET: INDEX,
+
+	tok.OPTIONAL_DOT: CALL,
+	tok.LBRACE:       CALL, // Point{x: 1}
+}
+
+// Precedence returns the binding power of an infix operator token, or
+// LOWEST if it is not one.
+func Precedence(t tok.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// ParseExpression parses the whole input as a single expression, as typed
+// into the debugger for breakpoint conditions and watches.
+func (p *Parser) ParseExpression() ast.Expression {
+	exp := p.parseExpression(LOWEST)
+	if exp != nil && !p.peekTokenIs(tok.EOF) {
+		p.errorf(p.peekToken.Pos, "unexpected %s after expression", p.peekToken.Type)
+	}
+	return exp
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.currentToken.Type]
 	if prefix == nil {
+		p.errorf(p.currentToken.Pos, "unexpected %s", p.currentToken.Type)
 		return nil
 	}
 	leftExp := prefix()
@@ -181,8 +317,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.currentToken.Pos, "could not parse %q as integer", p.currentToken.Literal)
 		return nil
 	}
 
@@ -213,24 +348,21 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currentToken}
 
 	if !p.expectPeek(tok.LPAREN) {
-		fmt.Println("Expected '(' after 'if'")
 		return nil
 	}
 
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST)
 	if expression.Condition == nil {
-		fmt.Println("Failed to parse condition")
+		p.errorf(p.currentToken.Pos, "missing if condition")
 		return nil
 	}
 
 	if !p.expectPeek(tok.RPAREN) {
-		fmt.Println("Expected ')' after condition")
 		return nil
 	}
 
 	if !p.expectPeek(tok.LBRACE) {
-		fmt.Println("Expected '{' after ')'")
 		return nil
 	}
 
@@ -242,19 +374,199 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(tok.ELSE) {
 		p.nextToken()
 
-		if !p.expectPeek(tok.LBRACE) {
+		if p.peekTokenIs(tok.IF) {
+			p.nextToken()
+			expression.Alternative = p.parseElseIf()
+		} else if p.expectPeek(tok.LBRACE) {
+			expression.Alternative = p.parseBlockStatement()
+		}
+		if expression.Alternative == nil {
 			return nil
 		}
+	}
 
-		expression.Alternative = p.parseBlockStatement()
-		if expression.Alternative == nil {
+	return expression
+}
+
+// parseElseIf parses the if of an else if into a block of its own, so an
+// else is always followed by a block.
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.currentToken}
+	next, ok := p.parseIfExpression().(*ast.IfExpression)
+	if !ok {
+		return nil
+	}
+
+	block.Statements = []ast.Statement{next}
+	block.End = next.Consequence.End
+	if next.Alternative != nil {
+		block.End = next.Alternative.End
+	}
+	return block
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(tok.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if expression.Value == nil {
+		p.errorf(p.currentToken.Pos, "missing match value")
+		return nil
+	}
+
+	if !p.expectPeek(tok.RPAREN) || !p.expectPeek(tok.LBRACE) {
+		return nil
+	}
+
+	// arms are separated by commas, which are optional after a block
+	for !p.peekTokenIs(tok.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
 			return nil
 		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekTokenIs(tok.COMMA) {
+			p.nextToken()
+		} else if arm.Body == nil {
+			break
+		}
+	}
+
+	if !p.expectPeek(tok.RBRACE) {
+		return nil
 	}
+	expression.End = p.currentToken.Pos
 
+	if len(expression.Arms) == 0 {
+		p.errorf(expression.Pos(), "match needs at least one arm")
+		return nil
+	}
 	return expression
 }
 
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+
+	for {
+		pattern := p.parsePattern()
+		if pattern == nil {
+			return nil
+		}
+		arm.Patterns = append(arm.Patterns, pattern)
+
+		if !p.peekTokenIs(tok.COMMA) {
+			break
+		}
+		p.nextToken()
+		p.nextToken()
+	}
+
+	if len(arm.Patterns) > 1 {
+		for _, pattern := range arm.Patterns {
+			if names := ast.Bindings(pattern); len(names) > 0 {
+				p.errorf(names[0].Pos(), "cannot bind %s in an arm with more than one pattern", names[0].Value)
+				return nil
+			}
+		}
+	}
+
+	if p.peekTokenIs(tok.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+		if arm.Guard == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(tok.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.currentToken.Type == tok.LBRACE {
+		arm.Body = p.parseBlockStatement()
+	} else if arm.Value = p.parseExpression(LOWEST); arm.Value == nil {
+		return nil
+	}
+	return arm
+}
+
+// parsePattern parses a match pattern: an integer, string, boolean or null
+// literal, _, a name to bind, a variant such as Color.Red, a variant and
+// patterns for the values it carries, such as Result.Ok(v), or an array or
+// hash pattern such as [a, ...rest] or {name}.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.currentToken.Type {
+	case tok.INT:
+		return p.parseIntegerLiteral()
+	case tok.STRING:
+		return p.parseStringLiteral()
+	case tok.TRUE, tok.FALSE:
+		return p.parseBooleanLiteral()
+	case tok.NULL:
+		return p.parseNullLiteral()
+	case tok.IDENT:
+		if !p.peekTokenIs(tok.DOT) {
+			return p.parseIdentifier()
+		}
+		return p.parseVariantPattern()
+	case tok.LBRACKET, tok.LBRACE:
+		pattern := p.parseBindingPattern()
+		if pattern == nil {
+			return nil
+		}
+		return pattern.(ast.Expression)
+	}
+	p.errorf(p.currentToken.Pos, "expected a match pattern, got %s", p.currentToken.Literal)
+	return nil
+}
+
+// parseVariantPattern parses a pattern that starts with a dotted name.
+// Without parentheses after it, it is the value the name refers to.
+func (p *Parser) parseVariantPattern() ast.Expression {
+	var typ ast.Expression = p.parseIdentifier()
+	for p.peekTokenIs(tok.DOT) {
+		p.nextToken()
+		me := &ast.MemberExpression{Token: p.currentToken, Object: typ}
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		me.Member = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		typ = me
+	}
+	if !p.peekTokenIs(tok.LPAREN) {
+		return typ
+	}
+
+	p.nextToken()
+	pattern := &ast.VariantPattern{Token: p.currentToken, Type: typ}
+	for {
+		p.nextToken()
+		sub := p.parsePattern()
+		if sub == nil {
+			return nil
+		}
+		pattern.Patterns = append(pattern.Patterns, sub)
+		if !p.peekTokenIs(tok.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(tok.RPAREN) {
+		return nil
+	}
+	pattern.End = p.currentToken.Pos
+	return pattern
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currentToken}
 	block.Statements = []ast.Statement{}
@@ -269,9 +581,113 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	block.End = p.currentToken.Pos
 	return block
 }
 
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.currentToken}
+
+	if !p.expectPeek(tok.LBRACE) {
+		return nil
+	}
+	if stmt.Body = p.parseBlockStatement(); stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(tok.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(tok.LPAREN) || !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		stmt.Param = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(tok.RPAREN) || !p.expectPeek(tok.LBRACE) {
+			return nil
+		}
+		if stmt.Catch = p.parseBlockStatement(); stmt.Catch == nil {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(tok.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(tok.LBRACE) {
+			return nil
+		}
+		if stmt.Finally = p.parseBlockStatement(); stmt.Finally == nil {
+			return nil
+		}
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorf(stmt.Pos(), "try needs a catch or a finally")
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.currentToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tok.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForStatement parses for (name in iterable) { body }, where name can
+// be an array or hash pattern as in a var.
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectPeek(tok.LPAREN) {
+		return nil
+	}
+	if p.peekTokenIs(tok.LBRACKET) || p.peekTokenIs(tok.LBRACE) {
+		p.nextToken()
+		if stmt.Name = p.parsePatternName(); stmt.Name == nil {
+			return nil
+		}
+	} else if !p.expectPeek(tok.IDENT) {
+		return nil
+	} else {
+		stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	if !p.expectPeek(tok.IN) {
+		return nil
+	}
+	p.nextToken()
+	if stmt.Iterable = p.parseExpression(LOWEST); stmt.Iterable == nil {
+		return nil
+	}
+
+	if !p.expectPeek(tok.RPAREN) || !p.expectPeek(tok.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	return stmt
+}
+
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.currentToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tok.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExitStatement() *ast.ExitStatement {
 	stmt := &ast.ExitStatement{Token: p.currentToken}
 
@@ -294,6 +710,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
+	lit.ReturnType = p.parseOptionalReturnType()
 
 	if !p.expectPeek(tok.LBRACE) {
 		return nil
@@ -314,27 +731,483 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	identifiers = append(identifiers, ident)
+	for {
+		ident := p.parseParameter()
+		if ident == nil {
+			return nil
+		}
+		if len(identifiers) > 0 {
+			last := identifiers[len(identifiers)-1]
+			if last.Variadic {
+				p.errorf(last.Pos(), "...%s must come last", last.Value)
+				return nil
+			}
+			if last.Default != nil && ident.Default == nil && !ident.Variadic {
+				p.errorf(ident.Pos(), "%s follows a parameter with a default, so it needs one too", ident.Value)
+				return nil
+			}
+		}
+		identifiers = append(identifiers, ident)
 
-	for p.peekTokenIs(tok.COMMA) {
+		if !p.peekTokenIs(tok.COMMA) {
+			break
+		}
 		p.nextToken()
 		p.nextToken()
-		ident = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
 	if !p.expectPeek(tok.RPAREN) {
-		fmt.Println("Expected ')' after body")
 		return nil
 	}
 
 	return identifiers
 }
 
+// parseParameter parses a name or pattern with an optional default, or
+// ...name. Either kind of name can have a type annotation.
+func (p *Parser) parseParameter() *ast.Identifier {
+	variadic := p.currentToken.Type == tok.ELLIPSIS
+	if variadic && !p.expectPeek(tok.IDENT) {
+		return nil
+	}
+
+	var ident *ast.Identifier
+	switch p.currentToken.Type {
+	case tok.LBRACKET, tok.LBRACE:
+		if ident = p.parsePatternName(); ident == nil {
+			return nil
+		}
+	case tok.IDENT:
+		ident = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal, Variadic: variadic}
+		if p.peekTokenIs(tok.COLON) {
+			p.nextToken()
+			ident.Type = p.parseTypeAnnotation()
+		}
+	default:
+		p.errorf(p.currentToken.Pos, "expected a parameter, got %s instead", p.currentToken.Type)
+		return nil
+	}
+
+	if p.peekTokenIs(tok.ASSIGN) {
+		p.nextToken()
+		if variadic {
+			p.errorf(p.currentToken.Pos, "...%s cannot have a default", ident.Value)
+			return nil
+		}
+		p.nextToken()
+		if ident.Default = p.parseExpression(LOWEST); ident.Default == nil {
+			return nil
+		}
+	}
+
+	return ident
+}
+
+// parsePatternName parses the array or hash pattern of a destructured var or
+// parameter and returns the name made up for it, which holds the pattern.
+func (p *Parser) parsePatternName() *ast.Identifier {
+	pattern := p.parseBindingPattern()
+	if pattern == nil {
+		return nil
+	}
+	name := pattern.String()
+	return &ast.Identifier{
+		Token:   tok.Tok{Type: tok.IDENT, Literal: name, Pos: pattern.Pos(), End: ast.End(pattern)},
+		Value:   name,
+		Pattern: pattern,
+	}
+}
+
+// parseBindingPattern parses a name, [elements] or {keys}, where the last
+// element or key can be ...rest.
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case tok.IDENT:
+		return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	case tok.LBRACKET:
+		pattern := &ast.ArrayPattern{Token: p.currentToken, Elements: []ast.Pattern{}}
+		rest, ok := p.parsePatternList(tok.RBRACKET, func() bool {
+			element := p.parseBindingPattern()
+			pattern.Elements = append(pattern.Elements, element)
+			return element != nil
+		})
+		if !ok {
+			return nil
+		}
+		pattern.Rest, pattern.End = rest, p.currentToken.Pos
+		return pattern
+
+	case tok.LBRACE:
+		pattern := &ast.HashPattern{Token: p.currentToken}
+		rest, ok := p.parsePatternList(tok.RBRACE, func() bool {
+			if p.currentToken.Type != tok.IDENT {
+				p.errorf(p.currentToken.Pos, "expected a key name, got %s instead", p.currentToken.Type)
+				return false
+			}
+			pattern.Keys = append(pattern.Keys, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+			return true
+		})
+		if !ok {
+			return nil
+		}
+		pattern.Rest, pattern.End = rest, p.currentToken.Pos
+		return pattern
+	}
+
+	p.errorf(p.currentToken.Pos, "expected a name or a pattern, got %s instead", p.currentToken.Type)
+	return nil
+}
+
+// parsePatternList parses the comma separated items of an array or hash
+// pattern up to end, calling item for each but a ...rest, which must come
+// last and is returned.
+func (p *Parser) parsePatternList(end tok.TokenType, item func() bool) (*ast.Identifier, bool) {
+	for !p.peekTokenIs(end) {
+		p.nextToken()
+
+		if p.currentToken.Type == tok.ELLIPSIS {
+			if !p.expectPeek(tok.IDENT) {
+				return nil, false
+			}
+			rest := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+			if !p.peekTokenIs(end) {
+				p.errorf(p.peekToken.Pos, "...%s must come last", rest.Value)
+				return nil, false
+			}
+			p.nextToken()
+			return rest, true
+		}
+
+		if !item() {
+			return nil, false
+		}
+		if !p.peekTokenIs(tok.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil, false
+	}
+	return nil, true
+}
+
+// parseOptionalReturnType parses the `: type` that may follow a parameter
+// list.
+func (p *Parser) parseOptionalReturnType() *ast.TypeAnnotation {
+	if !p.peekTokenIs(tok.COLON) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseTypeAnnotation()
+}
+
+// parseTypeAnnotation expects the current token to be the one just before
+// the type, usually the ':'.
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	p.nextToken()
+	ta := &ast.TypeAnnotation{Token: p.currentToken}
+
+	switch p.currentToken.Type {
+	case tok.IDENT:
+		ta.Name = p.currentToken.Literal
+		return ta
+	case tok.FUNCTION:
+	default:
+		p.errorf(p.currentToken.Pos, "expected a type, got %s instead", p.currentToken.Type)
+		return nil
+	}
+
+	if !p.expectPeek(tok.LPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(tok.RPAREN) {
+		p.nextToken()
+	} else {
+		for {
+			param := p.parseTypeAnnotation()
+			if param == nil {
+				return nil
+			}
+			ta.Parameters = append(ta.Parameters, param)
+
+			if !p.peekTokenIs(tok.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(tok.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(tok.COLON) {
+		return nil
+	}
+	if ta.Return = p.parseTypeAnnotation(); ta.Return == nil {
+		return nil
+	}
+
+	return ta
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currentToken, Function: function}
-	exp.Arguments = p.parseExpressionList(tok.RPAREN)
+	exp.Arguments = p.parseCallArguments()
+	exp.End = p.currentToken.Pos
+	return exp
+}
+
+// parseCallArguments parses the arguments of a call up to the closing
+// parenthesis: expressions and ...spreads, then name: value pairs.
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+	named := map[string]bool{}
+
+	for !p.peekTokenIs(tok.RPAREN) {
+		if len(args) > 0 && !p.expectPeek(tok.COMMA) {
+			return nil
+		}
+		p.nextToken()
+		start := p.currentToken.Pos
+
+		switch {
+		case p.currentToken.Type == tok.ELLIPSIS:
+			spread := &ast.SpreadExpression{Token: p.currentToken}
+			p.nextToken()
+			spread.Value = p.parseExpression(LOWEST)
+			args = append(args, spread)
+
+		case p.currentToken.Type == tok.IDENT && p.peekTokenIs(tok.COLON):
+			arg := &ast.NamedArgument{Token: p.currentToken, Name: p.currentToken.Literal}
+			if named[arg.Name] {
+				p.errorf(arg.Pos(), "argument %s given twice", arg.Name)
+			}
+			named[arg.Name] = true
+			p.nextToken()
+			p.nextToken()
+			arg.Value = p.parseExpression(LOWEST)
+			args = append(args, arg)
+			continue
+
+		default:
+			args = append(args, p.parseExpression(LOWEST))
+		}
+
+		if len(named) > 0 {
+			p.errorf(start, "positional argument after a named one")
+		}
+	}
+
+	p.nextToken()
+	return args
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	if array.Elements = p.parseExpressionList(tok.RBRACKET); array.Elements == nil {
+		return nil
+	}
+	array.End = p.currentToken.Pos
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Keys: []ast.Expression{}, Values: []ast.Expression{}}
+
+	for !p.peekTokenIs(tok.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil || !p.expectPeek(tok.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if !p.peekTokenIs(tok.RBRACE) && !p.expectPeek(tok.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(tok.RBRACE) {
+		return nil
+	}
+	hash.End = p.currentToken.Pos
+	return hash
+}
+
+// parseStructStatement parses struct Point { x, y }.
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.currentToken}
+
+	if !p.expectPeek(tok.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(tok.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(tok.RBRACE) {
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if seen[field.Value] {
+			p.errorf(field.Pos(), "duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(tok.RBRACE) && !p.expectPeek(tok.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	stmt.End = p.currentToken.Pos
+	return stmt
+}
+
+// parseEnumStatement parses enum Result { Ok(value), Err(error) }. A
+// variant without values has no parentheses.
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.currentToken}
+
+	if !p.expectPeek(tok.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(tok.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(tok.RBRACE) {
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}}
+		if seen[variant.Name.Value] {
+			p.errorf(variant.Pos(), "duplicate variant %s in enum %s", variant.Name.Value, stmt.Name.Value)
+		}
+		seen[variant.Name.Value] = true
+
+		if p.peekTokenIs(tok.LPAREN) {
+			p.nextToken()
+			if p.peekTokenIs(tok.RPAREN) {
+				p.errorf(p.currentToken.Pos, "variant %s needs a name for each value it carries, or no parentheses", variant.Name.Value)
+				return nil
+			}
+			fields := map[string]bool{}
+			for {
+				if !p.expectPeek(tok.IDENT) {
+					return nil
+				}
+				field := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+				if fields[field.Value] {
+					p.errorf(field.Pos(), "duplicate field %s in variant %s", field.Value, variant.Name.Value)
+				}
+				fields[field.Value] = true
+				variant.Fields = append(variant.Fields, field)
+				if !p.peekTokenIs(tok.COMMA) {
+					break
+				}
+				p.nextToken()
+			}
+			if !p.expectPeek(tok.RPAREN) {
+				return nil
+			}
+			variant.End = p.currentToken.Pos
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(tok.RBRACE) && !p.expectPeek(tok.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if len(stmt.Variants) == 0 {
+		p.errorf(stmt.Pos(), "enum %s needs at least one variant", stmt.Name.Value)
+		return nil
+	}
+	stmt.End = p.currentToken.Pos
+	return stmt
+}
+
+// parseStructLiteral parses the fields of Point{x: 1, y: 2}, where the
+// name before the { has already been parsed as typ.
+func (p *Parser) parseStructLiteral(typ ast.Expression) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.currentToken, Type: typ, Values: []ast.Expression{}}
+
+	named := false
+	switch typ := typ.(type) {
+	case *ast.Identifier:
+		named = true
+	case *ast.MemberExpression:
+		named = !typ.Optional
+	}
+	if !named {
+		p.errorf(lit.Pos(), "a struct literal needs the name of a struct before {")
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(tok.RBRACE) {
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if seen[field.Value] {
+			p.errorf(field.Pos(), "field %s given twice", field.Value)
+		}
+		seen[field.Value] = true
+
+		if !p.expectPeek(tok.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, value)
+
+		if !p.peekTokenIs(tok.RBRACE) && !p.expectPeek(tok.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	lit.End = p.currentToken.Pos
+	return lit
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
+
+	p.nextToken()
+	if exp.Index = p.parseExpression(LOWEST); exp.Index == nil {
+		return nil
+	}
+	if !p.expectPeek(tok.RBRACKET) {
+		return nil
+	}
+	exp.End = p.currentToken.Pos
 	return exp
 }
 
@@ -365,6 +1238,22 @@ func (p *Parser) parseExpressionList(end tok.TokenType) []ast.Expression {
 func (p *Parser) parseFunctionStatement() ast.Statement {
 	stmt := &ast.FunctionStatement{Token: p.currentToken}
 
+	// a method: gorlami (p Point) norm()
+	if p.peekTokenIs(tok.LPAREN) {
+		p.nextToken()
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		stmt.Receiver = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(tok.IDENT) {
+			return nil
+		}
+		stmt.ReceiverType = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(tok.RPAREN) {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(tok.IDENT) {
 		return nil
 	}
@@ -376,6 +1265,7 @@ func (p *Parser) parseFunctionStatement() ast.Statement {
 	}
 
 	stmt.Parameters = p.parseFunctionParameters()
+	stmt.ReturnType = p.parseOptionalReturnType()
 
 	if !p.expectPeek(tok.LBRACE) {
 		return nil
@@ -400,10 +1290,127 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tok.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.currentToken, Object: object}
+
+	if !p.expectPeek(tok.IDENT) {
+		return nil
+	}
+
+	exp.Member = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	return exp
+}
+
+// parseOptionalExpression parses what follows ?. : either a member name,
+// m?.x, or the arguments of a safe call, f?.(x).
+func (p *Parser) parseOptionalExpression(left ast.Expression) ast.Expression {
+	if p.peekTokenIs(tok.LPAREN) {
+		p.nextToken()
+		call := p.parseCallExpression(left).(*ast.CallExpression)
+		call.Optional = true
+		return call
+	}
+
+	member, ok := p.parseMemberExpression(left).(*ast.MemberExpression)
+	if !ok {
+		return nil
+	}
+	member.Optional = true
+	return member
+}
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+
+	if !p.expectPeek(tok.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(tok.AS) {
+		return nil
+	}
+	if !p.expectPeek(tok.IDENT) {
+		return nil
+	}
+	stmt.Alias = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekTokenIs(tok.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.currentToken}
+
+	p.nextToken()
+	switch p.currentToken.Type {
+	case tok.VAR:
+		decl := p.parseVarStatement()
+		if decl == nil {
+			return nil
+		}
+		if decl.Name.Pattern != nil {
+			p.errorf(decl.Name.Pos(), "cannot export a destructuring var")
+			return nil
+		}
+		stmt.Declaration = decl
+	case tok.FUNCTION:
+		decl := p.parseFunctionStatement()
+		if decl == nil {
+			return nil
+		}
+		if decl.(*ast.FunctionStatement).Receiver != nil {
+			p.errorf(decl.Pos(), "cannot export a method; it is exported with its struct")
+			return nil
+		}
+		stmt.Declaration = decl
+	case tok.STRUCT:
+		decl := p.parseStructStatement()
+		if decl == nil {
+			return nil
+		}
+		stmt.Declaration = decl
+	case tok.ENUM:
+		decl := p.parseEnumStatement()
+		if decl == nil {
+			return nil
+		}
+		stmt.Declaration = decl
+	default:
+		p.errorf(p.currentToken.Pos, "expected var, gorlami, struct or enum after export, got %s instead", p.currentToken.Type)
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Token: p.currentToken, Value: p.currentToken.Type == tok.TRUE}
 }
 
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.currentToken}
+}
+
 func (p *Parser) currentPrecedence() int {
 	if p, ok := precedences[p.currentToken.Type]; ok {
 		return p
@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read
+// by go tool pprof. Each call stack becomes a sample with two values, the
+// statements run there and the time spent there, and each frame a location
+// at the line it was on.
+func (p *Profile) WritePprof(w io.Writer) error {
+	b := &pprofBuilder{strings: map[string]int64{"": 0}, table: []string{""}, locations: map[[2]int]uint64{}}
+
+	var msg protobuf
+	msg.message(1, b.valueType("hits", "count"))
+	msg.message(1, b.valueType("time", "nanoseconds"))
+
+	stacks := p.Stacks()
+	sort.Slice(stacks, func(a, c int) bool { return stackName(stacks[a], ";") < stackName(stacks[c], ";") })
+
+	for _, s := range stacks {
+		var sample protobuf
+		ids := make([]uint64, 0, len(s.Frames))
+		for idx := len(s.Frames) - 1; idx >= 0; idx-- { // leaf first
+			f := s.Frames[idx]
+			ids = append(ids, b.location(f.Function.ID, f.Line))
+		}
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(s.Hits), uint64(s.Self.Nanoseconds())})
+		msg.message(2, sample)
+	}
+
+	for _, loc := range b.locationList {
+		msg.message(4, loc)
+	}
+
+	for _, fn := range p.order {
+		var f protobuf
+		f.varint(1, uint64(fn.ID))
+		f.varint(2, uint64(b.str(fn.Name)))
+		f.varint(3, uint64(b.str(fn.Name)))
+		f.varint(4, uint64(b.str(fn.File)))
+		f.varint(5, uint64(fn.Line))
+		msg.message(5, f)
+	}
+
+	// The string table must be complete before it is written, so everything
+	// that interns a string comes first.
+	periodType := b.valueType("time", "nanoseconds")
+	defaultType := b.str("time")
+
+	for _, s := range b.table {
+		msg.bytes(6, []byte(s))
+	}
+	msg.varint(9, uint64(p.start.UnixNano()))
+	msg.varint(10, uint64(p.total.Nanoseconds()))
+	msg.message(11, periodType)
+	msg.varint(12, 1)
+	msg.varint(14, uint64(defaultType))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(msg.buf); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type pprofBuilder struct {
+	strings      map[string]int64
+	table        []string
+	locations    map[[2]int]uint64
+	locationList []protobuf
+}
+
+func (b *pprofBuilder) str(s string) int64 {
+	if idx, ok := b.strings[s]; ok {
+		return idx
+	}
+	idx := int64(len(b.table))
+	b.strings[s] = idx
+	b.table = append(b.table, s)
+	return idx
+}
+
+func (b *pprofBuilder) valueType(typ, unit string) protobuf {
+	var vt protobuf
+	vt.varint(1, uint64(b.str(typ)))
+	vt.varint(2, uint64(b.str(unit)))
+	return vt
+}
+
+// location returns the ID of the location for line in function fn, adding
+// it on first use.
+func (b *pprofBuilder) location(fn, line int) uint64 {
+	key := [2]int{fn, line}
+	if id, ok := b.locations[key]; ok {
+		return id
+	}
+
+	id := uint64(len(b.locationList) + 1)
+	b.locations[key] = id
+
+	var ln protobuf
+	ln.varint(1, uint64(fn))
+	ln.varint(2, uint64(line))
+
+	var loc protobuf
+	loc.varint(1, id)
+	loc.message(4, ln)
+	b.locationList = append(b.locationList, loc)
+	return id
+}
+
+// protobuf is just enough of a protocol buffer encoder for profile.proto:
+// varint and length delimited fields.
+type protobuf struct {
+	buf []byte
+}
+
+func (p *protobuf) uvarint(v uint64) {
+	for v >= 0x80 {
+		p.buf = append(p.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	p.buf = append(p.buf, byte(v))
+}
+
+func (p *protobuf) key(field, wireType int) {
+	p.uvarint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (p *protobuf) varint(field int, v uint64) {
+	if v == 0 {
+		return // the default, so it can be left out
+	}
+	p.key(field, 0)
+	p.uvarint(v)
+}
+
+func (p *protobuf) bytes(field int, b []byte) {
+	p.key(field, 2)
+	p.uvarint(uint64(len(b)))
+	p.buf = append(p.buf, b...)
+}
+
+func (p *protobuf) message(field int, m protobuf) {
+	p.bytes(field, m.buf)
+}
+
+func (p *protobuf) packed(field int, vs []uint64) {
+	var inner protobuf
+	for _, v := range vs {
+		inner.uvarint(v)
+	}
+	p.bytes(field, inner.buf)
+}
@@ -0,0 +1,283 @@
+// Package profile measures where a salami program spends its time. It
+// records call counts and inclusive and exclusive time for every gorlami,
+// hit counts and self time for every source line, and the time spent in
+// each distinct call stack. Either engine can feed it, through
+// Profile.Interpreter or Profile.VM.
+//
+// Time is measured between events rather than sampled: whatever ran between
+// two statements (or calls) is charged to the line, function and stack that
+// were current when it started.
+package profile
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// Function holds the totals for one gorlami, or for the top level program.
+type Function struct {
+	ID        int
+	Name      string
+	File      string
+	Line      int // where it is declared; on the vm, its first line of code
+	Calls     int64
+	Inclusive time.Duration // with recursive calls counted once
+	Exclusive time.Duration // not counting the functions it calls
+
+	active int // calls currently on the stack
+}
+
+// Line holds the totals for one source line.
+type Line struct {
+	File string
+	Line int
+	Hits int64
+	Self time.Duration
+}
+
+// Stack holds the totals for one distinct call stack, identified by the
+// function and current line of each frame from the outermost in.
+type Stack struct {
+	Frames []StackFrame
+	Hits   int64
+	Self   time.Duration
+}
+
+type StackFrame struct {
+	Function *Function
+	Line     int
+}
+
+type frame struct {
+	fn      *Function
+	line    int
+	entered time.Duration // the profile's measured time when it was entered
+	prefix  string        // key of the calling frames, each with its current line
+}
+
+type lineKey struct {
+	file string
+	line int
+}
+
+type Profile struct {
+	Engine string // which engine produced it, for the report header
+
+	functions map[string]*Function
+	order     []*Function
+	lines     map[lineKey]*Line
+	stacks    map[string]*Stack
+
+	stack    []*frame
+	last     time.Time
+	start    time.Time
+	measured time.Duration // charged so far, not counting the profiler itself
+	total    time.Duration
+}
+
+// New starts a profile of a program read from file. Its top level code is
+// recorded as a function called main.
+func New(file string) *Profile {
+	p := &Profile{
+		functions: map[string]*Function{},
+		lines:     map[lineKey]*Line{},
+		stacks:    map[string]*Stack{},
+	}
+	p.start = time.Now()
+	p.last = p.start
+	p.enter("main", file, 0)
+	return p
+}
+
+// Stop ends the profile, closing any calls a runtime error or exit left
+// open.
+func (p *Profile) Stop() {
+	for len(p.stack) > 0 {
+		p.exit()
+	}
+	p.total = p.measured
+}
+
+// Total is the time measured between New and Stop, leaving out the time
+// spent in the profiler itself.
+func (p *Profile) Total() time.Duration { return p.total }
+
+// Functions returns every function that was called, in order of first call.
+func (p *Profile) Functions() []*Function { return p.order }
+
+// Lines returns every line that ran.
+func (p *Profile) Lines() []*Line {
+	lines := make([]*Line, 0, len(p.lines))
+	for _, l := range p.lines {
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// Stacks returns every distinct call stack seen.
+func (p *Profile) Stacks() []*Stack {
+	stacks := make([]*Stack, 0, len(p.stacks))
+	for _, s := range p.stacks {
+		stacks = append(stacks, s)
+	}
+	return stacks
+}
+
+// tick charges the time since the last event to whatever was running.
+// Each event ends with done, so the profiler's own bookkeeping is not
+// charged to the frame left on top.
+// Nothing runs before main is entered, so that time is not measured.
+func (p *Profile) tick() {
+	if len(p.stack) == 0 {
+		return
+	}
+	elapsed := time.Since(p.last)
+	p.measured += elapsed
+
+	top := p.stack[len(p.stack)-1]
+	top.fn.Exclusive += elapsed
+	if top.line > 0 {
+		p.line(top.fn.File, top.line).Self += elapsed
+	}
+	p.current().Self += elapsed
+}
+
+func (p *Profile) enter(name, file string, line int) {
+	p.tick()
+
+	key := fmt.Sprintf("%s\x00%s\x00%d", name, file, line)
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &Function{ID: len(p.order) + 1, Name: name, File: file, Line: line}
+		p.functions[key] = fn
+		p.order = append(p.order, fn)
+	}
+	fn.Calls++
+	fn.active++
+
+	prefix := ""
+	if len(p.stack) > 0 {
+		caller := p.stack[len(p.stack)-1]
+		prefix = caller.prefix + fmt.Sprintf("%d:%d;", caller.fn.ID, caller.line)
+	}
+	p.stack = append(p.stack, &frame{fn: fn, entered: p.measured, prefix: prefix})
+	p.done()
+}
+
+func (p *Profile) exit() {
+	p.tick()
+
+	top := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	top.fn.active--
+	if top.fn.active == 0 {
+		top.fn.Inclusive += p.measured - top.entered
+	}
+	p.done()
+}
+
+func (p *Profile) step(line int) {
+	p.tick()
+
+	top := p.stack[len(p.stack)-1]
+	top.line = line
+	p.line(top.fn.File, line).Hits++
+	p.current().Hits++
+	p.done()
+}
+
+func (p *Profile) done() {
+	p.last = time.Now()
+}
+
+func (p *Profile) line(file string, line int) *Line {
+	key := lineKey{file, line}
+	l, ok := p.lines[key]
+	if !ok {
+		l = &Line{File: file, Line: line}
+		p.lines[key] = l
+	}
+	return l
+}
+
+// current returns the totals for the stack as it is now.
+func (p *Profile) current() *Stack {
+	top := p.stack[len(p.stack)-1]
+	key := top.prefix + fmt.Sprintf("%d:%d", top.fn.ID, top.line)
+
+	s, ok := p.stacks[key]
+	if !ok {
+		s = &Stack{}
+		for _, f := range p.stack {
+			s.Frames = append(s.Frames, StackFrame{Function: f.fn, Line: f.line})
+		}
+		p.stacks[key] = s
+	}
+	return s
+}
+
+// Interpreter returns a tracer that feeds the tree-walking interpreter's
+// calls and statements into p.
+func (p *Profile) Interpreter() interpreter.Tracer {
+	return interpTracer{p}
+}
+
+type interpTracer struct{ p *Profile }
+
+func (t interpTracer) Program(string, *ast.Program) {}
+
+func (t interpTracer) Enter(fn *interpreter.Function) {
+	t.p.enter(functionName(fn.Name), fn.File, fn.Body.Pos().Line)
+}
+
+func (t interpTracer) Exit(*interpreter.Function) { t.p.exit() }
+
+func (t interpTracer) Statement(stmt ast.Statement) { t.p.step(stmt.Pos().Line) }
+
+func (t interpTracer) Branch(*ast.IfExpression, bool) {}
+
+// VM returns a tracer that feeds the virtual machine's calls and lines into
+// p. Compiled code does not record its file, so every function is taken to
+// come from the file p was created for.
+func (p *Profile) VM() *VMTracer {
+	return &VMTracer{p: p, file: p.order[0].File}
+}
+
+type VMTracer struct {
+	p    *Profile
+	file string
+}
+
+func (t *VMTracer) Enter(fn *code.CompiledFunction) {
+	line := 0
+	if len(fn.Lines) > 0 {
+		line = fn.Lines[0].Line
+	}
+	t.p.enter(functionName(fn.Name), t.file, line)
+}
+
+func (t *VMTracer) Exit(*code.CompiledFunction) { t.p.exit() }
+
+func (t *VMTracer) Line(line int) { t.p.step(line) }
+
+func functionName(name string) string {
+	if name == "" {
+		return "<anonymous>"
+	}
+	return name
+}
+
+// stackName joins the function names in s, outermost first, with sep.
+func stackName(s *Stack, sep string) string {
+	names := make([]string, len(s.Frames))
+	for idx, f := range s.Frames {
+		names[idx] = f.Function.Name
+	}
+	return strings.Join(names, sep)
+}
@@ -0,0 +1,316 @@
+package profile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/profile"
+	"github.com/afoley/salami-lang/vm"
+)
+
+// fib(25) makes this many calls to fib, 121393 of which have n < 2.
+const (
+	fibCalls  = 242785
+	fibLeaves = 121393
+)
+
+// run profiles examples/fib.salami on engine.
+func run(t *testing.T, engine string) *profile.Profile {
+	t.Helper()
+	path, _ := filepath.Abs("../examples/fib.salami")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	prof := profile.New(path)
+	prof.Engine = engine
+	switch engine {
+	case "interp":
+		interp := interpreter.New()
+		interp.File = path
+		interp.Tracer = prof.Interpreter()
+		if _, err := interp.Run(program); err != nil {
+			t.Fatal(err)
+		}
+	case "vm":
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatal(err)
+		}
+		machine, err := vm.New(comp.Bytecode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		machine.Tracer = prof.VM()
+		if err := machine.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prof.Stop()
+	return prof
+}
+
+func functions(prof *profile.Profile) map[string]*profile.Function {
+	fns := map[string]*profile.Function{}
+	for _, fn := range prof.Functions() {
+		fns[fn.Name] = fn
+	}
+	return fns
+}
+
+// Both engines count every call, and a function's inclusive time counts
+// recursive calls once, so no function takes longer than the program.
+func TestCalls(t *testing.T) {
+	for _, engine := range []string{"interp", "vm"} {
+		t.Run(engine, func(t *testing.T) {
+			prof := run(t, engine)
+			fns := functions(prof)
+			if len(fns) != 2 || fns["main"] == nil || fns["fib"] == nil {
+				t.Fatalf("got functions %v, want main and fib", fns)
+			}
+			if fns["main"].Calls != 1 || fns["fib"].Calls != fibCalls {
+				t.Errorf("calls: got main %d, fib %d, want 1 and %d", fns["main"].Calls, fns["fib"].Calls, fibCalls)
+			}
+			// compiled code only knows the line its body starts on
+			if want := map[string]int{"interp": 1, "vm": 2}[engine]; fns["fib"].Line != want {
+				t.Errorf("fib declared on line %d, want %d", fns["fib"].Line, want)
+			}
+
+			total := prof.Total()
+			if fns["main"].Inclusive != total {
+				t.Errorf("main inclusive %s, want the total %s", fns["main"].Inclusive, total)
+			}
+			if fib := fns["fib"]; fib.Inclusive > total || fib.Exclusive > fib.Inclusive {
+				t.Errorf("fib inclusive %s, exclusive %s, total %s", fib.Inclusive, fib.Exclusive, total)
+			}
+			if sum := fns["main"].Exclusive + fns["fib"].Exclusive; sum != total {
+				t.Errorf("exclusive times add up to %s, want the total %s", sum, total)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	hits := map[int]int64{}
+	for _, l := range run(t, "interp").Lines() {
+		hits[l.Line] = l.Hits
+	}
+	want := map[int]int64{1: 1, 2: fibCalls, 3: fibLeaves, 5: fibCalls - fibLeaves, 8: 1}
+	if len(hits) != len(want) {
+		t.Errorf("got hits on lines %v, want %v", hits, want)
+	}
+	for line, n := range want {
+		if hits[line] != n {
+			t.Errorf("line %d: got %d hits, want %d", line, hits[line], n)
+		}
+	}
+}
+
+// pprof is the part of profile.proto the test looks at.
+type pprof struct {
+	sampleTypes [][2]int64 // type and unit, as string table indexes
+	samples     []sample
+	locations   map[uint64][2]uint64 // function and line, by location ID
+	functions   map[uint64]int64     // name, by function ID
+	strings     []string
+	duration    int64
+}
+
+type sample struct {
+	locations []uint64 // leaf first
+	values    []int64
+}
+
+// fields calls f with each field of the protocol buffer message buf: its
+// number and either its varint value or its bytes.
+func fields(t *testing.T, buf []byte, f func(field int, v uint64, b []byte)) {
+	t.Helper()
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(buf)
+			buf = buf[n:]
+			f(int(key>>3), v, nil)
+		case 2:
+			length, n := binary.Uvarint(buf)
+			buf = buf[n:]
+			f(int(key>>3), 0, buf[:length])
+			buf = buf[length:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+}
+
+func packed(b []byte) []uint64 {
+	var vs []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		vs = append(vs, v)
+		b = b[n:]
+	}
+	return vs
+}
+
+func decode(t *testing.T, data []byte) *pprof {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &pprof{locations: map[uint64][2]uint64{}, functions: map[uint64]int64{}}
+	fields(t, raw, func(field int, v uint64, b []byte) {
+		switch field {
+		case 1:
+			var vt [2]int64
+			fields(t, b, func(field int, v uint64, _ []byte) { vt[field-1] = int64(v) })
+			p.sampleTypes = append(p.sampleTypes, vt)
+		case 2:
+			var s sample
+			fields(t, b, func(field int, _ uint64, b []byte) {
+				switch field {
+				case 1:
+					s.locations = packed(b)
+				case 2:
+					for _, v := range packed(b) {
+						s.values = append(s.values, int64(v))
+					}
+				}
+			})
+			p.samples = append(p.samples, s)
+		case 4:
+			var id uint64
+			var fnLine [2]uint64
+			fields(t, b, func(field int, v uint64, b []byte) {
+				switch field {
+				case 1:
+					id = v
+				case 4:
+					fields(t, b, func(field int, v uint64, _ []byte) { fnLine[field-1] = v })
+				}
+			})
+			p.locations[id] = fnLine
+		case 5:
+			var id uint64
+			var name int64
+			fields(t, b, func(field int, v uint64, _ []byte) {
+				switch field {
+				case 1:
+					id = v
+				case 2:
+					name = int64(v)
+				}
+			})
+			p.functions[id] = name
+		case 6:
+			p.strings = append(p.strings, string(b))
+		case 10:
+			p.duration = int64(v)
+		}
+	})
+	return p
+}
+
+func TestPprof(t *testing.T) {
+	prof := run(t, "interp")
+	var buf bytes.Buffer
+	if err := prof.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p := decode(t, buf.Bytes())
+
+	if len(p.strings) == 0 || p.strings[0] != "" {
+		t.Fatalf("string table %q must start with the empty string", p.strings)
+	}
+	var types []string
+	for _, vt := range p.sampleTypes {
+		types = append(types, p.strings[vt[0]]+"/"+p.strings[vt[1]])
+	}
+	if got := strings.Join(types, ", "); got != "hits/count, time/nanoseconds" {
+		t.Errorf("sample types: got %s", got)
+	}
+
+	// The hits of each sample go to the line at its leaf; the time of all
+	// of them adds up to the duration of the profile.
+	hits := map[string]int64{}
+	var elapsed int64
+	for _, s := range p.samples {
+		loc := p.locations[s.locations[0]]
+		name := p.strings[p.functions[loc[0]]]
+		hits[name+":"+strconv.FormatUint(loc[1], 10)] += s.values[0]
+		elapsed += s.values[1]
+
+		if len(s.locations) > 26 {
+			t.Errorf("a stack %d deep, want at most main and 25 calls to fib", len(s.locations))
+		}
+		if outer := p.locations[s.locations[len(s.locations)-1]]; p.strings[p.functions[outer[0]]] != "main" {
+			t.Errorf("a stack that does not start in main")
+		}
+	}
+	want := map[string]int64{"main:1": 1, "main:8": 1, "fib:2": fibCalls, "fib:3": fibLeaves, "fib:5": fibCalls - fibLeaves}
+	for key, n := range want {
+		if hits[key] != n {
+			t.Errorf("%s: got %d hits, want %d", key, hits[key], n)
+		}
+	}
+	if elapsed != p.duration || time.Duration(p.duration) != prof.Total() {
+		t.Errorf("samples add up to %dns, duration %dns, total %s", elapsed, p.duration, prof.Total())
+	}
+}
+
+func TestFolded(t *testing.T) {
+	prof := run(t, "interp")
+	var buf bytes.Buffer
+	if err := prof.WriteFolded(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var sum int64
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, line := range lines {
+		idx := strings.LastIndexByte(line, ' ')
+		us, err := strconv.ParseInt(line[idx+1:], 10, 64)
+		if idx < 0 || err != nil || us <= 0 {
+			t.Fatalf("bad line %q", line)
+		}
+		sum += us
+
+		names := strings.Split(line[:idx], ";")
+		if names[0] != "main" || len(names) > 26 {
+			t.Errorf("bad stack %q", line[:idx])
+		}
+		for _, name := range names[1:] {
+			if name != "fib" {
+				t.Errorf("bad stack %q", line[:idx])
+			}
+		}
+	}
+	if total := prof.Total().Microseconds(); sum > total || sum < total-int64(len(lines)) {
+		t.Errorf("stacks add up to %dµs, want the total %dµs", sum, total)
+	}
+}
@@ -0,0 +1,118 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxLines is how many of the hottest lines the text report lists.
+const maxLines = 20
+
+// WriteText writes a human readable report: every function by exclusive
+// time, then the lines with the most self time.
+func (p *Profile) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "profile of %s (%s), total %s\n\n", filepath.Base(p.order[0].File), p.Engine, round(p.total))
+
+	fns := append([]*Function(nil), p.order...)
+	sort.SliceStable(fns, func(a, b int) bool { return fns[a].Exclusive > fns[b].Exclusive })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "calls\tinclusive\t\texclusive\t\tfunction")
+	for _, fn := range fns {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			fn.Calls, round(fn.Inclusive), p.percent(fn.Inclusive),
+			round(fn.Exclusive), p.percent(fn.Exclusive), location(fn.Name, fn.File, fn.Line))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	lines := p.Lines()
+	sort.Slice(lines, func(a, b int) bool {
+		if lines[a].Self != lines[b].Self {
+			return lines[a].Self > lines[b].Self
+		}
+		return lines[a].Line < lines[b].Line
+	})
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+
+	fmt.Fprintln(w)
+	sources := map[string][]string{}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "hits\tself\t\tline")
+	for _, l := range lines {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s:%d\t%s\n",
+			l.Hits, round(l.Self), p.percent(l.Self), filepath.Base(l.File), l.Line, sourceLine(sources, l.File, l.Line))
+	}
+	return tw.Flush()
+}
+
+// WriteFolded writes one line per call stack, function names joined by
+// semicolons followed by the microseconds spent there, the input format of
+// flamegraph.pl and most other flame graph tools.
+func (p *Profile) WriteFolded(w io.Writer) error {
+	totals := map[string]time.Duration{}
+	for _, s := range p.stacks {
+		totals[stackName(s, ";")] += s.Self
+	}
+
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if us := totals[name].Microseconds(); us > 0 {
+			if _, err := fmt.Fprintf(w, "%s %d\n", name, us); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Profile) percent(d time.Duration) string {
+	if p.total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(p.total))
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(time.Microsecond)
+	}
+	return d
+}
+
+func location(name, file string, line int) string {
+	if line == 0 {
+		return fmt.Sprintf("%s %s", name, filepath.Base(file))
+	}
+	return fmt.Sprintf("%s %s:%d", name, filepath.Base(file), line)
+}
+
+func sourceLine(cache map[string][]string, file string, line int) string {
+	lines, ok := cache[file]
+	if !ok {
+		src, _ := os.ReadFile(file)
+		lines = strings.Split(string(src), "\n")
+		cache[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+// parseSource parses and resolves src, failing t on any error.
+func parseSource(t testing.TB, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+	return program
+}
+
+// exitCode runs src on engine, interp or vm, and returns the value it
+// exits with, failing t if it fails or does not exit.
+func exitCode(t *testing.T, engine, src string) int64 {
+	t.Helper()
+	program := parseSource(t, src)
+	switch engine {
+	case "interp":
+		interp := interpreter.New()
+		if _, err := interp.Run(program); err != nil {
+			t.Fatalf("interp: %v", err)
+		}
+		if !interp.Exited {
+			t.Fatalf("interp: program did not exit")
+		}
+		return interp.ExitCode
+	default:
+		machine, err := runVM("", program, nil, false)
+		if err != nil {
+			t.Fatalf("vm: %v", err)
+		}
+		if !machine.Exited {
+			t.Fatalf("vm: program did not exit")
+		}
+		return machine.ExitCode
+	}
+}
+
+// runError runs src on engine and returns the error it fails with.
+func runError(t *testing.T, engine, src string) error {
+	t.Helper()
+	program := parseSource(t, src)
+	if engine == "interp" {
+		_, err := interpreter.New().Run(program)
+		return err
+	}
+	_, err := runVM("", program, nil, false)
+	return err
+}
+
+var engines = []string{"interp", "vm"}
+
+// Ten million calls deep is far past where either engine would run out of
+// stack, were the calls in tail position not made in place.
+var tailCalls = []struct {
+	name string
+	src  string
+	want int64
+}{
+	{"self", `
+gorlami count(n, acc) {
+    if (n < 1) {
+        dicocco acc;
+    }
+    dicocco count(n - 1, acc + 1);
+}
+exit count(10000000, 0);
+`, 10000000},
+	{"mutual", `
+gorlami ping(n) {
+    if (n < 1) {
+        dicocco 0;
+    }
+    dicocco pong(n - 1);
+}
+gorlami pong(n) {
+    if (n < 1) {
+        dicocco 1;
+    }
+    dicocco ping(n - 1);
+}
+exit ping(10000001);
+`, 1},
+	{"if", `
+gorlami count(n, acc) {
+    dicocco if (n < 1) { acc; } else { count(n - 1, acc + 1); };
+}
+exit count(10000000, 0);
+`, 10000000},
+	{"match", `
+gorlami count(n, acc) {
+    dicocco match (n) {
+        0 => acc,
+        _ => {
+            var m = n - 1;
+            count(m, acc + 1);
+        }
+    };
+}
+exit count(10000000, 0);
+`, 10000000},
+	{"mutual if and match", `
+gorlami even(n) {
+    dicocco if (n < 1) { 1; } else { odd(n - 1); };
+}
+gorlami odd(n) {
+    dicocco match (n) {
+        0 => 0,
+        _ => even(n - 1),
+    };
+}
+exit even(10000000);
+`, 1},
+}
+
+func TestDeepTailCalls(t *testing.T) {
+	if testing.Short() {
+		t.Skip("ten million calls take a while")
+	}
+	for _, tc := range tailCalls {
+		for _, engine := range engines {
+			t.Run(tc.name+"/"+engine, func(t *testing.T) {
+				if got := exitCode(t, engine, tc.src); got != tc.want {
+					t.Errorf("exit %d, want %d", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// Calls that are not in tail position nest as deep on either engine, up to
+// a limit they share, however much Go stack each call takes underneath.
+var deepCalls = []struct {
+	name string
+	src  string
+	want int64
+}{
+	{"sum", `
+gorlami sum(n) {
+    if (n < 1) {
+        dicocco 0;
+    }
+    dicocco n + sum(n - 1);
+}
+exit sum(200000);
+`, 20000100000},
+	{"nested in blocks and expressions", `
+gorlami f(n) {
+    var r = match (n) {
+        0 => 0,
+        _ => {
+            if (n > 0) {
+                var xs = [{"a": 1 + f(n - 1)}];
+                xs[0]["a"];
+            } else {
+                0;
+            }
+        }
+    };
+    dicocco r;
+}
+exit f(` + strconv.Itoa(interpreter.MaxCallDepth-10) + `);
+`, interpreter.MaxCallDepth - 10},
+}
+
+func TestDeepCalls(t *testing.T) {
+	if testing.Short() {
+		t.Skip("a quarter of a million calls deep take a while")
+	}
+	for _, tc := range deepCalls {
+		for _, engine := range engines {
+			t.Run(tc.name+"/"+engine, func(t *testing.T) {
+				if got := exitCode(t, engine, tc.src); got != tc.want {
+					t.Errorf("exit %d, want %d", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// Calls that are not in tail position stop with an error rather than
+// taking Go down with them.
+var overflows = []struct {
+	name string
+	src  string
+}{
+	{"self", `
+gorlami deep(n) {
+    dicocco 1 + deep(n + 1);
+}
+deep(0);
+`},
+	{"mutual", `
+gorlami ping(n) {
+    dicocco 1 + pong(n);
+}
+gorlami pong(n) {
+    dicocco 1 + ping(n);
+}
+ping(0);
+`},
+	{"through a builtin", `
+gorlami deep(n) {
+    dicocco next(map(gorlami(x) { dicocco deep(x + 1); }, [n]));
+}
+deep(0);
+`},
+	{"through a generator", `
+gorlami deep(n) {
+    yield next(deep(n + 1));
+}
+next(deep(0));
+`},
+}
+
+func TestStackOverflow(t *testing.T) {
+	for _, tc := range overflows {
+		for _, engine := range engines {
+			t.Run(tc.name+"/"+engine, func(t *testing.T) {
+				err := runError(t, engine, tc.src)
+				if err == nil || !strings.Contains(err.Error(), "stack overflow") {
+					t.Errorf("got error %v, want a stack overflow", err)
+				}
+			})
+		}
+	}
+}
+
+func TestCatchStackOverflow(t *testing.T) {
+	src := `
+gorlami deep(n) {
+    dicocco 1 + deep(n + 1);
+}
+gorlami safely() {
+    try {
+        deep(0);
+    } catch (e) {
+        dicocco e.message;
+    }
+}
+assert_eq(safely(), "stack overflow");
+exit 0;
+`
+	for _, engine := range engines {
+		t.Run(engine, func(t *testing.T) {
+			if got := exitCode(t, engine, src); got != 0 {
+				t.Errorf("exit %d, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+// Package resolver binds every identifier in a parsed program to a variable
+// slot before it runs, so the interpreter can index straight into its
+// environments instead of looking names up by string.
+//
+// The program and every function body are a scope. if and for blocks are
+// not: a var inside one lives in the enclosing function, as it always has. Every name
+// declared anywhere in a scope gets its slot up front, which lets a function
+// refer to globals (or sibling functions) declared after it, while a direct
+// read of a name before its declaration in the same scope is an error.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/tok"
+)
+
+type scope struct {
+	slots    map[string]int
+	names    []string
+	declared map[string]bool
+	yields   bool // whether a yield appears directly in the scope
+}
+
+func (s *scope) slot(name string) int {
+	if idx, ok := s.slots[name]; ok {
+		return idx
+	}
+	s.slots[name] = len(s.names)
+	s.names = append(s.names, name)
+	return s.slots[name]
+}
+
+type resolver struct {
+	scopes []*scope
+	errors []string
+
+	valueBranches int // ifs and matches used as values around the node being resolved
+}
+
+// Resolve annotates program in place and returns any errors found.
+func Resolve(program *ast.Program) []string {
+	r := &resolver{}
+
+	r.enterScope(nil, program.Statements)
+	r.resolveStatements(program.Statements)
+	program.Globals = r.leaveScope()
+	program.Resolved = true
+
+	return r.errors
+}
+
+// enterScope gives params, then the names in their patterns, then the
+// names declared in body their slots in a new scope. The parameters are
+// declared by resolveParameters.
+func (r *resolver) enterScope(params []*ast.Identifier, body []ast.Statement) {
+	s := &scope{slots: map[string]int{}, declared: map[string]bool{}}
+	r.scopes = append(r.scopes, s)
+
+	for _, p := range params {
+		if _, dup := s.slots[p.Value]; dup {
+			r.errorf(p.Pos(), "duplicate parameter %s", p.Value)
+		}
+		s.slot(p.Value)
+	}
+	for _, p := range params {
+		if p.Pattern == nil {
+			continue
+		}
+		for _, name := range ast.PatternNames(p) {
+			if _, dup := s.slots[name.Value]; dup {
+				r.errorf(name.Pos(), "duplicate parameter %s", name.Value)
+			}
+			s.slot(name.Value)
+		}
+	}
+	for _, p := range params {
+		r.hoistValueIfs(s, p.Default)
+	}
+
+	r.hoist(s, body)
+}
+
+// resolveParameters declares params in order, resolving each default
+// before its own parameter is declared, so a default can only use the
+// parameters before it.
+func (r *resolver) resolveParameters(params []*ast.Identifier) {
+	for _, p := range params {
+		if p.Default != nil {
+			r.resolve(p.Default)
+		}
+		r.declare(p)
+		if p.Pattern != nil {
+			for _, name := range ast.PatternNames(p) {
+				r.declare(name)
+			}
+		}
+	}
+}
+
+func (r *resolver) leaveScope() []string {
+	s := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return s.names
+}
+
+// hoist gives every name declared in stmts, including inside if blocks but
+// not inside nested functions, a slot in s.
+func (r *resolver) hoist(s *scope, stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.VarStatement:
+			r.hoistValueIfs(s, stmt.Value)
+			s.slot(stmt.Name.Value)
+			for _, name := range ast.PatternNames(stmt.Name) {
+				s.slot(name.Value)
+			}
+		case *ast.ExpressionStatement:
+			r.hoistValueIfs(s, stmt.Expression)
+		case *ast.ReturnStatement:
+			r.hoistValueIfs(s, stmt.ReturnValue)
+		case *ast.ExitStatement:
+			r.hoistValueIfs(s, stmt.Value)
+		case *ast.ThrowStatement:
+			r.hoistValueIfs(s, stmt.Value)
+		case *ast.YieldStatement:
+			r.hoistValueIfs(s, stmt.Value)
+		case *ast.ForStatement:
+			r.hoistValueIfs(s, stmt.Iterable)
+			s.slot(stmt.Name.Value)
+			for _, name := range ast.PatternNames(stmt.Name) {
+				s.slot(name.Value)
+			}
+			r.hoist(s, stmt.Body.Statements)
+		case *ast.TryStatement:
+			r.hoist(s, stmt.Body.Statements)
+			if stmt.Catch != nil {
+				s.slot(stmt.Param.Value)
+				r.hoist(s, stmt.Catch.Statements)
+			}
+			if stmt.Finally != nil {
+				r.hoist(s, stmt.Finally.Statements)
+			}
+		case *ast.FunctionStatement:
+			if stmt.Receiver == nil {
+				s.slot(stmt.Name.Value)
+			}
+		case *ast.StructStatement:
+			s.slot(stmt.Name.Value)
+		case *ast.EnumStatement:
+			s.slot(stmt.Name.Value)
+		case *ast.AssignStatement:
+			r.hoistValueIfs(s, stmt.Target)
+			r.hoistValueIfs(s, stmt.Value)
+		case *ast.ImportStatement:
+			s.slot(stmt.Alias.Value)
+		case *ast.ExportStatement:
+			r.hoist(s, []ast.Statement{stmt.Declaration})
+		case *ast.IfExpression:
+			r.hoistValueIfs(s, stmt.Condition)
+			r.hoist(s, stmt.Consequence.Statements)
+			if stmt.Alternative != nil {
+				r.hoist(s, stmt.Alternative.Statements)
+			}
+		case *ast.BlockStatement:
+			r.hoist(s, stmt.Statements)
+		}
+	}
+}
+
+// hoistValueIfs hoists the names declared in the blocks of any if or match
+// in expr, which belong to s just as those of an if statement do. A match
+// arm's bindings belong to s too.
+func (r *resolver) hoistValueIfs(s *scope, expr ast.Expression) {
+	if expr == nil {
+		return
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.IfExpression:
+			r.hoist(s, []ast.Statement{n})
+			return false
+		case *ast.MatchExpression:
+			r.hoistValueIfs(s, n.Value)
+			for _, arm := range n.Arms {
+				if len(arm.Patterns) == 1 {
+					for _, name := range ast.Bindings(arm.Patterns[0]) {
+						s.slot(name.Value)
+					}
+				}
+				r.hoistValueIfs(s, arm.Guard)
+				r.hoistValueIfs(s, arm.Value)
+				if arm.Body != nil {
+					r.hoist(s, arm.Body.Statements)
+				}
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func (r *resolver) declare(ident *ast.Identifier) {
+	s := r.scopes[len(r.scopes)-1]
+	ident.Depth = 0
+	ident.Index = s.slot(ident.Value)
+	ident.Resolved = true
+	s.declared[ident.Value] = true
+}
+
+func (r *resolver) resolveStatements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		if ie, ok := stmt.(*ast.IfExpression); ok {
+			r.resolveIf(ie)
+			continue
+		}
+		if es, ok := stmt.(*ast.ExpressionStatement); ok {
+			if me, ok := es.Expression.(*ast.MatchExpression); ok {
+				r.resolveMatch(me)
+				continue
+			}
+		}
+		r.resolve(stmt)
+	}
+}
+
+func (r *resolver) resolveIf(ie *ast.IfExpression) {
+	r.resolve(ie.Condition)
+	r.resolve(ie.Consequence)
+	if ie.Alternative != nil {
+		r.resolve(ie.Alternative)
+	}
+}
+
+func (r *resolver) resolveMatch(me *ast.MatchExpression) {
+	r.resolve(me.Value)
+	for _, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			r.resolvePattern(pattern)
+		}
+		if arm.Guard != nil {
+			r.resolve(arm.Guard)
+		}
+		if arm.Body != nil {
+			r.resolve(arm.Body)
+		} else {
+			r.resolve(arm.Value)
+		}
+	}
+}
+
+// resolvePattern declares the names pattern binds, each only once, and
+// resolves the names of the variants it refers to.
+func (r *resolver) resolvePattern(pattern ast.Expression) {
+	seen := map[string]bool{}
+	for _, name := range ast.Bindings(pattern) {
+		if seen[name.Value] {
+			r.errorf(name.Pos(), "%s is bound twice in one pattern", name.Value)
+		}
+		seen[name.Value] = true
+		r.declare(name)
+	}
+	var variants func(ast.Expression)
+	variants = func(pattern ast.Expression) {
+		switch pattern := pattern.(type) {
+		case *ast.MemberExpression:
+			r.resolve(pattern)
+		case *ast.VariantPattern:
+			r.resolve(pattern.Type)
+			for _, p := range pattern.Patterns {
+				variants(p)
+			}
+		}
+	}
+	variants(pattern)
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.VarStatement:
+		r.resolve(node.Value)
+		r.declare(node.Name)
+		if node.Name.Pattern != nil {
+			r.declarePattern(node.Name)
+		}
+
+	case *ast.FunctionStatement:
+		if node.Receiver != nil {
+			r.resolveMethod(node)
+			return
+		}
+		r.declare(node.Name)
+		node.Locals, node.Generator = r.resolveFunction(node.Parameters, node.Body)
+
+	case *ast.StructStatement:
+		if len(r.scopes) > 1 {
+			r.errorf(node.Pos(), "struct is only allowed at the top level")
+		}
+		r.declare(node.Name)
+
+	case *ast.EnumStatement:
+		r.declare(node.Name)
+
+	case *ast.StructLiteral:
+		r.resolve(node.Type)
+		for _, v := range node.Values {
+			r.resolve(v)
+		}
+
+	case *ast.AssignStatement:
+		r.resolve(node.Target)
+		r.resolve(node.Value)
+
+	case *ast.FunctionLiteral:
+		node.Locals, node.Generator = r.resolveFunction(node.Parameters, node.Body)
+
+	case *ast.ReturnStatement:
+		if len(r.scopes) == 1 {
+			r.errorf(node.Pos(), "dicocco outside of a function")
+		} else if r.valueBranches > 0 {
+			r.errorf(node.Pos(), "dicocco inside an if or match used as a value")
+		}
+		r.resolve(node.ReturnValue)
+
+	case *ast.ExitStatement:
+		r.resolve(node.Value)
+
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+
+	case *ast.YieldStatement:
+		if len(r.scopes) == 1 {
+			r.errorf(node.Pos(), "yield outside of a function")
+		}
+		r.scopes[len(r.scopes)-1].yields = true
+		r.resolve(node.Value)
+
+	case *ast.ForStatement:
+		// like a var, the loop's name belongs to the enclosing function
+		r.resolve(node.Iterable)
+		r.declare(node.Name)
+		if node.Name.Pattern != nil {
+			r.declarePattern(node.Name)
+		}
+		r.resolve(node.Body)
+
+	case *ast.TryStatement:
+		// like a match arm's binding, the caught error belongs to the
+		// enclosing function
+		r.resolve(node.Body)
+		if node.Catch != nil {
+			r.declare(node.Param)
+			r.resolve(node.Catch)
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+
+	case *ast.ImportStatement:
+		if len(r.scopes) > 1 {
+			r.errorf(node.Pos(), "import is only allowed at the top level")
+		}
+		r.declare(node.Alias)
+
+	case *ast.ExportStatement:
+		if len(r.scopes) > 1 {
+			r.errorf(node.Pos(), "export is only allowed at the top level")
+		}
+		r.resolve(node.Declaration)
+
+	case *ast.MemberExpression:
+		r.resolve(node.Object)
+
+	case *ast.IfExpression:
+		// statement ifs are resolved by resolveStatements; this one is a value
+		r.valueBranches++
+		r.resolveIf(node)
+		r.valueBranches--
+
+	case *ast.MatchExpression:
+		// likewise, a match statement is resolved by resolveStatements
+		r.valueBranches++
+		r.resolveMatch(node)
+		r.valueBranches--
+
+	case *ast.BlockStatement:
+		r.resolveStatements(node.Statements)
+
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			r.resolve(e)
+		}
+
+	case *ast.HashLiteral:
+		for idx := range node.Keys {
+			r.resolve(node.Keys[idx])
+			r.resolve(node.Values[idx])
+		}
+
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+
+	case *ast.NamedArgument:
+		r.resolve(node.Value)
+
+	case *ast.SpreadExpression:
+		r.resolve(node.Value)
+
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+	}
+}
+
+// declarePattern declares the names the pattern of a destructuring var
+// binds, each of which it may bind only once.
+func (r *resolver) declarePattern(ident *ast.Identifier) {
+	seen := map[string]bool{}
+	for _, name := range ast.PatternNames(ident) {
+		if seen[name.Value] {
+			r.errorf(name.Pos(), "%s is bound twice in %s", name.Value, ident.Value)
+		}
+		seen[name.Value] = true
+		r.declare(name)
+	}
+}
+
+// resolveFunction resolves a function body and returns the names of its
+// slots and whether it is a generator, one whose body yields.
+func (r *resolver) resolveFunction(params []*ast.Identifier, body *ast.BlockStatement) (locals []string, generator bool) {
+	valueBranches := r.valueBranches
+	r.valueBranches = 0
+	defer func() { r.valueBranches = valueBranches }()
+
+	r.enterScope(params, body.Statements)
+	r.resolveParameters(params)
+	r.resolveStatements(body.Statements)
+	generator = r.scopes[len(r.scopes)-1].yields
+	return r.leaveScope(), generator
+}
+
+// resolveMethod resolves a method, whose receiver is bound in the slot
+// after its parameters. A method belongs to its struct, so its name is not
+// declared.
+func (r *resolver) resolveMethod(fs *ast.FunctionStatement) {
+	if len(r.scopes) > 1 {
+		r.errorf(fs.Pos(), "methods are only allowed at the top level")
+	}
+	r.resolveIdentifier(fs.ReceiverType)
+	params := append(append([]*ast.Identifier{}, fs.Parameters...), fs.Receiver)
+	fs.Locals, fs.Generator = r.resolveFunction(params, fs.Body)
+}
+
+// resolveIdentifier binds ident to the innermost scope declaring it. Names
+// declared nowhere are left unresolved and read as null at runtime.
+func (r *resolver) resolveIdentifier(ident *ast.Identifier) {
+	for depth := 0; depth < len(r.scopes); depth++ {
+		s := r.scopes[len(r.scopes)-1-depth]
+
+		idx, ok := s.slots[ident.Value]
+		if !ok {
+			continue
+		}
+
+		if depth == 0 && !s.declared[ident.Value] {
+			r.errorf(ident.Pos(), "%s used before declaration", ident.Value)
+		}
+
+		ident.Depth = depth
+		ident.Index = idx
+		ident.Resolved = true
+		return
+	}
+}
+
+func (r *resolver) errorf(pos tok.Position, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	r.errors = append(r.errors, fmt.Sprintf("%d:%d: %s", pos.Line, pos.Column, msg))
+}
@@ -0,0 +1,104 @@
+package resolver_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+)
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+var resolveErrors = []struct {
+	name string
+	src  string
+	want string
+}{
+	{"use before declaration", "var a = b;\nvar b = 1;\n", "1:9: b used before declaration"},
+	{"use before declaration in a function", "gorlami f() {\n    var a = b;\n    var b = 1;\n}\n", "2:13: b used before declaration"},
+	{"duplicate parameter", "gorlami f(a, b, a) {}\n", "1:17: duplicate parameter a"},
+	{"duplicate parameter in a pattern", "gorlami f(a, [a, b]) {}\n", "duplicate parameter a"},
+	{"dicocco outside a function", "dicocco 1;\n", "1:1: dicocco outside of a function"},
+	{"dicocco in an if value", "gorlami f() {\n    var a = if (true) { dicocco 1; } else { 2 };\n}\n", "dicocco inside an if or match used as a value"},
+	{"yield outside a function", "yield 1;\n", "1:1: yield outside of a function"},
+	{"bound twice in a pattern", "var [a, a] = [1, 2];\n", "a is bound twice"},
+	{"nested struct", "gorlami f() {\n    struct P { x }\n}\n", "struct is only allowed at the top level"},
+}
+
+func TestResolveErrors(t *testing.T) {
+	for _, tc := range resolveErrors {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := resolver.Resolve(parse(t, tc.src))
+			if len(errs) != 1 || !strings.Contains(errs[0], tc.want) {
+				t.Errorf("got %q, want one error containing %q", errs, tc.want)
+			}
+		})
+	}
+}
+
+// Functions may use globals and each other before their declarations, as
+// long as they are only called after.
+func TestResolveLaterDeclarations(t *testing.T) {
+	src := "gorlami f() { dicocco g() + total; }\ngorlami g() { dicocco 1; }\nvar total = 2;\nf();\n"
+	if errs := resolver.Resolve(parse(t, src)); len(errs) != 0 {
+		t.Errorf("got %q, want no errors", errs)
+	}
+}
+
+// Every use of a name is bound to the scope that declares it, counted
+// outward from the use, and to the slot it has there.
+func TestResolveAnnotations(t *testing.T) {
+	program := parse(t, `var a = 1;
+gorlami outer(x) {
+    var y = x;
+    if (y) {
+        var z = a;
+    }
+    dicocco gorlami(w) {
+        dicocco a + x + z + w + missing;
+    };
+}
+`)
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			if ident.Resolved {
+				got = append(got, fmt.Sprintf("%s %d/%d", ident.Value, ident.Depth, ident.Index))
+			} else {
+				got = append(got, ident.Value+" unresolved")
+			}
+		}
+		return true
+	})
+	want := []string{
+		"a 0/0", "outer 0/1", "x 0/0", "y 0/1", "x 0/0", "y 0/1", "z 0/2", "a 1/0",
+		"w 0/0", "a 2/0", "x 1/0", "z 1/2", "w 0/0", "missing unresolved",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, ", "), strings.Join(want, ", "))
+	}
+
+	if want := []string{"a", "outer"}; fmt.Sprint(program.Globals) != fmt.Sprint(want) {
+		t.Errorf("globals: got %v, want %v", program.Globals, want)
+	}
+	fs := program.Statements[1].(*ast.FunctionStatement)
+	if want := []string{"x", "y", "z"}; fmt.Sprint(fs.Locals) != fmt.Sprint(want) {
+		t.Errorf("locals of outer: got %v, want %v", fs.Locals, want)
+	}
+}
@@ -0,0 +1,99 @@
+package salc
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/compiler"
+)
+
+// Disassemble writes a human readable listing of bc: the constant pool, then
+// the top level code and every function, one instruction per line with the
+// source line it came from.
+func Disassemble(w io.Writer, bc *compiler.Bytecode) error {
+	fmt.Fprintf(w, "; salc format v%d, %d globals, %d constants\n", FormatVersion, bc.NumGlobals, len(bc.Constants))
+
+	fmt.Fprintln(w, "\nconstants:")
+	for i, c := range bc.Constants {
+		fmt.Fprintf(w, "  %4d  %s\n", i, describeConstant(c))
+	}
+
+	fmt.Fprintln(w, "\nmain:")
+	if err := disassembleInstructions(w, bc.Instructions, bc.Lines, bc); err != nil {
+		return err
+	}
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*code.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		kind := "function"
+		if fn.Generator {
+			kind = "generator"
+		}
+		fmt.Fprintf(w, "\n%s %d %s (params=%d locals=%d):\n", kind, i, functionName(fn), fn.NumParameters, fn.NumLocals)
+		if err := disassembleInstructions(w, fn.Instructions, fn.Lines, bc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func disassembleInstructions(w io.Writer, ins code.Instructions, lines code.LineTable, bc *compiler.Bytecode) error {
+	lastLine := -1
+
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return err
+		}
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		lineCol := "    "
+		if line := lines.LineFor(ip); line != lastLine && line > 0 {
+			lineCol = fmt.Sprintf("%4d", line)
+			lastLine = line
+		}
+
+		text := def.Name
+		for _, o := range operands {
+			text += fmt.Sprintf(" %d", o)
+		}
+
+		switch code.Opcode(ins[ip]) {
+		case code.OpConstant, code.OpClosure, code.OpMember, code.OpStruct, code.OpSetMember, code.OpMethod, code.OpEnum:
+			if operands[0] < len(bc.Constants) {
+				text = fmt.Sprintf("%-24s ; %s", text, describeConstant(bc.Constants[operands[0]]))
+			}
+		}
+
+		fmt.Fprintf(w, "  %s  %04d %s\n", lineCol, ip, text)
+		ip += 1 + read
+	}
+
+	return nil
+}
+
+func describeConstant(c interface{}) string {
+	switch c := c.(type) {
+	case int64:
+		return fmt.Sprintf("int %d", c)
+	case string:
+		return fmt.Sprintf("string %q", c)
+	case *code.CompiledFunction:
+		return fmt.Sprintf("gorlami %s/%d", functionName(c), c.NumParameters)
+	default:
+		return fmt.Sprintf("%T", c)
+	}
+}
+
+func functionName(fn *code.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
@@ -0,0 +1,276 @@
+// Package salc reads and writes compiled salami programs.
+//
+// A .salc file is laid out as:
+//
+//	magic       "SALC"
+//	version     uint16
+//	globals     uint32 number of global slots
+//	constants   uint32 count, then one tagged entry per constant
+//	main        instructions and debug line table of the top level code
+//	checksum    uint32 CRC-32 (IEEE) of every preceding byte
+//
+// Instructions are a uint32 length followed by the raw bytes, and a line
+// table is a uint32 count followed by (offset, line) uint32 pairs. All
+// integers are big endian.
+package salc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/compiler"
+)
+
+const (
+	Magic         = "SALC"
+	FormatVersion = 4
+)
+
+const (
+	tagInteger  byte = 'i'
+	tagString   byte = 's'
+	tagFunction byte = 'f'
+)
+
+// limit on any single length prefix so a corrupt file cannot make us
+// allocate unbounded memory before the read fails
+const maxSectionLen = 1 << 28
+
+var ErrChecksum = errors.New("salc: checksum mismatch")
+
+func Write(w io.Writer, bc *compiler.Bytecode) error {
+	var buf bytes.Buffer
+	e := &encoder{buf: &buf}
+
+	e.buf.WriteString(Magic)
+	e.u16(FormatVersion)
+	e.u32(uint32(bc.NumGlobals))
+
+	e.u32(uint32(len(bc.Constants)))
+	for i, c := range bc.Constants {
+		switch c := c.(type) {
+		case int64:
+			e.buf.WriteByte(tagInteger)
+			e.u64(uint64(c))
+		case string:
+			e.buf.WriteByte(tagString)
+			e.str(c)
+		case *code.CompiledFunction:
+			e.buf.WriteByte(tagFunction)
+			e.str(c.Name)
+			e.u32(uint32(c.NumLocals))
+			e.u32(uint32(c.NumParameters))
+			for _, name := range c.ParameterNames {
+				e.str(name)
+			}
+			e.u32(uint32(c.NumDefaults))
+			e.bool(c.Variadic)
+			e.bool(c.Generator)
+			e.instructions(c.Instructions)
+			e.lines(c.Lines)
+		default:
+			return fmt.Errorf("salc: cannot encode constant %d of type %T", i, c)
+		}
+	}
+
+	e.instructions(bc.Instructions)
+	e.lines(bc.Lines)
+
+	e.u32(crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func Read(r io.Reader) (*compiler.Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(Magic)+2+4 || string(data[:len(Magic)]) != Magic {
+		return nil, errors.New("salc: not a compiled salami file")
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{r: bytes.NewReader(body[len(Magic):])}
+
+	if version := d.u16(); d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("salc: unsupported format version %d (want %d)", version, FormatVersion)
+	}
+
+	bc := &compiler.Bytecode{NumGlobals: int(d.u32())}
+
+	numConstants := d.length()
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			bc.Constants = append(bc.Constants, int64(d.u64()))
+		case tagString:
+			bc.Constants = append(bc.Constants, d.str())
+		case tagFunction:
+			fn := &code.CompiledFunction{Name: d.str()}
+			fn.NumLocals = int(d.u32())
+			fn.NumParameters = int(d.u32())
+			for i := 0; i < fn.NumParameters && d.err == nil; i++ {
+				fn.ParameterNames = append(fn.ParameterNames, d.str())
+			}
+			fn.NumDefaults = int(d.u32())
+			fn.Variadic = d.byte() == 1
+			fn.Generator = d.byte() == 1
+			fn.Instructions = d.instructions()
+			fn.Lines = d.lines()
+			bc.Constants = append(bc.Constants, fn)
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("salc: unknown constant tag %q", tag)
+			}
+		}
+	}
+
+	bc.Instructions = d.instructions()
+	bc.Lines = d.lines()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.r.Len() != 0 {
+		return nil, fmt.Errorf("salc: %d trailing bytes", d.r.Len())
+	}
+
+	if err := Verify(bc); err != nil {
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+type encoder struct {
+	buf *bytes.Buffer
+}
+
+func (e *encoder) u16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) u32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) u64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) str(s string) {
+	e.u32(uint32(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) instructions(ins code.Instructions) {
+	e.u32(uint32(len(ins)))
+	e.buf.Write(ins)
+}
+
+func (e *encoder) lines(lt code.LineTable) {
+	e.u32(uint32(len(lt)))
+	for _, entry := range lt {
+		e.u32(uint32(entry.Offset))
+		e.u32(uint32(entry.Line))
+	}
+}
+
+// decoder records the first error and turns every later read into a no-op,
+// so callers can check d.err once at the end.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > d.r.Len() {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	d.r.Read(b)
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.read(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.read(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) length() int {
+	n := d.u32()
+	if d.err == nil && n > maxSectionLen {
+		d.err = fmt.Errorf("salc: section length %d too large", n)
+	}
+	return int(n)
+}
+
+func (d *decoder) str() string {
+	return string(d.read(d.length()))
+}
+
+func (d *decoder) instructions() code.Instructions {
+	return code.Instructions(d.read(d.length()))
+}
+
+func (d *decoder) lines() code.LineTable {
+	n := d.length()
+	var lt code.LineTable
+	for i := 0; i < n && d.err == nil; i++ {
+		lt = append(lt, code.LineEntry{Offset: int(d.u32()), Line: int(d.u32())})
+	}
+	return lt
+}
@@ -0,0 +1,253 @@
+package salc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/salc"
+	"github.com/afoley/salami-lang/vm"
+)
+
+// compile compiles the program in the file at path as the build command
+// does.
+func compile(t testing.TB, path string) *compiler.Bytecode {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.NewLexer(bytes.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("%s: parser errors: %v", path, errs)
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		t.Fatalf("%s: resolver errors: %v", path, errs)
+	}
+	comp := compiler.New()
+	comp.File, _ = filepath.Abs(path)
+	comp.SearchPath = interpreter.SearchPath(filepath.Dir(comp.File))
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return comp.Bytecode()
+}
+
+// examples returns the example programs, which between them use every
+// kind of constant and most of the instructions.
+func examples(t testing.TB) []string {
+	t.Helper()
+	paths, err := filepath.Glob("../examples/*.salami")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	return append(paths, "../examples/modules/main.salami")
+}
+
+func write(t testing.TB, bc *compiler.Bytecode) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := salc.Write(&buf, bc); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, path := range examples(t) {
+		bc := compile(t, path)
+		data := write(t, bc)
+		got, err := salc.Read(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: Read: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, bc) {
+			t.Errorf("%s: read back\n%+v\nwant\n%+v", path, got, bc)
+		}
+		if again := write(t, got); !bytes.Equal(again, data) {
+			t.Errorf("%s: writing what was read gives different bytes", path)
+		}
+	}
+}
+
+// resum replaces the checksum at the end of data with the right one for
+// the rest, so that a change gets past the checksum to what it is testing.
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.BigEndian.AppendUint32(append([]byte{}, body...), crc32.ChecksumIEEE(body))
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	data := write(t, compile(t, "../examples/fib.salami"))
+	for _, at := range []int{len(salc.Magic), len(data) / 2, len(data) - 1} {
+		corrupt := append([]byte{}, data...)
+		corrupt[at] ^= 0xff
+		if _, err := salc.Read(bytes.NewReader(corrupt)); !errors.Is(err, salc.ErrChecksum) {
+			t.Errorf("flipping byte %d: got %v, want %v", at, err, salc.ErrChecksum)
+		}
+	}
+}
+
+func TestWrongVersion(t *testing.T) {
+	data := write(t, compile(t, "../examples/fib.salami"))
+	for _, version := range []uint16{salc.FormatVersion - 1, salc.FormatVersion + 1} {
+		old := append([]byte{}, data...)
+		binary.BigEndian.PutUint16(old[len(salc.Magic):], version)
+		_, err := salc.Read(bytes.NewReader(resum(old)))
+		if err == nil || !strings.Contains(err.Error(), "unsupported format version") {
+			t.Errorf("version %d: got %v, want an unsupported format version", version, err)
+		}
+	}
+}
+
+func TestNotCompiled(t *testing.T) {
+	for _, data := range []string{"", "SALC", "gorlami main() {}"} {
+		_, err := salc.Read(strings.NewReader(data))
+		if err == nil || err.Error() != "salc: not a compiled salami file" {
+			t.Errorf("%q: got %v, want not a compiled salami file", data, err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	data := write(t, compile(t, "../examples/fib.salami"))
+	// cut off as a partial download would, checksum and all
+	for n := 0; n < len(data); n++ {
+		if _, err := salc.Read(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("cut to %d of %d bytes: no error", n, len(data))
+		}
+	}
+
+	// and with the checksum right for what is left, so that the reader
+	// itself has to notice the file ends early
+	body := data[:len(data)-4]
+	for n := len(salc.Magic) + 2 + 4; n < len(body); n++ {
+		_, err := salc.Read(bytes.NewReader(resum(append(body[:n:n], 0, 0, 0, 0))))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("body cut to %d of %d bytes: got %v, want %v", n, len(body), err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// A file that passes Verify can still be wrong about the stack, which the
+// VM reports rather than crashing on.
+func TestRunInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ins  []byte
+	}{
+		{"pop an empty stack", code.Make(code.OpPop)},
+		{"add nothing", code.Make(code.OpAdd)},
+		{"iterate over an array", append(append(append(code.Make(code.OpArray, 0), code.Make(code.OpIterNext, 6)...), code.Make(code.OpPop)...), code.Make(code.OpPop)...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := write(t, &compiler.Bytecode{Instructions: tc.ins, Constants: []interface{}{}})
+			bc, err := salc.Read(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			machine, err := vm.New(bc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := machine.Run(); err == nil || !strings.Contains(err.Error(), "invalid bytecode") {
+				t.Errorf("got %v, want an invalid bytecode error", err)
+			}
+		})
+	}
+}
+
+// calls stops a run after too many calls, as the fuzz test would
+// otherwise wait on a file that recurses forever.
+type calls int
+
+var errTooManyCalls = errors.New("too many calls")
+
+func (c *calls) Enter(*code.CompiledFunction) {
+	if *c++; *c > 10000 {
+		panic(errTooManyCalls)
+	}
+}
+
+func (c *calls) Exit(*code.CompiledFunction) {}
+func (c *calls) Line(int)                    {}
+
+// loops reports whether any function in bc jumps backwards, as a loop
+// does, or uses range, whose generators can run on for as long as it
+// likes: the fuzz test has no way to stop either.
+func loops(bc *compiler.Bytecode) bool {
+	functions := []code.Instructions{bc.Instructions}
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*code.CompiledFunction); ok {
+			functions = append(functions, fn.Instructions)
+		}
+	}
+	for _, ins := range functions {
+		for ip := 0; ip < len(ins); {
+			def, _ := code.Lookup(ins[ip])
+			operands, width := code.ReadOperands(def, ins[ip+1:])
+			switch code.Opcode(ins[ip]) {
+			case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNull, code.OpJumpNotNull, code.OpTry, code.OpIterNext:
+				if operands[0] <= ip {
+					return true
+				}
+			case code.OpJumpPassed:
+				if operands[1] <= ip {
+					return true
+				}
+			case code.OpGetBuiltin:
+				if code.Builtins[operands[0]] == "range" {
+					return true
+				}
+			}
+			ip += 1 + width
+		}
+	}
+	return false
+}
+
+// FuzzReadRun checks that whatever file Read accepts runs to an end, an
+// exit or an error, without the VM crashing.
+func FuzzReadRun(f *testing.F) {
+	for _, path := range examples(f) {
+		f.Add(write(f, compile(f, path)))
+	}
+	f.Add(write(f, &compiler.Bytecode{Instructions: code.Make(code.OpPop), Constants: []interface{}{}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// past the checksum, which a mutation would almost always break
+		if len(data) >= 4 {
+			data = resum(data)
+		}
+		bc, err := salc.Read(bytes.NewReader(data))
+		if err != nil || loops(bc) {
+			return
+		}
+		machine, err := vm.New(bc)
+		if err != nil {
+			return
+		}
+		machine.Tracer = new(calls)
+		defer func() {
+			if r := recover(); r != nil && r != errTooManyCalls {
+				panic(r)
+			}
+		}()
+		machine.Run()
+	})
+}
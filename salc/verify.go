@@ -0,0 +1,134 @@
+package salc
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/compiler"
+)
+
+// Verify checks that every instruction in bc is well formed and that its
+// operands stay within the constant pool, globals, locals and the function
+// body. It does not follow how deep the stack is or what kind of value is
+// on it, so a file that passes can still pop an empty stack or iterate
+// over an array; the VM stops such a program with an error.
+func Verify(bc *compiler.Bytecode) error {
+	// no instruction can reach a global or local past these, so a file
+	// asking for more would only have the VM allocate them for nothing
+	if bc.NumGlobals > maxGlobals {
+		return fmt.Errorf("salc: %d globals, at most %d", bc.NumGlobals, maxGlobals)
+	}
+
+	if err := verifyFunction("main", bc.Instructions, 0, bc); err != nil {
+		return err
+	}
+
+	for i, c := range bc.Constants {
+		if fn, ok := c.(*code.CompiledFunction); ok {
+			if fn.NumLocals > maxLocals {
+				return fmt.Errorf("salc: constant %d: %d locals, at most %d", i, fn.NumLocals, maxLocals)
+			}
+			if fn.NumLocals < fn.NumParameters {
+				return fmt.Errorf("salc: constant %d: fewer locals than parameters", i)
+			}
+			if len(fn.ParameterNames) != fn.NumParameters {
+				return fmt.Errorf("salc: constant %d: %d parameter names for %d parameters", i, len(fn.ParameterNames), fn.NumParameters)
+			}
+			fixed := fn.NumParameters
+			if fn.Variadic {
+				fixed--
+			}
+			if fixed < 0 || fn.NumDefaults > fixed {
+				return fmt.Errorf("salc: constant %d: more optional parameters than parameters", i)
+			}
+			if err := verifyFunction(fmt.Sprintf("constant %d", i), fn.Instructions, fn.NumLocals, bc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// the most globals and locals the operands of OpGetGlobal and OpGetLocal
+// can index
+const (
+	maxGlobals = 1 << 16
+	maxLocals  = 1 << 8
+)
+
+func verifyFunction(name string, ins code.Instructions, numLocals int, bc *compiler.Bytecode) error {
+	starts := map[int]bool{}
+	var jumps []int
+
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return fmt.Errorf("salc: %s at %04d: %w", name, ip, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+1+width > len(ins) {
+			return fmt.Errorf("salc: %s at %04d: truncated %s", name, ip, def.Name)
+		}
+
+		operands, _ := code.ReadOperands(def, ins[ip+1:])
+		bad := func(what string) error {
+			return fmt.Errorf("salc: %s at %04d: %s operand %s out of range", name, ip, def.Name, what)
+		}
+
+		switch code.Opcode(ins[ip]) {
+		case code.OpConstant:
+			if operands[0] >= len(bc.Constants) {
+				return bad("constant")
+			}
+		case code.OpClosure:
+			if operands[0] >= len(bc.Constants) {
+				return bad("constant")
+			}
+			if _, ok := bc.Constants[operands[0]].(*code.CompiledFunction); !ok {
+				return fmt.Errorf("salc: %s at %04d: closure over a non-function constant", name, ip)
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= bc.NumGlobals {
+				return bad("global")
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpMakeCell, code.OpGetCell, code.OpSetCell:
+			if operands[0] >= numLocals {
+				return bad("local")
+			}
+		case code.OpMember, code.OpStruct, code.OpSetMember, code.OpMethod, code.OpEnum, code.OpModule:
+			if operands[0] >= len(bc.Constants) {
+				return bad("constant")
+			}
+			if _, ok := bc.Constants[operands[0]].(string); !ok {
+				return fmt.Errorf("salc: %s at %04d: %s names a non-string constant", name, ip, def.Name)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(code.Builtins) {
+				return bad("builtin")
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNull, code.OpJumpNotNull, code.OpTry, code.OpIterNext:
+			jumps = append(jumps, operands[0])
+		case code.OpJumpPassed:
+			if operands[0] >= numLocals {
+				return bad("local")
+			}
+			jumps = append(jumps, operands[1])
+		}
+
+		starts[ip] = true
+		ip += 1 + width
+	}
+
+	for _, target := range jumps {
+		if target != len(ins) && !starts[target] {
+			return fmt.Errorf("salc: %s: jump to %04d is not an instruction boundary", name, target)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/afoley/salami-lang/coverage"
+	"github.com/afoley/salami-lang/testrunner"
+)
+
+// testCommand runs the test functions in *_test.salami files under the
+// given files and directories, the current directory by default.
+func testCommand(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	run := fs.String("run", "", "only run tests whose names match this regular expression")
+	format := fs.String("format", "text", "output format: text, tap or junit")
+	cover := fs.Bool("cover", false, "report statement and branch coverage")
+	coverProfile := fs.String("coverprofile", "", "write an LCOV coverage file; implies -cover")
+	coverHTML := fs.String("coverhtml", "", "write an annotated HTML coverage report; implies -cover")
+	strict := fs.Bool("strict", false, "make reading an undefined name an error rather than null")
+	strictBooleans := fs.Bool("strict-booleans", false, "make an if condition that is not a boolean an error")
+	opt := addOptimizeFlags(fs)
+	fs.Parse(args)
+
+	opts := testrunner.Options{Optimize: opt.Passes(), Strict: *strict, StrictBooleans: *strictBooleans}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad -run pattern:", err)
+			os.Exit(2)
+		}
+		opts.Run = re
+	}
+	if *cover || *coverProfile != "" || *coverHTML != "" {
+		opts.Coverage = coverage.New()
+	}
+
+	reporter, err := testrunner.NewReporter(*format, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testrunner.Find(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, file := range files {
+		start := time.Now()
+		testrunner.RunFile(file, opts, func(r *testrunner.Result) {
+			failed = failed || r.Status == testrunner.Fail
+			reporter.Result(r)
+		})
+		reporter.EndFile(file, time.Since(start))
+	}
+
+	if err := reporter.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if opts.Coverage != nil {
+		// the tests themselves are not what is being measured
+		opts.Coverage.Filter(func(path string) bool { return !strings.HasSuffix(path, "_test.salami") })
+
+		// keep machine readable test output clean
+		summary := os.Stdout
+		if *format != "text" {
+			summary = os.Stderr
+		}
+		if !writeCoverage(opts.Coverage, summary, *coverProfile, *coverHTML) {
+			os.Exit(2)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// writeCoverage prints a summary of cov to summary and writes the LCOV and
+// HTML reports to any paths given, reporting whether all of it worked.
+func writeCoverage(cov *coverage.Profile, summary *os.File, lcovPath, htmlPath string) bool {
+	fmt.Fprintln(summary)
+	if err := cov.WriteSummary(summary); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	ok := true
+	write := func(path string, fn func(io.Writer) error) {
+		if path == "" {
+			return
+		}
+		f, err := os.Create(path)
+		if err == nil {
+			err = fn(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error writing coverage:", err)
+			ok = false
+		}
+	}
+	write(lcovPath, cov.WriteLCOV)
+	write(htmlPath, cov.WriteHTML)
+	return ok
+}
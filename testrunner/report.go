@@ -0,0 +1,213 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Reporter formats results as they come in. EndFile is called after the
+// last result of each file and Close once every file has run.
+type Reporter interface {
+	Result(r *Result)
+	EndFile(file string, elapsed time.Duration)
+	Close() error
+}
+
+// NewReporter returns the reporter for format: text, tap or junit.
+func NewReporter(format string, w io.Writer) (Reporter, error) {
+	switch format {
+	case "text":
+		return &textReporter{w: w}, nil
+	case "tap":
+		return &tapReporter{w: w}, nil
+	case "junit":
+		return &junitReporter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want text, tap or junit", format)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r *Result) title() string {
+	if r.Name == "" {
+		return r.File
+	}
+	return r.Name
+}
+
+// textReporter prints one line per test in the style of go test -v.
+type textReporter struct {
+	w                     io.Writer
+	fileFailed            bool
+	passed, failed, skips int
+}
+
+func (t *textReporter) Result(r *Result) {
+	fmt.Fprintf(t.w, "--- %s: %s (%ss)\n", r.Status, r.title(), seconds(r.Duration))
+	if r.Message != "" {
+		fmt.Fprintf(t.w, "    %s: %s\n", r.Where(), r.Message)
+	}
+
+	switch r.Status {
+	case Pass:
+		t.passed++
+	case Fail:
+		t.failed++
+		t.fileFailed = true
+	case Skip:
+		t.skips++
+	}
+}
+
+func (t *textReporter) EndFile(file string, elapsed time.Duration) {
+	status := "ok  "
+	if t.fileFailed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(t.w, "%s\t%s\t%ss\n", status, file, seconds(elapsed))
+	t.fileFailed = false
+}
+
+func (t *textReporter) Close() error {
+	_, err := fmt.Fprintf(t.w, "\n%d passed, %d failed, %d skipped\n", t.passed, t.failed, t.skips)
+	return err
+}
+
+// tapReporter writes TAP version 13, with the plan at the end since the
+// number of tests is not known up front.
+type tapReporter struct {
+	w       io.Writer
+	n       int
+	started bool
+}
+
+func (t *tapReporter) Result(r *Result) {
+	if !t.started {
+		fmt.Fprintln(t.w, "TAP version 13")
+		t.started = true
+	}
+	t.n++
+
+	status := "ok"
+	if r.Status == Fail {
+		status = "not ok"
+	}
+	description := r.File
+	if r.Name != "" {
+		description += ": " + r.Name
+	}
+	fmt.Fprintf(t.w, "%s %d - %s", status, t.n, description)
+	if r.Status == Skip {
+		fmt.Fprintf(t.w, " # SKIP %s", r.Message)
+	}
+	fmt.Fprintln(t.w)
+
+	if r.Status == Fail {
+		fmt.Fprintln(t.w, "  ---")
+		fmt.Fprintf(t.w, "  message: %q\n", r.Message)
+		fmt.Fprintf(t.w, "  at: %q\n", r.Where())
+		fmt.Fprintf(t.w, "  duration_ms: %.3f\n", float64(r.Duration.Microseconds())/1000)
+		fmt.Fprintln(t.w, "  ...")
+	}
+}
+
+func (t *tapReporter) EndFile(string, time.Duration) {}
+
+func (t *tapReporter) Close() error {
+	if !t.started {
+		fmt.Fprintln(t.w, "TAP version 13")
+	}
+	_, err := fmt.Fprintf(t.w, "1..%d\n", t.n)
+	return err
+}
+
+// junitReporter collects results into one testsuite per file and writes
+// the XML document on Close.
+type junitReporter struct {
+	w       io.Writer
+	pending []*Result
+	suites  []junitSuite
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+
+	elapsed time.Duration
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func (j *junitReporter) Result(r *Result) {
+	j.pending = append(j.pending, r)
+}
+
+func (j *junitReporter) EndFile(file string, elapsed time.Duration) {
+	suite := junitSuite{Name: file, Time: seconds(elapsed), elapsed: elapsed}
+	classname := strings.TrimSuffix(file, ".salami")
+
+	for _, r := range j.pending {
+		c := junitCase{Name: r.title(), Classname: classname, Time: seconds(r.Duration)}
+		switch r.Status {
+		case Fail:
+			c.Failure = &junitMessage{Message: r.Message, Body: r.Where() + ": " + r.Message}
+			suite.Failures++
+		case Skip:
+			c.Skipped = &junitMessage{Message: r.Message}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+	}
+
+	j.suites = append(j.suites, suite)
+	j.pending = nil
+}
+
+func (j *junitReporter) Close() error {
+	doc := junitSuites{Suites: j.suites}
+	var total time.Duration
+	for _, s := range j.suites {
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+		doc.Skipped += s.Skipped
+		total += s.elapsed
+	}
+	doc.Time = seconds(total)
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, "%s%s\n", xml.Header, out)
+	return err
+}
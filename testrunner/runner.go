@@ -0,0 +1,223 @@
+// Package testrunner finds and runs the test functions in *_test.salami
+// files. A test is any top level gorlami whose name starts with test_ and
+// which takes no arguments. Each one runs in a fresh interpreter: the file's
+// top level statements run first, then the test function is called, so no
+// state leaks from one test to the next.
+package testrunner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/coverage"
+	"github.com/afoley/salami-lang/interpreter"
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/optimize"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/tok"
+)
+
+const (
+	Pass = "PASS"
+	Fail = "FAIL"
+	Skip = "SKIP"
+)
+
+// Result is the outcome of one test. A file that cannot be loaded is
+// reported as a single failed result with an empty Name.
+type Result struct {
+	File     string // as found, relative to the directory given
+	Name     string
+	Status   string
+	Pos      tok.Position // of the failure or skip
+	Message  string
+	Duration time.Duration
+}
+
+// Where returns the file:line:col of the failure or skip.
+func (r *Result) Where() string {
+	if r.Pos.Line == 0 {
+		return r.File
+	}
+	return fmt.Sprintf("%s:%d:%d", r.File, r.Pos.Line, r.Pos.Column)
+}
+
+type Options struct {
+	Run            *regexp.Regexp    // only run tests whose names match, if set
+	Coverage       *coverage.Profile // records what the tests ran, if set
+	Optimize       []*optimize.Pass  // applied to each test file before it runs
+	Strict         bool              // run tests in strict mode
+	StrictBooleans bool              // run tests with strict booleans
+}
+
+// Find returns the test files named by paths: files are used as they are
+// and directories are searched recursively.
+func Find(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(file, "_test.salami") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// RunFile runs the tests in file, calling report after each one.
+func RunFile(file string, opts Options, report func(*Result)) {
+	program, err := load(file, opts.Optimize)
+	if err != nil {
+		report(&Result{File: file, Status: Fail, Message: err.Error()})
+		return
+	}
+
+	for _, fn := range Tests(program) {
+		if opts.Run != nil && !opts.Run.MatchString(fn.Name.Value) {
+			continue
+		}
+		report(runTest(file, program, fn, opts))
+	}
+}
+
+// Tests returns the test functions declared in program.
+func Tests(program *ast.Program) []*ast.FunctionStatement {
+	tests := []*ast.FunctionStatement{}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Declaration
+		}
+		if fn, ok := stmt.(*ast.FunctionStatement); ok && strings.HasPrefix(fn.Name.Value, "test_") {
+			tests = append(tests, fn)
+		}
+	}
+	return tests
+}
+
+func load(file string, passes []*optimize.Pass) (*ast.Program, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(errs, "; "))
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		return nil, fmt.Errorf("resolver errors: %s", strings.Join(errs, "; "))
+	}
+	if len(passes) != 0 {
+		if errs := optimize.Run(program, passes); len(errs) != 0 {
+			return nil, fmt.Errorf("resolver errors after optimizing: %s", strings.Join(errs, "; "))
+		}
+	}
+	return program, nil
+}
+
+// skipped is raised by the skip builtin to stop a test early.
+type skipped struct {
+	pos    tok.Position
+	reason string
+}
+
+var skipBuiltin = &interpreter.Builtin{
+	Name: "skip",
+	Fn: func(i *interpreter.Interpreter, call *ast.CallExpression, args []interface{}) interface{} {
+		reason := "skipped"
+		if len(args) > 0 {
+			if s, ok := args[0].(string); ok {
+				reason = s
+			} else {
+				reason = interpreter.Inspect(args[0])
+			}
+		}
+		panic(&skipped{pos: call.Pos(), reason: reason})
+	},
+}
+
+func runTest(file string, program *ast.Program, fn *ast.FunctionStatement, opts Options) (result *Result) {
+	result = &Result{File: file, Name: fn.Name.Value, Status: Pass}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	if len(fn.Parameters) != 0 {
+		result.fail(fn.Pos(), "test functions take no arguments")
+		return result
+	}
+
+	interp := interpreter.New()
+	interp.File, _ = filepath.Abs(file)
+	interp.Builtins = map[string]*interpreter.Builtin{skipBuiltin.Name: skipBuiltin}
+	interp.Strict = opts.Strict
+	interp.StrictBooleans = opts.StrictBooleans
+	if opts.Coverage != nil {
+		opts.Coverage.Attach(interp)
+	}
+
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case *skipped:
+			result.Status, result.Pos, result.Message = Skip, r.pos, r.reason
+		default:
+			// a Go panic in the interpreter is still just this test failing
+			result.fail(fn.Pos(), fmt.Sprintf("panic: %v", r))
+		}
+	}()
+
+	if _, err := interp.Run(program); err != nil {
+		result.failWith(err, "in top level code: ")
+		return result
+	}
+	if interp.Exited {
+		result.fail(fn.Pos(), fmt.Sprintf("top level code exited with %d", interp.ExitCode))
+		return result
+	}
+
+	if _, err := interp.Call(fn.Name.Value); err != nil {
+		result.failWith(err, "")
+	} else if interp.Exited {
+		result.fail(fn.Pos(), fmt.Sprintf("test exited with %d", interp.ExitCode))
+	}
+	return result
+}
+
+func (r *Result) fail(pos tok.Position, msg string) {
+	r.Status, r.Pos, r.Message = Fail, pos, msg
+}
+
+func (r *Result) failWith(err error, prefix string) {
+	if rtErr, ok := err.(*interpreter.RuntimeError); ok {
+		if abs, _ := filepath.Abs(r.File); rtErr.File == abs {
+			r.fail(rtErr.Pos, prefix+rtErr.Message)
+			return
+		}
+	}
+	r.fail(tok.Position{}, prefix+err.Error())
+}
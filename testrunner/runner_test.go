@@ -0,0 +1,99 @@
+package testrunner_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/afoley/salami-lang/testrunner"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The files under testdata are not named *_test.salami, so that salami test
+// run over the repository does not pick up their failures.
+var files = []string{"testdata/broken.salami", "testdata/sample.salami"}
+
+// run runs the tests in files through a reporter in format, with every
+// duration zeroed so the output does not change from run to run.
+func run(t *testing.T, format string, opts testrunner.Options) string {
+	t.Helper()
+	var out bytes.Buffer
+	reporter, err := testrunner.NewReporter(format, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		testrunner.RunFile(file, opts, func(r *testrunner.Result) {
+			r.Duration = 0
+			reporter.Result(r)
+		})
+		reporter.EndFile(file, 0)
+	}
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := "testdata/" + name
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("got\n%s\nwant, from %s\n%s\nrun go test -update if the change is intended", got, path, want)
+	}
+}
+
+// The golden files pin down each report format over one test of each
+// outcome and a file that does not parse.
+func TestReports(t *testing.T) {
+	for _, format := range []string{"text", "tap", "junit"} {
+		t.Run(format, func(t *testing.T) {
+			golden(t, "report."+format, run(t, format, testrunner.Options{}))
+		})
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	golden(t, "filtered.tap", run(t, "tap", testrunner.Options{Run: regexp.MustCompile("pass|skip$")}))
+}
+
+// Find searches directories for test files but takes a file named
+// directly whatever it is called.
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.salami", "b.salami", "sub/c_test.salami"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := testrunner.Find([]string{dir, filepath.Join(dir, "b.salami")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a_test.salami", "b.salami", "sub/c_test.salami"}
+	for i := range want {
+		want[i] = filepath.Join(dir, want[i])
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,10 +1,26 @@
 package tok
 
+import "sort"
+
 type TokenType string
 
+type Position struct {
+	Line   int
+	Column int
+}
+
 type Tok struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position // just past the last character
+}
+
+// Comment is a // line comment. The lexer skips comments rather than
+// returning them as tokens, but keeps them for tools that need them.
+type Comment struct {
+	Pos  Position
+	Text string // including the leading //
 }
 
 const (
@@ -13,6 +29,7 @@ const (
 
 	IDENT     = "IDENT"
 	INT       = "INT"
+	STRING    = "STRING"
 	ASSIGN    = "="
 	PLUS      = "+"
 	MINUS     = "-"
@@ -21,12 +38,21 @@ const (
 	SEMICOLON = ";"
 	GT        = ">"
 	LT        = "<"
+	COALESCE  = "??"
+	ARROW     = "=>"
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
-	COMMA  = ","
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
+	COMMA    = ","
+	COLON    = ":"
+	DOT      = "."
+	ELLIPSIS = "..."
+
+	OPTIONAL_DOT = "?."
 
 	// Keywords
 	VAR      = "VAR"
@@ -37,6 +63,20 @@ const (
 	EXIT     = "EXIT"
 	FUNCTION = "FUNCTION"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	NULL     = "NULL"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	STRUCT   = "STRUCT"
+	ENUM     = "ENUM"
+	FOR      = "FOR"
+	IN       = "IN"
+	YIELD    = "YIELD"
 )
 
 var keywords = map[string]TokenType{
@@ -48,6 +88,20 @@ var keywords = map[string]TokenType{
 	"exit":    EXIT,
 	"gorlami": FUNCTION,
 	"dicocco": RETURN,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"null":    NULL,
+	"match":   MATCH,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"struct":  STRUCT,
+	"enum":    ENUM,
+	"for":     FOR,
+	"in":      IN,
+	"yield":   YIELD,
 }
 
 func KeywordLookup(ident string) TokenType {
@@ -56,3 +110,13 @@ func KeywordLookup(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords returns every reserved word of the language.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
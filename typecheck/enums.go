@@ -0,0 +1,89 @@
+package typecheck
+
+import "github.com/afoley/salami-lang/ast"
+
+// variant returns the index of the variant called name, or -1.
+func (e *Enum) variant(name string) int {
+	for i, v := range e.Variants {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *checker) checkEnum(stmt *ast.EnumStatement) {
+	e := &Enum{Name: stmt.Name.Value}
+	for _, v := range stmt.Variants {
+		var fields []string
+		for _, f := range v.Fields {
+			fields = append(fields, f.Value)
+		}
+		e.Variants = append(e.Variants, v.Name.Value)
+		e.Fields = append(e.Fields, fields)
+	}
+	c.env.types[e.Name] = e
+	c.bind(stmt.Name, &EnumType{Enum: e})
+}
+
+// enumMember is the type of me, a variant of e: a value of e if the
+// variant has no fields, or a function making one if it has. The values a
+// variant carries may have any type.
+func (c *checker) enumMember(me *ast.MemberExpression, e *Enum) Type {
+	i := e.variant(me.Member.Value)
+	if i < 0 {
+		c.errorf(me.Member, "%s has no variant %s", e.Name, me.Member.Value)
+		return c.fresh()
+	}
+	if e.Fields[i] == nil {
+		return e
+	}
+	fn := &Func{Return: e}
+	for range e.Fields[i] {
+		fn.Params = append(fn.Params, c.fresh())
+	}
+	return fn
+}
+
+// enumValueMember is the type of me, a field of a value of e, which some
+// variant of e must have.
+func (c *checker) enumValueMember(me *ast.MemberExpression, e *Enum) Type {
+	for _, fields := range e.Fields {
+		for _, f := range fields {
+			if f == me.Member.Value {
+				return c.fresh()
+			}
+		}
+	}
+	c.errorf(me.Member, "no variant of %s has a field %s", e.Name, me.Member.Value)
+	return c.fresh()
+}
+
+// checkVariantPattern checks a variant pattern against a matched value of
+// type t. Its own patterns match values of any type.
+func (c *checker) checkVariantPattern(vp *ast.VariantPattern, t Type) {
+	switch typ := prune(c.infer(vp.Type)).(type) {
+	case *Func:
+		if e, ok := prune(typ.Return).(*Enum); ok {
+			if len(vp.Patterns) != len(typ.Params) {
+				name := e.Name
+				if me, ok := vp.Type.(*ast.MemberExpression); ok {
+					name += "." + me.Member.Value
+				}
+				c.errorf(vp, "pattern for %s: want %d patterns, got %d", name, len(typ.Params), len(vp.Patterns))
+			}
+			if err := unify(t, e); err != nil {
+				c.errorf(vp, "pattern does not fit the matched value: %s", err)
+			}
+			break
+		}
+		c.errorf(vp.Type, "%s is not an enum variant with fields", typ)
+	case *Var:
+	default:
+		c.errorf(vp.Type, "%s is not an enum variant with fields", typ)
+	}
+
+	for _, p := range vp.Patterns {
+		c.checkPattern(p, c.fresh())
+	}
+}
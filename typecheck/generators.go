@@ -0,0 +1,33 @@
+package typecheck
+
+import "github.com/afoley/salami-lang/ast"
+
+// checkFor checks a for, whose name takes the type of the values of its
+// iterable.
+func (c *checker) checkFor(stmt *ast.ForStatement) {
+	t := c.elementType(stmt.Iterable, c.infer(stmt.Iterable))
+	c.bind(stmt.Name, t)
+	if stmt.Name.Pattern != nil {
+		c.bindPattern(stmt.Name.Pattern, t)
+	}
+	c.checkStatements(stmt.Body.Statements)
+}
+
+// elementType is the type of the values iterating over a value of type t
+// gives: an array's elements, a hash's keys or a generator's values. Until
+// t is known, they may have any type.
+func (c *checker) elementType(node ast.Node, t Type) Type {
+	switch t := prune(t).(type) {
+	case *Array:
+		return t.Elem
+	case *Generator:
+		return t.Elem
+	case *Var:
+		return c.fresh()
+	}
+	if t == Hash {
+		return c.fresh()
+	}
+	c.errorf(node, "cannot iterate over %s", prune(t))
+	return c.fresh()
+}
@@ -0,0 +1,124 @@
+package typecheck
+
+import "github.com/afoley/salami-lang/ast"
+
+// hoistMethods notes the methods declared on each struct, so that a method
+// can be used before its declaration has been checked.
+func (c *checker) hoistMethods(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		if es, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = es.Declaration
+		}
+		if fs, ok := stmt.(*ast.FunctionStatement); ok && fs.Receiver != nil {
+			name := fs.ReceiverType.Value
+			c.methods[name] = append(c.methods[name], fs.Name.Value)
+		}
+	}
+}
+
+func (c *checker) checkStruct(stmt *ast.StructStatement) {
+	s := &Struct{Name: stmt.Name.Value, Methods: map[string]*scheme{}}
+	for _, f := range stmt.Fields {
+		s.Fields = append(s.Fields, f.Value)
+		s.Types = append(s.Types, c.fresh())
+	}
+	for _, name := range c.methods[s.Name] {
+		s.Methods[name] = &scheme{t: c.fresh()}
+	}
+	c.structs = append(c.structs, s)
+	c.env.types[s.Name] = s
+	c.bind(stmt.Name, &Constructor{Struct: s})
+}
+
+// checkMethod checks a method and gives its struct the method's type,
+// generalized the way a gorlami declaration is.
+func (c *checker) checkMethod(stmt *ast.FunctionStatement) {
+	var self Type = c.fresh()
+	var s *Struct
+	switch t := prune(c.infer(stmt.ReceiverType)).(type) {
+	case *Constructor:
+		s, self = t.Struct, t.Struct
+		if s.field(stmt.Name.Value) >= 0 {
+			c.errorf(stmt.Name, "%s already has a field %s", s.Name, stmt.Name.Value)
+			s = nil
+		}
+	case *Var:
+	default:
+		c.errorf(stmt.ReceiverType, "cannot declare method %s on %s, it is not a struct", stmt.Name.Value, t)
+	}
+
+	t := c.inferFunction(stmt.Receiver, self, stmt.Parameters, stmt.ReturnType, stmt.Body, stmt.Locals, stmt.Generator)
+	if s == nil {
+		return
+	}
+	if hoisted, ok := s.Methods[stmt.Name.Value]; ok && len(hoisted.vars) == 0 {
+		if err := unify(hoisted.t, t); err != nil {
+			c.errorf(stmt.Name, "%s.%s redeclared with a different type: %s", s.Name, stmt.Name.Value, err)
+		}
+	}
+	s.Methods[stmt.Name.Value] = c.generalize(t, nil)
+}
+
+// structMember is the type of me, a field or method of a value of s.
+func (c *checker) structMember(me *ast.MemberExpression, s *Struct) Type {
+	if i := s.field(me.Member.Value); i >= 0 {
+		return s.Types[i]
+	}
+	if m, ok := s.Methods[me.Member.Value]; ok {
+		return c.instantiate(m)
+	}
+	c.errorf(me.Member, "%s has no field or method %s", s.Name, me.Member.Value)
+	return c.fresh()
+}
+
+func (c *checker) inferStructLiteral(sl *ast.StructLiteral) Type {
+	var s *Struct
+	switch t := prune(c.infer(sl.Type)).(type) {
+	case *Constructor:
+		s = t.Struct
+	case *Var:
+	default:
+		c.errorf(sl.Type, "%s is not a struct", t)
+	}
+
+	for i, f := range sl.Fields {
+		t := c.infer(sl.Values[i])
+		if s == nil {
+			continue
+		}
+		field := s.field(f.Value)
+		if field < 0 {
+			c.errorf(f, "%s has no field %s", s.Name, f.Value)
+			continue
+		}
+		if err := unify(s.Types[field], t); err != nil {
+			c.errorf(sl.Values[i], "field %s of %s: %s", f.Value, s.Name, err)
+		}
+	}
+	if s == nil {
+		return c.fresh()
+	}
+	return s
+}
+
+// inferAssign checks an assignment to a field and returns the type of the
+// value.
+func (c *checker) inferAssign(stmt *ast.AssignStatement) Type {
+	name := stmt.Target.Member.Value
+	object := prune(c.infer(stmt.Target.Object))
+	t := c.infer(stmt.Value)
+
+	switch object := object.(type) {
+	case *Struct:
+		field := object.field(name)
+		if field < 0 {
+			c.errorf(stmt.Target.Member, "%s has no field %s", object.Name, name)
+		} else if err := unify(object.Types[field], t); err != nil {
+			c.errorf(stmt.Value, "cannot set %s.%s: %s", object.Name, name, err)
+		}
+	case *Var:
+	default:
+		c.errorf(stmt, "cannot set .%s on %s, it is not a struct", name, object)
+	}
+	return t
+}
@@ -0,0 +1,837 @@
+// Package typecheck infers static types for salami programs and reports
+// mismatches before they run.
+//
+// Annotations are optional. Unannotated names get type variables that are
+// solved by unification, Hindley-Milner style, and every gorlami declaration
+// is generalized once its body has been checked, so a helper like
+// `gorlami id(x) { dicocco x; }` can be used at more than one type. The
+// program must already have been through the resolver: the checker keeps
+// one type per resolver slot.
+package typecheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/tok"
+)
+
+type env struct {
+	slots []*scheme
+	types map[string]Type // the structs and enums declared in this scope, by name
+	outer *env
+}
+
+// Options change what the checker accepts.
+type Options struct {
+	// StrictBooleans requires if conditions to be bool, as the engines
+	// do in strict booleans mode, rather than of any type.
+	StrictBooleans bool
+}
+
+type checker struct {
+	opts    Options
+	env     *env
+	returns []Type // return type of each enclosing function
+	yields  []Type // type of what each enclosing function yields, nil if it doesn't
+	nextVar int
+	errors  []string
+
+	methods map[string][]string // names of the methods declared on each struct
+	structs []*Struct           // every struct declared so far
+}
+
+// Check type checks program. It returns the type of each global, in the
+// order of program.Globals, and any errors found.
+func Check(program *ast.Program, opts Options) ([]Type, []string) {
+	if !program.Resolved {
+		resolver.Resolve(program)
+	}
+
+	c := &checker{opts: opts, methods: map[string][]string{}}
+	c.env = c.newEnv(len(program.Globals), nil)
+	c.hoistMethods(program.Statements)
+	c.checkStatements(program.Statements)
+
+	types := make([]Type, len(c.env.slots))
+	for i, s := range c.env.slots {
+		types[i] = prune(s.t)
+	}
+	return types, c.errors
+}
+
+func (c *checker) newEnv(size int, outer *env) *env {
+	e := &env{slots: make([]*scheme, size), types: map[string]Type{}, outer: outer}
+	for i := range e.slots {
+		e.slots[i] = &scheme{t: c.fresh()}
+	}
+	return e
+}
+
+func (c *checker) fresh() *Var {
+	c.nextVar++
+	return &Var{ID: c.nextVar}
+}
+
+func (c *checker) checkStatements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		c.checkStatement(stmt)
+	}
+}
+
+func (c *checker) checkStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VarStatement:
+		t := c.infer(stmt.Value)
+		if stmt.Type != nil {
+			if err := unify(c.fromAnnotation(stmt.Type), t); err != nil {
+				c.errorf(stmt.Value, "cannot initialize %s: %s", stmt.Name.Value, err)
+			}
+		}
+		c.bind(stmt.Name, t)
+		if stmt.Name.Pattern != nil {
+			c.bindPattern(stmt.Name.Pattern, t)
+		}
+
+	case *ast.FunctionStatement:
+		if stmt.Receiver != nil {
+			c.checkMethod(stmt)
+			return
+		}
+		t := c.inferFunction(nil, nil, stmt.Parameters, stmt.ReturnType, stmt.Body, stmt.Locals, stmt.Generator)
+		c.bind(stmt.Name, t)
+		c.env.slots[stmt.Name.Index] = c.generalize(t, c.env.slots[stmt.Name.Index])
+
+	case *ast.ReturnStatement:
+		t := c.infer(stmt.ReturnValue)
+		if len(c.returns) == 0 {
+			return // reported by the resolver
+		}
+		if err := unify(c.returns[len(c.returns)-1], t); err != nil {
+			c.errorf(stmt, "bad dicocco value: %s", err)
+		}
+
+	case *ast.ExitStatement:
+		if err := unify(Int, c.infer(stmt.Value)); err != nil {
+			c.errorf(stmt, "bad exit value: %s", err)
+		}
+
+	case *ast.ThrowStatement:
+		// anything can be thrown
+		c.infer(stmt.Value)
+
+	case *ast.YieldStatement:
+		t := c.infer(stmt.Value)
+		if len(c.yields) == 0 || c.yields[len(c.yields)-1] == nil {
+			return // reported by the resolver
+		}
+		if err := unify(c.yields[len(c.yields)-1], t); err != nil {
+			c.errorf(stmt, "bad yield value: %s", err)
+		}
+
+	case *ast.ForStatement:
+		c.checkFor(stmt)
+
+	case *ast.TryStatement:
+		c.checkStatements(stmt.Body.Statements)
+		if stmt.Catch != nil {
+			c.bind(stmt.Param, Error)
+			c.checkStatements(stmt.Catch.Statements)
+		}
+		if stmt.Finally != nil {
+			c.checkStatements(stmt.Finally.Statements)
+		}
+
+	case *ast.StructStatement:
+		c.checkStruct(stmt)
+
+	case *ast.EnumStatement:
+		c.checkEnum(stmt)
+
+	case *ast.AssignStatement:
+		c.inferAssign(stmt)
+
+	case *ast.ExpressionStatement:
+		if me, ok := stmt.Expression.(*ast.MatchExpression); ok {
+			c.inferMatch(me, false)
+			return
+		}
+		c.infer(stmt.Expression)
+
+	case *ast.IfExpression:
+		c.checkIf(stmt)
+
+	case *ast.BlockStatement:
+		c.checkStatements(stmt.Statements)
+
+	case *ast.ExportStatement:
+		c.checkStatement(stmt.Declaration)
+	}
+}
+
+func (c *checker) checkIf(ie *ast.IfExpression) {
+	c.checkCondition(ie)
+	c.checkStatements(ie.Consequence.Statements)
+	if ie.Alternative != nil {
+		c.checkStatements(ie.Alternative.Statements)
+	}
+}
+
+func (c *checker) checkCondition(ie *ast.IfExpression) {
+	if t := c.infer(ie.Condition); c.opts.StrictBooleans && unify(Bool, t) != nil {
+		c.errorf(ie.Condition, "if condition must be bool, got %s", prune(t))
+	}
+}
+
+// inferIf infers the type of an if used as a value. Both branches must
+// have the same type; without an else, the if may be null, which has any.
+func (c *checker) inferIf(ie *ast.IfExpression) Type {
+	c.checkCondition(ie)
+	t := c.inferBranch(ie.Consequence)
+	if ie.Alternative == nil {
+		return c.fresh()
+	}
+	if err := unify(t, c.inferBranch(ie.Alternative)); err != nil {
+		c.errorf(ie, "if branches have different types: %s", err)
+	}
+	return t
+}
+
+// inferBranch checks block and returns the type of its last statement.
+func (c *checker) inferBranch(block *ast.BlockStatement) Type {
+	n := len(block.Statements)
+	if n == 0 {
+		return c.fresh()
+	}
+	c.checkStatements(block.Statements[:n-1])
+
+	switch last := block.Statements[n-1].(type) {
+	case *ast.ExpressionStatement:
+		return c.infer(last.Expression)
+	case *ast.IfExpression:
+		return c.inferIf(last)
+	case *ast.VarStatement:
+		c.checkStatement(last)
+		return c.infer(last.Name)
+	case *ast.AssignStatement:
+		return c.inferAssign(last)
+	default:
+		c.checkStatement(last)
+		return c.fresh()
+	}
+}
+
+// inferMatch infers the type of a match. Literal patterns must have the
+// type of the value, which is also the type of a binding, and a variant
+// pattern must name a variant of it. As a value, every arm must have the
+// same type; as a statement, the arms are only checked.
+func (c *checker) inferMatch(me *ast.MatchExpression, value bool) Type {
+	t := c.infer(me.Value)
+
+	var result Type
+	for _, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			c.checkPattern(pattern, t)
+		}
+
+		if arm.Guard != nil {
+			if gt := c.infer(arm.Guard); c.opts.StrictBooleans && unify(Bool, gt) != nil {
+				c.errorf(arm.Guard, "match guard must be bool, got %s", prune(gt))
+			}
+		}
+
+		var armType Type
+		if arm.Body != nil {
+			armType = c.inferBranch(arm.Body)
+		} else {
+			armType = c.infer(arm.Value)
+		}
+		if !value {
+			continue
+		}
+		if result == nil {
+			result = armType
+		} else if err := unify(result, armType); err != nil {
+			c.errorf(arm, "match arms have different types: %s", err)
+		}
+	}
+
+	if result == nil {
+		return c.fresh()
+	}
+	return result
+}
+
+// checkPattern checks pattern against a matched value of type t.
+func (c *checker) checkPattern(pattern ast.Expression, t Type) {
+	if ast.IsWildcard(pattern) {
+		return
+	}
+	if name := ast.Binding(pattern); name != nil {
+		c.bind(name, t)
+		return
+	}
+	if vp, ok := pattern.(*ast.VariantPattern); ok {
+		c.checkVariantPattern(vp, t)
+		return
+	}
+	switch p := pattern.(type) {
+	case *ast.ArrayPattern, *ast.HashPattern:
+		c.bindPattern(p.(ast.Pattern), t)
+		return
+	}
+	if err := unify(t, c.infer(pattern)); err != nil {
+		c.errorf(pattern, "pattern does not fit the matched value: %s", err)
+	}
+}
+
+// bind unifies t with the type already held by the slot ident declares,
+// which is either the fresh variable it was hoisted with or the type of an
+// earlier declaration of the same name.
+func (c *checker) bind(ident *ast.Identifier, t Type) {
+	slot := c.env.slots[ident.Index]
+	if len(slot.vars) > 0 {
+		// redeclaring a generalized gorlami; start over
+		c.env.slots[ident.Index] = &scheme{t: t}
+		return
+	}
+	if err := unify(slot.t, t); err != nil {
+		c.errorf(ident, "%s redeclared with a different type: %s", ident.Value, err)
+	}
+}
+
+// bindPattern binds the names in pattern to the types of the parts of a
+// value of type t. The values in a hash may have any type.
+func (c *checker) bindPattern(pattern ast.Pattern, t Type) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Pattern != nil {
+			c.bindPattern(p.Pattern, t)
+		} else if p.Value != "_" {
+			c.bind(p, t)
+		}
+
+	case *ast.ArrayPattern:
+		elem := c.fresh()
+		if err := unify(&Array{Elem: elem}, t); err != nil {
+			c.errorf(p, "cannot destructure %s as an array", prune(t))
+		}
+		for _, e := range p.Elements {
+			c.bindPattern(e, elem)
+		}
+		if p.Rest != nil {
+			c.bindPattern(p.Rest, &Array{Elem: elem})
+		}
+
+	case *ast.HashPattern:
+		if err := unify(Hash, t); err != nil {
+			c.errorf(p, "cannot destructure %s as a hash", prune(t))
+		}
+		for _, k := range p.Keys {
+			c.bindPattern(k, c.fresh())
+		}
+		if p.Rest != nil {
+			c.bindPattern(p.Rest, Hash)
+		}
+	}
+}
+
+func (c *checker) infer(node ast.Expression) Type {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+
+	case *ast.BooleanLiteral:
+		return Bool
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.NullLiteral:
+		// null stands in for a value of any type
+		return c.fresh()
+
+	case *ast.MemberExpression:
+		// the members of an imported module are not known statically
+		switch object := prune(c.infer(node.Object)).(type) {
+		case *Struct:
+			return c.structMember(node, object)
+		case *EnumType:
+			return c.enumMember(node, object.Enum)
+		case *Enum:
+			return c.enumValueMember(node, object)
+		case *Basic:
+			if object == Error {
+				return c.errorMember(node)
+			}
+		}
+		return c.fresh()
+
+	case *ast.StructLiteral:
+		return c.inferStructLiteral(node)
+
+	case *ast.Identifier:
+		if !node.Resolved {
+			if t, ok := c.builtinType(node.Value); ok {
+				return t
+			}
+			c.errorf(node, "undefined: %s", node.Value)
+			return c.fresh()
+		}
+		e := c.env
+		for d := node.Depth; d > 0; d-- {
+			e = e.outer
+		}
+		return c.instantiate(e.slots[node.Index])
+
+	case *ast.InfixExpression:
+		if node.Operator == "??" {
+			left := c.infer(node.Left)
+			if err := unify(left, c.infer(node.Right)); err != nil {
+				c.errorf(node.Right, "operands of ?? differ: %s", err)
+			}
+			return left
+		}
+		for _, operand := range []ast.Expression{node.Left, node.Right} {
+			if t := c.infer(operand); unify(Int, t) != nil {
+				c.errorf(operand, "operator %s needs int operands, got %s", node.Operator, prune(t))
+			}
+		}
+		if node.Operator == "<" || node.Operator == ">" {
+			return Bool
+		}
+		return Int
+
+	case *ast.ArrayLiteral:
+		elem := c.fresh()
+		for _, e := range node.Elements {
+			if err := unify(elem, c.infer(e)); err != nil {
+				c.errorf(e, "array elements have different types: %s", err)
+			}
+		}
+		return &Array{Elem: elem}
+
+	case *ast.HashLiteral:
+		for idx := range node.Keys {
+			c.infer(node.Keys[idx])
+			c.infer(node.Values[idx])
+		}
+		return Hash
+
+	case *ast.IndexExpression:
+		return c.inferIndex(node)
+
+	case *ast.FunctionLiteral:
+		return c.inferFunction(nil, nil, node.Parameters, node.ReturnType, node.Body, node.Locals, node.Generator)
+
+	case *ast.CallExpression:
+		return c.inferCall(node)
+
+	case *ast.IfExpression:
+		return c.inferIf(node)
+
+	case *ast.MatchExpression:
+		return c.inferMatch(node, true)
+
+	default:
+		return c.fresh()
+	}
+}
+
+// errorMember is the type of me, a member of an error.
+func (c *checker) errorMember(me *ast.MemberExpression) Type {
+	switch me.Member.Value {
+	case "message":
+		return String
+	case "stack":
+		return &Array{Elem: String}
+	case "value":
+		return c.fresh()
+	}
+	c.errorf(me.Member, "an error has no member %s", me.Member.Value)
+	return c.fresh()
+}
+
+// inferIndex infers the type of indexing an array, which needs an int and
+// gives an element, or a hash, which gives a value of any type.
+func (c *checker) inferIndex(ie *ast.IndexExpression) Type {
+	left := prune(c.infer(ie.Left))
+	index := c.infer(ie.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if err := unify(Int, index); err != nil {
+			c.errorf(ie.Index, "array index must be int, got %s", prune(index))
+		}
+		return left.Elem
+	case *Var:
+		return c.fresh()
+	}
+	if left != Hash {
+		c.errorf(ie, "cannot index %s", left)
+	}
+	return c.fresh()
+}
+
+// builtinType returns a fresh instance of the type of a builtin function.
+func (c *checker) builtinType(name string) (Type, bool) {
+	switch name {
+	case "assert":
+		return &Func{Params: []Type{Bool}, Return: Bool}, true
+	case "assert_eq":
+		a := c.fresh()
+		return &Func{Params: []Type{a, a}, Return: Bool}, true
+	case "bool":
+		return &Func{Params: []Type{c.fresh()}, Return: Bool}, true
+	case "len": // of an array, hash or string
+		return &Func{Params: []Type{c.fresh()}, Return: Int}, true
+	case "next": // with a default for once the generator is exhausted
+		a := c.fresh()
+		return &Func{Params: []Type{&Generator{Elem: a}, a}, Optional: 1, Return: a}, true
+	case "range":
+		return &Func{Params: []Type{Int, Int, Int}, Optional: 2, Return: &Generator{Elem: Int}}, true
+	case "map": // over any iterable
+		b := c.fresh()
+		return &Func{Params: []Type{&Func{Params: []Type{c.fresh()}, Return: b}, c.fresh()}, Return: &Generator{Elem: b}}, true
+	case "filter":
+		a := c.fresh()
+		return &Func{Params: []Type{&Func{Params: []Type{a}, Return: c.fresh()}, c.fresh()}, Return: &Generator{Elem: a}}, true
+	case "take":
+		return &Func{Params: []Type{Int, c.fresh()}, Return: &Generator{Elem: c.fresh()}}, true
+	case "zip": // of any number of iterables of any types
+		return c.fresh(), true
+	case "skip": // only defined under salami test
+		return &Func{Params: []Type{String}, Return: c.fresh()}, true
+	}
+	return nil, false
+}
+
+func (c *checker) inferCall(ce *ast.CallExpression) Type {
+	callee := c.infer(ce.Function)
+
+	args := make([]Type, len(ce.Arguments))
+	flexible := false
+	for i, a := range ce.Arguments {
+		switch a := a.(type) {
+		case *ast.NamedArgument:
+			args[i], flexible = c.infer(a.Value), true
+		case *ast.SpreadExpression:
+			args[i], flexible = c.infer(a.Value), true
+		default:
+			args[i] = c.infer(a)
+		}
+	}
+
+	name := "function"
+	if ident, ok := ce.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+
+	fn, known := prune(callee).(*Func)
+	if known && (flexible || fn.Optional > 0 || fn.Variadic) {
+		c.checkArguments(ce, name, fn, args)
+		return fn.Return
+	}
+	if flexible {
+		// nothing says which parameters the arguments land in
+		return c.fresh()
+	}
+
+	if fn, ok := prune(callee).(*Func); ok && len(fn.Params) != len(args) {
+		c.errorf(ce, "wrong number of arguments in call to %s: want %d, got %d", name, len(fn.Params), len(args))
+		return fn.Return
+	}
+
+	ret := c.fresh()
+	if err := unify(callee, &Func{Params: args, Return: ret}); err != nil {
+		c.errorf(ce, "cannot call %s with (%s): %s", name, typeList(args), err)
+	}
+	return ret
+}
+
+// checkArguments checks the arguments of a call with named or spread
+// arguments, or of a function with defaults or a variadic parameter,
+// against the parameters of fn. args holds the type of each argument, or
+// of the value of a named or spread one.
+func (c *checker) checkArguments(ce *ast.CallExpression, name string, fn *Func, args []Type) {
+	fixed := len(fn.Params)
+	if fn.Variadic {
+		fixed--
+	}
+	given := make([]bool, fixed)
+	spread := false // after a spread, which parameter an argument lands in is unknown
+	pos := 0
+
+	for i, a := range ce.Arguments {
+		switch a := a.(type) {
+		case *ast.SpreadExpression:
+			elem := c.fresh()
+			if err := unify(&Array{Elem: elem}, args[i]); err != nil {
+				c.errorf(a, "cannot spread %s, it is not an array", args[i])
+			}
+			if fn.Variadic && pos >= fixed {
+				if err := unify(fn.Params[fixed], &Array{Elem: elem}); err != nil {
+					c.errorf(a, "argument ...%s to %s: %s", fn.Names[fixed], name, err)
+				}
+			}
+			spread = true
+
+		case *ast.NamedArgument:
+			idx := -1
+			for pidx := 0; pidx < fixed && pidx < len(fn.Names); pidx++ {
+				if fn.Names[pidx] == a.Name {
+					idx = pidx
+				}
+			}
+			switch {
+			case fn.Names == nil:
+				c.errorf(a, "%s takes no named arguments", name)
+				return
+			case idx < 0 && fn.Variadic && fn.Names[fixed] == a.Name:
+				c.errorf(a, "cannot pass ...%s by name", a.Name)
+			case idx < 0:
+				c.errorf(a, "%s has no parameter %s", name, a.Name)
+			case given[idx]:
+				c.errorf(a, "argument %s given twice in call to %s", a.Name, name)
+			default:
+				given[idx] = true
+				if err := unify(fn.Params[idx], args[i]); err != nil {
+					c.errorf(a, "argument %s to %s: %s", a.Name, name, err)
+				}
+			}
+
+		default:
+			if spread {
+				continue
+			}
+			switch {
+			case pos < fixed:
+				given[pos] = true
+				if err := unify(fn.Params[pos], args[i]); err != nil {
+					c.errorf(a, "argument %d to %s: %s", pos+1, name, err)
+				}
+			case fn.Variadic:
+				if err := unify(fn.Params[fixed], &Array{Elem: args[i]}); err != nil {
+					c.errorf(a, "argument %d to %s: %s", pos+1, name, err)
+				}
+			default:
+				c.errorf(ce, "too many arguments to %s: want %s, got %d", name, maxArguments(fn, fixed), positional(ce))
+				return
+			}
+			pos++
+		}
+	}
+
+	if spread {
+		return
+	}
+	for idx := 0; idx < fixed-fn.Optional; idx++ {
+		switch {
+		case given[idx]:
+		case fn.Names == nil: // a builtin's parameters have no names
+			c.errorf(ce, "too few arguments to %s: want at least %d, got %d", name, fixed-fn.Optional, positional(ce))
+			return
+		default:
+			c.errorf(ce, "missing argument %s in call to %s", fn.Names[idx], name)
+		}
+	}
+}
+
+func maxArguments(fn *Func, fixed int) string {
+	if fn.Optional > 0 {
+		return fmt.Sprintf("at most %d", fixed)
+	}
+	return fmt.Sprint(fixed)
+}
+
+// positional counts the arguments of ce not passed by name.
+func positional(ce *ast.CallExpression) int {
+	n := 0
+	for _, a := range ce.Arguments {
+		if _, ok := a.(*ast.NamedArgument); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// inferFunction infers the type of a function. The receiver of a method,
+// if there is one, has type self. A generator returns a generator of what
+// it yields; what a dicocco in it gives is never seen.
+func (c *checker) inferFunction(receiver *ast.Identifier, self Type, params []*ast.Identifier, retAnnotation *ast.TypeAnnotation, body *ast.BlockStatement, locals []string, generator bool) Type {
+	fn := &Func{Params: make([]Type, len(params))}
+
+	c.env = c.newEnv(len(locals), c.env)
+	defer func() { c.env = c.env.outer }()
+
+	if receiver != nil {
+		c.env.slots[receiver.Index] = &scheme{t: self}
+	}
+
+	for i, p := range params {
+		switch {
+		case p.Variadic && p.Type != nil:
+			c.env.slots[p.Index] = &scheme{t: &Array{Elem: c.fromAnnotation(p.Type)}}
+		case p.Variadic:
+			c.env.slots[p.Index] = &scheme{t: &Array{Elem: c.fresh()}}
+		case p.Type != nil:
+			c.env.slots[p.Index] = &scheme{t: c.fromAnnotation(p.Type)}
+		}
+		fn.Params[i] = c.env.slots[p.Index].t
+		fn.Names = append(fn.Names, p.Value)
+		fn.Variadic = p.Variadic
+		if p.Default != nil {
+			fn.Optional++
+			if err := unify(fn.Params[i], c.infer(p.Default)); err != nil {
+				c.errorf(p.Default, "default for %s: %s", p.Value, err)
+			}
+		}
+		if p.Pattern != nil {
+			c.bindPattern(p.Pattern, fn.Params[i])
+		}
+	}
+
+	if retAnnotation != nil {
+		fn.Return = c.fromAnnotation(retAnnotation)
+	} else {
+		fn.Return = c.fresh()
+	}
+
+	ret, yields := fn.Return, Type(nil)
+	if generator {
+		yields = c.fresh()
+		if err := unify(fn.Return, &Generator{Elem: yields}); err != nil {
+			c.errorf(retAnnotation, "a gorlami that yields returns a generator: %s", err)
+		}
+		ret = c.fresh()
+	}
+
+	c.returns = append(c.returns, ret)
+	c.yields = append(c.yields, yields)
+	c.checkStatements(body.Statements)
+	c.returns = c.returns[:len(c.returns)-1]
+	c.yields = c.yields[:len(c.yields)-1]
+
+	return fn
+}
+
+func (c *checker) fromAnnotation(ta *ast.TypeAnnotation) Type {
+	switch ta.Name {
+	case "int":
+		return Int
+	case "bool":
+		return Bool
+	case "string":
+		return String
+	case "":
+		fn := &Func{Return: c.fromAnnotation(ta.Return)}
+		for _, p := range ta.Parameters {
+			fn.Params = append(fn.Params, c.fromAnnotation(p))
+		}
+		return fn
+	default:
+		for e := c.env; e != nil; e = e.outer {
+			if t, ok := e.types[ta.Name]; ok {
+				return t
+			}
+		}
+		c.errorf(ta, "unknown type %s", ta.Name)
+		return c.fresh()
+	}
+}
+
+// generalize quantifies the variables of t that are not free anywhere in the
+// environment or a struct, ignoring self, the slot t is about to replace.
+func (c *checker) generalize(t Type, self *scheme) *scheme {
+	inEnv := map[*Var]bool{}
+	for _, s := range c.structs {
+		for _, ft := range s.Types {
+			freeVars(ft, inEnv)
+		}
+		for _, m := range s.Methods {
+			if len(m.vars) == 0 {
+				freeVars(m.t, inEnv)
+			}
+		}
+	}
+	for e := c.env; e != nil; e = e.outer {
+		for _, s := range e.slots {
+			if s == self {
+				continue
+			}
+			vars := map[*Var]bool{}
+			freeVars(s.t, vars)
+			for _, q := range s.vars {
+				delete(vars, q)
+			}
+			for v := range vars {
+				inEnv[v] = true
+			}
+		}
+	}
+
+	free := map[*Var]bool{}
+	freeVars(t, free)
+
+	s := &scheme{t: t}
+	for v := range free {
+		if !inEnv[v] {
+			s.vars = append(s.vars, v)
+		}
+	}
+	return s
+}
+
+func (c *checker) instantiate(s *scheme) Type {
+	if len(s.vars) == 0 {
+		return s.t
+	}
+
+	mapping := map[*Var]Type{}
+	for _, v := range s.vars {
+		mapping[v] = c.fresh()
+	}
+	return substitute(s.t, mapping)
+}
+
+func substitute(t Type, mapping map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if r, ok := mapping[t]; ok {
+			return r
+		}
+		return t
+	case *Func:
+		fn := &Func{Params: make([]Type, len(t.Params)), Return: substitute(t.Return, mapping),
+			Names: t.Names, Optional: t.Optional, Variadic: t.Variadic}
+		for i, p := range t.Params {
+			fn.Params[i] = substitute(p, mapping)
+		}
+		return fn
+	case *Array:
+		return &Array{Elem: substitute(t.Elem, mapping)}
+	case *Generator:
+		return &Generator{Elem: substitute(t.Elem, mapping)}
+	default:
+		return t
+	}
+}
+
+func typeList(types []Type) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = prune(t).String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c *checker) errorf(node ast.Node, format string, args ...interface{}) {
+	var pos tok.Position
+	if node != nil {
+		pos = node.Pos()
+	}
+	msg := fmt.Sprintf(format, args...)
+	c.errors = append(c.errors, fmt.Sprintf("%d:%d: %s", pos.Line, pos.Column, msg))
+}
@@ -0,0 +1,105 @@
+package typecheck_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/typecheck"
+)
+
+func check(t *testing.T, src string, opts typecheck.Options) []string {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	_, errs := typecheck.Check(program, opts)
+	return errs
+}
+
+// Each program has at most one type error, which must contain want.
+var programs = []struct {
+	name string
+	src  string
+	opts typecheck.Options
+	want string
+}{
+	{"annotation mismatch", "var x: int = true;\n", typecheck.Options{}, "1:14: cannot initialize x: expected int, got bool"},
+	{"operand mismatch", "var x = 1 - \"a\";\n", typecheck.Options{}, "operator - needs int operands, got string"},
+	{"if branches differ", "var x = if (true) { 1 } else { \"a\" };\n", typecheck.Options{}, "if branches have different types"},
+	{"return mismatch", "gorlami f(): int { dicocco \"a\"; }\n", typecheck.Options{}, "bad dicocco value"},
+	{"argument mismatch", "gorlami f(a: int) { dicocco a; }\nf(\"a\");\n", typecheck.Options{}, "cannot call f with (string)"},
+	{"calling an int", "var x = 1;\nx(2);\n", typecheck.Options{}, "cannot call x with (int)"},
+	{"too few arguments", "gorlami f(a, b) { dicocco a; }\nf(1);\n", typecheck.Options{}, "2:2: wrong number of arguments in call to f: want 2, got 1"},
+	{"too many arguments", "gorlami f(a) { dicocco a; }\nf(1, 2);\n", typecheck.Options{}, "wrong number of arguments in call to f: want 1, got 2"},
+	{"missing argument", "gorlami f(a, b, c = 1) { dicocco a; }\nf(1);\n", typecheck.Options{}, "missing argument b in call to f"},
+	{"unknown named argument", "gorlami f(a, b = 1) { dicocco a; }\nf(1, c: 2);\n", typecheck.Options{}, "f has no parameter c"},
+	{"let-polymorphism", "gorlami id(x) { dicocco x; }\nvar a: int = id(1);\nvar b: bool = id(true);\n", typecheck.Options{}, ""},
+	{"monomorphic lambda", "var id = gorlami(x) { dicocco x; };\nid(1);\nid(true);\n", typecheck.Options{}, "cannot call id with (bool)"},
+	{"int condition", "if (1) { 2; }\n", typecheck.Options{}, ""},
+	{"strict int condition", "if (1) { 2; }\n", typecheck.Options{StrictBooleans: true}, "1:5: if condition must be bool, got int"},
+	{"strict bool condition", "if (1 < 2) { 2; }\n", typecheck.Options{StrictBooleans: true}, ""},
+	{"struct annotation", `struct Point { x, y }
+var o: Point = Point{x: 0, y: 0};
+gorlami (p Point) moved(dx: int): Point { dicocco p; }
+gorlami origin(): Point { dicocco o; }
+`, typecheck.Options{}, ""},
+	{"struct annotation mismatch", `struct Point { x, y }
+var o: Point = 1;
+`, typecheck.Options{}, "cannot initialize o: expected Point, got int"},
+	{"enum out of scope", `gorlami f() {
+    enum Inner { A }
+    dicocco Inner.A;
+}
+var i: Inner = f();
+`, typecheck.Options{}, "unknown type Inner"},
+	{"enum annotation", `enum Color { Red, Green(shade) }
+var c: Color = Color.Red;
+var g: Color = Color.Green(1);
+gorlami paint(c: Color): Color { dicocco c; }
+paint(g);
+`, typecheck.Options{}, ""},
+	{"enum annotation mismatch", `enum Color { Red }
+enum Size { Small }
+var c: Color = Size.Small;
+`, typecheck.Options{}, "cannot initialize c: expected Color, got Size"},
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range programs {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := check(t, tc.src, tc.opts)
+			switch {
+			case tc.want == "" && len(errs) != 0:
+				t.Errorf("got %v, want no errors", errs)
+			case tc.want != "" && (len(errs) != 1 || !strings.Contains(errs[0], tc.want)):
+				t.Errorf("got %v, want one error containing %q", errs, tc.want)
+			}
+		})
+	}
+}
+
+// A gorlami declaration is generalized, so each use of id gets its own
+// type, and the globals come back in declaration order.
+func TestCheckTypes(t *testing.T) {
+	p := parser.New(lexer.NewLexer(strings.NewReader("gorlami id(x) { dicocco x; }\nvar a = id(1);\nvar b = id(true);\nvar c = id(id);\n")))
+	program := p.ParseProgram()
+	types, errs := typecheck.Check(program, typecheck.Options{})
+	if len(errs) != 0 {
+		t.Fatalf("type errors: %v", errs)
+	}
+
+	var got []string
+	for _, typ := range types[1:] {
+		got = append(got, typ.String())
+	}
+	if want := "int, bool"; strings.Join(got[:2], ", ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, ", "), want)
+	}
+	if !strings.HasPrefix(types[0].String(), "gorlami(") || !strings.HasPrefix(got[2], "gorlami(") {
+		t.Errorf("id and c: got %s and %s, want functions", types[0], got[2])
+	}
+}
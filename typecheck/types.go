@@ -0,0 +1,244 @@
+package typecheck
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Type interface {
+	String() string
+}
+
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	Bool   = &Basic{Name: "bool"}
+	String = &Basic{Name: "string"}
+	// Hash is the type of every hash: their values may have different
+	// types, so nothing is known about what indexing one gives.
+	Hash = &Basic{Name: "hash"}
+	// Error is the type of what a catch binds.
+	Error = &Basic{Name: "error"}
+)
+
+// Array is the type of arrays whose elements all have type Elem.
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return "[" + prune(a.Elem).String() + "]" }
+
+// Generator is the type of generators whose values all have type Elem.
+type Generator struct {
+	Elem Type
+}
+
+func (g *Generator) String() string { return "generator<" + prune(g.Elem).String() + ">" }
+
+// Struct is the type of the values of a struct declaration, which no other
+// declaration's values share. Each field has one type for every value.
+type Struct struct {
+	Name    string
+	Fields  []string
+	Types   []Type
+	Methods map[string]*scheme
+}
+
+func (s *Struct) String() string { return s.Name }
+
+func (s *Struct) field(name string) int {
+	for i, f := range s.Fields {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Constructor is the type of the name a struct declaration binds.
+type Constructor struct {
+	Struct *Struct
+}
+
+func (c *Constructor) String() string { return "struct " + c.Struct.Name }
+
+// Enum is the type of the values of an enum declaration, whichever
+// variant they are, which no other declaration's values share.
+type Enum struct {
+	Name     string
+	Variants []string
+	Fields   [][]string // nil for a variant without fields
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// EnumType is the type of the name an enum declaration binds.
+type EnumType struct {
+	Enum *Enum
+}
+
+func (e *EnumType) String() string { return "enum " + e.Enum.Name }
+
+type Func struct {
+	Params []Type
+	Return Type
+
+	// Names names the parameters of a declared function, for named
+	// arguments. The last Optional parameters before a Variadic one have
+	// defaults, and a Variadic last parameter is an array of the arguments
+	// left over.
+	Names    []string
+	Optional int
+	Variadic bool
+}
+
+func (f *Func) String() string {
+	params := make([]string, len(f.Params))
+	fixed := len(f.Params)
+	if f.Variadic {
+		fixed--
+	}
+	for i, p := range f.Params {
+		params[i] = prune(p).String()
+		switch {
+		case i == fixed:
+			if arr, ok := prune(p).(*Array); ok {
+				params[i] = "..." + prune(arr.Elem).String()
+			}
+		case i >= fixed-f.Optional:
+			params[i] += "?"
+		}
+	}
+	return "gorlami(" + strings.Join(params, ", ") + "): " + prune(f.Return).String()
+}
+
+// Var is a type variable. Once unified with something it forwards to
+// Instance.
+type Var struct {
+	ID       int
+	Instance Type
+}
+
+func (v *Var) String() string {
+	if v.Instance != nil {
+		return v.Instance.String()
+	}
+	return fmt.Sprintf("t%d", v.ID)
+}
+
+// scheme is a type with some of its variables universally quantified, as
+// given to a generalized gorlami declaration.
+type scheme struct {
+	vars []*Var
+	t    Type
+}
+
+func prune(t Type) Type {
+	if v, ok := t.(*Var); ok && v.Instance != nil {
+		v.Instance = prune(v.Instance)
+		return v.Instance
+	}
+	return t
+}
+
+func occursIn(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Func:
+		for _, p := range t.Params {
+			if occursIn(v, p) {
+				return true
+			}
+		}
+		return occursIn(v, t.Return)
+	case *Array:
+		return occursIn(v, t.Elem)
+	case *Generator:
+		return occursIn(v, t.Elem)
+	}
+	return false
+}
+
+func unify(a, b Type) error {
+	a, b = prune(a), prune(b)
+
+	if av, ok := a.(*Var); ok {
+		if bv, ok := b.(*Var); ok && av == bv {
+			return nil
+		}
+		if occursIn(av, b) {
+			return fmt.Errorf("recursive type %s = %s", a, b)
+		}
+		av.Instance = b
+		return nil
+	}
+	if _, ok := b.(*Var); ok {
+		return unify(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Basic:
+		if bb, ok := b.(*Basic); ok && a.Name == bb.Name {
+			return nil
+		}
+	case *Func:
+		bf, ok := b.(*Func)
+		if !ok || len(a.Params) != len(bf.Params) {
+			break
+		}
+		for i := range a.Params {
+			if err := unify(a.Params[i], bf.Params[i]); err != nil {
+				return err
+			}
+		}
+		return unify(a.Return, bf.Return)
+	case *Array:
+		if ba, ok := b.(*Array); ok {
+			return unify(a.Elem, ba.Elem)
+		}
+	case *Generator:
+		if bg, ok := b.(*Generator); ok {
+			return unify(a.Elem, bg.Elem)
+		}
+	case *Struct:
+		if a == b {
+			return nil
+		}
+	case *Constructor:
+		if bc, ok := b.(*Constructor); ok && a.Struct == bc.Struct {
+			return nil
+		}
+	case *Enum:
+		if a == b {
+			return nil
+		}
+	case *EnumType:
+		if be, ok := b.(*EnumType); ok && a.Enum == be.Enum {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected %s, got %s", a, b)
+}
+
+func freeVars(t Type, into map[*Var]bool) {
+	switch t := prune(t).(type) {
+	case *Var:
+		into[t] = true
+	case *Func:
+		for _, p := range t.Params {
+			freeVars(p, into)
+		}
+		freeVars(t.Return, into)
+	case *Array:
+		freeVars(t.Elem, into)
+	case *Generator:
+		freeVars(t.Elem, into)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/vet"
+)
+
+// vetCommand reports likely mistakes in the .salami files under the given
+// files and directories, the current directory by default. It exits 1 if
+// it finds any, or if a file does not parse.
+func vetCommand(args []string) {
+	fs := flag.NewFlagSet("vet", flag.ExitOnError)
+	enable := fs.String("enable", "", "comma separated rules to run instead of all of them")
+	disable := fs.String("disable", "", "comma separated rules not to run")
+	list := fs.Bool("list", false, "list the rules and exit")
+	fs.Parse(args)
+
+	if *list {
+		for _, a := range vet.Analyzers {
+			fmt.Printf("%-20s %s\n", a.Name, a.Doc)
+		}
+		return
+	}
+
+	analyzers := vet.Analyzers
+	if *enable != "" {
+		analyzers = nil
+		for _, rule := range ruleList(*enable) {
+			analyzers = append(analyzers, vet.Lookup(rule))
+		}
+	}
+	if *disable != "" {
+		off := map[string]bool{}
+		for _, rule := range ruleList(*disable) {
+			off[rule] = true
+		}
+		var kept []*vet.Analyzer
+		for _, a := range analyzers {
+			if !off[a.Name] {
+				kept = append(kept, a)
+			}
+		}
+		analyzers = kept
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := salamiFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	found := false
+	for _, file := range files {
+		for _, finding := range vetFile(file, analyzers) {
+			fmt.Printf("%s:%s\n", file, finding)
+			found = true
+		}
+	}
+	if found {
+		os.Exit(1)
+	}
+}
+
+// ruleList splits a comma separated list of rule IDs, exiting if one is
+// unknown.
+func ruleList(s string) []string {
+	var rules []string
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if vet.Lookup(rule) == nil {
+			fmt.Fprintf(os.Stderr, "unknown rule %q; salami vet -list shows them all\n", rule)
+			os.Exit(2)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// vetFile returns the findings for file as "line:col: message" strings,
+// or its parser or resolver errors if it cannot be checked.
+func vetFile(file string, analyzers []*vet.Analyzer) []string {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return []string{" " + err.Error()}
+	}
+
+	p := parser.New(lexer.NewLexer(strings.NewReader(string(src))))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return errs
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		return errs
+	}
+
+	var out []string
+	for _, d := range vet.Run(program, analyzers) {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+// salamiFiles returns the files named by paths, searching directories
+// recursively for .salami files.
+func salamiFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(file, ".salami") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
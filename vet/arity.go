@@ -0,0 +1,56 @@
+package vet
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+var Arity = &Analyzer{
+	Name: "arity",
+	Doc:  "a call to a known gorlami with the wrong number of arguments",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+			ident, ok := call.Function.(*ast.Identifier)
+			if !ok {
+				return true
+			}
+			b := pass.scopes.uses[ident]
+			if b == nil || b.arity == nil {
+				return true
+			}
+			count := len(call.Arguments)
+			for _, a := range call.Arguments {
+				if _, ok := a.(*ast.SpreadExpression); ok {
+					return true // the number is only known at run time
+				}
+			}
+			if a := b.arity; count < a.required || (!a.variadic && count > a.required+a.optional) {
+				pass.Reportf(ident.Pos(), "%s takes %s but is called with %d", b.name, a, count)
+			}
+			return true
+		})
+	},
+}
+
+func (a *arity) String() string {
+	max := a.required + a.optional
+	switch {
+	case a.variadic:
+		return fmt.Sprintf("at least %d %s", a.required, plural(a.required, "argument"))
+	case a.optional > 0:
+		return fmt.Sprintf("%d to %d arguments", a.required, max)
+	}
+	return fmt.Sprintf("%d %s", max, plural(max, "argument"))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,94 @@
+package vet
+
+import "github.com/afoley/salami-lang/ast"
+
+var ConstantCondition = &Analyzer{
+	Name: "constant-condition",
+	Doc:  "an if whose condition is the same every time",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			if ie, ok := n.(*ast.IfExpression); ok {
+				if b, ok := constantTruth(ie.Condition); ok {
+					pass.Reportf(ie.Condition.Pos(), "condition is always %t", b)
+				}
+			}
+			return true
+		})
+	},
+}
+
+var DivideByZero = &Analyzer{
+	Name: "divide-by-zero",
+	Doc:  "a division whose divisor is a constant zero",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			if ie, ok := n.(*ast.InfixExpression); ok && ie.Operator == "/" {
+				if v, ok := constant(ie.Right); ok && v == int64(0) {
+					pass.Reportf(ie.Pos(), "division by zero")
+				}
+			}
+			return true
+		})
+	},
+}
+
+// constantTruth reports whether cond, if it only involves literals, is
+// always true or always false as a condition.
+func constantTruth(cond ast.Expression) (bool, bool) {
+	switch cond := cond.(type) {
+	case *ast.StringLiteral:
+		return cond.Value != "", true
+	case *ast.NullLiteral:
+		return false, true
+	}
+	switch v, _ := constant(cond); v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	}
+	return false, false
+}
+
+// constant evaluates expr if it only involves literals, returning an int64
+// or a bool.
+func constant(expr ast.Expression) (interface{}, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return expr.Value, true
+	case *ast.BooleanLiteral:
+		return expr.Value, true
+	case *ast.InfixExpression:
+		left, ok := constant(expr.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constant(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		l, lok := left.(int64)
+		r, rok := right.(int64)
+		if !lok || !rok {
+			return nil, false
+		}
+		switch expr.Operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r == 0 {
+				return nil, false
+			}
+			return l / r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		}
+	}
+	return nil, false
+}
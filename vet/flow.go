@@ -0,0 +1,108 @@
+package vet
+
+import (
+	"github.com/afoley/salami-lang/ast"
+)
+
+var Unreachable = &Analyzer{
+	Name: "unreachable",
+	Doc:  "statements after a dicocco, exit or throw, or after an if whose branches all end in one",
+	Run: func(pass *Pass) {
+		var check func([]ast.Statement)
+		check = func(stmts []ast.Statement) {
+			for idx, stmt := range stmts {
+				if terminates(stmt) && idx+1 < len(stmts) {
+					pass.Reportf(stmts[idx+1].Pos(), "unreachable code")
+					return
+				}
+			}
+		}
+
+		check(pass.Program.Statements)
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			if block, ok := n.(*ast.BlockStatement); ok {
+				check(block.Statements)
+			}
+			return true
+		})
+	},
+}
+
+var MissingReturn = &Analyzer{
+	Name: "missing-return",
+	Doc:  "a gorlami that returns a value on some paths but can reach its end on others",
+	Run: func(pass *Pass) {
+		for _, fn := range functions(pass.Program) {
+			// a dicocco only ends a generator; its value goes nowhere
+			if fn.generator || !returnsValue(fn.body) || terminatesBlock(fn.body.Statements) {
+				continue
+			}
+			name := "gorlami literal"
+			if fn.name != "" {
+				name = "gorlami " + fn.name
+			}
+			pass.Reportf(fn.body.End, "%s is missing a dicocco at the end", name)
+		}
+	},
+}
+
+// terminates reports whether control never continues past stmt.
+func terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ExitStatement, *ast.ThrowStatement:
+		return true
+	case *ast.TryStatement:
+		if stmt.Finally != nil && terminatesBlock(stmt.Finally.Statements) {
+			return true
+		}
+		return terminatesBlock(stmt.Body.Statements) &&
+			(stmt.Catch == nil || terminatesBlock(stmt.Catch.Statements))
+	case *ast.IfExpression:
+		return stmt.Alternative != nil &&
+			terminatesBlock(stmt.Consequence.Statements) &&
+			terminatesBlock(stmt.Alternative.Statements)
+	case *ast.BlockStatement:
+		return terminatesBlock(stmt.Statements)
+	case *ast.ExpressionStatement:
+		if me, ok := stmt.Expression.(*ast.MatchExpression); ok {
+			return armsTerminate(me)
+		}
+	}
+	return false
+}
+
+// armsTerminate reports whether every arm of me ends in a dicocco or exit.
+// A match that no arm matches fails, so it never continues either.
+func armsTerminate(me *ast.MatchExpression) bool {
+	for _, arm := range me.Arms {
+		if arm.Body == nil || !terminatesBlock(arm.Body.Statements) {
+			return false
+		}
+	}
+	return true
+}
+
+func terminatesBlock(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		if terminates(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// returnsValue reports whether body has a dicocco of its own, not counting
+// those in nested gorlamis.
+func returnsValue(body *ast.BlockStatement) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.ReturnStatement:
+			found = true
+		case *ast.FunctionLiteral, *ast.FunctionStatement:
+			return false
+		}
+		return !found
+	})
+	return found
+}
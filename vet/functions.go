@@ -0,0 +1,32 @@
+package vet
+
+import "github.com/afoley/salami-lang/ast"
+
+// function is a gorlami declaration or literal, for the checks that look
+// at each function body.
+type function struct {
+	name   string // empty for a literal
+	node   ast.Node
+	params []*ast.Identifier
+	body   *ast.BlockStatement
+
+	generator bool // whether the body yields
+}
+
+func functions(program *ast.Program) []function {
+	var fns []function
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionStatement:
+			name := n.Name.Value
+			if n.Receiver != nil {
+				name = n.ReceiverType.Value + "." + name
+			}
+			fns = append(fns, function{name, n, n.Parameters, n.Body, n.Generator})
+		case *ast.FunctionLiteral:
+			fns = append(fns, function{"", n, n.Parameters, n.Body, n.Generator})
+		}
+		return true
+	})
+	return fns
+}
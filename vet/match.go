@@ -0,0 +1,223 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+)
+
+var UnreachableArm = &Analyzer{
+	Name: "unreachable-arm",
+	Doc:  "a match arm or pattern that an earlier arm always takes first",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			if me, ok := n.(*ast.MatchExpression); ok {
+				checkArms(pass, me)
+			}
+			return true
+		})
+	},
+}
+
+var IncompleteMatch = &Analyzer{
+	Name: "incomplete-match",
+	Doc:  "a match on the variants of an enum that leaves some out and has no arm for anything else",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			if me, ok := n.(*ast.MatchExpression); ok {
+				checkVariants(pass, me)
+			}
+			return true
+		})
+	},
+}
+
+// checkArms reports the arms after one that matches anything, and the
+// literal, array and hash patterns already matched by an earlier arm. An
+// arm with a guard may fail to take the value, so it hides nothing.
+func checkArms(pass *Pass, me *ast.MatchExpression) {
+	seen := map[interface{}]bool{}
+	var shapes []ast.Pattern
+	for idx, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			key, literal := patternValue(pattern)
+			if !literal && catchAll(pattern) {
+				if arm.Guard == nil && idx+1 < len(me.Arms) {
+					pass.Reportf(me.Arms[idx+1].Pos(), "unreachable match arm")
+					return
+				}
+				continue
+			}
+			if seen[key] || covered(shapes, pattern) {
+				pass.Reportf(pattern.Pos(), "pattern is already matched by an earlier arm")
+			}
+		}
+		if arm.Guard != nil {
+			continue
+		}
+		for _, pattern := range arm.Patterns {
+			if key, literal := patternValue(pattern); literal {
+				seen[key] = true
+			}
+			switch p := pattern.(type) {
+			case *ast.ArrayPattern, *ast.HashPattern:
+				shapes = append(shapes, p.(ast.Pattern))
+			}
+		}
+	}
+}
+
+// covered reports whether one of shapes, the array and hash patterns of
+// earlier arms, matches every value pattern does.
+func covered(shapes []ast.Pattern, pattern ast.Expression) bool {
+	p, ok := pattern.(ast.Pattern)
+	if !ok {
+		return false
+	}
+	for _, shape := range shapes {
+		if covers(shape, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether pattern a matches every value that b does: a
+// name matches anything, an array pattern any array as long and with
+// elements it covers, or longer if it has a ...rest, and a hash pattern any
+// hash with the keys it names.
+func covers(a, b ast.Pattern) bool {
+	switch a := a.(type) {
+	case *ast.Identifier:
+		if a.Pattern != nil {
+			return covers(a.Pattern, b)
+		}
+		return true
+	case *ast.ArrayPattern:
+		b, ok := b.(*ast.ArrayPattern)
+		if !ok || len(b.Elements) < len(a.Elements) {
+			return false
+		}
+		if a.Rest == nil && (b.Rest != nil || len(b.Elements) != len(a.Elements)) {
+			return false
+		}
+		for idx, e := range a.Elements {
+			if !covers(e, b.Elements[idx]) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashPattern:
+		b, ok := b.(*ast.HashPattern)
+		if !ok {
+			return false
+		}
+		keys := map[string]bool{}
+		for _, k := range b.Keys {
+			keys[k.Value] = true
+		}
+		for _, k := range a.Keys {
+			if !keys[k.Value] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// checkVariants reports the variants of an enum that a match whose
+// patterns name them handles in no arm. An arm with a guard handles
+// nothing for sure, nor does a variant pattern whose own patterns may fail.
+func checkVariants(pass *Pass, me *ast.MatchExpression) {
+	var enum *ast.EnumStatement
+	handled := map[string]bool{}
+	for _, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			if catchAll(pattern) {
+				if arm.Guard == nil {
+					return
+				}
+				continue
+			}
+			e, name, all := variantOf(pass, pattern)
+			if e == nil {
+				continue
+			}
+			if enum != nil && e != enum {
+				return // a match on more than one enum is beyond this check
+			}
+			enum = e
+			if arm.Guard == nil && all {
+				handled[name] = true
+			}
+		}
+	}
+	if enum == nil {
+		return
+	}
+
+	var missing []string
+	for _, v := range enum.Variants {
+		if !handled[v.Name.Value] {
+			missing = append(missing, v.Name.Value)
+		}
+	}
+	if len(missing) > 0 {
+		pass.Reportf(me.Pos(), "match on %s does not handle %s", enum.Name.Value, strings.Join(missing, ", "))
+	}
+}
+
+// variantOf returns the enum declaration and variant name a pattern such
+// as Color.Red or Result.Ok(v) names, and whether it matches every value of
+// the variant.
+func variantOf(pass *Pass, pattern ast.Expression) (*ast.EnumStatement, string, bool) {
+	all := true
+	if vp, ok := pattern.(*ast.VariantPattern); ok {
+		for _, p := range vp.Patterns {
+			all = all && catchAll(p)
+		}
+		pattern = vp.Type
+	}
+	me, ok := pattern.(*ast.MemberExpression)
+	if !ok {
+		return nil, "", false
+	}
+	ident, ok := me.Object.(*ast.Identifier)
+	if !ok || pass.scopes.uses[ident] == nil {
+		return nil, "", false
+	}
+	return pass.scopes.uses[ident].enum, me.Member.Value, all
+}
+
+// catchAll reports whether pattern matches any value: _ or a name.
+func catchAll(pattern ast.Expression) bool {
+	_, ok := pattern.(*ast.Identifier)
+	return ok
+}
+
+// patternValue returns the value a literal pattern matches, or for a
+// pattern naming a variant without fields, such as Color.Red, its name.
+func patternValue(pattern ast.Expression) (interface{}, bool) {
+	switch p := pattern.(type) {
+	case *ast.MemberExpression:
+		if ident, ok := p.Object.(*ast.Identifier); ok {
+			return variantPattern{ident.Value, p.Member.Value}, true
+		}
+	case *ast.IntegerLiteral:
+		return p.Value, true
+	case *ast.StringLiteral:
+		return p.Value, true
+	case *ast.BooleanLiteral:
+		return p.Value, true
+	case *ast.NullLiteral:
+		return nullPattern{}, true
+	}
+	return nil, false
+}
+
+// nullPattern is the value patternValue returns for null.
+type nullPattern struct{}
+
+// variantPattern is the value patternValue returns for a variant.
+type variantPattern struct{ enum, variant string }
@@ -0,0 +1,334 @@
+package vet
+
+import (
+	"github.com/afoley/salami-lang/ast"
+)
+
+type bindingKind int
+
+const (
+	variableBinding bindingKind = iota
+	functionBinding
+	parameterBinding
+	importBinding
+	structBinding
+	enumBinding
+)
+
+// binding is one variable slot, found by following the resolver's depth
+// and index annotations.
+type binding struct {
+	name     string
+	kind     bindingKind
+	decls    []*ast.Identifier // every declaration of the slot, in order
+	reads    int
+	exported bool
+	scope    *scope
+
+	// for a slot declared once, as a gorlami or a var holding a gorlami
+	// literal, how many arguments it takes; nil otherwise
+	arity *arity
+
+	// for a slot declared once, as an enum, its declaration; nil otherwise
+	enum *ast.EnumStatement
+}
+
+// arity is how many arguments a gorlami takes: required ones, then
+// optional ones with defaults, then any number more if it is variadic.
+type arity struct {
+	required, optional int
+	variadic           bool
+}
+
+func arityOf(params []*ast.Identifier) *arity {
+	a := &arity{}
+	for _, p := range params {
+		switch {
+		case p.Variadic:
+			a.variadic = true
+		case p.Default != nil:
+			a.optional++
+		default:
+			a.required++
+		}
+	}
+	return a
+}
+
+type scope struct {
+	parent *scope
+	slots  map[int]*binding
+	names  map[string]*binding
+}
+
+// lookup finds name in s or an enclosing scope.
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.parent {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// scopeInfo is shared by every analyzer in a run.
+type scopeInfo struct {
+	bindings []*binding
+	uses     map[*ast.Identifier]*binding
+}
+
+func analyzeScopes(program *ast.Program) *scopeInfo {
+	b := &scopeBuilder{info: &scopeInfo{uses: map[*ast.Identifier]*binding{}}}
+	b.enter()
+	b.statements(program.Statements)
+	return b.info
+}
+
+type scopeBuilder struct {
+	info  *scopeInfo
+	stack []*scope
+}
+
+func (b *scopeBuilder) enter() {
+	s := &scope{slots: map[int]*binding{}, names: map[string]*binding{}}
+	if len(b.stack) > 0 {
+		s.parent = b.stack[len(b.stack)-1]
+	}
+	b.stack = append(b.stack, s)
+}
+
+func (b *scopeBuilder) leave() {
+	b.stack = b.stack[:len(b.stack)-1]
+}
+
+func (b *scopeBuilder) slot(s *scope, ident *ast.Identifier) *binding {
+	bind, ok := s.slots[ident.Index]
+	if !ok {
+		bind = &binding{name: ident.Value, scope: s}
+		s.slots[ident.Index] = bind
+		s.names[ident.Value] = bind
+		b.info.bindings = append(b.info.bindings, bind)
+	}
+	return bind
+}
+
+func (b *scopeBuilder) declare(ident *ast.Identifier, kind bindingKind, arity *arity) *binding {
+	bind := b.slot(b.stack[len(b.stack)-1], ident)
+	if len(bind.decls) == 0 {
+		bind.kind, bind.arity = kind, arity
+	} else {
+		// which declaration a use sees depends on the path
+		bind.arity, bind.enum = nil, nil
+	}
+	bind.decls = append(bind.decls, ident)
+	return bind
+}
+
+// declareNames declares ident, or for the name standing in for a
+// destructuring pattern, each name in the pattern instead.
+func (b *scopeBuilder) declareNames(ident *ast.Identifier, kind bindingKind, arity *arity) {
+	if ident.Pattern == nil {
+		b.declare(ident, kind, arity)
+		return
+	}
+	for _, name := range ast.PatternNames(ident) {
+		b.declare(name, kind, nil)
+	}
+}
+
+func (b *scopeBuilder) use(ident *ast.Identifier) {
+	if !ident.Resolved || ident.Depth >= len(b.stack) {
+		return
+	}
+	bind := b.slot(b.stack[len(b.stack)-1-ident.Depth], ident)
+	bind.reads++
+	b.info.uses[ident] = bind
+}
+
+func (b *scopeBuilder) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		b.node(stmt)
+	}
+}
+
+// function walks a gorlami, or a method if receiver is not nil.
+func (b *scopeBuilder) function(receiver *ast.Identifier, params []*ast.Identifier, body *ast.BlockStatement) {
+	b.enter()
+	for _, p := range params {
+		if p.Default != nil {
+			b.node(p.Default)
+		}
+		b.declareNames(p, parameterBinding, nil)
+	}
+	if receiver != nil {
+		b.declare(receiver, parameterBinding, nil)
+	}
+	b.statements(body.Statements)
+	b.leave()
+}
+
+// pattern declares the names a match pattern binds and uses those of the
+// variants it names.
+func (b *scopeBuilder) pattern(pattern ast.Expression) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if name := ast.Binding(p); name != nil {
+			b.declare(name, variableBinding, nil)
+		}
+	case *ast.MemberExpression:
+		b.node(p)
+	case *ast.VariantPattern:
+		b.node(p.Type)
+		for _, sub := range p.Patterns {
+			b.pattern(sub)
+		}
+	case *ast.ArrayPattern, *ast.HashPattern:
+		for _, name := range ast.PatternNames(p.(ast.Pattern)) {
+			b.declare(name, variableBinding, nil)
+		}
+	}
+}
+
+func (b *scopeBuilder) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.VarStatement:
+		b.node(node.Value)
+		var arity *arity
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			arity = arityOf(fn.Parameters)
+		}
+		b.declareNames(node.Name, variableBinding, arity)
+
+	case *ast.FunctionStatement:
+		// a method's name is not declared in any scope
+		if node.Receiver != nil {
+			b.use(node.ReceiverType)
+		} else {
+			b.declare(node.Name, functionBinding, arityOf(node.Parameters))
+		}
+		b.function(node.Receiver, node.Parameters, node.Body)
+
+	case *ast.FunctionLiteral:
+		b.function(nil, node.Parameters, node.Body)
+
+	case *ast.StructStatement:
+		b.declare(node.Name, structBinding, nil)
+
+	case *ast.EnumStatement:
+		if bind := b.declare(node.Name, enumBinding, nil); len(bind.decls) == 1 {
+			bind.enum = node
+		}
+
+	case *ast.StructLiteral:
+		b.node(node.Type)
+		for _, v := range node.Values {
+			b.node(v)
+		}
+
+	case *ast.AssignStatement:
+		b.node(node.Target)
+		b.node(node.Value)
+
+	case *ast.ImportStatement:
+		b.declare(node.Alias, importBinding, nil)
+
+	case *ast.ExportStatement:
+		b.node(node.Declaration)
+		if name := node.Name(); name != nil {
+			b.slot(b.stack[len(b.stack)-1], name).exported = true
+		}
+
+	case *ast.ReturnStatement:
+		b.node(node.ReturnValue)
+
+	case *ast.ExitStatement:
+		b.node(node.Value)
+
+	case *ast.ThrowStatement:
+		b.node(node.Value)
+
+	case *ast.YieldStatement:
+		b.node(node.Value)
+
+	case *ast.ForStatement:
+		b.node(node.Iterable)
+		b.declareNames(node.Name, variableBinding, nil)
+		b.node(node.Body)
+
+	case *ast.TryStatement:
+		b.node(node.Body)
+		if node.Catch != nil {
+			b.declare(node.Param, variableBinding, nil)
+			b.node(node.Catch)
+		}
+		if node.Finally != nil {
+			b.node(node.Finally)
+		}
+
+	case *ast.ExpressionStatement:
+		b.node(node.Expression)
+
+	case *ast.IfExpression:
+		b.node(node.Condition)
+		b.node(node.Consequence)
+		if node.Alternative != nil {
+			b.node(node.Alternative)
+		}
+
+	case *ast.MatchExpression:
+		b.node(node.Value)
+		for _, arm := range node.Arms {
+			for _, p := range arm.Patterns {
+				b.pattern(p)
+			}
+			if arm.Guard != nil {
+				b.node(arm.Guard)
+			}
+			if arm.Body != nil {
+				b.node(arm.Body)
+			} else {
+				b.node(arm.Value)
+			}
+		}
+
+	case *ast.BlockStatement:
+		b.statements(node.Statements)
+
+	case *ast.InfixExpression:
+		b.node(node.Left)
+		b.node(node.Right)
+
+	case *ast.CallExpression:
+		b.node(node.Function)
+		for _, a := range node.Arguments {
+			b.node(a)
+		}
+
+	case *ast.NamedArgument:
+		b.node(node.Value)
+
+	case *ast.SpreadExpression:
+		b.node(node.Value)
+
+	case *ast.MemberExpression:
+		b.node(node.Object)
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			b.node(e)
+		}
+
+	case *ast.HashLiteral:
+		for idx := range node.Keys {
+			b.node(node.Keys[idx])
+			b.node(node.Values[idx])
+		}
+
+	case *ast.IndexExpression:
+		b.node(node.Left)
+		b.node(node.Index)
+
+	case *ast.Identifier:
+		b.use(node)
+	}
+}
@@ -0,0 +1,49 @@
+package vet
+
+import "strings"
+
+var UnusedVariable = &Analyzer{
+	Name: "unused-variable",
+	Doc:  "a var that is never read; exported globals and names starting with _ are exempt",
+	Run: func(pass *Pass) {
+		for _, b := range pass.scopes.bindings {
+			if b.kind == variableBinding && unused(b) {
+				pass.Reportf(b.decls[0].Pos(), "%s declared and not used", b.name)
+			}
+		}
+	},
+}
+
+var UnusedParameter = &Analyzer{
+	Name: "unused-parameter",
+	Doc:  "a gorlami parameter that is never read; names starting with _ are exempt",
+	Run: func(pass *Pass) {
+		for _, b := range pass.scopes.bindings {
+			if b.kind == parameterBinding && unused(b) {
+				pass.Reportf(b.decls[0].Pos(), "parameter %s is not used", b.name)
+			}
+		}
+	},
+}
+
+func unused(b *binding) bool {
+	return len(b.decls) > 0 && b.reads == 0 && !b.exported && !strings.HasPrefix(b.name, "_")
+}
+
+var Shadow = &Analyzer{
+	Name: "shadow",
+	Doc:  "a declaration inside a gorlami that hides a name from an enclosing scope",
+	Run: func(pass *Pass) {
+		for _, b := range pass.scopes.bindings {
+			if b.scope.parent == nil || len(b.decls) == 0 {
+				continue
+			}
+			outer := b.scope.parent.lookup(b.name)
+			if outer == nil || len(outer.decls) == 0 {
+				continue
+			}
+			decl := outer.decls[0].Pos()
+			pass.Reportf(b.decls[0].Pos(), "%s shadows the declaration at %d:%d", b.name, decl.Line, decl.Column)
+		}
+	},
+}
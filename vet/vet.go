@@ -0,0 +1,152 @@
+// Package vet finds code in salami programs that runs but is probably
+// wrong. Each check is an Analyzer, identified by a stable rule ID; Run
+// applies a set of them to a parsed and resolved program.
+//
+// A finding can be suppressed with a comment naming its rule, either at the
+// end of the line it is reported on or on the line above:
+//
+//	// vet:ignore unused-variable
+//	var scratch = setup();
+//
+// Several rules may be listed, separated by commas. vet:ignore-file
+// suppresses rules for the whole file.
+package vet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/afoley/salami-lang/ast"
+	"github.com/afoley/salami-lang/tok"
+)
+
+// Analyzer is one check.
+type Analyzer struct {
+	Name string // the rule ID, used to report and suppress findings
+	Doc  string
+	Run  func(*Pass)
+}
+
+// Pass is what an analyzer sees while checking one program.
+type Pass struct {
+	Analyzer *Analyzer
+	Program  *ast.Program
+
+	scopes *scopeInfo
+	report func(Diagnostic)
+}
+
+// Reportf records a finding at pos under the analyzer's rule.
+func (p *Pass) Reportf(pos tok.Position, format string, args ...interface{}) {
+	p.report(Diagnostic{Pos: pos, Rule: p.Analyzer.Name, Message: fmt.Sprintf(format, args...)})
+}
+
+// Diagnostic is one finding.
+type Diagnostic struct {
+	Pos     tok.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s [%s]", d.Pos.Line, d.Pos.Column, d.Message, d.Rule)
+}
+
+// Analyzers lists every check, in the order their rules are documented.
+var Analyzers = []*Analyzer{
+	UnusedVariable,
+	UnusedParameter,
+	Unreachable,
+	Shadow,
+	Arity,
+	ConstantCondition,
+	DivideByZero,
+	MissingReturn,
+	UnreachableArm,
+	IncompleteMatch,
+}
+
+// Lookup returns the analyzer for a rule ID, or nil.
+func Lookup(rule string) *Analyzer {
+	for _, a := range Analyzers {
+		if a.Name == rule {
+			return a
+		}
+	}
+	return nil
+}
+
+// Run applies analyzers to program, which must already be resolved, and
+// returns their findings in source order, less any suppressed by comments.
+func Run(program *ast.Program, analyzers []*Analyzer) []Diagnostic {
+	ignored := suppressions(program.Comments)
+	scopes := analyzeScopes(program)
+
+	var diags []Diagnostic
+	for _, a := range analyzers {
+		pass := &Pass{Analyzer: a, Program: program, scopes: scopes}
+		pass.report = func(d Diagnostic) {
+			if !ignored.suppresses(d) {
+				diags = append(diags, d)
+			}
+		}
+		a.Run(pass)
+	}
+
+	sort.SliceStable(diags, func(a, b int) bool {
+		if diags[a].Pos.Line != diags[b].Pos.Line {
+			return diags[a].Pos.Line < diags[b].Pos.Line
+		}
+		return diags[a].Pos.Column < diags[b].Pos.Column
+	})
+	return diags
+}
+
+type ignoreSet struct {
+	file  map[string]bool
+	lines map[int]map[string]bool
+}
+
+func (s ignoreSet) suppresses(d Diagnostic) bool {
+	return s.file[d.Rule] || s.lines[d.Pos.Line][d.Rule]
+}
+
+// suppressions reads the vet:ignore and vet:ignore-file comments.
+func suppressions(comments []tok.Comment) ignoreSet {
+	s := ignoreSet{file: map[string]bool{}, lines: map[int]map[string]bool{}}
+
+	for _, c := range comments {
+		fields := strings.Fields(strings.TrimPrefix(c.Text, "//"))
+		if len(fields) < 2 {
+			continue
+		}
+
+		var rules []string
+		for _, r := range strings.Split(fields[1], ",") {
+			if r != "" {
+				rules = append(rules, r)
+			}
+		}
+
+		switch fields[0] {
+		case "vet:ignore-file":
+			for _, r := range rules {
+				s.file[r] = true
+			}
+		case "vet:ignore":
+			// the comment's own line, for a trailing comment, and the next,
+			// for one on a line of its own
+			for _, line := range []int{c.Pos.Line, c.Pos.Line + 1} {
+				if s.lines[line] == nil {
+					s.lines[line] = map[string]bool{}
+				}
+				for _, r := range rules {
+					s.lines[line][r] = true
+				}
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,158 @@
+package vet_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/afoley/salami-lang/lexer"
+	"github.com/afoley/salami-lang/parser"
+	"github.com/afoley/salami-lang/resolver"
+	"github.com/afoley/salami-lang/vet"
+)
+
+func run(t *testing.T, src string, analyzers ...*vet.Analyzer) []vet.Diagnostic {
+	t.Helper()
+	p := parser.New(lexer.NewLexer(strings.NewReader(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v\n%s", errs, src)
+	}
+	if errs := resolver.Resolve(program); len(errs) != 0 {
+		t.Fatalf("resolver errors: %v\n%s", errs, src)
+	}
+	return vet.Run(program, analyzers)
+}
+
+// Each rule with a program it reports once, on line, with a message
+// containing want.
+var rules = []struct {
+	rule string
+	src  string
+	line int
+	want string
+}{
+	{"unused-variable", `gorlami f() {
+    var scratch = 1;
+    dicocco 2;
+}
+f();
+`, 2, "scratch"},
+	{"unused-parameter", `gorlami f(a, b) {
+    dicocco a;
+}
+f(1, 2);
+`, 1, "b"},
+	{"unreachable", `gorlami f() {
+    dicocco 1;
+    f();
+}
+f();
+`, 3, "unreachable"},
+	{"shadow", `var total = 1;
+gorlami f() {
+    var total = 2;
+    dicocco total;
+}
+exit f() + total;
+`, 3, "total"},
+	{"arity", `gorlami f(a, b) {
+    dicocco a + b;
+}
+f(1);
+`, 4, "f"},
+	{"constant-condition", `gorlami f(n) {
+    if (true) {
+        dicocco n;
+    }
+    dicocco 0;
+}
+f(1);
+`, 2, "true"},
+	{"divide-by-zero", `gorlami f(n) {
+    dicocco n / 0;
+}
+f(1);
+`, 2, "zero"},
+	{"missing-return", `gorlami f(n) {
+    if (n > 0) {
+        dicocco n;
+    }
+}
+f(1);
+`, 5, "f"},
+	{"unreachable-arm", `gorlami f(n) {
+    dicocco match (n) {
+        _ => 1,
+        2 => 2,
+    };
+}
+f(1);
+`, 4, ""},
+	{"incomplete-match", `enum Color { Red, Green, Blue }
+gorlami f(c) {
+    dicocco match (c) {
+        Color.Red => 1,
+        Color.Green => 2,
+    };
+}
+f(Color.Red);
+`, 3, "Blue"},
+}
+
+func TestRules(t *testing.T) {
+	if len(rules) != len(vet.Analyzers) {
+		t.Errorf("%d rules tested, want one case for each of the %d analyzers", len(rules), len(vet.Analyzers))
+	}
+	for _, tc := range rules {
+		t.Run(tc.rule, func(t *testing.T) {
+			a := vet.Lookup(tc.rule)
+			if a == nil {
+				t.Fatalf("no analyzer for %s", tc.rule)
+			}
+
+			// Every analyzer runs, so the programs show that only the rule
+			// being tested fires.
+			diags := run(t, tc.src, vet.Analyzers...)
+			if len(diags) != 1 || diags[0].Rule != tc.rule || diags[0].Pos.Line != tc.line || !strings.Contains(diags[0].Message, tc.want) {
+				t.Fatalf("got %v, want one %s finding on line %d mentioning %q", diags, tc.rule, tc.line, tc.want)
+			}
+
+			lines := strings.SplitAfter(tc.src, "\n")
+			above := strings.Join(lines[:tc.line-1], "") + "// vet:ignore " + tc.rule + "\n" + strings.Join(lines[tc.line-1:], "")
+			trailing := strings.Join(lines[:tc.line-1], "") + strings.TrimSuffix(lines[tc.line-1], "\n") + " // vet:ignore shadow," + tc.rule + "\n" + strings.Join(lines[tc.line:], "")
+			file := "// vet:ignore-file " + tc.rule + "\n" + tc.src
+			for name, src := range map[string]string{"the line above": above, "the same line": trailing, "the file": file} {
+				if diags := run(t, src, vet.Analyzers...); len(diags) != 0 {
+					t.Errorf("ignored on %s: got %v\n%s", name, diags, src)
+				}
+			}
+		})
+	}
+}
+
+// A vet:ignore comment only covers the rules it names, on its own line and
+// the next.
+func TestIgnoreScope(t *testing.T) {
+	src := `// vet:ignore unused-parameter
+gorlami f(a) {
+    var x = 1;
+    var y = 2;
+    dicocco 0;
+}
+
+// vet:ignore unused-variable
+f(1);
+`
+	var got []string
+	for _, d := range run(t, src, vet.Analyzers...) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"3:9: x declared and not used [unused-variable]",
+		"4:9: y declared and not used [unused-variable]",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
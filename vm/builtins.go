@@ -0,0 +1,161 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// Builtin is the value behind a BuiltinValue, a function implemented in Go.
+// It behaves as the interpreter's builtin of the same name.
+type Builtin struct {
+	Name string
+	Fn   func(vm *VM, args []Value) (Value, error)
+}
+
+// builtins holds the VM's builtin for each name of code.Builtins, at the
+// same index.
+var builtins = make([]*Builtin, len(code.Builtins))
+
+func init() {
+	fns := map[string]func(vm *VM, args []Value) (Value, error){
+		"assert":    builtinAssert,
+		"assert_eq": builtinAssertEq,
+		"bool":      builtinBool,
+		"len":       builtinLen,
+		"next":      builtinNext,
+		"range":     builtinRange,
+		"map":       builtinMap,
+		"filter":    builtinFilter,
+		"take":      builtinTake,
+		"zip":       builtinZip,
+	}
+	for idx, name := range code.Builtins {
+		fn, ok := fns[name]
+		if !ok {
+			panic("vm: no builtin " + name)
+		}
+		builtins[idx] = &Builtin{Name: name, Fn: fn}
+	}
+}
+
+func (b *Builtin) native() *interpreter.Builtin {
+	return interpreter.StandardBuiltin(b.Name)
+}
+
+// callBuiltin pops the numArgs arguments on top of the stack and the
+// builtin below them, and pushes what the builtin returns.
+func (vm *VM) callBuiltin(numArgs int, named *Hash) error {
+	b := vm.stack[vm.sp-1-numArgs].Ref.(*Builtin)
+	if named != nil && len(named.keys) > 0 {
+		return fmt.Errorf("%s takes no named arguments", b.Name)
+	}
+	args := make([]Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs + 1
+	result, err := b.Fn(vm, args)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+// call calls fn, a function, builtin or variant, with args on behalf of a
+// builtin and returns its result. A function runs on vm's stack, in a run
+// of its own that returns when the function does.
+func (vm *VM) call(fn Value, args []Value) (Value, error) {
+	if fn.Kind != ClosureValue && fn.Kind != BuiltinValue && fn.Kind != VariantValue {
+		return Null, fmt.Errorf("calling non-function %s", inspect(fn))
+	}
+	if err := vm.reserve(vm.sp + 1 + len(args)); err != nil {
+		return Null, err
+	}
+	vm.stack[vm.sp] = fn
+	copy(vm.stack[vm.sp+1:], args)
+	vm.sp += 1 + len(args)
+
+	if vm.inPlace(len(args)) {
+		if err := vm.callFunction(len(args), nil); err != nil {
+			return Null, err
+		}
+		return vm.pop(), nil
+	}
+
+	if vm.runs >= MaxRuns {
+		return Null, fmt.Errorf("stack overflow")
+	}
+	stop := vm.stop
+	vm.stop = len(vm.frames)
+	vm.runs++
+	defer func() { vm.stop, vm.runs = stop, vm.runs-1 }()
+	if err := vm.callFunction(len(args), nil); err != nil {
+		return Null, err
+	}
+	if vm.Tracer != nil {
+		vm.Tracer.Enter(vm.frames[len(vm.frames)-1].cl.Fn)
+	}
+	err := vm.run()
+	for err != nil && vm.catch(err) {
+		err = vm.run()
+	}
+	if err != nil || vm.Exited {
+		return Null, err
+	}
+	return vm.pop(), nil
+}
+
+func checkArgs(name string, args []Value, want int) error {
+	if len(args) != want {
+		return fmt.Errorf("%s: want %d arguments, got %d", name, want, len(args))
+	}
+	return nil
+}
+
+// inspect renders v as the interpreter does in its error messages.
+func inspect(v Value) string {
+	return interpreter.Inspect(v.Native())
+}
+
+func builtinAssert(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("assert", args, 1); err != nil {
+		return Null, err
+	}
+	if args[0].Kind != BooleanValue || !args[0].Bool() {
+		return Null, fmt.Errorf("assertion failed: %s", inspect(args[0]))
+	}
+	return True, nil
+}
+
+func builtinAssertEq(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("assert_eq", args, 2); err != nil {
+		return Null, err
+	}
+	got, want := args[0].Native(), args[1].Native()
+	if !interpreter.Equal(got, want) {
+		return Null, fmt.Errorf("assert_eq: got %s, want %s", interpreter.Inspect(got), interpreter.Inspect(want))
+	}
+	return True, nil
+}
+
+func builtinBool(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("bool", args, 1); err != nil {
+		return Null, err
+	}
+	return Boolean(args[0].Truthy()), nil
+}
+
+func builtinLen(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("len", args, 1); err != nil {
+		return Null, err
+	}
+	switch args[0].Kind {
+	case ArrayValue:
+		return Integer(int64(len(args[0].Ref.(*Array).Elements))), nil
+	case HashValue:
+		return Integer(int64(len(args[0].Ref.(*Hash).keys))), nil
+	case StringValue:
+		return Integer(int64(len(args[0].Ref.(string)))), nil
+	}
+	return Null, fmt.Errorf("len: cannot take the length of %s", inspect(args[0]))
+}
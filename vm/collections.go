@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// Array is the value behind an ArrayValue.
+type Array struct {
+	Elements []Value
+}
+
+// Hash is the value behind a HashValue. A key is an integer, string or
+// boolean Value, which compare equal exactly when the values are the same.
+type Hash struct {
+	keys  []Value
+	pairs map[Value]Value
+}
+
+func newHash() *Hash {
+	return &Hash{pairs: map[Value]Value{}}
+}
+
+func (h *Hash) set(key, value Value) {
+	if _, ok := h.pairs[key]; !ok {
+		h.keys = append(h.keys, key)
+	}
+	h.pairs[key] = value
+}
+
+func hashKey(v Value) bool {
+	switch v.Kind {
+	case IntegerValue, BooleanValue, StringValue:
+		return true
+	}
+	return false
+}
+
+func (a *Array) native() *interpreter.Array {
+	elements := make([]interface{}, len(a.Elements))
+	for idx, e := range a.Elements {
+		elements[idx] = e.Native()
+	}
+	return &interpreter.Array{Elements: elements}
+}
+
+func (h *Hash) native() *interpreter.Hash {
+	hash := interpreter.NewHash()
+	for _, k := range h.keys {
+		hash.Set(k.Native(), h.pairs[k].Native())
+	}
+	return hash
+}
+
+func (vm *VM) buildArray(n int) error {
+	elements := make([]Value, n)
+	copy(elements, vm.stack[vm.sp-n:vm.sp])
+	vm.sp -= n
+	return vm.push(Value{Kind: ArrayValue, Ref: &Array{Elements: elements}})
+}
+
+func (vm *VM) buildHash(n int) error {
+	hash := newHash()
+	pairs := vm.stack[vm.sp-2*n : vm.sp]
+	for idx := 0; idx < len(pairs); idx += 2 {
+		if !hashKey(pairs[idx]) {
+			return fmt.Errorf("unusable as hash key: %v", pairs[idx])
+		}
+		hash.set(pairs[idx], pairs[idx+1])
+	}
+	vm.sp -= 2 * n
+	return vm.push(Value{Kind: HashValue, Ref: hash})
+}
+
+func (vm *VM) executeIndex() error {
+	index := vm.pop()
+	left := vm.pop()
+
+	switch left.Kind {
+	case ArrayValue:
+		elements := left.Ref.(*Array).Elements
+		if index.Kind != IntegerValue {
+			return fmt.Errorf("array index must be an integer, got %v", index)
+		}
+		if index.Int < 0 || index.Int >= int64(len(elements)) {
+			return vm.push(Null)
+		}
+		return vm.push(elements[index.Int])
+	case HashValue:
+		if !hashKey(index) {
+			return fmt.Errorf("unusable as hash key: %v", index)
+		}
+		if v, ok := left.Ref.(*Hash).pairs[index]; ok {
+			return vm.push(v)
+		}
+		return vm.push(Null)
+	}
+	return fmt.Errorf("cannot index %v", left)
+}
+
+// isArray pops a value and reports whether destructureArray would take it
+// apart into n elements, and the rest if rest is set.
+func (vm *VM) isArray(n int, rest bool) bool {
+	value := vm.pop()
+	if value.Kind != ArrayValue {
+		return false
+	}
+	length := len(value.Ref.(*Array).Elements)
+	return length == n || rest && length > n
+}
+
+// hasKeys pops n keys and a value and reports whether the value is a hash
+// with all of them.
+func (vm *VM) hasKeys(n int) bool {
+	keys := vm.stack[vm.sp-n : vm.sp]
+	vm.sp -= n
+	value := vm.pop()
+	if value.Kind != HashValue {
+		return false
+	}
+	for _, k := range keys {
+		if _, ok := value.Ref.(*Hash).pairs[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (vm *VM) destructureArray(n int, rest bool) error {
+	value := vm.pop()
+	if value.Kind != ArrayValue {
+		return fmt.Errorf("cannot destructure %v as an array", value)
+	}
+	elements := value.Ref.(*Array).Elements
+	if !rest && len(elements) != n {
+		return fmt.Errorf("cannot destructure an array of length %d into %d elements", len(elements), n)
+	}
+	if rest && len(elements) < n {
+		return fmt.Errorf("cannot destructure an array of length %d into at least %d elements", len(elements), n)
+	}
+
+	if err := vm.reserve(vm.sp + n + 1); err != nil {
+		return err
+	}
+	if rest {
+		tail := append([]Value{}, elements[n:]...)
+		vm.push(Value{Kind: ArrayValue, Ref: &Array{Elements: tail}})
+	}
+	for idx := n - 1; idx >= 0; idx-- {
+		vm.push(elements[idx])
+	}
+	return nil
+}
+
+func (vm *VM) destructureHash(n int, rest bool) error {
+	keys := append([]Value{}, vm.stack[vm.sp-n:vm.sp]...)
+	vm.sp -= n
+	value := vm.pop()
+	if value.Kind != HashValue {
+		return fmt.Errorf("cannot destructure %v as a hash", value)
+	}
+	hash := value.Ref.(*Hash)
+
+	values := make([]Value, n)
+	for idx, k := range keys {
+		v, ok := hash.pairs[k]
+		if !ok {
+			return fmt.Errorf("cannot destructure a hash without the key %q", k.Ref)
+		}
+		values[idx] = v
+	}
+
+	if err := vm.reserve(vm.sp + n + 1); err != nil {
+		return err
+	}
+	if rest {
+		taken := map[Value]bool{}
+		for _, k := range keys {
+			taken[k] = true
+		}
+		others := newHash()
+		for _, k := range hash.keys {
+			if !taken[k] {
+				others.set(k, hash.pairs[k])
+			}
+		}
+		vm.push(Value{Kind: HashValue, Ref: others})
+	}
+	for idx := n - 1; idx >= 0; idx-- {
+		vm.push(values[idx])
+	}
+	return nil
+}
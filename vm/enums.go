@@ -0,0 +1,141 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// EnumType is the value behind an EnumTypeValue: what an enum declaration
+// binds its name to.
+type EnumType struct {
+	Name     string
+	Variants []*Variant
+
+	native *interpreter.Enum // made once, so that Native keeps variants apart
+}
+
+// Variant is the value behind a VariantValue, a variant with fields that
+// is called to make a value of it. A variant without fields has a single
+// value, Value, instead.
+type Variant struct {
+	Type   *EnumType
+	Name   string
+	Fields []string
+	Value  *Enum // nil if the variant has fields
+
+	index int
+}
+
+// Enum is the value behind an EnumValue, with one value per field of its
+// variant.
+type Enum struct {
+	Variant *Variant
+	Values  []Value
+}
+
+func (t *EnumType) toNative() *interpreter.Enum {
+	if t.native == nil {
+		names := make([]string, len(t.Variants))
+		fields := make([][]string, len(t.Variants))
+		for idx, v := range t.Variants {
+			names[idx], fields[idx] = v.Name, v.Fields
+		}
+		t.native = interpreter.NewEnum(t.Name, names, fields)
+	}
+	return t.native
+}
+
+func (v *Variant) toNative() *interpreter.Variant {
+	return v.Type.toNative().Variants[v.index]
+}
+
+func (e *Enum) native() *interpreter.EnumValue {
+	variant := e.Variant.toNative()
+	if variant.Value != nil {
+		return variant.Value
+	}
+	values := make([]interface{}, len(e.Values))
+	for idx, v := range e.Values {
+		values[idx] = v.Native()
+	}
+	return &interpreter.EnumValue{Variant: variant, Values: values}
+}
+
+// buildEnum pops n pairs of a variant name and an array of its field
+// names, or null for none, and pushes an enum of them named name.
+func (vm *VM) buildEnum(name string, n int) error {
+	t := &EnumType{Name: name}
+	pairs := vm.stack[vm.sp-2*n : vm.sp]
+	for idx := 0; idx < len(pairs); idx += 2 {
+		v := &Variant{Type: t, Name: pairs[idx].Ref.(string), index: len(t.Variants)}
+		if pairs[idx+1].Kind == NullValue {
+			v.Value = &Enum{Variant: v}
+		} else {
+			for _, f := range pairs[idx+1].Ref.(*Array).Elements {
+				v.Fields = append(v.Fields, f.Ref.(string))
+			}
+		}
+		t.Variants = append(t.Variants, v)
+	}
+	vm.sp -= 2 * n
+	return vm.push(Value{Kind: EnumTypeValue, Ref: t})
+}
+
+// callVariant pops the numArgs arguments on top of the stack and the
+// variant below them, and pushes a value of the variant made of them.
+func (vm *VM) callVariant(numArgs int, named *Hash) error {
+	v := vm.stack[vm.sp-1-numArgs].Ref.(*Variant)
+	if named != nil && len(named.keys) > 0 {
+		return fmt.Errorf("%s.%s takes no named arguments", v.Type.Name, v.Name)
+	}
+	if numArgs != len(v.Fields) {
+		return fmt.Errorf("%s.%s: want %d arguments, got %d", v.Type.Name, v.Name, len(v.Fields), numArgs)
+	}
+	values := make([]Value, numArgs)
+	copy(values, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs + 1
+	return vm.push(Value{Kind: EnumValue, Ref: &Enum{Variant: v, Values: values}})
+}
+
+// isVariant pops a variant and a value and pushes whether the value is a
+// value of the variant. The pattern that names the variant matches n
+// values, which must be one per field.
+func (vm *VM) isVariant(n int) error {
+	typ := vm.pop()
+	value := vm.pop()
+	if typ.Kind != VariantValue {
+		return fmt.Errorf("%v is not an enum variant with fields", typ)
+	}
+	v := typ.Ref.(*Variant)
+	if n != len(v.Fields) {
+		return fmt.Errorf("pattern for %s.%s: want %d patterns, got %d", v.Type.Name, v.Name, len(v.Fields), n)
+	}
+	return vm.push(Boolean(value.Kind == EnumValue && value.Ref.(*Enum).Variant == v))
+}
+
+// enumMember is the value of t.name: a variant's value if it has no
+// fields, or the variant to call if it has.
+func enumMember(t *EnumType, name string) (Value, error) {
+	for _, v := range t.Variants {
+		if v.Name != name {
+			continue
+		}
+		if v.Value != nil {
+			return Value{Kind: EnumValue, Ref: v.Value}, nil
+		}
+		return Value{Kind: VariantValue, Ref: v}, nil
+	}
+	return Null, fmt.Errorf("%s has no variant %s", t.Name, name)
+}
+
+// enumValueMember is the value of e.name, one of the fields of its
+// variant.
+func enumValueMember(e *Enum, name string) (Value, error) {
+	for idx, f := range e.Variant.Fields {
+		if f == name {
+			return e.Values[idx], nil
+		}
+	}
+	return Null, fmt.Errorf("%s.%s has no field %s", e.Variant.Type.Name, e.Variant.Name, name)
+}
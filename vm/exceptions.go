@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// Error is an error value, raised by a throw or by a failing instruction,
+// as a catch binds it.
+type Error struct {
+	Message string
+	Value   Value
+	Stack   []string // the calls it unwound, innermost first, as "f (line 3)"
+}
+
+func (e *Error) native() *interpreter.Error {
+	return &interpreter.Error{Message: e.Message, Value: e.Value.Native(), Stack: e.Stack}
+}
+
+// thrown is returned from run by OpThrow.
+type thrown struct {
+	err *Error
+}
+
+func (t *thrown) Error() string { return t.err.Message }
+
+// handler is an active try: where to unwind the stack to, and where its
+// catch starts.
+type handler struct {
+	frames int
+	sp     int
+	catch  int
+}
+
+// callStack describes the active calls, innermost first, each at the line it
+// has reached. Those of a generator's body carry on with the calls of
+// whoever resumed it.
+func (vm *VM) callStack() []string {
+	stack := []string{}
+	for ; vm != nil; vm = vm.resumer() {
+		for idx := len(vm.frames) - 1; idx >= 0; idx-- {
+			frame := vm.frames[idx]
+			name := "main"
+			if idx > 0 || vm.gen != nil {
+				name = fnName(frame.cl.Fn)
+			}
+			stack = append(stack, fmt.Sprintf("%s (line %d)", name, frame.cl.Fn.Lines.LineFor(frame.ip)))
+		}
+	}
+	return stack
+}
+
+// resumer is the VM that resumed the generator vm runs, or nil if vm runs
+// no generator.
+func (vm *VM) resumer() *VM {
+	if vm.gen == nil {
+		return nil
+	}
+	return vm.gen.parent
+}
+
+func (vm *VM) throw() error {
+	value := vm.pop()
+	if value.Kind == ErrorValue {
+		return &thrown{value.Ref.(*Error)}
+	}
+	message := value.String()
+	if value.Kind == StringValue {
+		message = value.Ref.(string)
+	}
+	return &thrown{&Error{Message: message, Value: value, Stack: vm.callStack()}}
+}
+
+// catch hands err to the innermost active try, if there is one: it drops
+// the frames and stack above where the try started, pushes the error and
+// continues at the try's catch. A try outside the call a builtin is making
+// is left for whoever runs it.
+func (vm *VM) catch(err error) bool {
+	if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frames <= vm.stop {
+		return false
+	}
+
+	var t *thrown
+	e := &Error{Message: err.Error(), Value: Value{Kind: StringValue, Ref: err.Error()}}
+	if errors.As(err, &t) {
+		e = t.err
+	} else {
+		e.Stack = vm.callStack()
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	if vm.Tracer != nil {
+		for idx := len(vm.frames) - 1; idx >= h.frames; idx-- {
+			vm.Tracer.Exit(vm.frames[idx].cl.Fn)
+		}
+	}
+	vm.frames = vm.frames[:h.frames]
+	vm.sp = h.sp
+	vm.stack[vm.sp] = Value{Kind: ErrorValue, Ref: e}
+	vm.sp++
+	vm.frames[len(vm.frames)-1].ip = h.catch - 1
+	return true
+}
+
+// member is the value of object.name, which only structs, enums and
+// errors have.
+func member(object Value, name string) (Value, error) {
+	switch object.Kind {
+	case StructValue:
+		return structMember(object.Ref.(*Struct), name)
+	case EnumTypeValue:
+		return enumMember(object.Ref.(*EnumType), name)
+	case EnumValue:
+		return enumValueMember(object.Ref.(*Enum), name)
+	case ModuleValue:
+		return moduleMember(object.Ref.(*Module), name)
+	case ErrorValue:
+	default:
+		return Null, fmt.Errorf("cannot access .%s on %v, it is not a struct, enum, module or error", name, object)
+	}
+	e := object.Ref.(*Error)
+	switch name {
+	case "message":
+		return Value{Kind: StringValue, Ref: e.Message}, nil
+	case "value":
+		return e.Value, nil
+	case "stack":
+		stack := make([]Value, len(e.Stack))
+		for idx, s := range e.Stack {
+			stack[idx] = Value{Kind: StringValue, Ref: s}
+		}
+		return Value{Kind: ArrayValue, Ref: &Array{Elements: stack}}, nil
+	}
+	return Null, fmt.Errorf("an error has no member %s", name)
+}
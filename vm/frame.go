@@ -0,0 +1,18 @@
+package vm
+
+import "github.com/afoley/salami-lang/code"
+
+type Frame struct {
+	cl          *Closure
+	ip          int
+	basePointer int
+	line        int // last source line reported to the tracer
+}
+
+func NewFrame(cl *Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,364 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// generators start on a small stack, which grows as any other does: a
+// program can have a lot of them about at once
+const generatorStackSize = 32
+
+// errYield is returned from run by OpYield, which stops the body of a
+// generator until it is resumed.
+var errYield = errors.New("yield")
+
+// Generator is the value behind a GeneratorValue: a lazy sequence of
+// values, what calling a function that yields returns, or what range, map,
+// filter, take and zip make. Each value is worked out only when it is asked
+// for.
+type Generator struct {
+	Name string
+
+	// next returns the next value and true, or false once there are none
+	// left. vm is whoever asks, which runs any calls it takes.
+	next func(vm *VM) (Value, bool, error)
+
+	native *interpreter.Generator // made once, so that Native keeps generators apart
+}
+
+// coroutine runs the body of a generator function on a VM of its own,
+// whose frames and stack keep where the body stopped between values.
+type coroutine struct {
+	name    string
+	vm      *VM
+	parent  *VM   // the VM that last resumed it, whose calls are below its own
+	yielded Value // handed over by the last OpYield
+
+	running, done bool
+}
+
+// generatorError is an error raised in the body of a generator, which
+// carries on in whoever resumed it. Run reports it at line, where it was
+// raised, rather than at the line of the resume.
+type generatorError struct {
+	line int
+	err  error
+}
+
+func (e *generatorError) Error() string { return e.err.Error() }
+func (e *generatorError) Unwrap() error { return e.err }
+
+// callGenerator pops the numArgs arguments on top of the stack, already
+// bound to the parameters of cl, and cl below them, and pushes a
+// generator that runs cl's body with them. None of the body runs yet.
+func (vm *VM) callGenerator(cl *Closure, numArgs int) error {
+	child := &VM{
+		constants:      vm.constants,
+		rawConsts:      vm.rawConsts,
+		stack:          make([]Value, generatorStackSize),
+		globals:        vm.globals,
+		Tracer:         vm.Tracer,
+		StrictBooleans: vm.StrictBooleans,
+	}
+	if err := child.reserve(numArgs + 1); err != nil {
+		return err
+	}
+	copy(child.stack, vm.stack[vm.sp-1-numArgs:vm.sp])
+	child.sp = numArgs + 1
+	if err := child.initLocals(1, cl); err != nil {
+		return err
+	}
+	child.frames = []*Frame{NewFrame(cl, 1)}
+
+	co := &coroutine{name: fnName(cl.Fn), vm: child}
+	child.gen = co
+	vm.sp -= numArgs + 1
+	return vm.push(Value{Kind: GeneratorValue, Ref: &Generator{Name: co.name, next: co.resume}})
+}
+
+// resume runs the body for vm from where it stopped to its next yield. It
+// returns the value yielded, or false once the body has finished, which a
+// dicocco or an exit in it does too.
+func (co *coroutine) resume(vm *VM) (Value, bool, error) {
+	if co.done {
+		return Null, false, nil
+	}
+	if co.running {
+		return Null, false, fmt.Errorf("generator %s is already running", co.name)
+	}
+
+	if vm.runs >= MaxRuns {
+		return Null, false, fmt.Errorf("stack overflow")
+	}
+
+	child := co.vm
+	child.runs = vm.runs + 1
+	co.parent, co.running = vm, true
+	if vm.Tracer != nil {
+		vm.Tracer.Enter(child.frames[0].cl.Fn)
+	}
+	err := child.run()
+	for err != nil && err != errYield && child.catch(err) {
+		err = child.run()
+	}
+	co.running = false
+	if vm.Tracer != nil {
+		for idx := len(child.frames) - 1; idx >= 0; idx-- {
+			vm.Tracer.Exit(child.frames[idx].cl.Fn)
+		}
+	}
+
+	switch {
+	case err == errYield:
+		return co.yielded, true, nil
+	case err != nil:
+		co.done = true
+		return Null, false, child.generatorError(err)
+	}
+	co.done = true
+	if child.Exited {
+		vm.ExitCode, vm.Exited = child.ExitCode, true
+	}
+	return Null, false, nil
+}
+
+// generatorError turns err, which the body of the generator vm runs did not
+// catch, into an error for whoever resumed it. The stack of calls it
+// unwound is worked out now, while the body's frames are still there.
+func (vm *VM) generatorError(err error) error {
+	var ge *generatorError
+	if errors.As(err, &ge) {
+		// raised in a generator this one resumed, which has done this
+		return err
+	}
+	var t *thrown
+	if !errors.As(err, &t) {
+		t = &thrown{&Error{Message: err.Error(), Value: Value{Kind: StringValue, Ref: err.Error()}, Stack: vm.callStack()}}
+	}
+	frame := vm.frames[len(vm.frames)-1]
+	return &generatorError{line: frame.cl.Fn.Lines.LineFor(frame.ip), err: t}
+}
+
+// yield pops the value to hand to whoever resumed the generator vm runs.
+func (vm *VM) yield() error {
+	if vm.gen == nil {
+		return fmt.Errorf("yield outside of a generator")
+	}
+	vm.gen.yielded = vm.pop()
+	return errYield
+}
+
+// iterator is the value behind an IteratorValue, which a for keeps on the
+// stack while it runs.
+type iterator struct {
+	next func(vm *VM) (Value, bool, error)
+}
+
+// iter pops an array, hash or generator and pushes an iterator over it.
+func (vm *VM) iter() error {
+	next, err := iterate(vm.pop())
+	if err != nil {
+		return err
+	}
+	return vm.push(Value{Kind: IteratorValue, Ref: &iterator{next: next}})
+}
+
+// iterate returns a function that returns the values of value one by one:
+// the elements of an array, the keys of a hash or the values of a
+// generator. Anything else is an error.
+func iterate(value Value) (func(vm *VM) (Value, bool, error), error) {
+	switch value.Kind {
+	case ArrayValue:
+		array, idx := value.Ref.(*Array), 0
+		return func(*VM) (Value, bool, error) {
+			if idx >= len(array.Elements) {
+				return Null, false, nil
+			}
+			idx++
+			return array.Elements[idx-1], true, nil
+		}, nil
+	case HashValue:
+		hash, idx := value.Ref.(*Hash), 0
+		return func(*VM) (Value, bool, error) {
+			if idx >= len(hash.keys) {
+				return Null, false, nil
+			}
+			idx++
+			return hash.keys[idx-1], true, nil
+		}, nil
+	case GeneratorValue:
+		return value.Ref.(*Generator).next, nil
+	}
+	return nil, fmt.Errorf("%s is not iterable", inspect(value))
+}
+
+func (g *Generator) toNative() *interpreter.Generator {
+	if g.native == nil {
+		g.native = interpreter.NewGenerator(g.Name, nil)
+	}
+	return g.native
+}
+
+// builtinNext returns the next value of a generator. Once there are none
+// left it returns its second argument, if given, and is an error if not.
+func builtinNext(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return Null, fmt.Errorf("next: want 1 or 2 arguments, got %d", len(args))
+	}
+	if args[0].Kind != GeneratorValue {
+		return Null, fmt.Errorf("next: %s is not a generator", inspect(args[0]))
+	}
+	g := args[0].Ref.(*Generator)
+	value, ok, err := g.next(vm)
+	switch {
+	case err != nil || vm.Exited:
+		return Null, err
+	case ok:
+		return value, nil
+	case len(args) == 2:
+		return args[1], nil
+	}
+	return Null, fmt.Errorf("next: generator %s is exhausted", g.Name)
+}
+
+// builtinRange counts from start up to, but not including, stop, by step:
+// range(stop) from 0 by 1, range(start, stop) by 1 or range(start, stop,
+// step). A negative step counts down.
+func builtinRange(vm *VM, args []Value) (Value, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return Null, fmt.Errorf("range: want 1 to 3 arguments, got %d", len(args))
+	}
+	bounds := make([]int64, len(args))
+	for idx, arg := range args {
+		if arg.Kind != IntegerValue {
+			return Null, fmt.Errorf("range: arguments must be integers, got %s", inspect(arg))
+		}
+		bounds[idx] = arg.Int
+	}
+
+	start, stop, step := int64(0), bounds[0], int64(1)
+	if len(bounds) > 1 {
+		start, stop = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		return Null, fmt.Errorf("range: step must not be 0")
+	}
+
+	n := start
+	return Value{Kind: GeneratorValue, Ref: &Generator{Name: "range", next: func(*VM) (Value, bool, error) {
+		if (step > 0 && n >= stop) || (step < 0 && n <= stop) {
+			return Null, false, nil
+		}
+		n += step
+		return Integer(n - step), true, nil
+	}}}, nil
+}
+
+// builtinMap calls a function on each value of an iterable as it is
+// wanted.
+func builtinMap(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("map", args, 2); err != nil {
+		return Null, err
+	}
+	fn := args[0]
+	next, err := iterate(args[1])
+	if err != nil {
+		return Null, err
+	}
+	return Value{Kind: GeneratorValue, Ref: &Generator{Name: "map", next: func(vm *VM) (Value, bool, error) {
+		value, ok, err := next(vm)
+		if !ok || err != nil {
+			return Null, false, err
+		}
+		value, err = vm.call(fn, []Value{value})
+		return value, err == nil && !vm.Exited, err
+	}}}, nil
+}
+
+// builtinFilter keeps the values of an iterable a function is truthy for.
+func builtinFilter(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("filter", args, 2); err != nil {
+		return Null, err
+	}
+	fn := args[0]
+	next, err := iterate(args[1])
+	if err != nil {
+		return Null, err
+	}
+	return Value{Kind: GeneratorValue, Ref: &Generator{Name: "filter", next: func(vm *VM) (Value, bool, error) {
+		for {
+			value, ok, err := next(vm)
+			if !ok || err != nil {
+				return Null, false, err
+			}
+			keep, err := vm.call(fn, []Value{value})
+			if err != nil || vm.Exited {
+				return Null, false, err
+			}
+			if keep.Truthy() {
+				return value, true, nil
+			}
+		}
+	}}}, nil
+}
+
+// builtinTake stops an iterable after its first n values, without asking
+// it for any more.
+func builtinTake(vm *VM, args []Value) (Value, error) {
+	if err := checkArgs("take", args, 2); err != nil {
+		return Null, err
+	}
+	if args[0].Kind != IntegerValue || args[0].Int < 0 {
+		return Null, fmt.Errorf("take: count must be a non-negative integer, got %s", inspect(args[0]))
+	}
+	n := args[0].Int
+	next, err := iterate(args[1])
+	if err != nil {
+		return Null, err
+	}
+	return Value{Kind: GeneratorValue, Ref: &Generator{Name: "take", next: func(vm *VM) (Value, bool, error) {
+		if n == 0 {
+			return Null, false, nil
+		}
+		n--
+		return next(vm)
+	}}}, nil
+}
+
+// builtinZip pairs up the values of its iterables in arrays, one value
+// from each, until the shortest runs out.
+func builtinZip(vm *VM, args []Value) (Value, error) {
+	if len(args) == 0 {
+		return Null, fmt.Errorf("zip: want at least 1 argument, got 0")
+	}
+	nexts := make([]func(*VM) (Value, bool, error), len(args))
+	for idx, arg := range args {
+		next, err := iterate(arg)
+		if err != nil {
+			return Null, err
+		}
+		nexts[idx] = next
+	}
+	done := false
+	return Value{Kind: GeneratorValue, Ref: &Generator{Name: "zip", next: func(vm *VM) (Value, bool, error) {
+		if done {
+			return Null, false, nil
+		}
+		values := make([]Value, len(nexts))
+		for idx, next := range nexts {
+			value, ok, err := next(vm)
+			if !ok || err != nil {
+				done = true
+				return Null, false, err
+			}
+			values[idx] = value
+		}
+		return Value{Kind: ArrayValue, Ref: &Array{Elements: values}}, true, nil
+	}}}, nil
+}
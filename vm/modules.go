@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// Module is the value behind a ModuleValue, what an import binds: the
+// exported globals of one salami file after it has run.
+type Module struct {
+	Path    string
+	Exports map[string]Value
+}
+
+func (m *Module) native() *interpreter.Module {
+	exports := make(map[string]interface{}, len(m.Exports))
+	for name, value := range m.Exports {
+		exports[name] = value.Native()
+	}
+	return &interpreter.Module{Path: m.Path, Exports: exports}
+}
+
+// buildModule pops n pairs of an export's name and value and pushes the
+// module of them for the file at path.
+func (vm *VM) buildModule(path string, n int) error {
+	m := &Module{Path: path, Exports: make(map[string]Value, n)}
+	pairs := vm.stack[vm.sp-2*n : vm.sp]
+	for idx := 0; idx < len(pairs); idx += 2 {
+		m.Exports[pairs[idx].Ref.(string)] = pairs[idx+1]
+	}
+	vm.sp -= 2 * n
+	return vm.push(Value{Kind: ModuleValue, Ref: m})
+}
+
+func moduleMember(m *Module, name string) (Value, error) {
+	value, ok := m.Exports[name]
+	if !ok {
+		return Null, fmt.Errorf("%s does not export %s", filepath.Base(m.Path), name)
+	}
+	return value, nil
+}
@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/code"
+)
+
+// unset fills the slot of a parameter the call left out, until the
+// function's prologue runs the parameter's default. It is a null, so it
+// reads as one if it ever escapes.
+var unset = Value{Kind: NullValue, Int: 1}
+
+// spread pops an array and the array of arguments before it, which the
+// compiler always starts afresh, and pushes the arguments with the
+// elements added.
+func (vm *VM) spread() error {
+	value := vm.pop()
+	if value.Kind != ArrayValue {
+		return fmt.Errorf("cannot spread %v, it is not an array", value)
+	}
+	args := vm.stack[vm.sp-1].Ref.(*Array)
+	args.Elements = append(args.Elements, value.Ref.(*Array).Elements...)
+	return nil
+}
+
+// callWith pops a hash of named arguments and an array of positional ones
+// and calls the function below them.
+func (vm *VM) callWith() error {
+	named := vm.pop().Ref.(*Hash)
+	positional := vm.pop().Ref.(*Array).Elements
+	if err := vm.reserve(vm.sp + len(positional)); err != nil {
+		return err
+	}
+	copy(vm.stack[vm.sp:], positional)
+	vm.sp += len(positional)
+	return vm.callFunction(len(positional), named)
+}
+
+// bindArguments matches the numArgs positional arguments on top of the
+// stack, and any named ones, to the parameters of fn, by the same rules as
+// the interpreter, and replaces them with one value per parameter. It
+// returns the number of parameters.
+func (vm *VM) bindArguments(fn *code.CompiledFunction, numArgs int, named *Hash) (int, error) {
+	fixed := fn.NumParameters
+	if fn.Variadic {
+		fixed--
+	}
+
+	if numArgs > fixed && !fn.Variadic {
+		want := fmt.Sprint(fixed)
+		if fn.NumDefaults > 0 {
+			want = "at most " + want
+		}
+		return 0, fmt.Errorf("too many arguments to %s: want %s, got %d", fnName(fn), want, numArgs)
+	}
+
+	base := vm.sp - numArgs
+	args := make([]Value, fn.NumParameters)
+	given := make([]bool, fn.NumParameters)
+	for idx := 0; idx < fixed && idx < numArgs; idx++ {
+		args[idx], given[idx] = vm.stack[base+idx], true
+	}
+	if fn.Variadic {
+		rest := []Value{}
+		if numArgs > fixed {
+			rest = append(rest, vm.stack[base+fixed:vm.sp]...)
+		}
+		args[fixed] = Value{Kind: ArrayValue, Ref: &Array{Elements: rest}}
+	}
+
+	if named != nil {
+		for _, key := range named.keys {
+			name := key.Ref.(string)
+			idx := -1
+			for pidx, p := range fn.ParameterNames[:fixed] {
+				if p == name {
+					idx = pidx
+				}
+			}
+			switch {
+			case idx < 0 && fn.Variadic && fn.ParameterNames[fixed] == name:
+				return 0, fmt.Errorf("cannot pass ...%s by name", name)
+			case idx < 0:
+				return 0, fmt.Errorf("%s has no parameter %s", fnName(fn), name)
+			case given[idx]:
+				return 0, fmt.Errorf("argument %s given twice in call to %s", name, fnName(fn))
+			}
+			args[idx], given[idx] = named.pairs[key], true
+		}
+	}
+
+	for idx := 0; idx < fixed; idx++ {
+		if given[idx] {
+			continue
+		}
+		if idx < fixed-fn.NumDefaults {
+			return 0, fmt.Errorf("missing argument %s in call to %s", fn.ParameterNames[idx], fnName(fn))
+		}
+		args[idx] = unset
+	}
+
+	if err := vm.reserve(base + len(args)); err != nil {
+		return 0, err
+	}
+	copy(vm.stack[base:], args)
+	vm.sp = base + len(args)
+	return len(args), nil
+}
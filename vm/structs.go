@@ -0,0 +1,131 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+// StructType is the value behind a StructTypeValue: what a struct
+// declaration binds its name to.
+type StructType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]*Closure
+
+	native *interpreter.StructType // made once, so that Native keeps types apart
+}
+
+// Struct is the value behind a StructValue, with one value per field of
+// its type.
+type Struct struct {
+	Type   *StructType
+	Fields []Value
+}
+
+func (t *StructType) field(name string) int {
+	for idx, f := range t.Fields {
+		if f == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (t *StructType) toNative() *interpreter.StructType {
+	if t.native == nil {
+		t.native = &interpreter.StructType{Name: t.Name, Fields: t.Fields, Methods: map[string]*interpreter.Function{}}
+	}
+	return t.native
+}
+
+func (s *Struct) native() *interpreter.Struct {
+	fields := make([]interface{}, len(s.Fields))
+	for idx, f := range s.Fields {
+		fields[idx] = f.Native()
+	}
+	return &interpreter.Struct{Type: s.Type.toNative(), Fields: fields}
+}
+
+// buildStruct pops n field names and pushes a struct of them named name.
+func (vm *VM) buildStruct(name string, n int) error {
+	t := &StructType{Name: name, Fields: make([]string, n), Methods: map[string]*Closure{}}
+	for idx, f := range vm.stack[vm.sp-n : vm.sp] {
+		t.Fields[idx] = f.Ref.(string)
+	}
+	vm.sp -= n
+	return vm.push(Value{Kind: StructTypeValue, Ref: t})
+}
+
+// construct pops n field name and value pairs and the struct below them,
+// and pushes a value of the struct with the fields left out null.
+func (vm *VM) construct(n int) error {
+	typ := vm.stack[vm.sp-2*n-1]
+	if typ.Kind != StructTypeValue {
+		return fmt.Errorf("%v is not a struct", typ)
+	}
+	t := typ.Ref.(*StructType)
+
+	s := &Struct{Type: t, Fields: make([]Value, len(t.Fields))}
+	for idx := range s.Fields {
+		s.Fields[idx] = Null
+	}
+	pairs := vm.stack[vm.sp-2*n : vm.sp]
+	for idx := 0; idx < len(pairs); idx += 2 {
+		name := pairs[idx].Ref.(string)
+		field := t.field(name)
+		if field < 0 {
+			return fmt.Errorf("%s has no field %s", t.Name, name)
+		}
+		s.Fields[field] = pairs[idx+1]
+	}
+	vm.sp -= 2*n + 1
+	return vm.push(Value{Kind: StructValue, Ref: s})
+}
+
+// setMember pops a value and a struct value, sets the struct's field name
+// to the value and pushes the value.
+func (vm *VM) setMember(name string) error {
+	value := vm.pop()
+	object := vm.pop()
+	if object.Kind != StructValue {
+		return fmt.Errorf("cannot set .%s on %v, it is not a struct", name, object)
+	}
+	s := object.Ref.(*Struct)
+	field := s.Type.field(name)
+	if field < 0 {
+		return fmt.Errorf("%s has no field %s", s.Type.Name, name)
+	}
+	s.Fields[field] = value
+	return vm.push(value)
+}
+
+// addMethod pops a closure and the struct below it, adds the closure to
+// the struct as the method name and pushes the closure.
+func (vm *VM) addMethod(name string) error {
+	method := vm.pop()
+	typ := vm.pop()
+	if typ.Kind != StructTypeValue {
+		return fmt.Errorf("cannot declare method %s on %v, it is not a struct", name, typ)
+	}
+	t := typ.Ref.(*StructType)
+	if t.field(name) >= 0 {
+		return fmt.Errorf("%s already has a field %s", t.Name, name)
+	}
+	t.Methods[name] = method.Ref.(*Closure)
+	return vm.push(method)
+}
+
+// structMember is the value of s.name: a field, or a method bound to s.
+func structMember(s *Struct, name string) (Value, error) {
+	if field := s.Type.field(name); field >= 0 {
+		return s.Fields[field], nil
+	}
+	if method, ok := s.Type.Methods[name]; ok {
+		self := Value{Kind: StructValue, Ref: s}
+		bound := *method
+		bound.Receiver = &self
+		return Value{Kind: ClosureValue, Ref: &bound}, nil
+	}
+	return Null, fmt.Errorf("%s has no field or method %s", s.Type.Name, name)
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+type ValueKind uint8
+
+const (
+	NullValue ValueKind = iota
+	IntegerValue
+	BooleanValue
+	StringValue
+	ClosureValue
+	ArrayValue
+	HashValue
+	ErrorValue
+	StructTypeValue
+	StructValue
+	EnumTypeValue
+	VariantValue
+	EnumValue
+	GeneratorValue
+	IteratorValue
+	CellValue
+	BuiltinValue
+	ModuleValue
+)
+
+// Value is an unboxed runtime value. Integers and booleans live in Int so
+// that arithmetic never allocates; everything else hangs off Ref.
+type Value struct {
+	Kind ValueKind
+	Int  int64
+	Ref  interface{}
+}
+
+type Closure struct {
+	Fn   *code.CompiledFunction
+	Free []Value
+
+	// Receiver is the struct a method was read off, which a call binds
+	// in the local slot just after the parameters
+	Receiver *Value
+}
+
+// Cell is the value behind a CellValue: a local that closures capture,
+// which they share with the function it belongs to. Free holds the cells
+// of a closure's free variables.
+type Cell struct {
+	Value Value
+}
+
+var (
+	Null  = Value{Kind: NullValue}
+	True  = Value{Kind: BooleanValue, Int: 1}
+	False = Value{Kind: BooleanValue, Int: 0}
+)
+
+func Integer(v int64) Value {
+	return Value{Kind: IntegerValue, Int: v}
+}
+
+func Boolean(b bool) Value {
+	if b {
+		return True
+	}
+	return False
+}
+
+func (v Value) Bool() bool {
+	return v.Int != 0
+}
+
+// Truthy reports whether v counts as true in a condition, by the same rules
+// as interpreter.Truthy: false, 0, "", null and an empty array or hash are
+// false.
+func (v Value) Truthy() bool {
+	switch v.Kind {
+	case NullValue:
+		return false
+	case IntegerValue, BooleanValue:
+		return v.Int != 0
+	case StringValue:
+		return v.Ref.(string) != ""
+	case ArrayValue:
+		return len(v.Ref.(*Array).Elements) > 0
+	case HashValue:
+		return len(v.Ref.(*Hash).keys) > 0
+	default:
+		return true
+	}
+}
+
+// Native converts v into the plain Go value the tree-walking interpreter
+// would have produced, so both engines can be printed and compared alike.
+func (v Value) Native() interface{} {
+	switch v.Kind {
+	case IntegerValue:
+		return v.Int
+	case BooleanValue:
+		return v.Bool()
+	case StringValue, ClosureValue:
+		return v.Ref
+	case ArrayValue:
+		return v.Ref.(*Array).native()
+	case HashValue:
+		return v.Ref.(*Hash).native()
+	case ErrorValue:
+		return v.Ref.(*Error).native()
+	case StructTypeValue:
+		return v.Ref.(*StructType).toNative()
+	case StructValue:
+		return v.Ref.(*Struct).native()
+	case EnumTypeValue:
+		return v.Ref.(*EnumType).toNative()
+	case VariantValue:
+		return v.Ref.(*Variant).toNative()
+	case EnumValue:
+		return v.Ref.(*Enum).native()
+	case GeneratorValue:
+		return v.Ref.(*Generator).toNative()
+	case BuiltinValue:
+		return v.Ref.(*Builtin).native()
+	case ModuleValue:
+		return v.Ref.(*Module).native()
+	default:
+		return interpreter.NULL
+	}
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%v", v.Native())
+}
+
+func fromConstant(obj interface{}) (Value, error) {
+	switch obj := obj.(type) {
+	case int64:
+		return Integer(obj), nil
+	case string:
+		return Value{Kind: StringValue, Ref: obj}, nil
+	case *code.CompiledFunction:
+		return Value{Kind: ClosureValue, Ref: &Closure{Fn: obj}}, nil
+	default:
+		return Null, fmt.Errorf("unsupported constant %T", obj)
+	}
+}
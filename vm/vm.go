@@ -0,0 +1,772 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/afoley/salami-lang/code"
+	"github.com/afoley/salami-lang/compiler"
+	"github.com/afoley/salami-lang/interpreter"
+)
+
+const (
+	InitialStackSize = 256
+	MaxStackSize     = 1 << 24
+	MaxFrames        = interpreter.MaxCallDepth // so both engines recurse as deep
+
+	// MaxRuns is how deeply the calls builtins make and the resumes of
+	// generators can nest, each in a run of its own on the Go stack.
+	MaxRuns = 1 << 16
+)
+
+type VM struct {
+	constants []Value
+	rawConsts []interface{}
+
+	stack []Value
+	sp    int // always points to the next free slot; top of stack is stack[sp-1]
+
+	globals []Value
+
+	frames   []*Frame
+	handlers []handler // active trys, innermost last
+
+	// stop is the number of frames below those of the call a builtin is
+	// making, if it is making one: run returns once the call does
+	stop int
+	runs int // runs under way, this VM's and those of the VMs resuming it
+
+	gen *coroutine // whose body this VM runs, if it runs one
+
+	result   Value
+	ExitCode int64
+	Exited   bool
+
+	Tracer Tracer // told about calls and lines, for profilers
+
+	// StrictBooleans makes an if condition that is not a boolean an error
+	// rather than true or false by Value.Truthy.
+	StrictBooleans bool
+}
+
+// Tracer observes execution without changing it. Enter and Exit bracket
+// every call of a compiled function (a tail call exits the caller before
+// entering the callee) and Line is called whenever execution moves to a
+// different source line within a function.
+type Tracer interface {
+	Enter(fn *code.CompiledFunction)
+	Exit(fn *code.CompiledFunction)
+	Line(line int)
+}
+
+func New(bytecode *compiler.Bytecode) (*VM, error) {
+	constants := make([]Value, len(bytecode.Constants))
+	for i, c := range bytecode.Constants {
+		v, err := fromConstant(c)
+		if err != nil {
+			return nil, err
+		}
+		constants[i] = v
+	}
+
+	mainFn := &code.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainFrame := NewFrame(&Closure{Fn: mainFn}, 0)
+
+	return &VM{
+		constants: constants,
+		rawConsts: bytecode.Constants,
+		stack:     make([]Value, InitialStackSize),
+		globals:   make([]Value, bytecode.NumGlobals),
+		frames:    []*Frame{mainFrame},
+	}, nil
+}
+
+// Result returns the value of the last statement executed, or the value
+// given to a top level dicocco, as a plain Go value.
+func (vm *VM) Result() interface{} {
+	if vm.Exited {
+		return vm.ExitCode
+	}
+	return vm.result.Native()
+}
+
+// Run executes the bytecode. Runtime errors are reported with the source
+// line of the failing instruction when the bytecode carries a line table,
+// unless a try catches them. Bytecode the compiler did not make, such as
+// a corrupt .salc file that passed salc.Verify, can still pop an empty
+// stack or find the wrong kind of value; the Go runtime error that follows
+// stops the program with an error rather than crashing.
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(runtime.Error)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("invalid bytecode: %v", rerr)
+		}
+	}()
+
+	err = vm.run()
+	for err != nil && vm.catch(err) {
+		err = vm.run()
+	}
+	if err == nil {
+		return nil
+	}
+
+	var ge *generatorError
+	if errors.As(err, &ge) && ge.line > 0 {
+		return fmt.Errorf("line %d: %w", ge.line, ge.err)
+	}
+	frame := vm.frames[len(vm.frames)-1]
+	if line := frame.cl.Fn.Lines.LineFor(frame.ip); line > 0 {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return err
+}
+
+func (vm *VM) run() error {
+	frame := vm.frames[len(vm.frames)-1]
+	ins := frame.Instructions()
+
+	for {
+		frame.ip++
+		if frame.ip >= len(ins) {
+			return nil
+		}
+
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		if vm.Tracer != nil {
+			if line := frame.cl.Fn.Lines.LineFor(ip); line != frame.line && line > 0 {
+				frame.line = line
+				vm.Tracer.Line(line)
+			}
+		}
+
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.push(vm.constants[idx]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.result = vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpGreaterThan, code.OpLessThan:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			if condition.Kind != BooleanValue && vm.StrictBooleans {
+				return fmt.Errorf("if condition must be a boolean, got %v", condition)
+			}
+			if !condition.Truthy() {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if vm.stack[vm.sp-1].Kind == NullValue {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if vm.stack[vm.sp-1].Kind != NullValue {
+				frame.ip = pos - 1
+			} else {
+				vm.sp--
+			}
+
+		case code.OpDup:
+			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+				return err
+			}
+
+		case code.OpEqual:
+			right := vm.pop()
+			left := vm.pop()
+			if err := vm.push(Boolean(left == right)); err != nil {
+				return err
+			}
+
+		case code.OpNoMatch:
+			return fmt.Errorf("no match arm matches %v", vm.pop())
+
+		case code.OpArray, code.OpHash:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			build := vm.buildArray
+			if op == code.OpHash {
+				build = vm.buildHash
+			}
+			if err := build(n); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			if err := vm.executeIndex(); err != nil {
+				return err
+			}
+
+		case code.OpJumpPassed:
+			local := int(code.ReadUint8(ins[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+			value := vm.stack[frame.basePointer+local]
+			if value.Kind == CellValue {
+				value = value.Ref.(*Cell).Value
+			}
+			if value != unset {
+				frame.ip = pos - 1
+			}
+
+		case code.OpTry:
+			catch := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{frames: len(vm.frames), sp: vm.sp, catch: catch})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			return vm.throw()
+
+		case code.OpMember:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			value, err := member(vm.pop(), vm.constants[idx].Ref.(string))
+			if err != nil {
+				return err
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpStruct:
+			idx := code.ReadUint16(ins[ip+1:])
+			n := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			if err := vm.buildStruct(vm.constants[idx].Ref.(string), n); err != nil {
+				return err
+			}
+
+		case code.OpConstruct:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if err := vm.construct(n); err != nil {
+				return err
+			}
+
+		case code.OpSetMember, code.OpMethod:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			set := vm.setMember
+			if op == code.OpMethod {
+				set = vm.addMethod
+			}
+			if err := set(vm.constants[idx].Ref.(string)); err != nil {
+				return err
+			}
+
+		case code.OpEnum:
+			idx := code.ReadUint16(ins[ip+1:])
+			n := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			if err := vm.buildEnum(vm.constants[idx].Ref.(string), n); err != nil {
+				return err
+			}
+
+		case code.OpIsVariant:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			if err := vm.isVariant(n); err != nil {
+				return err
+			}
+
+		case code.OpField:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			e, ok := vm.pop().Ref.(*Enum)
+			if !ok || int(idx) >= len(e.Values) {
+				return fmt.Errorf("no field %d to match", idx)
+			}
+			if err := vm.push(e.Values[idx]); err != nil {
+				return err
+			}
+
+		case code.OpIter:
+			if err := vm.iter(); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			value, ok, err := vm.stack[vm.sp-1].Ref.(*iterator).next(vm)
+			if err != nil {
+				return err
+			}
+			if vm.Exited {
+				return nil
+			}
+			if !ok {
+				vm.sp--
+				frame.ip = pos - 1
+				break
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpYield:
+			return vm.yield()
+
+		case code.OpSpread:
+			if err := vm.spread(); err != nil {
+				return err
+			}
+
+		case code.OpDestructureArray, code.OpDestructureHash:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+2:]) == 1
+			frame.ip += 2
+			destructure := vm.destructureArray
+			if op == code.OpDestructureHash {
+				destructure = vm.destructureHash
+			}
+			if err := destructure(n, rest); err != nil {
+				return err
+			}
+
+		case code.OpIsArray:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+2:]) == 1
+			frame.ip += 2
+			if err := vm.push(Boolean(vm.isArray(n, rest))); err != nil {
+				return err
+			}
+
+		case code.OpHasKeys:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			if err := vm.push(Boolean(vm.hasKeys(n))); err != nil {
+				return err
+			}
+
+		case code.OpSetGlobal:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.result = vm.pop()
+			vm.globals[idx] = vm.result
+
+		case code.OpGetGlobal:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.push(vm.globals[idx]); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.stack[frame.basePointer+int(idx)] = vm.pop()
+
+		case code.OpGetLocal:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(vm.stack[frame.basePointer+int(idx)]); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(frame.cl.Free[idx].Ref.(*Cell).Value); err != nil {
+				return err
+			}
+
+		case code.OpGetFreeCell:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(frame.cl.Free[idx]); err != nil {
+				return err
+			}
+
+		case code.OpMakeCell:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			slot := &vm.stack[frame.basePointer+int(idx)]
+			*slot = Value{Kind: CellValue, Ref: &Cell{Value: *slot}}
+
+		case code.OpGetCell:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(vm.stack[frame.basePointer+int(idx)].Ref.(*Cell).Value); err != nil {
+				return err
+			}
+
+		case code.OpSetCell:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.stack[frame.basePointer+int(idx)].Ref.(*Cell).Value = vm.pop()
+
+		case code.OpGetBuiltin:
+			idx := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(Value{Kind: BuiltinValue, Ref: builtins[idx]}); err != nil {
+				return err
+			}
+
+		case code.OpModule:
+			idx := code.ReadUint16(ins[ip+1:])
+			n := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			if err := vm.buildModule(vm.constants[idx].Ref.(string), n); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(Value{Kind: ClosureValue, Ref: frame.cl}); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIdx := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			if err := vm.pushClosure(int(constIdx), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			inPlace := vm.inPlace(int(numArgs))
+			if err := vm.callFunction(int(numArgs), nil); err != nil {
+				return err
+			}
+			if inPlace {
+				// made a value in place, without a frame, unless a builtin
+				// ran into an exit
+				if vm.Exited {
+					return nil
+				}
+				break
+			}
+			frame = vm.frames[len(vm.frames)-1]
+			ins = frame.Instructions()
+			if vm.Tracer != nil {
+				vm.Tracer.Enter(frame.cl.Fn)
+			}
+
+		case code.OpCallWith:
+			inPlace := vm.inPlace(2)
+			if err := vm.callWith(); err != nil {
+				return err
+			}
+			if inPlace {
+				if vm.Exited {
+					return nil
+				}
+				break
+			}
+			frame = vm.frames[len(vm.frames)-1]
+			ins = frame.Instructions()
+			if vm.Tracer != nil {
+				vm.Tracer.Enter(frame.cl.Fn)
+			}
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			if !vm.inPlace(numArgs) {
+				caller := frame.cl.Fn
+				if err := vm.tailCallFunction(frame, numArgs); err != nil {
+					return err
+				}
+				ins = frame.Instructions()
+				if vm.Tracer != nil {
+					frame.line = 0
+					vm.Tracer.Exit(caller)
+					vm.Tracer.Enter(frame.cl.Fn)
+				}
+				break
+			}
+			// a variant, a builtin or a generator function makes its value
+			// without a frame, which is then returned
+			if err := vm.callFunction(numArgs, nil); err != nil {
+				return err
+			}
+			if vm.Exited {
+				return nil
+			}
+			fallthrough
+
+		case code.OpReturnValue, code.OpReturn:
+			returnValue := Null
+			if op != code.OpReturn {
+				returnValue = vm.pop()
+			}
+
+			if len(vm.frames) == 1 {
+				vm.result = returnValue
+				return nil
+			}
+
+			if vm.Tracer != nil {
+				vm.Tracer.Exit(frame.cl.Fn)
+			}
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.basePointer - 1
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+			if len(vm.frames) == vm.stop {
+				return nil
+			}
+
+			frame = vm.frames[len(vm.frames)-1]
+			ins = frame.Instructions()
+
+		case code.OpExit:
+			val := vm.pop()
+			if val.Kind != IntegerValue {
+				return fmt.Errorf("exit value must be an integer, got %v", val)
+			}
+			vm.ExitCode = val.Int
+			vm.Exited = true
+			return nil
+
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+}
+
+func (vm *VM) callFunction(numArgs int, named *Hash) error {
+	switch vm.stack[vm.sp-1-numArgs].Kind {
+	case VariantValue:
+		return vm.callVariant(numArgs, named)
+	case BuiltinValue:
+		return vm.callBuiltin(numArgs, named)
+	}
+	cl, numArgs, err := vm.callee(numArgs, named)
+	if err != nil {
+		return err
+	}
+	if cl.Fn.Generator {
+		return vm.callGenerator(cl, numArgs)
+	}
+
+	if len(vm.frames) >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	basePointer := vm.sp - numArgs
+	if err := vm.initLocals(basePointer, cl); err != nil {
+		return err
+	}
+
+	vm.frames = append(vm.frames, NewFrame(cl, basePointer))
+	return nil
+}
+
+// inPlace reports whether calling the value below the numArgs arguments on
+// top of the stack makes its result without a frame: a variant makes a
+// value of it, a builtin runs in Go, and a function that yields makes a
+// generator.
+func (vm *VM) inPlace(numArgs int) bool {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee.Kind {
+	case VariantValue, BuiltinValue:
+		return true
+	case ClosureValue:
+		return callee.Ref.(*Closure).Fn.Generator
+	}
+	return false
+}
+
+// tailCallFunction reuses frame for the call: the callee and its arguments
+// slide down over the current callee slot and the frame restarts.
+func (vm *VM) tailCallFunction(frame *Frame, numArgs int) error {
+	cl, numArgs, err := vm.callee(numArgs, nil)
+	if err != nil {
+		return err
+	}
+
+	calleeSlot := frame.basePointer - 1
+	copy(vm.stack[calleeSlot:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	if err := vm.initLocals(frame.basePointer, cl); err != nil {
+		return err
+	}
+
+	frame.cl = cl
+	frame.ip = -1
+	return nil
+}
+
+// callee checks the function below the numArgs arguments on top of the
+// stack and, unless they already match its parameters one for one, binds
+// them and any named arguments to its parameters. It returns the function
+// and its new number of arguments.
+func (vm *VM) callee(numArgs int, named *Hash) (*Closure, int, error) {
+	callee := vm.stack[vm.sp-1-numArgs]
+	if callee.Kind != ClosureValue {
+		return nil, 0, fmt.Errorf("calling non-function %v", callee)
+	}
+
+	cl := callee.Ref.(*Closure)
+	if numArgs != cl.Fn.NumParameters || named != nil || cl.Fn.Variadic {
+		var err error
+		if numArgs, err = vm.bindArguments(cl.Fn, numArgs, named); err != nil {
+			return nil, 0, err
+		}
+	}
+	return cl, numArgs, nil
+}
+
+// initLocals clears the local slots of cl above its arguments, binds the
+// receiver of a method, and leaves sp just past them.
+func (vm *VM) initLocals(basePointer int, cl *Closure) error {
+	if err := vm.reserve(basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = Null
+	}
+	if cl.Receiver != nil {
+		vm.stack[basePointer+cl.Fn.NumParameters] = *cl.Receiver
+	}
+	vm.sp = basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	fn, ok := vm.rawConsts[constIndex].(*code.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %v", vm.rawConsts[constIndex])
+	}
+
+	free := make([]Value, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(Value{Kind: ClosureValue, Ref: &Closure{Fn: fn, Free: free}})
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if left.Kind != IntegerValue || right.Kind != IntegerValue {
+		return fmt.Errorf("unsupported operand types for %s: %v and %v",
+			binaryOperators[op], left, right)
+	}
+
+	l, r := left.Int, right.Int
+	switch op {
+	case code.OpAdd:
+		return vm.push(Integer(l + r))
+	case code.OpSub:
+		return vm.push(Integer(l - r))
+	case code.OpMul:
+		return vm.push(Integer(l * r))
+	case code.OpDiv:
+		if r == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(Integer(l / r))
+	case code.OpGreaterThan:
+		return vm.push(Boolean(l > r))
+	default:
+		return vm.push(Boolean(l < r))
+	}
+}
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) push(v Value) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.reserve(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = v
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// reserve grows the value stack so that it holds at least n slots.
+func (vm *VM) reserve(n int) error {
+	if n <= len(vm.stack) {
+		return nil
+	}
+	if n > MaxStackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	size := len(vm.stack) * 2
+	for size < n {
+		size *= 2
+	}
+
+	stack := make([]Value, size)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
+}
+
+func fnName(fn *code.CompiledFunction) string {
+	if fn.Name == "" {
+		return "anonymous function"
+	}
+	return fn.Name
+}